@@ -2,16 +2,19 @@ package main
 
 import (
 	"bedrud-backend/config"
+	"bedrud-backend/internal/account"
+	"bedrud-backend/internal/auth"
 	"bedrud-backend/internal/database"
 	"bedrud-backend/internal/models"
 	"bedrud-backend/internal/repository"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -25,6 +28,7 @@ var (
 	email    = flag.String("email", "", "User's email")
 	password = flag.String("password", "", "User's password")
 	name     = flag.String("name", "", "User's name")
+	tenant   = flag.String("tenant", "", "User's tenant ID (multi-tenant deployments only)")
 )
 
 func main() {
@@ -49,15 +53,17 @@ func run() error {
 	}
 	defer database.Close()
 
-	// Initialize repository
+	// Initialize repositories
 	userRepo := repository.NewUserRepository(database.GetDB())
+	roomRepo := repository.NewRoomRepository(database.GetDB())
+	accounts := account.NewService(userRepo, roomRepo, &cfg.LiveKit)
 
 	// Execute command
 	switch {
 	case *createUser:
 		return handleCreateUser(userRepo)
 	case *deleteUser:
-		return handleDeleteUser(userRepo)
+		return handleDeleteUser(userRepo, accounts)
 	case *makeAdmin:
 		return handleMakeAdmin(userRepo)
 	case *removeAdmin:
@@ -74,7 +80,7 @@ func handleCreateUser(userRepo *repository.UserRepository) error {
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	hashedPassword, err := auth.HashPassword(*password)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -82,15 +88,18 @@ func handleCreateUser(userRepo *repository.UserRepository) error {
 	user := &models.User{
 		ID:        uuid.New().String(),
 		Email:     *email,
-		Password:  string(hashedPassword),
+		Password:  hashedPassword,
 		Name:      *name,
 		Provider:  "local",
 		Accesses:  models.StringArray{"user"},
+		TenantID:  *tenant,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	if err := userRepo.CreateUser(user); err != nil {
+	if err := userRepo.CreateUser(user); errors.Is(err, repository.ErrConflict) {
+		return fmt.Errorf("a user with email %s already exists", user.Email)
+	} else if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
@@ -98,7 +107,7 @@ func handleCreateUser(userRepo *repository.UserRepository) error {
 	return nil
 }
 
-func handleDeleteUser(userRepo *repository.UserRepository) error {
+func handleDeleteUser(userRepo *repository.UserRepository, accounts *account.Service) error {
 	if *email == "" {
 		return fmt.Errorf("email is required")
 	}
@@ -111,7 +120,7 @@ func handleDeleteUser(userRepo *repository.UserRepository) error {
 		return fmt.Errorf("user not found")
 	}
 
-	if err := userRepo.DeleteUser(user.ID); err != nil {
+	if err := accounts.DeleteUserFully(context.Background(), user.ID); err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
@@ -191,7 +200,7 @@ func handleRemoveAdmin(userRepo *repository.UserRepository) error {
 
 func printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("  Create user:    cli -create -email=user@example.com -password=secret -name=\"John Doe\"")
+	fmt.Println("  Create user:    cli -create -email=user@example.com -password=secret -name=\"John Doe\" [-tenant=acme]")
 	fmt.Println("  Delete user:    cli -delete -email=user@example.com")
 	fmt.Println("  Make admin:     cli -make-admin -email=user@example.com")
 	fmt.Println("  Remove admin:   cli -remove-admin -email=user@example.com")
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bedrud-backend/config"
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -9,15 +10,22 @@ import (
 
 	_ "bedrud-backend/docs"
 	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
 	"bedrud-backend/internal/database"
 	"bedrud-backend/internal/handlers"
+	"bedrud-backend/internal/jobs"
 	"bedrud-backend/internal/middleware"
+	"bedrud-backend/internal/notify"
+	"bedrud-backend/internal/realtime"
 	"bedrud-backend/internal/repository"
 	"bedrud-backend/internal/scheduler"
+	"bedrud-backend/internal/webhook"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -43,7 +51,8 @@ import (
 // @name Authorization
 // @description Enter the token with the `Bearer ` prefix, e.g. "Bearer abcde12345"
 
-func init() {
+// setup loads the configuration and configures logging before the server starts
+func setup() {
 	// Load configuration
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
@@ -75,13 +84,64 @@ func init() {
 		Out:        output,
 		TimeFormat: time.RFC3339,
 	})
+
+	setProbeLogger(log.Logger, cfg.Logger.SampleHealthChecks)
+
+	log.Info().Interface("config", cfg.Redacted()).Msg("Loaded configuration")
+	for _, warning := range cfg.Warnings() {
+		log.Warn().Msg(warning)
+	}
+}
+
+// probeLog and probeLevel are used to log health and readiness probes
+var (
+	probeLog   zerolog.Logger
+	probeLevel = zerolog.DebugLevel
+)
+
+// disableRoomRoutes answers 503 on every route that needs LiveKit, ahead of
+// the handlers registered for them
+func disableRoomRoutes(app *fiber.App) {
+	roomsUnavailable := middleware.Unavailable("rooms unavailable")
+	app.Use("/create-room", roomsUnavailable)
+	app.Use("/join-room", roomsUnavailable)
+	app.Use("/rooms", roomsUnavailable)
+	app.Use("/admin/rooms", roomsUnavailable)
+	app.Use("/admin/livekit", roomsUnavailable)
+}
+
+// setProbeLogger routes probe logs through base. Probes arrive every few
+// seconds, so they stay at debug unless sampleEvery > 0, in which case
+// 1 in sampleEvery of them is logged at info.
+func setProbeLogger(base zerolog.Logger, sampleEvery int) {
+	probeLog = base
+	probeLevel = zerolog.DebugLevel
+	if sampleEvery > 0 {
+		probeLog = base.Sample(&zerolog.BasicSampler{N: uint32(sampleEvery)})
+		probeLevel = zerolog.InfoLevel
+	}
 }
 
 func main() {
+	setup()
 	cfg := config.Get()
 
+	// Without LiveKit only the room endpoints are affected, so it may be optional
+	liveKitEnabled := cfg.LiveKit.Configured()
+	if !liveKitEnabled {
+		if cfg.LiveKit.Required {
+			log.Fatal().Msg("LiveKit is not configured: set livekit.host, livekit.apiKey and livekit.apiSecret, or set livekit.required to false to run without rooms")
+		}
+		log.Warn().Msg("LiveKit is not configured; room endpoints will answer 503")
+	}
+
 	// Initialize session store first
-	auth.InitializeSessionStore(cfg.Auth.SessionSecret)
+	if err := auth.InitializeSessionStore(cfg.Auth.SessionSecret, cfg.Auth.SessionCookie); err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize session store")
+	}
+	if !cfg.Auth.SessionCookie.Secure {
+		log.Warn().Msg("OAuth session cookie is not Secure; set auth.sessionCookie.secure to true when serving over HTTPS")
+	}
 
 	// Initialize database connection
 	if err := database.Initialize(&cfg.Database); err != nil {
@@ -90,13 +150,44 @@ func main() {
 	defer database.Close()
 
 	// Run database migrations after database initialization
-	if err := database.RunMigrations(); err != nil {
+	if err := database.RunMigrations(cfg.Rooms.DefaultMaxParticipants); err != nil {
 		log.Fatal().Err(err).Msg("Failed to run database migrations")
 	}
 
 	// Initialize scheduler
 	scheduler.Initialize()
-	defer scheduler.Stop()
+
+	// Scheduled work that may fail transiently runs on the job queue so it is retried
+	jobQueue := jobs.NewQueue(4, 100)
+
+	// Keep idle database connections healthy
+	if cfg.Database.PingInterval > 0 {
+		err := scheduler.Every(time.Duration(cfg.Database.PingInterval)*time.Second, func() {
+			_ = database.Ping()
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to schedule database health ping")
+		}
+	}
+
+	// Purge rooms that have been inactive longer than the retention window
+	if days := cfg.Rooms.RetentionDays; days > 0 {
+		roomRepo := repository.NewRoomRepository(database.GetDB())
+		err := scheduler.Every(time.Hour, func() {
+			cutoff := time.Now().AddDate(0, 0, -days)
+			purged, err := roomRepo.PurgeInactiveRooms(cutoff, 100)
+			if err != nil {
+				log.Error().Err(err).Int("purged", purged).Msg("Failed to purge inactive rooms")
+				return
+			}
+			if purged > 0 {
+				log.Info().Int("purged", purged).Int("retentionDays", days).Msg("Purged inactive rooms")
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to schedule room retention purge")
+		}
+	}
 
 	// Initialize Goth providers (after session store is initialized)
 	auth.Init(cfg)
@@ -108,7 +199,9 @@ func main() {
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 		// Enable custom error handling
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			requestID, _ := ctxutil.RequestID(c)
 			log.Error().Err(err).
+				Str("requestId", requestID).
 				Str("path", c.Path()).
 				Str("ip", c.IP()).
 				Msg("Error handling request")
@@ -126,7 +219,12 @@ func main() {
 	})
 
 	// Middleware
+	app.Use(requestid.New(requestid.Config{
+		ContextKey: ctxutil.RequestIDKey,
+	}))
 	app.Use(recover.New())
+	// CORS goes first so preflights and 503s from maintenance mode still carry
+	// the headers the frontend needs to read them
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:8090,http://127.0.0.1:8090,http://localhost:5173,http://127.0.0.1:5173",
 		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
@@ -135,6 +233,13 @@ func main() {
 		ExposeHeaders:    "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type",
 		MaxAge:           300,
 	}))
+	middleware.SetMaintenance(cfg.Server.MaintenanceMode)
+	retryAfter := cfg.Server.MaintenanceRetryAfter
+	if retryAfter <= 0 {
+		retryAfter = 300
+	}
+	app.Use(middleware.Maintenance(retryAfter))
+	app.Use(middleware.Timeout(time.Duration(cfg.Server.RequestTimeout) * time.Second))
 
 	// Swagger configuration
 	app.Get("/swagger/*", swagger.New(swagger.Config{
@@ -164,51 +269,283 @@ func main() {
 
 	// Auth routes with handlers
 	userRepo := repository.NewUserRepository(database.GetDB())
-	authService := auth.NewAuthService(userRepo)
+	notifier := notify.New(&cfg.SMTP)
+	authService := auth.NewAuthService(userRepo, notifier)
 	authHandler := handlers.NewAuthHandler(authService, cfg)
 
+	// Give a fresh deployment its first superadmin
+	created, err := authService.BootstrapAdmin(cfg.Auth.Bootstrap)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to bootstrap admin user")
+	} else if created {
+		log.Warn().Str("email", cfg.Auth.Bootstrap.Email).Msg("Created bootstrap superadmin; change its password and remove auth.bootstrap from the config")
+	}
+
+	// Drop blocked and retired refresh tokens once they would have expired anyway
+	err = scheduler.Every(time.Hour, func() {
+		err := jobQueue.Enqueue(jobs.Job{
+			Name: "cleanup-blocked-tokens",
+			Run: func(ctx context.Context) error {
+				return userRepo.CleanupBlockedTokens()
+			},
+			Retry: jobs.DefaultRetry,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to queue blocked token cleanup")
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to schedule blocked token cleanup")
+	}
+
+	// Drop login attempts past the retention window
+	if days := cfg.Auth.LoginAttemptRetentionDays; days > 0 {
+		err = scheduler.Every(time.Hour, func() {
+			err := jobQueue.Enqueue(jobs.Job{
+				Name: "cleanup-login-attempts",
+				Run: func(ctx context.Context) error {
+					_, err := userRepo.CleanupLoginAttempts(time.Now().AddDate(0, 0, -days))
+					return err
+				},
+				Retry: jobs.DefaultRetry,
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to queue login attempt cleanup")
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to schedule login attempt cleanup")
+		}
+	}
+
+	// Drop server-side OAuth sessions once their cookie would have expired
+	err = scheduler.Every(time.Hour, func() {
+		if _, err := auth.CleanupSessionFiles(); err != nil {
+			log.Error().Err(err).Msg("Failed to clean up session files")
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to schedule session file cleanup")
+	}
+
+	// Rate-limit counters stay in memory unless configured to survive restarts
+	var rateLimitStorage fiber.Storage
+	if cfg.Server.RateLimitStorage == "database" {
+		store := repository.NewRateLimitStore(database.GetDB())
+		rateLimitStorage = store
+		err := scheduler.Every(10*time.Minute, func() {
+			if err := store.DeleteExpired(); err != nil {
+				log.Error().Err(err).Msg("Failed to clean up rate-limit counters")
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to schedule rate-limit cleanup")
+		}
+	}
+
+	// Validate JSON bodies up front for the auth and room endpoints
+	jsonBody := middleware.JSONBody(1<<20, 32)
+	app.Use("/auth", jsonBody)
+	app.Use("/auth", middleware.Timeout(time.Duration(cfg.Server.RouteTimeouts.Auth)*time.Second))
+	app.Use("/create-room", jsonBody)
+	app.Use("/join-room", jsonBody)
+	app.Use("/rooms", jsonBody)
+
 	// Register auth routes
 	app.Post("/auth/register", authHandler.Register)
 	app.Post("/auth/login", authHandler.Login)
 	app.Post("/auth/refresh", authHandler.RefreshToken)
-	app.Post("/auth/logout", middleware.Protected(), authHandler.Logout)
+	app.Post("/auth/logout", middleware.Protected(), middleware.BlockImpersonation(), authHandler.Logout)
 	app.Get("/auth/me", middleware.Protected(), authHandler.GetMe)
+	app.Get("/auth/sessions", middleware.Protected(), middleware.BlockImpersonation(), authHandler.ListSessions)
+	app.Patch("/auth/sessions/:id", middleware.Protected(), middleware.BlockImpersonation(), authHandler.LabelSession)
+	app.Get("/auth/api-keys", middleware.Protected(), middleware.BlockImpersonation(), middleware.BlockAPIKeys(), authHandler.ListAPIKeys)
+	app.Post("/auth/api-keys", middleware.Protected(), middleware.BlockImpersonation(), middleware.BlockAPIKeys(), authHandler.CreateAPIKey)
+	app.Delete("/auth/api-keys/:id", middleware.Protected(), middleware.BlockImpersonation(), middleware.BlockAPIKeys(), authHandler.RevokeAPIKey)
 
 	// Social auth routes (existing)
+	app.Get("/auth/providers", authHandler.ListProviders)
 	app.Get("/auth/:provider/login", handlers.BeginAuthHandler)
-	app.Get("/auth/:provider/callback", handlers.CallbackHandler)
+	app.Get("/auth/:provider/callback", authHandler.CallbackHandler)
+	app.Post("/auth/exchange", authHandler.ExchangeCode)
 
 	// Initialize repositories
 	roomRepo := repository.NewRoomRepository(database.GetDB())
+	auditRepo := repository.NewAuditRepository(database.GetDB())
+
+	// Realtime hub for admin dashboards
+	hub := realtime.NewHub()
 
 	// Initialize handlers
 	roomHandler := handlers.NewRoomHandler(
-		cfg.LiveKit.Host,
-		cfg.LiveKit.APIKey,
-		cfg.LiveKit.APISecret,
+		&cfg.LiveKit,
 		roomRepo,
+		&cfg.Rooms,
+		hub,
+		auditRepo,
 	)
 
+	// Close rooms that outlived their expiry
+	if liveKitEnabled {
+		err := scheduler.Every(5*time.Minute, func() {
+			ended, err := roomHandler.SweepExpiredRooms(context.Background(), cfg.Rooms.CleanupBatchSize)
+			if err != nil {
+				log.Error().Err(err).Int("ended", ended).Msg("Failed to clean up expired rooms")
+				return
+			}
+			if ended > 0 {
+				log.Info().Int("ended", ended).Msg("Closed expired rooms")
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to schedule expired room cleanup")
+		}
+
+		// Re-apply admin mutes that LiveKit lost track of, e.g. while webhooks were missed
+		err = scheduler.Every(time.Minute, func() {
+			muted, err := roomHandler.SweepMutes(context.Background())
+			if err != nil {
+				log.Error().Err(err).Int("muted", muted).Msg("Failed to enforce participant mutes")
+				return
+			}
+			if muted > 0 {
+				log.Info().Int("muted", muted).Msg("Re-muted tracks of muted participants")
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to schedule mute enforcement")
+		}
+
+		// Lift timed chat mutes once they run out
+		err = scheduler.Every(time.Minute, func() {
+			lifted, err := roomHandler.SweepChatMutes(context.Background())
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to lift expired chat mutes")
+				return
+			}
+			if lifted > 0 {
+				log.Info().Int("lifted", lifted).Msg("Lifted expired chat mutes")
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to schedule chat mute expiry")
+		}
+
+		// Remove participants who stopped doing anything without disconnecting
+		if minutes := cfg.Rooms.IdleKickMinutes; minutes > 0 {
+			err = scheduler.Every(time.Minute, func() {
+				removed, err := roomHandler.SweepIdleParticipants(context.Background(), time.Duration(minutes)*time.Minute)
+				if err != nil {
+					log.Error().Err(err).Int("removed", removed).Msg("Failed to remove idle participants")
+					return
+				}
+				if removed > 0 {
+					log.Info().Int("removed", removed).Msg("Removed idle participants")
+				}
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to schedule idle participant removal")
+			}
+		}
+
+		// LiveKit webhooks, accepted only when signed with a configured key
+		if verifier := webhook.NewVerifier(&cfg.LiveKit); verifier.NumKeys() > 0 {
+			webhookHandler := handlers.NewLiveKitWebhookHandler(verifier, roomHandler)
+			app.Post("/webhooks/livekit", webhookHandler.Receive)
+		}
+	}
+
 	// Room routes
+	if !liveKitEnabled {
+		disableRoomRoutes(app)
+	}
 	app.Post("/create-room", middleware.Protected(), roomHandler.CreateRoom)
 	app.Post("/join-room", middleware.Protected(), roomHandler.JoinRoom)
+	app.Get("/rooms/available", middleware.Protected(), middleware.RateLimit(30, time.Minute, rateLimitStorage), roomHandler.CheckRoomName)
+	app.Post("/rooms/:roomName/refresh-token", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.RefreshJoinToken)
+	app.Get("/rooms/:roomName/membership", middleware.Protected(), roomHandler.GetMembership)
+	app.Post("/rooms/:roomId/end", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.EndRoom)
+	app.Post("/rooms/:roomId/deactivate", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.DeactivateRoom)
+	app.Post("/rooms/:roomId/reactivate", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.ReactivateRoom)
+	app.Post("/rooms/:roomId/ensure", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.EnsureRoom)
+	app.Get("/rooms/:roomId/me", middleware.Protected(), roomHandler.GetMyParticipant)
+	app.Patch("/rooms/:roomId/me/state", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.UpdateMyState)
+	app.Get("/rooms/:roomId/participants", middleware.Protected(), roomHandler.ListParticipants)
+	app.Get("/rooms/:roomId/settings", middleware.Protected(), roomHandler.GetRoomSettings)
+	app.Patch("/rooms/:roomId/metadata", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.UpdateRoomMetadata)
+	app.Put("/rooms/:roomId/participants/:userId/permissions", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.UpdatePermissions)
+	app.Post("/rooms/:roomId/participants/:userId/reset-state", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.ResetParticipantState)
+	app.Post("/rooms/:roomId/participants/:userId/promote", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.PromoteParticipant)
+	app.Post("/rooms/:roomId/participants/:userId/demote", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.DemoteParticipant)
+	app.Post("/rooms/:roomId/participants/:userId/chat-mute", middleware.Protected(), middleware.BlockImpersonation(), roomHandler.ChatMuteParticipant)
 
 	// Initialize handlers
-	usersHandler := handlers.NewUsersHandler(userRepo)
+	usersHandler := handlers.NewUsersHandler(userRepo, auditRepo)
+	maintenanceHandler := handlers.NewMaintenanceHandler(auditRepo, repository.NewSettingsRepository(database.GetDB()))
+	// Pick up maintenance mode toggled through any instance
+	if err := maintenanceHandler.Sync(); err != nil {
+		log.Error().Err(err).Msg("Failed to load maintenance mode")
+	}
+	err = scheduler.Every(5*time.Second, func() {
+		if err := maintenanceHandler.Sync(); err != nil {
+			log.Error().Err(err).Msg("Failed to sync maintenance mode")
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to schedule maintenance mode sync")
+	}
+	auditHandler := handlers.NewAuditHandler(auditRepo, userRepo, roomRepo)
+	adminStreamHandler := handlers.NewAdminStreamHandler(
+		hub,
+		roomRepo,
+		userRepo,
+		time.Duration(cfg.Realtime.StatsInterval)*time.Second,
+	)
+
+	// Admin WebSocket stream, registered ahead of the group so the upgrade
+	// check can translate the access_token query parameter before auth
+	app.Get("/admin/stream",
+		middleware.RequireWebSocket(),
+		middleware.Protected(),
+		middleware.RequireGlobal(),
+		middleware.RequireAccess("superadmin"),
+		websocket.New(adminStreamHandler.Stream),
+	)
 
 	// Admin routes
 	adminGroup := app.Group("/admin",
 		middleware.Protected(),
+		middleware.BlockImpersonation(),
 		middleware.RequireAccess("superadmin"),
 	)
 
 	// Add these new routes
+	adminGroup.Get("/maintenance", middleware.RequireGlobal(), maintenanceHandler.Get)
+	adminGroup.Put("/maintenance", middleware.RequireGlobal(), maintenanceHandler.Set)
+	adminGroup.Get("/audit", auditHandler.List)
 	adminGroup.Get("/users", usersHandler.ListUsers)
+	adminGroup.Get("/users/by-access/:level", usersHandler.ListUsersByAccess)
 	adminGroup.Put("/users/:id/status", usersHandler.UpdateUserStatus)
+	adminGroup.Patch("/users/:id", usersHandler.UpdateUser)
+	adminGroup.Get("/users/:id/blocked-tokens", usersHandler.ListBlockedTokens)
+	adminGroup.Get("/users/:id/login-attempts", usersHandler.ListLoginAttempts)
+	adminGroup.Put("/users/:id/accesses", usersHandler.UpdateUserAccesses)
+	adminGroup.Post("/users/:id/refresh-tokens/:tokenId/revoke", usersHandler.RevokeRefreshToken)
+	adminGroup.Post("/users/:id/impersonate", usersHandler.Impersonate)
+	adminGroup.Get("/users/:id/rooms", roomHandler.AdminListUserRooms)
 
 	// ...existing admin routes...
 	adminGroup.Get("/rooms", roomHandler.AdminListRooms)
+	adminGroup.Get("/rooms/stats", roomHandler.AdminRoomStats)
+	adminGroup.Post("/rooms/bulk", roomHandler.AdminBulkCreateRooms)
 	adminGroup.Post("/rooms/:roomId/token", roomHandler.AdminGenerateToken)
+	adminGroup.Get("/rooms/:roomId/history", roomHandler.AdminRoomHistory)
+	adminGroup.Get("/rooms/:roomId/timeline", roomHandler.AdminRoomTimeline)
+	adminGroup.Post("/livekit/decode-token", middleware.RequireGlobal(), roomHandler.AdminDecodeToken)
+	adminGroup.Get("/rooms/:roomId/participants.csv",
+		middleware.Timeout(time.Duration(cfg.Server.RouteTimeouts.Export)*time.Second),
+		roomHandler.AdminExportParticipants,
+	)
 
 	// Start server in a goroutine
 	serverAddr := cfg.Server.Host + ":" + cfg.Server.Port
@@ -224,9 +561,26 @@ func main() {
 	<-quit
 
 	log.Info().Msg("Shutting down server...")
+
+	// Close dashboard streams first; hijacked WebSocket connections aren't
+	// waited for by the HTTP server
+	hubCtx, cancelHub := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := hub.Shutdown(hubCtx); err != nil {
+		log.Warn().Err(err).Msg("Realtime clients did not disconnect before shutdown")
+	}
+	cancelHub()
+
 	if err := app.Shutdown(); err != nil {
 		log.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
+
+	// Stop scheduling new work, then let queued jobs finish
+	scheduler.Stop()
+	drainCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := jobQueue.Shutdown(drainCtx); err != nil {
+		log.Warn().Err(err).Msg("Background jobs did not finish before shutdown")
+	}
 }
 
 // @Summary Health check endpoint
@@ -237,14 +591,14 @@ func main() {
 // @Router /health [get]
 // Health check handler
 func healthCheck(c *fiber.Ctx) error {
-	log.Info().
+	probeLog.WithLevel(probeLevel).
 		Str("path", c.Path()).
 		Str("ip", c.IP()).
 		Msg("Health check request received")
 
 	return c.JSON(fiber.Map{
 		"status": "healthy",
-		"time":   time.Now().Unix(),
+		"time":   time.Now().UTC(),
 	})
 }
 
@@ -253,16 +607,25 @@ func healthCheck(c *fiber.Ctx) error {
 // @Tags health
 // @Produce json
 // @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
 // @Router /ready [get]
 // Readiness check handler
 func readinessCheck(c *fiber.Ctx) error {
-	log.Info().
+	probeLog.WithLevel(probeLevel).
 		Str("path", c.Path()).
 		Str("ip", c.IP()).
 		Msg("Readiness check request received")
 
+	if err := database.Ping(); err != nil {
+		log.Error().Err(err).Msg("Readiness check failed")
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "unavailable",
+			"time":   time.Now().UTC(),
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"status": "ready",
-		"time":   time.Now().Unix(),
+		"time":   time.Now().UTC(),
 	})
 }
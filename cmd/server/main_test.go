@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+func TestHealthCheckLogSampling(t *testing.T) {
+	tests := []struct {
+		name        string
+		sampleEvery int
+		wantLines   int
+		wantLevel   string
+	}{
+		{"unsampled probes log at debug", 0, 9, "debug"},
+		{"every probe sampled", 1, 9, "info"},
+		{"one in three probes sampled", 3, 3, "info"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			setProbeLogger(zerolog.New(&buf), tt.sampleEvery)
+			t.Cleanup(func() { setProbeLogger(zerolog.Nop(), 0) })
+
+			app := fiber.New()
+			app.Get("/health", healthCheck)
+			for i := 0; i < 9; i++ {
+				resp, err := app.Test(httptest.NewRequest("GET", "/health", nil))
+				if err != nil {
+					t.Fatalf("GET /health: %v", err)
+				}
+				if resp.StatusCode != fiber.StatusOK {
+					t.Fatalf("GET /health status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+				}
+			}
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if buf.Len() == 0 {
+				lines = nil
+			}
+			if len(lines) != tt.wantLines {
+				t.Fatalf("logged %d probes, want %d:\n%s", len(lines), tt.wantLines, buf.String())
+			}
+			for _, line := range lines {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("log line %q: %v", line, err)
+				}
+				if entry["level"] != tt.wantLevel {
+					t.Errorf("level = %v, want %v", entry["level"], tt.wantLevel)
+				}
+				if entry["path"] != "/health" {
+					t.Errorf("path = %v, want /health", entry["path"])
+				}
+			}
+		})
+	}
+}
+
+func TestRoomRoutesWithoutLiveKit(t *testing.T) {
+	app := fiber.New()
+	disableRoomRoutes(app)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Post("/create-room", ok)
+	app.Post("/join-room", ok)
+	app.Get("/rooms/available", ok)
+	app.Get("/rooms/:roomId/me", ok)
+	app.Get("/admin/rooms", ok)
+	app.Post("/admin/livekit/decode-token", ok)
+	app.Post("/auth/login", ok)
+	app.Get("/health", healthCheck)
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"POST", "/create-room", fiber.StatusServiceUnavailable},
+		{"POST", "/join-room", fiber.StatusServiceUnavailable},
+		{"GET", "/rooms/available", fiber.StatusServiceUnavailable},
+		{"GET", "/rooms/r1/me", fiber.StatusServiceUnavailable},
+		{"GET", "/admin/rooms", fiber.StatusServiceUnavailable},
+		{"POST", "/admin/livekit/decode-token", fiber.StatusServiceUnavailable},
+		{"POST", "/auth/login", fiber.StatusOK},
+		{"GET", "/health", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != fiber.StatusServiceUnavailable {
+			continue
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error != "rooms unavailable" {
+			t.Errorf("%s %s: body error = %q (%v), want rooms unavailable", tt.method, tt.path, body.Error, err)
+		}
+	}
+}
+
+func TestHealthCheckTimeIsRFC3339(t *testing.T) {
+	app := fiber.New()
+	app.Get("/health", healthCheck)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health", nil))
+	if err != nil {
+		t.Fatalf("GET /health: %v", err)
+	}
+
+	var body struct {
+		Time string `json:"time"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	got, err := time.Parse(time.RFC3339, body.Time)
+	if err != nil {
+		t.Fatalf("time = %q, want RFC 3339: %v", body.Time, err)
+	}
+	if _, offset := got.Zone(); offset != 0 {
+		t.Errorf("time = %q, want UTC", body.Time)
+	}
+	if age := time.Since(got); age < 0 || age > time.Minute {
+		t.Errorf("time = %q, want now", body.Time)
+	}
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,121 +18,700 @@ type Config struct {
 	LiveKit  LiveKitConfig  `yaml:"livekit"`
 	Auth     AuthConfig     `yaml:"auth"`
 	Logger   LoggerConfig   `yaml:"logger"`
+	SMTP     SMTPConfig     `yaml:"smtp"`
+	Rooms    RoomsConfig    `yaml:"rooms"`
+	Realtime RealtimeConfig `yaml:"realtime"`
+
+	warnings []string // set by validate for insecure settings that don't stop startup
+}
+
+// Warnings returns problems found while loading that were not severe enough to fail startup
+func (c *Config) Warnings() []string {
+	return c.warnings
 }
 
 type ServerConfig struct {
-	Port         string `yaml:"port"`
-	Host         string `yaml:"host"`
-	ReadTimeout  int    `yaml:"readTimeout"`
-	WriteTimeout int    `yaml:"writeTimeout"`
+	Port           string `yaml:"port"`
+	Host           string `yaml:"host"`
+	ReadTimeout    int    `yaml:"readTimeout"`
+	WriteTimeout   int    `yaml:"writeTimeout"`
+	RequestTimeout int    `yaml:"requestTimeout"` // in seconds
+	// RouteTimeouts override RequestTimeout for some routes
+	RouteTimeouts RouteTimeoutsConfig `yaml:"routeTimeouts"`
+	// RateLimitStorage keeps rate-limit counters in "memory" (default) or the "database" so they survive restarts
+	RateLimitStorage string `yaml:"rateLimitStorage"`
+	// MaintenanceMode starts the server answering 503 to non-admins; it can be flipped at runtime
+	MaintenanceMode       bool `yaml:"maintenanceMode"`
+	MaintenanceRetryAfter int  `yaml:"maintenanceRetryAfter"` // in seconds
+	// Environment is "development" (default) or "production"; production turns
+	// insecure settings from warnings into startup errors
+	Environment string `yaml:"environment"`
+}
+
+// RouteTimeoutsConfig holds per-route overrides of server.requestTimeout, in
+// seconds; 0 keeps the global timeout
+type RouteTimeoutsConfig struct {
+	Auth   int `yaml:"auth"`   // /auth/*, kept short so logins fail fast when a dependency hangs
+	Export int `yaml:"export"` // CSV exports; also lifts writeTimeout while the file streams
+}
+
+// IsProduction reports whether the server runs with production guardrails
+func (s *ServerConfig) IsProduction() bool {
+	return strings.EqualFold(s.Environment, "production")
 }
 
 type DatabaseConfig struct {
-	Host         string `yaml:"host"`
-	Port         string `yaml:"port"`
-	User         string `yaml:"user"`
-	Password     string `yaml:"password"`
-	DBName       string `yaml:"dbname"`
-	SSLMode      string `yaml:"sslmode"`
-	MaxIdleConns int    `yaml:"maxIdleConns"`
-	MaxOpenConns int    `yaml:"maxOpenConns"`
-	MaxLifetime  int    `yaml:"maxLifetime"` // in minutes
+	Host               string          `yaml:"host"`
+	Port               string          `yaml:"port"`
+	User               string          `yaml:"user"`
+	Password           string          `yaml:"password"`
+	DBName             string          `yaml:"dbname"`
+	SSLMode            string          `yaml:"sslmode"`
+	MaxIdleConns       int             `yaml:"maxIdleConns"`
+	MaxOpenConns       int             `yaml:"maxOpenConns"`
+	MaxLifetime        int             `yaml:"maxLifetime"`        // in minutes
+	LogLevel           string          `yaml:"logLevel"`           // silent, error, warn or info
+	SlowQueryThreshold int             `yaml:"slowQueryThreshold"` // in milliseconds
+	Replicas           []ReplicaConfig `yaml:"replicas"`           // read-only; writes always use the primary
+	PrepareStmt        bool            `yaml:"prepareStmt"`        // cache prepared statements per connection
+	PingInterval       int             `yaml:"pingInterval"`       // in seconds, 0 disables health pings
+}
+
+// ReplicaConfig describes a read-only replica. Empty credentials fall back to the primary's.
+type ReplicaConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
 }
 
 type LiveKitConfig struct {
-	Host      string `yaml:"host"`
-	APIKey    string `yaml:"apiKey"`    // Changed from ApiKey to APIKey
-	APISecret string `yaml:"apiSecret"` // Changed from ApiSecret to APISecret
+	Host             string `yaml:"host"`
+	APIKey           string `yaml:"apiKey"`           // Changed from ApiKey to APIKey
+	APISecret        string `yaml:"apiSecret"`        // Changed from ApiSecret to APISecret
+	IdentityStrategy string `yaml:"identityStrategy"` // email (default), userId or userId+device
+	TokenCacheTTL    int    `yaml:"tokenCacheTTL"`    // in seconds, 0 disables join token reuse
+	// Required makes the server refuse to start without LiveKit settings; when false,
+	// the default, the room endpoints answer 503 instead, so auth can run on its own
+	Required bool `yaml:"required"`
+	// Webhook signatures are checked with this key pair, falling back to APIKey/APISecret
+	WebhookAPIKey    string `yaml:"webhookAPIKey"`
+	WebhookAPISecret string `yaml:"webhookAPISecret"`
+	// Extra key -> secret pairs still accepted for webhooks while keys are rotated
+	WebhookRotationKeys map[string]string `yaml:"webhookRotationKeys"`
+	// Regions rooms may be created in, as region -> LiveKit node ID the room is
+	// pinned to. An empty node ID records the region without pinning.
+	Regions map[string]string `yaml:"regions"`
 }
 
+// Configured reports whether host and credentials are all set
+func (c *LiveKitConfig) Configured() bool {
+	return c.Host != "" && c.APIKey != "" && c.APISecret != ""
+}
+
+// RegionNode returns the node ID rooms in the region are pinned to, and false
+// for a region that isn't configured
+func (c *LiveKitConfig) RegionNode(region string) (string, bool) {
+	node, ok := c.Regions[region]
+	return node, ok
+}
+
+// WebhookKeys returns every key -> secret pair a LiveKit webhook may be signed with
+func (c *LiveKitConfig) WebhookKeys() map[string]string {
+	keys := make(map[string]string, len(c.WebhookRotationKeys)+1)
+	for key, secret := range c.WebhookRotationKeys {
+		keys[key] = secret
+	}
+	if c.WebhookAPIKey != "" && c.WebhookAPISecret != "" {
+		keys[c.WebhookAPIKey] = c.WebhookAPISecret
+	} else if c.APIKey != "" && c.APISecret != "" {
+		keys[c.APIKey] = c.APISecret
+	}
+	return keys
+}
+
+// Participant identity strategies for LiveKit tokens
+const (
+	IdentityEmail        = "email"
+	IdentityUserID       = "userId"
+	IdentityUserIDDevice = "userId+device"
+)
+
 type AuthConfig struct {
-	JWTSecret     string       `yaml:"jwtSecret"`
-	TokenDuration int          `yaml:"tokenDuration"` // in hours
-	Google        OAuth2Config `yaml:"google"`
-	Github        OAuth2Config `yaml:"github"`
-	Twitter       OAuth2Config `yaml:"twitter"`
-	FrontendURL   string       `env:"AUTH_FRONTEND_URL"`
-	SessionSecret string       `yaml:"sessionSecret"`
+	JWTSecret           string       `yaml:"jwtSecret"`
+	TokenDuration       int          `yaml:"tokenDuration"` // in hours
+	Google              OAuth2Config `yaml:"google"`
+	Github              OAuth2Config `yaml:"github"`
+	Twitter             OAuth2Config `yaml:"twitter"`
+	FrontendURL         string       `env:"AUTH_FRONTEND_URL"`
+	SessionSecret       string       `yaml:"sessionSecret"`
+	LegacyTokenRedirect bool         `yaml:"legacyTokenRedirect"` // put the token in the OAuth redirect instead of an exchange code
+	Cookie              CookieConfig `yaml:"cookie"`
+	RefreshTokenScheme  string       `yaml:"refreshTokenScheme"` // "jwt" or "opaque"
+	// AllowLocalRegistration enables /auth/register; OAuth sign-up is unaffected
+	AllowLocalRegistration bool `yaml:"allowLocalRegistration"`
+	// AllowedEmailDomains restricts registration and OAuth login to these domains when set
+	AllowedEmailDomains []string `yaml:"allowedEmailDomains"`
+	// AllowedAlgorithms lists the JWT signing algorithms accepted on incoming tokens
+	AllowedAlgorithms []string `yaml:"allowedAlgorithms"`
+	// PasswordHash picks the algorithm for new password hashes: "bcrypt" or "argon2id"
+	PasswordHash string `yaml:"passwordHash"`
+	// SessionCookie configures the cookie holding OAuth login state between redirects
+	SessionCookie SessionCookieConfig `yaml:"sessionCookie"`
+	// AllowedRedirectURLs are extra frontends an OAuth login may return to via ?redirect=
+	AllowedRedirectURLs []string `yaml:"allowedRedirectURLs"`
+	// OAuthAccess picks the access level given to accounts created by an OAuth login
+	OAuthAccess OAuthAccessConfig `yaml:"oauthAccess"`
+	// MinSecretLength is the shortest jwtSecret, in bytes, that passes the startup check
+	MinSecretLength int `yaml:"minSecretLength"`
+	// WeakSecret is "reject" or "warn" for a short or placeholder jwtSecret.
+	// Unset means reject in production and warn otherwise.
+	WeakSecret string `yaml:"weakSecret"`
+	// RefreshReuseGrace is how many seconds a just-rotated opaque refresh token
+	// keeps working, so parallel refreshes don't count as reuse; 0 disables it
+	RefreshReuseGrace int `yaml:"refreshReuseGrace"`
+	// Bootstrap creates the first superadmin on startup while none exists
+	Bootstrap BootstrapConfig `yaml:"bootstrap"`
+	// MaxNameLength and MaxEmailLength bound user names and emails, in
+	// characters; neither may exceed the MaxFieldLength the columns hold
+	MaxNameLength  int `yaml:"maxNameLength"`
+	MaxEmailLength int `yaml:"maxEmailLength"`
+	// LoginAttemptRetentionDays is how long recorded login attempts are kept; 0 keeps them forever
+	LoginAttemptRetentionDays int `yaml:"loginAttemptRetentionDays"`
+	// MaxSessions caps a user's concurrent sessions unless the user has a limit
+	// of their own; 0 means no limit.
+	// SessionLimit picks what a login past the cap does: "reject" or "evict".
+	MaxSessions  int    `yaml:"maxSessions"`
+	SessionLimit string `yaml:"sessionLimit"`
+}
+
+// Session limit policies for auth.sessionLimit
+const (
+	SessionLimitReject = "reject"
+	SessionLimitEvict  = "evict"
+)
+
+// MaxTokenCacheTTL caps livekit.tokenCacheTTL, in seconds, at half the hour a
+// join token is valid for, so a reused token always has time left to connect
+const MaxTokenCacheTTL = 30 * 60
+
+// MaxFieldLength is the size of the users.name and users.email columns
+const MaxFieldLength = 255
+
+// BootstrapConfig is the superadmin account created on first run. Leaving the
+// email empty turns bootstrapping off.
+type BootstrapConfig struct {
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+}
+
+// MaxRefreshReuseGrace caps auth.refreshReuseGrace; a longer window would make a
+// stolen, already-rotated refresh token useful again
+const MaxRefreshReuseGrace = 60
+
+// Weak JWT secret policies for auth.weakSecret
+const (
+	WeakSecretReject = "reject"
+	WeakSecretWarn   = "warn"
+)
+
+// placeholderSecrets are values from examples and tutorials that must never sign real tokens
+var placeholderSecrets = []string{
+	"your-secret-key",
+	"your-jwt-secret",
+	"your-session-secret-key",
+	"secret",
+	"changeme",
+	"change-me",
+	"jwt-secret",
+	"jwtsecret",
+}
+
+// OAuthAccessConfig is the access policy for new OAuth users. Existing users keep their accesses.
+type OAuthAccessConfig struct {
+	Default string            `yaml:"default"` // guest, user, moderator or admin
+	Domains map[string]string `yaml:"domains"` // email domain -> level, overriding Default
+}
+
+// RedirectAllowlist returns every frontend an OAuth login may redirect to,
+// starting with FrontendURL
+func (c *AuthConfig) RedirectAllowlist() []string {
+	allowed := make([]string, 0, len(c.AllowedRedirectURLs)+1)
+	if c.FrontendURL != "" {
+		allowed = append(allowed, c.FrontendURL)
+	}
+	return append(allowed, c.AllowedRedirectURLs...)
+}
+
+// CookieConfig controls the JWT cookie set after an OAuth login
+type CookieConfig struct {
+	Name     string `yaml:"name"`
+	Domain   string `yaml:"domain"`
+	Path     string `yaml:"path"`
+	SameSite string `yaml:"sameSite"` // Strict, Lax or None
+	Secure   *bool  `yaml:"secure"`   // unset means secure when served over HTTPS
+	MaxAge   int    `yaml:"maxAge"`   // in seconds, 0 means the token duration
+}
+
+// SessionCookieConfig controls the OAuth session cookie
+type SessionCookieConfig struct {
+	Domain   string `yaml:"domain"`
+	SameSite string `yaml:"sameSite"` // Strict, Lax or None
+	Secure   bool   `yaml:"secure"`   // must be true in production
+	MaxAge   int    `yaml:"maxAge"`   // in seconds
+
+	// FallbackDir holds sessions too large for a cookie; empty uses a
+	// directory under the system temp dir
+	FallbackDir string `yaml:"fallbackDir"`
 }
 
 type OAuth2Config struct {
 	ClientID     string `yaml:"clientId"`
 	ClientSecret string `yaml:"clientSecret"`
 	RedirectURL  string `yaml:"redirectUrl"`
+	DisplayName  string `yaml:"displayName"` // label for login buttons; defaults to the provider's name
+	// TrustEmail treats every email from the provider as verified, for providers
+	// that only hand out verified addresses without saying so
+	TrustEmail bool `yaml:"trustEmail"`
+}
+
+// OAuthProvider returns the settings of a provider by its goth name
+func (c *AuthConfig) OAuthProvider(name string) (OAuth2Config, bool) {
+	switch name {
+	case "google":
+		return c.Google, true
+	case "github":
+		return c.Github, true
+	case "twitter":
+		return c.Twitter, true
+	}
+	return OAuth2Config{}, false
+}
+
+// Enabled reports whether the provider has the credentials it needs
+func (o OAuth2Config) Enabled() bool {
+	return o.ClientID != "" && o.ClientSecret != ""
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+type RoomsConfig struct {
+	// DefaultSettings apply to any setting a client leaves out when creating a room
+	DefaultSettings RoomSettingsConfig `yaml:"defaultSettings"`
+	// LowercaseNames folds room names to lower case when creating and joining rooms
+	LowercaseNames bool `yaml:"lowercaseNames"`
+	// RetentionDays deletes rooms that have been inactive for this many days; 0 keeps them forever
+	RetentionDays int `yaml:"retentionDays"`
+	// CleanupBatchSize is how many expired rooms the cleanup job ends per batch
+	CleanupBatchSize int `yaml:"cleanupBatchSize"`
+	// JoinerPermissions are given to participants joining a room they didn't create,
+	// unless the room was created with its own
+	JoinerPermissions JoinerPermissionsConfig `yaml:"joinerPermissions"`
+	// UniqueDisplayNames handles two active participants of a room with the same
+	// name: off (allow it), reject (refuse the join) or suffix (rename to "Alex (2)")
+	UniqueDisplayNames string `yaml:"uniqueDisplayNames"`
+	// IdleKickMinutes removes participants of rooms with kickIdle set after this
+	// many minutes without activity; 0 turns the sweep off
+	IdleKickMinutes int `yaml:"idleKickMinutes"`
+	// DefaultMaxParticipants is the capacity of rooms created without maxParticipants
+	DefaultMaxParticipants int `yaml:"defaultMaxParticipants"`
+}
+
+// Display name policies for rooms.uniqueDisplayNames
+const (
+	DisplayNamesOff    = "off"
+	DisplayNamesReject = "reject"
+	DisplayNamesSuffix = "suffix"
+)
+
+type JoinerPermissionsConfig struct {
+	CanKick         bool `yaml:"canKick"`
+	CanMuteAudio    bool `yaml:"canMuteAudio"`
+	CanDisableVideo bool `yaml:"canDisableVideo"`
+	CanChat         bool `yaml:"canChat"`
+}
+
+type RoomSettingsConfig struct {
+	AllowChat       bool `yaml:"allowChat"`
+	AllowVideo      bool `yaml:"allowVideo"`
+	AllowAudio      bool `yaml:"allowAudio"`
+	RequireApproval bool `yaml:"requireApproval"`
+	KickIdle        bool `yaml:"kickIdle"`
+}
+
+type RealtimeConfig struct {
+	StatsInterval int `yaml:"statsInterval"` // seconds between admin stream snapshots
 }
 
 type LoggerConfig struct {
-	Level      string `yaml:"level"`
-	OutputPath string `yaml:"outputPath"`
+	Level              string `yaml:"level"`
+	OutputPath         string `yaml:"outputPath"`
+	SampleHealthChecks int    `yaml:"sampleHealthChecks"` // log 1 in N health/readiness probes at info; 0 logs them at debug
 }
 
+// current holds the active configuration. Reload swaps in a new Config rather
+// than changing the old one, so a *Config from Get stays consistent for as long
+// as it is held, and Get is safe to call while a reload runs.
 var (
-	config *Config
-	once   sync.Once
+	current atomic.Pointer[Config]
+	loadErr error
+	once    sync.Once
 )
 
-// Load reads the configuration file and returns a Config struct
+// Load reads the configuration file and makes it the active configuration.
+// Only the first call reads the file; later calls return the same result.
+// A configuration that fails validation is still returned, with the error.
 func Load(configPath string) (*Config, error) {
 	once.Do(func() {
-		config = &Config{}
-
-		// Read the config file
-		data, err := os.ReadFile(configPath)
-		if err != nil {
-			panic(err)
+		var cfg *Config
+		cfg, loadErr = read(configPath)
+		if cfg != nil {
+			current.Store(cfg)
 		}
+	})
 
-		// Unmarshal the YAML into the config struct
-		err = yaml.Unmarshal(data, config)
-		if err != nil {
-			panic(err)
-		}
+	return current.Load(), loadErr
+}
 
-		// Override with environment variables if they exist
-		if envPort := os.Getenv("SERVER_PORT"); envPort != "" {
-			config.Server.Port = envPort
-		}
-		if dbHost := os.Getenv("DB_HOST"); dbHost != "" {
-			config.Database.Host = dbHost
-		}
-		if dbPort := os.Getenv("DB_PORT"); dbPort != "" {
-			config.Database.Port = dbPort
+// Reload reads the configuration file again and, if it is valid, makes it the
+// active configuration. On error the active configuration is left as it was.
+// Values copied out of the configuration at startup keep their old value.
+func Reload(configPath string) (*Config, error) {
+	cfg, err := read(configPath)
+	if err != nil {
+		return nil, err
+	}
+	current.Store(cfg)
+	return cfg, nil
+}
+
+// read builds a configuration from the defaults, the file and the environment.
+// The configuration is returned along with a validation error, if any; a file
+// that can't be read or parsed returns no configuration.
+func read(configPath string) (*Config, error) {
+	cfg := &Config{
+		Server: ServerConfig{
+			RouteTimeouts: RouteTimeoutsConfig{
+				Auth:   10,
+				Export: 300,
+			},
+		},
+		Rooms: RoomsConfig{
+			CleanupBatchSize: 100,
+			DefaultSettings: RoomSettingsConfig{
+				AllowChat:  true,
+				AllowVideo: true,
+				AllowAudio: true,
+			},
+			JoinerPermissions: JoinerPermissionsConfig{
+				CanChat: true,
+			},
+			UniqueDisplayNames: DisplayNamesOff,
+			IdleKickMinutes:    30,
+
+			DefaultMaxParticipants: 20,
+		},
+		Auth: AuthConfig{
+			RefreshTokenScheme:     "jwt",
+			RefreshReuseGrace:      10,
+			MinSecretLength:        32,
+			AllowLocalRegistration: true,
+			AllowedAlgorithms:      []string{"HS256"},
+			PasswordHash:           "bcrypt",
+			MaxNameLength:          MaxFieldLength,
+			MaxEmailLength:         MaxFieldLength,
+
+			LoginAttemptRetentionDays: 90,
+			SessionLimit:              SessionLimitEvict,
+			Cookie: CookieConfig{
+				Name:     "jwt",
+				Path:     "/",
+				SameSite: "Lax",
+			},
+			SessionCookie: SessionCookieConfig{
+				SameSite: "Lax",
+				MaxAge:   86400 * 30,
+			},
+			OAuthAccess: OAuthAccessConfig{
+				Default: "user",
+			},
+			// GitHub only hands out verified addresses but doesn't flag them
+			Github: OAuth2Config{
+				TrustEmail: true,
+			},
+		},
+	}
+
+	// Read the config file
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the YAML into the config struct
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", configPath, err)
+	}
+
+	// Override with environment variables if they exist
+	if envPort := os.Getenv("SERVER_PORT"); envPort != "" {
+		cfg.Server.Port = envPort
+	}
+	if dbHost := os.Getenv("DB_HOST"); dbHost != "" {
+		cfg.Database.Host = dbHost
+	}
+	if dbPort := os.Getenv("DB_PORT"); dbPort != "" {
+		cfg.Database.Port = dbPort
+	}
+	if dbUser := os.Getenv("DB_USER"); dbUser != "" {
+		cfg.Database.User = dbUser
+	}
+	if dbPass := os.Getenv("DB_PASSWORD"); dbPass != "" {
+		cfg.Database.Password = dbPass
+	}
+	if dbName := os.Getenv("DB_NAME"); dbName != "" {
+		cfg.Database.DBName = dbName
+	}
+	if livekitHost := os.Getenv("LIVEKIT_HOST"); livekitHost != "" {
+		cfg.LiveKit.Host = livekitHost
+	}
+	if livekitApiKey := os.Getenv("LIVEKIT_API_KEY"); livekitApiKey != "" {
+		cfg.LiveKit.APIKey = livekitApiKey
+	}
+	if livekitApiSecret := os.Getenv("LIVEKIT_API_SECRET"); livekitApiSecret != "" {
+		cfg.LiveKit.APISecret = livekitApiSecret
+	}
+	if webhookApiKey := os.Getenv("LIVEKIT_WEBHOOK_API_KEY"); webhookApiKey != "" {
+		cfg.LiveKit.WebhookAPIKey = webhookApiKey
+	}
+	if webhookApiSecret := os.Getenv("LIVEKIT_WEBHOOK_API_SECRET"); webhookApiSecret != "" {
+		cfg.LiveKit.WebhookAPISecret = webhookApiSecret
+	}
+	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
+		cfg.Auth.JWTSecret = jwtSecret
+	}
+	if frontendURL := os.Getenv("AUTH_FRONTEND_URL"); frontendURL != "" {
+		cfg.Auth.FrontendURL = frontendURL
+	}
+	if smtpPassword := os.Getenv("SMTP_PASSWORD"); smtpPassword != "" {
+		cfg.SMTP.Password = smtpPassword
+	}
+	if bootstrapPassword := os.Getenv("AUTH_BOOTSTRAP_PASSWORD"); bootstrapPassword != "" {
+		cfg.Auth.Bootstrap.Password = bootstrapPassword
+	}
+
+	return cfg, cfg.validate()
+}
+
+// checkJWTSecret rejects or warns about a jwtSecret that is short enough to brute
+// force or one of the well-known placeholders, depending on auth.weakSecret
+func (c *Config) checkJWTSecret() error {
+	policy := strings.ToLower(c.Auth.WeakSecret)
+	switch policy {
+	case WeakSecretReject, WeakSecretWarn:
+	case "":
+		policy = WeakSecretWarn
+		if c.Server.IsProduction() {
+			policy = WeakSecretReject
 		}
-		if dbUser := os.Getenv("DB_USER"); dbUser != "" {
-			config.Database.User = dbUser
+	default:
+		return fmt.Errorf("auth.weakSecret must be reject or warn, got %q", c.Auth.WeakSecret)
+	}
+	if c.Auth.MinSecretLength < 0 {
+		return fmt.Errorf("auth.minSecretLength must not be negative, got %d", c.Auth.MinSecretLength)
+	}
+
+	var problem string
+	secret := c.Auth.JWTSecret
+	for _, placeholder := range placeholderSecrets {
+		if strings.EqualFold(secret, placeholder) {
+			problem = "auth.jwtSecret is a well-known placeholder value"
+			break
 		}
-		if dbPass := os.Getenv("DB_PASSWORD"); dbPass != "" {
-			config.Database.Password = dbPass
+	}
+	if problem == "" && len(secret) < c.Auth.MinSecretLength {
+		problem = fmt.Sprintf("auth.jwtSecret is %d bytes, shorter than auth.minSecretLength (%d)", len(secret), c.Auth.MinSecretLength)
+	}
+	if problem == "" {
+		return nil
+	}
+
+	if policy == WeakSecretReject {
+		return errors.New(problem + "; tokens signed with it can be forged")
+	}
+	c.warnings = append(c.warnings, problem+"; tokens signed with it can be forged")
+	return nil
+}
+
+// validate rejects combinations of settings that can't work
+func (c *Config) validate() error {
+	cookie := c.Auth.Cookie
+	switch strings.ToLower(cookie.SameSite) {
+	case "strict", "lax":
+	case "none":
+		// Browsers drop SameSite=None cookies that aren't Secure
+		if cookie.Secure == nil || !*cookie.Secure {
+			return errors.New("auth.cookie.sameSite None requires auth.cookie.secure to be true")
 		}
-		if dbName := os.Getenv("DB_NAME"); dbName != "" {
-			config.Database.DBName = dbName
+	default:
+		return fmt.Errorf("auth.cookie.sameSite must be Strict, Lax or None, got %q", cookie.SameSite)
+	}
+
+	switch strings.ToLower(c.Server.Environment) {
+	case "", "development", "production":
+	default:
+		return fmt.Errorf("server.environment must be development or production, got %q", c.Server.Environment)
+	}
+
+	session := c.Auth.SessionCookie
+	switch strings.ToLower(session.SameSite) {
+	case "strict", "lax":
+	case "none":
+		if !session.Secure {
+			return errors.New("auth.sessionCookie.sameSite None requires auth.sessionCookie.secure to be true")
 		}
-		if livekitHost := os.Getenv("LIVEKIT_HOST"); livekitHost != "" {
-			config.LiveKit.Host = livekitHost
+	default:
+		return fmt.Errorf("auth.sessionCookie.sameSite must be Strict, Lax or None, got %q", session.SameSite)
+	}
+	if c.Server.IsProduction() && !session.Secure {
+		// The session cookie carries OAuth state; over plain HTTP it can be stolen
+		return errors.New("auth.sessionCookie.secure must be true when server.environment is production")
+	}
+
+	for _, raw := range c.Auth.AllowedRedirectURLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("auth.allowedRedirectURLs entries must be absolute http(s) URLs, got %q", raw)
 		}
-		if livekitApiKey := os.Getenv("LIVEKIT_API_KEY"); livekitApiKey != "" {
-			config.LiveKit.APIKey = livekitApiKey
+	}
+
+	for _, alg := range c.Auth.AllowedAlgorithms {
+		if strings.EqualFold(alg, "none") {
+			return errors.New(`auth.allowedAlgorithms must not contain "none"`)
 		}
-		if livekitApiSecret := os.Getenv("LIVEKIT_API_SECRET"); livekitApiSecret != "" {
-			config.LiveKit.APISecret = livekitApiSecret
+	}
+
+	switch c.Server.RateLimitStorage {
+	case "", "memory", "database":
+	default:
+		return fmt.Errorf("server.rateLimitStorage must be memory or database, got %q", c.Server.RateLimitStorage)
+	}
+
+	if c.Server.RouteTimeouts.Auth < 0 || c.Server.RouteTimeouts.Export < 0 {
+		return errors.New("server.routeTimeouts values must not be negative")
+	}
+
+	if c.LiveKit.TokenCacheTTL < 0 || c.LiveKit.TokenCacheTTL > MaxTokenCacheTTL {
+		return fmt.Errorf("livekit.tokenCacheTTL must be between 0 and %d, got %d", MaxTokenCacheTTL, c.LiveKit.TokenCacheTTL)
+	}
+
+	for region := range c.LiveKit.Regions {
+		if strings.TrimSpace(region) == "" || len(region) > 64 {
+			return fmt.Errorf("livekit.regions names must be 1 to 64 characters, got %q", region)
 		}
-		if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
-			config.Auth.JWTSecret = jwtSecret
+	}
+
+	if err := c.checkJWTSecret(); err != nil {
+		return err
+	}
+
+	switch c.Auth.RefreshTokenScheme {
+	case "jwt", "opaque":
+	default:
+		return fmt.Errorf("auth.refreshTokenScheme must be jwt or opaque, got %q", c.Auth.RefreshTokenScheme)
+	}
+
+	if c.Auth.RefreshReuseGrace < 0 || c.Auth.RefreshReuseGrace > MaxRefreshReuseGrace {
+		return fmt.Errorf("auth.refreshReuseGrace must be between 0 and %d seconds, got %d", MaxRefreshReuseGrace, c.Auth.RefreshReuseGrace)
+	}
+
+	if c.Rooms.CleanupBatchSize < 1 {
+		return fmt.Errorf("rooms.cleanupBatchSize must be at least 1, got %d", c.Rooms.CleanupBatchSize)
+	}
+
+	switch c.Rooms.UniqueDisplayNames {
+	case DisplayNamesOff, DisplayNamesReject, DisplayNamesSuffix:
+	default:
+		return fmt.Errorf("rooms.uniqueDisplayNames must be off, reject or suffix, got %q", c.Rooms.UniqueDisplayNames)
+	}
+
+	if c.Rooms.DefaultMaxParticipants < 1 {
+		return fmt.Errorf("rooms.defaultMaxParticipants must be at least 1, got %d", c.Rooms.DefaultMaxParticipants)
+	}
+	if c.Rooms.IdleKickMinutes < 0 {
+		return fmt.Errorf("rooms.idleKickMinutes must not be negative, got %d", c.Rooms.IdleKickMinutes)
+	}
+
+	if c.Rooms.RetentionDays < 0 {
+		return fmt.Errorf("rooms.retentionDays must not be negative, got %d", c.Rooms.RetentionDays)
+	}
+
+	if c.Auth.Bootstrap.Email != "" && c.Auth.Bootstrap.Password == "" {
+		return errors.New("auth.bootstrap.password is required when auth.bootstrap.email is set")
+	}
+	if c.Auth.Bootstrap.Email == "" && c.Auth.Bootstrap.Password != "" {
+		return errors.New("auth.bootstrap.email is required when auth.bootstrap.password is set")
+	}
+
+	if c.Auth.MaxNameLength < 1 || c.Auth.MaxNameLength > MaxFieldLength {
+		return fmt.Errorf("auth.maxNameLength must be between 1 and %d, got %d", MaxFieldLength, c.Auth.MaxNameLength)
+	}
+	if c.Auth.MaxEmailLength < 1 || c.Auth.MaxEmailLength > MaxFieldLength {
+		return fmt.Errorf("auth.maxEmailLength must be between 1 and %d, got %d", MaxFieldLength, c.Auth.MaxEmailLength)
+	}
+	if c.Auth.LoginAttemptRetentionDays < 0 {
+		return fmt.Errorf("auth.loginAttemptRetentionDays must not be negative, got %d", c.Auth.LoginAttemptRetentionDays)
+	}
+	if c.Auth.MaxSessions < 0 {
+		return fmt.Errorf("auth.maxSessions must not be negative, got %d", c.Auth.MaxSessions)
+	}
+	if c.Auth.SessionLimit != SessionLimitReject && c.Auth.SessionLimit != SessionLimitEvict {
+		return fmt.Errorf("auth.sessionLimit must be reject or evict, got %q", c.Auth.SessionLimit)
+	}
+
+	// superadmin is deliberately not grantable by policy
+	oauthLevels := map[string]bool{"guest": true, "user": true, "moderator": true, "admin": true}
+	if !oauthLevels[c.Auth.OAuthAccess.Default] {
+		return fmt.Errorf("auth.oauthAccess.default must be guest, user, moderator or admin, got %q", c.Auth.OAuthAccess.Default)
+	}
+	for domain, level := range c.Auth.OAuthAccess.Domains {
+		if !oauthLevels[level] {
+			return fmt.Errorf("auth.oauthAccess.domains[%q] must be guest, user, moderator or admin, got %q", domain, level)
 		}
-		if frontendURL := os.Getenv("AUTH_FRONTEND_URL"); frontendURL != "" {
-			config.Auth.FrontendURL = frontendURL
+	}
+
+	if (c.LiveKit.WebhookAPIKey == "") != (c.LiveKit.WebhookAPISecret == "") {
+		return errors.New("livekit.webhookAPIKey and livekit.webhookAPISecret must be set together")
+	}
+	for key, secret := range c.LiveKit.WebhookRotationKeys {
+		if key == "" || secret == "" {
+			return errors.New("livekit.webhookRotationKeys entries need both a key and a secret")
 		}
-	})
+	}
 
-	return config, nil
+	switch c.Auth.PasswordHash {
+	case "bcrypt", "argon2id":
+	default:
+		return fmt.Errorf("auth.passwordHash must be bcrypt or argon2id, got %q", c.Auth.PasswordHash)
+	}
+	return nil
 }
 
 // Get returns the loaded configuration
 func Get() *Config {
-	if config == nil {
+	cfg := current.Load()
+	if cfg == nil {
 		panic("Config not loaded")
 	}
-	return config
+	return cfg
 }
 
 // GetDSN returns the PostgreSQL connection string
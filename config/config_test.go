@@ -0,0 +1,440 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeConfig writes the example configuration, listening on port, to a
+// temporary file and returns its path
+func writeConfig(t *testing.T, port string) string {
+	t.Helper()
+
+	data, err := os.ReadFile("../config.yaml.example")
+	if err != nil {
+		t.Fatalf("read example config: %v", err)
+	}
+	yaml := strings.Replace(string(data), `port: "8090"`, `port: "`+port+`"`, 1)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+// exampleConfig returns the example configuration for a test to adjust and validate
+func exampleConfig(t *testing.T) *Config {
+	t.Helper()
+	t.Setenv("SERVER_PORT", "")
+
+	cfg, err := read("../config.yaml.example")
+	if err != nil {
+		t.Fatalf("read example config: %v", err)
+	}
+	return cfg
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	t.Setenv("SERVER_PORT", "")
+
+	if _, err := read("../config.yaml.example"); err != nil {
+		t.Fatalf("config.yaml.example doesn't validate: %v", err)
+	}
+}
+
+// Run with -race: readers hold on to the *Config from Get while reloads swap
+// in new ones underneath them
+func TestGetDuringReload(t *testing.T) {
+	t.Setenv("SERVER_PORT", "")
+	paths := []string{writeConfig(t, "8091"), writeConfig(t, "8092")}
+	if _, err := Reload(paths[0]); err != nil {
+		t.Fatalf("Reload() = %v", err)
+	}
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				cfg := Get()
+				port := cfg.Server.Port
+				if port != "8091" && port != "8092" {
+					t.Errorf("Get() returned port %q", port)
+					return
+				}
+				if cfg.Server.Port != port {
+					t.Error("a held configuration changed during a reload")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		if _, err := Reload(paths[i%2]); err != nil {
+			t.Errorf("Reload() = %v", err)
+			break
+		}
+	}
+	close(stop)
+	readers.Wait()
+}
+
+func TestReloadKeepsConfigOnError(t *testing.T) {
+	t.Setenv("SERVER_PORT", "")
+	good, err := Reload(writeConfig(t, "8091"))
+	if err != nil {
+		t.Fatalf("Reload() = %v", err)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(invalid, []byte("rooms:\n  cleanupBatchSize: 0\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	for _, path := range []string{invalid, filepath.Join(t.TempDir(), "missing.yaml")} {
+		if _, err := Reload(path); err == nil {
+			t.Errorf("Reload(%s) succeeded, want an error", filepath.Base(path))
+		}
+		if Get() != good {
+			t.Errorf("Reload(%s) replaced the active configuration", filepath.Base(path))
+		}
+	}
+}
+
+func TestCookieSameSite(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		sameSite string
+		secure   *bool
+		wantErr  bool
+	}{
+		{"Lax", nil, false},
+		{"strict", &no, false},
+		{"None", &yes, false},
+		{"None", &no, true},
+		{"None", nil, true},
+		{"Sometimes", nil, true},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.Auth.Cookie.SameSite = tt.sameSite
+		cfg.Auth.Cookie.Secure = tt.secure
+
+		if err := cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("sameSite %s, secure %v: validate() = %v, want error %v", tt.sameSite, tt.secure, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTokenCacheTTLBounds(t *testing.T) {
+	tests := map[int]bool{-1: true, 0: false, 60: false, MaxTokenCacheTTL: false, MaxTokenCacheTTL + 1: true}
+	for ttl, wantErr := range tests {
+		cfg := exampleConfig(t)
+		cfg.LiveKit.TokenCacheTTL = ttl
+
+		if err := cfg.validate(); (err != nil) != wantErr {
+			t.Errorf("tokenCacheTTL %d: validate() = %v, want error %v", ttl, err, wantErr)
+		}
+	}
+}
+
+func TestRefreshReuseGraceBounds(t *testing.T) {
+	tests := map[int]bool{-1: true, 0: false, 10: false, MaxRefreshReuseGrace: false, MaxRefreshReuseGrace + 1: true}
+	for grace, wantErr := range tests {
+		cfg := exampleConfig(t)
+		cfg.Auth.RefreshReuseGrace = grace
+
+		if err := cfg.validate(); (err != nil) != wantErr {
+			t.Errorf("refreshReuseGrace %d: validate() = %v, want error %v", grace, err, wantErr)
+		}
+	}
+}
+
+func TestAllowedAlgorithmsRejectNone(t *testing.T) {
+	tests := []struct {
+		algorithms []string
+		wantErr    bool
+	}{
+		{[]string{"HS256"}, false},
+		{[]string{"HS256", "HS512"}, false},
+		{[]string{"HS256", "none"}, true},
+		{[]string{"NONE"}, true},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.Auth.AllowedAlgorithms = tt.algorithms
+
+		if err := cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("allowedAlgorithms %v: validate() = %v, want error %v", tt.algorithms, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLiveKitConfigured(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  LiveKitConfig
+		want bool
+	}{
+		{"empty", LiveKitConfig{}, false},
+		{"host only", LiveKitConfig{Host: "http://localhost:7880"}, false},
+		{"no secret", LiveKitConfig{Host: "http://localhost:7880", APIKey: "key"}, false},
+		{"complete", LiveKitConfig{Host: "http://localhost:7880", APIKey: "key", APISecret: "secret"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.cfg.Configured(); got != tt.want {
+			t.Errorf("%s: Configured() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionCookieGuardrails(t *testing.T) {
+	tests := []struct {
+		environment string
+		sameSite    string
+		secure      bool
+		wantErr     bool
+	}{
+		{"", "Lax", false, false},
+		{"development", "Lax", false, false},
+		{"development", "None", false, true},
+		{"development", "None", true, false},
+		{"production", "Lax", false, true},
+		{"Production", "Strict", false, true},
+		{"production", "Lax", true, false},
+		{"staging", "Lax", true, true},
+		{"development", "Sometimes", true, true},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.Server.Environment = tt.environment
+		cfg.Auth.JWTSecret = strings.Repeat("k", 64)
+		cfg.Auth.SessionCookie.SameSite = tt.sameSite
+		cfg.Auth.SessionCookie.Secure = tt.secure
+
+		if err := cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("environment %q, sameSite %s, secure %v: validate() = %v, want error %v", tt.environment, tt.sameSite, tt.secure, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebhookKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  LiveKitConfig
+		want map[string]string
+	}{
+		{"none", LiveKitConfig{}, map[string]string{}},
+		{"main key", LiveKitConfig{APIKey: "main", APISecret: "s1"}, map[string]string{"main": "s1"}},
+		{
+			"webhook key replaces the main key",
+			LiveKitConfig{APIKey: "main", APISecret: "s1", WebhookAPIKey: "hook", WebhookAPISecret: "s2"},
+			map[string]string{"hook": "s2"},
+		},
+		{
+			"rotation keys are added",
+			LiveKitConfig{APIKey: "main", APISecret: "s1", WebhookRotationKeys: map[string]string{"old": "s0"}},
+			map[string]string{"main": "s1", "old": "s0"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.cfg.WebhookKeys(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: WebhookKeys() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOAuthAccessLevels(t *testing.T) {
+	tests := []struct {
+		policy  OAuthAccessConfig
+		wantErr bool
+	}{
+		{OAuthAccessConfig{Default: "user"}, false},
+		{OAuthAccessConfig{Default: "guest", Domains: map[string]string{"example.com": "admin"}}, false},
+		{OAuthAccessConfig{Default: "superadmin"}, true},
+		{OAuthAccessConfig{Default: "user", Domains: map[string]string{"example.com": "superadmin"}}, true},
+		{OAuthAccessConfig{Default: ""}, true},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.Auth.OAuthAccess = tt.policy
+
+		if err := cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("policy %+v: validate() = %v, want error %v", tt.policy, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckJWTSecret(t *testing.T) {
+	strong := strings.Repeat("k", 32)
+	tests := []struct {
+		name        string
+		environment string
+		policy      string
+		secret      string
+		wantErr     bool
+		wantWarning bool
+	}{
+		{"strong secret", "production", "", strong, false, false},
+		{"short secret in production", "production", "", "short", true, false},
+		{"placeholder in production", "production", "", "Your-Secret-Key", true, false},
+		{"short secret in development", "development", "", "short", false, true},
+		{"placeholder, warn", "production", WeakSecretWarn, "changeme", false, true},
+		{"short secret, reject", "development", WeakSecretReject, "short", true, false},
+		{"unknown policy", "development", "ignore", strong, true, false},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.Server.Environment = tt.environment
+		cfg.Auth.WeakSecret = tt.policy
+		cfg.Auth.JWTSecret = tt.secret
+		cfg.Auth.MinSecretLength = 32
+		cfg.warnings = nil
+
+		err := cfg.checkJWTSecret()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkJWTSecret() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if warned := len(cfg.Warnings()) > 0; warned != tt.wantWarning {
+			t.Errorf("%s: warnings %q, want a warning %v", tt.name, cfg.Warnings(), tt.wantWarning)
+		}
+	}
+}
+
+func TestRegions(t *testing.T) {
+	tests := []struct {
+		regions map[string]string
+		wantErr bool
+	}{
+		{nil, false},
+		{map[string]string{"eu-west": "node-eu-1", "us-east": ""}, false},
+		{map[string]string{" ": "node-eu-1"}, true},
+		{map[string]string{strings.Repeat("r", 65): ""}, true},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.LiveKit.Regions = tt.regions
+		if err := cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("regions %v: validate() = %v, want error %v", tt.regions, err, tt.wantErr)
+		}
+	}
+
+	lk := &LiveKitConfig{Regions: map[string]string{"eu-west": "node-eu-1"}}
+	if node, ok := lk.RegionNode("eu-west"); node != "node-eu-1" || !ok {
+		t.Errorf("RegionNode(eu-west) = %q, %v, want node-eu-1, true", node, ok)
+	}
+	if _, ok := lk.RegionNode("mars"); ok {
+		t.Error("RegionNode(mars) = true, want false")
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	tests := []struct {
+		timeouts RouteTimeoutsConfig
+		wantErr  bool
+	}{
+		{RouteTimeoutsConfig{}, false},
+		{RouteTimeoutsConfig{Auth: 10, Export: 300}, false},
+		{RouteTimeoutsConfig{Auth: -1}, true},
+		{RouteTimeoutsConfig{Export: -1}, true},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.Server.RouteTimeouts = tt.timeouts
+		if err := cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("routeTimeouts %+v: validate() = %v, want error %v", tt.timeouts, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBootstrapNeedsEmailAndPassword(t *testing.T) {
+	tests := []struct {
+		bootstrap BootstrapConfig
+		wantErr   bool
+	}{
+		{BootstrapConfig{}, false},
+		{BootstrapConfig{Email: "admin@example.com", Password: "correct horse battery"}, false},
+		{BootstrapConfig{Email: "admin@example.com"}, true},
+		{BootstrapConfig{Password: "correct horse battery"}, true},
+	}
+
+	for _, tt := range tests {
+		cfg := exampleConfig(t)
+		cfg.Auth.Bootstrap = tt.bootstrap
+		if err := cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("bootstrap email %q: validate() = %v, want error %v", tt.bootstrap.Email, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOAuthProvider(t *testing.T) {
+	auth := &AuthConfig{
+		Google: OAuth2Config{ClientID: "google-id"},
+		Github: OAuth2Config{ClientID: "github-id", TrustEmail: true},
+	}
+
+	tests := []struct {
+		name      string
+		wantID    string
+		wantTrust bool
+		wantOK    bool
+	}{
+		{"google", "google-id", false, true},
+		{"github", "github-id", true, true},
+		{"twitter", "", false, true},
+		{"gitlab", "", false, false},
+	}
+
+	for _, tt := range tests {
+		provider, ok := auth.OAuthProvider(tt.name)
+		if ok != tt.wantOK || provider.ClientID != tt.wantID || provider.TrustEmail != tt.wantTrust {
+			t.Errorf("OAuthProvider(%q) = %+v, %v, want client %q, trust %v, %v", tt.name, provider, ok, tt.wantID, tt.wantTrust, tt.wantOK)
+		}
+	}
+
+	// GitHub doesn't flag verified addresses, so it's trusted unless configured otherwise
+	cfg := exampleConfig(t)
+	if !cfg.Auth.Github.TrustEmail || cfg.Auth.Google.TrustEmail {
+		t.Errorf("trustEmail: GitHub %v, Google %v, want true and false", cfg.Auth.Github.TrustEmail, cfg.Auth.Google.TrustEmail)
+	}
+}
+
+func TestNameAndEmailLengthBounds(t *testing.T) {
+	tests := map[int]bool{0: true, 1: false, 64: false, MaxFieldLength: false, MaxFieldLength + 1: true}
+	for length, wantErr := range tests {
+		cfg := exampleConfig(t)
+		cfg.Auth.MaxNameLength = length
+		if err := cfg.validate(); (err != nil) != wantErr {
+			t.Errorf("maxNameLength %d: validate() = %v, want error %v", length, err, wantErr)
+		}
+
+		cfg = exampleConfig(t)
+		cfg.Auth.MaxEmailLength = length
+		if err := cfg.validate(); (err != nil) != wantErr {
+			t.Errorf("maxEmailLength %d: validate() = %v, want error %v", length, err, wantErr)
+		}
+	}
+}
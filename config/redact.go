@@ -0,0 +1,54 @@
+package config
+
+import "fmt"
+
+// redactedMask replaces every secret in Redacted; unset secrets stay empty so
+// a missing value can still be told apart from a configured one
+const redactedMask = "[REDACTED]"
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedMask
+}
+
+// Redacted returns a copy of the configuration that is safe to log: passwords,
+// signing secrets, OAuth client secrets and API keys are masked. The receiver
+// is not modified.
+func (c *Config) Redacted() Config {
+	out := *c
+	out.warnings = nil
+
+	out.Database.Password = redact(c.Database.Password)
+	if c.Database.Replicas != nil {
+		out.Database.Replicas = make([]ReplicaConfig, len(c.Database.Replicas))
+		for i, replica := range c.Database.Replicas {
+			replica.Password = redact(replica.Password)
+			out.Database.Replicas[i] = replica
+		}
+	}
+
+	out.LiveKit.APIKey = redact(c.LiveKit.APIKey)
+	out.LiveKit.APISecret = redact(c.LiveKit.APISecret)
+	out.LiveKit.WebhookAPIKey = redact(c.LiveKit.WebhookAPIKey)
+	out.LiveKit.WebhookAPISecret = redact(c.LiveKit.WebhookAPISecret)
+	if c.LiveKit.WebhookRotationKeys != nil {
+		// The keys are API keys too, so only how many there are is kept
+		n := len(c.LiveKit.WebhookRotationKeys)
+		out.LiveKit.WebhookRotationKeys = make(map[string]string, n)
+		for i := 1; i <= n; i++ {
+			out.LiveKit.WebhookRotationKeys[fmt.Sprintf("%s#%d", redactedMask, i)] = redactedMask
+		}
+	}
+
+	out.Auth.JWTSecret = redact(c.Auth.JWTSecret)
+	out.Auth.SessionSecret = redact(c.Auth.SessionSecret)
+	out.Auth.Google.ClientSecret = redact(c.Auth.Google.ClientSecret)
+	out.Auth.Github.ClientSecret = redact(c.Auth.Github.ClientSecret)
+	out.Auth.Twitter.ClientSecret = redact(c.Auth.Twitter.ClientSecret)
+	out.Auth.Bootstrap.Password = redact(c.Auth.Bootstrap.Password)
+
+	out.SMTP.Password = redact(c.SMTP.Password)
+	return out
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactedMasksSecrets(t *testing.T) {
+	cfg := exampleConfig(t)
+	secrets := map[string]*string{
+		"database password":  &cfg.Database.Password,
+		"LiveKit API key":    &cfg.LiveKit.APIKey,
+		"LiveKit API secret": &cfg.LiveKit.APISecret,
+		"webhook API key":    &cfg.LiveKit.WebhookAPIKey,
+		"webhook API secret": &cfg.LiveKit.WebhookAPISecret,
+		"JWT secret":         &cfg.Auth.JWTSecret,
+		"session secret":     &cfg.Auth.SessionSecret,
+		"Google secret":      &cfg.Auth.Google.ClientSecret,
+		"GitHub secret":      &cfg.Auth.Github.ClientSecret,
+		"Twitter secret":     &cfg.Auth.Twitter.ClientSecret,
+		"bootstrap password": &cfg.Auth.Bootstrap.Password,
+		"SMTP password":      &cfg.SMTP.Password,
+	}
+	for name, field := range secrets {
+		*field = "secret-" + strings.ReplaceAll(name, " ", "-")
+	}
+	cfg.Database.Replicas = []ReplicaConfig{{Host: "replica-1.internal", Password: "secret-replica-password"}}
+	cfg.LiveKit.WebhookRotationKeys = map[string]string{"secret-rotation-key": "secret-rotation-secret"}
+	cfg.Database.Host = "db.internal"
+	cfg.LiveKit.Host = "wss://livekit.example.com"
+	cfg.Auth.Bootstrap.Email = "admin@example.com"
+
+	data, err := json.Marshal(cfg.Redacted())
+	if err != nil {
+		t.Fatalf("json.Marshal(Redacted()) = %v", err)
+	}
+	logged := string(data)
+
+	if strings.Contains(logged, "secret-") {
+		t.Errorf("redacted config still holds a secret: %s", logged)
+	}
+	if !strings.Contains(logged, redactedMask) {
+		t.Errorf("redacted config has no %s mask: %s", redactedMask, logged)
+	}
+	for _, value := range []string{"db.internal", "replica-1.internal", "wss://livekit.example.com", "admin@example.com"} {
+		if !strings.Contains(logged, value) {
+			t.Errorf("redacted config lost %q: %s", value, logged)
+		}
+	}
+
+	// The live configuration keeps its secrets
+	if cfg.Auth.JWTSecret != "secret-JWT-secret" || cfg.Database.Replicas[0].Password != "secret-replica-password" {
+		t.Error("Redacted() modified the configuration it was called on")
+	}
+	if _, ok := cfg.LiveKit.WebhookRotationKeys["secret-rotation-key"]; !ok {
+		t.Error("Redacted() modified the webhook rotation keys")
+	}
+}
+
+func TestRedactedKeepsUnsetSecretsEmpty(t *testing.T) {
+	cfg := exampleConfig(t)
+	cfg.SMTP.Password = ""
+	cfg.Auth.Google.ClientSecret = ""
+
+	redacted := cfg.Redacted()
+	if redacted.SMTP.Password != "" || redacted.Auth.Google.ClientSecret != "" {
+		t.Errorf("unset secrets redacted to %q and %q, want them empty", redacted.SMTP.Password, redacted.Auth.Google.ClientSecret)
+	}
+}
@@ -0,0 +1,135 @@
+// Package account holds user account operations that span the database and LiveKit.
+package account
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/twitchtv/twirp"
+)
+
+// ErrUserNotFound is returned when deleting a user that doesn't exist
+var ErrUserNotFound = errors.New("user not found")
+
+// RoomService is the subset of the LiveKit room service API used to disconnect users
+type RoomService interface {
+	ListParticipants(ctx context.Context, req *livekit.ListParticipantsRequest) (*livekit.ListParticipantsResponse, error)
+	RemoveParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.RemoveParticipantResponse, error)
+}
+
+type Service struct {
+	userRepo         *repository.UserRepository
+	roomRepo         *repository.RoomRepository
+	roomService      RoomService // nil when LiveKit isn't configured
+	identityStrategy string
+}
+
+func NewService(userRepo *repository.UserRepository, roomRepo *repository.RoomRepository, livekitConfig *config.LiveKitConfig) *Service {
+	s := &Service{
+		userRepo:         userRepo,
+		roomRepo:         roomRepo,
+		identityStrategy: livekitConfig.IdentityStrategy,
+	}
+	if livekitConfig.Configured() {
+		s.roomService = lksdk.NewRoomServiceClient(livekitConfig.Host, livekitConfig.APIKey, livekitConfig.APISecret)
+	}
+	return s
+}
+
+// IsUserIdentity reports whether a LiveKit identity belongs to the user under
+// the given identity strategy
+func IsUserIdentity(strategy, identity string, user *models.User) bool {
+	switch strategy {
+	case config.IdentityUserID:
+		return identity == user.ID
+	case config.IdentityUserIDDevice:
+		return strings.HasPrefix(identity, user.ID+"#")
+	default:
+		return identity == user.Email
+	}
+}
+
+// DeleteUserFully deletes a user and everything attached to them. The steps run
+// so that stopping at any point leaves a state a retry can finish from:
+//  1. the account is disabled, so no new sessions can start
+//  2. all refresh sessions are revoked
+//  3. the user is disconnected from every live LiveKit room
+//  4. the database rows are deleted
+//
+// A LiveKit failure aborts before anything is deleted.
+func (s *Service) DeleteUserFully(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.userRepo.SetUserActive(user.ID, false); err != nil {
+		return fmt.Errorf("disable user: %w", err)
+	}
+	if err := s.userRepo.RevokeUserSessions(user.ID); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	if err := s.disconnectUser(ctx, user); err != nil {
+		return fmt.Errorf("disconnect from LiveKit: %w", err)
+	}
+	if err := s.userRepo.DeleteUser(user.ID); err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	return nil
+}
+
+// disconnectUser removes every LiveKit connection of the user in rooms that are still active
+func (s *Service) disconnectUser(ctx context.Context, user *models.User) error {
+	if s.roomService == nil {
+		return nil
+	}
+
+	rooms, err := s.roomRepo.GetActiveRoomsForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, room := range rooms {
+		res, err := s.roomService.ListParticipants(ctx, &livekit.ListParticipantsRequest{
+			Room: room.Name,
+		})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, p := range res.GetParticipants() {
+			if !IsUserIdentity(s.identityStrategy, p.GetIdentity(), user) {
+				continue
+			}
+			_, err := s.roomService.RemoveParticipant(ctx, &livekit.RoomParticipantIdentity{
+				Room:     room.Name,
+				Identity: p.GetIdentity(),
+			})
+			if err != nil && !isNotFound(err) {
+				return err
+			}
+			log.Info().Str("room", room.Name).Str("identity", p.GetIdentity()).Msg("Removed deleted user from LiveKit room")
+		}
+	}
+	return nil
+}
+
+// isNotFound reports whether LiveKit answered that the room or participant is already gone
+func isNotFound(err error) bool {
+	var twirpErr twirp.Error
+	return errors.As(err, &twirpErr) && twirpErr.Code() == twirp.NotFound
+}
@@ -0,0 +1,173 @@
+package account
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/twitchtv/twirp"
+)
+
+// deletion plays user u1, a participant of the active rooms standup and retro, and
+// logs the database writes and LiveKit removals in the order they happen
+type deletion struct {
+	mu           sync.Mutex
+	events       []string
+	participants map[string][]*livekit.ParticipantInfo
+	listErr      map[string]error
+}
+
+func (d *deletion) log(event string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events = append(d.events, event)
+}
+
+func (d *deletion) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions("room_participants"):
+		return &dbtest.Result{
+			Columns: []string{"id", "name", "is_active"},
+			Rows:    [][]interface{}{{"r1", "standup", true}, {"r2", "retro", true}},
+		}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "provider", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", "local", "{user}", true}},
+		}, nil
+	case stmt.Is("UPDATE") && stmt.Mentions(`"users"`):
+		if active, ok := stmt.Value("is_active"); ok && active == false {
+			d.log("disable user")
+		}
+	case stmt.Is("DELETE") && stmt.Mentions(`"refresh_sessions"`):
+		d.log("delete refresh_sessions")
+	case stmt.Is("DELETE") && stmt.Mentions(`"room_participants"`):
+		d.log("delete room_participants")
+	case stmt.Is("DELETE") && stmt.Mentions(`"users"`):
+		d.log("delete users")
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func (d *deletion) ListParticipants(_ context.Context, req *livekit.ListParticipantsRequest) (*livekit.ListParticipantsResponse, error) {
+	if err := d.listErr[req.Room]; err != nil {
+		return nil, err
+	}
+	return &livekit.ListParticipantsResponse{Participants: d.participants[req.Room]}, nil
+}
+
+func (d *deletion) RemoveParticipant(_ context.Context, req *livekit.RoomParticipantIdentity) (*livekit.RemoveParticipantResponse, error) {
+	d.log("remove " + req.Room + "/" + req.Identity)
+	return &livekit.RemoveParticipantResponse{}, nil
+}
+
+func newTestService(t *testing.T, d *deletion) *Service {
+	t.Helper()
+
+	db, _ := dbtest.Open(t, d.answer)
+	return &Service{
+		userRepo:         repository.NewUserRepository(db),
+		roomRepo:         repository.NewRoomRepository(db),
+		roomService:      d,
+		identityStrategy: config.IdentityUserIDDevice,
+	}
+}
+
+func TestDeleteUserFully(t *testing.T) {
+	d := &deletion{
+		participants: map[string][]*livekit.ParticipantInfo{
+			"standup": {{Identity: "u1#laptop"}, {Identity: "u2#phone"}, {Identity: "u1#phone"}},
+			"retro":   {{Identity: "u3#laptop"}},
+		},
+	}
+
+	if err := newTestService(t, d).DeleteUserFully(context.Background(), "u1"); err != nil {
+		t.Fatalf("DeleteUserFully() = %v", err)
+	}
+
+	want := []string{
+		"disable user",
+		"delete refresh_sessions",
+		"remove standup/u1#laptop",
+		"remove standup/u1#phone",
+		"delete room_participants",
+		"delete refresh_sessions",
+		"delete users",
+	}
+	if !reflect.DeepEqual(d.events, want) {
+		t.Errorf("events = %q, want %q", d.events, want)
+	}
+}
+
+func TestDeleteUserFullyStopsWhenLiveKitFails(t *testing.T) {
+	d := &deletion{
+		participants: map[string][]*livekit.ParticipantInfo{
+			"standup": {{Identity: "u1#laptop"}},
+		},
+		listErr: map[string]error{"retro": errors.New("connection refused")},
+	}
+
+	if err := newTestService(t, d).DeleteUserFully(context.Background(), "u1"); err == nil {
+		t.Fatal("DeleteUserFully() = nil, want the LiveKit error")
+	}
+
+	want := []string{"disable user", "delete refresh_sessions", "remove standup/u1#laptop"}
+	if !reflect.DeepEqual(d.events, want) {
+		t.Errorf("events = %q, want %q", d.events, want)
+	}
+}
+
+func TestDeleteUserFullySkipsRoomsLiveKitHasClosed(t *testing.T) {
+	d := &deletion{
+		participants: map[string][]*livekit.ParticipantInfo{
+			"retro": {{Identity: "u1#tablet"}},
+		},
+		listErr: map[string]error{"standup": twirp.NotFoundError("room not found")},
+	}
+
+	if err := newTestService(t, d).DeleteUserFully(context.Background(), "u1"); err != nil {
+		t.Fatalf("DeleteUserFully() = %v", err)
+	}
+	want := []string{
+		"disable user",
+		"delete refresh_sessions",
+		"remove retro/u1#tablet",
+		"delete room_participants",
+		"delete refresh_sessions",
+		"delete users",
+	}
+	if !reflect.DeepEqual(d.events, want) {
+		t.Errorf("events = %q, want %q", d.events, want)
+	}
+}
+
+func TestIsUserIdentity(t *testing.T) {
+	user := &models.User{ID: "u1", Email: "ann@example.com"}
+
+	tests := []struct {
+		strategy string
+		identity string
+		want     bool
+	}{
+		{config.IdentityUserID, "u1", true},
+		{config.IdentityUserID, "u1#laptop", false},
+		{config.IdentityUserIDDevice, "u1#laptop", true},
+		{config.IdentityUserIDDevice, "u10#laptop", false},
+		{config.IdentityUserIDDevice, "u1", false},
+		{config.IdentityEmail, "ann@example.com", true},
+		{config.IdentityEmail, "u1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsUserIdentity(tt.strategy, tt.identity, user); got != tt.want {
+			t.Errorf("IsUserIdentity(%q, %q) = %v, want %v", tt.strategy, tt.identity, got, tt.want)
+		}
+	}
+}
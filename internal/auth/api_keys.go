@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"bedrud-backend/internal/database"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs
+const APIKeyPrefix = "bdr_"
+
+// MaxAPIKeysPerUser caps how many API keys one user may hold
+const MaxAPIKeysPerUser = 25
+
+// apiKeyTouchInterval limits how often a key's last use is written back
+const apiKeyTouchInterval = time.Minute
+
+// ErrAPIKeyNotFound is returned when an API key doesn't exist or belongs to another user
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// ErrInvalidScope is returned when an API key asks for access its owner doesn't have
+var ErrInvalidScope = errors.New("scope exceeds the user's own access")
+
+// ErrTooManyAPIKeys is returned when a user already holds MaxAPIKeysPerUser keys
+var ErrTooManyAPIKeys = errors.New("too many API keys")
+
+// ErrInvalidAPIKey is returned for unknown API keys and keys of inactive users
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// CreateAPIKey issues a new API key for the user and returns it along with its
+// stored record. The key itself is not stored and can't be shown again. Scopes
+// must be a subset of the user's accesses; none means the key carries all of them.
+func (s *AuthService) CreateAPIKey(userID, name string, scopes []string) (string, *models.APIKey, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if user == nil {
+		return "", nil, ErrInvalidAPIKey
+	}
+
+	for _, scope := range scopes {
+		if !hasAccess(user.Accesses, scope) {
+			return "", nil, ErrInvalidScope
+		}
+	}
+
+	count, err := s.userRepo.CountAPIKeys(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if count >= MaxAPIKeysPerUser {
+		return "", nil, ErrTooManyAPIKeys
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	key := APIKeyPrefix + secret
+
+	record := &models.APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:len(APIKeyPrefix)+6],
+		KeyHash:   hashToken(key),
+		Scopes:    models.StringArray(scopes),
+		CreatedAt: time.Now(),
+	}
+	if err := s.userRepo.CreateAPIKey(record); err != nil {
+		return "", nil, err
+	}
+	return key, record, nil
+}
+
+// ListAPIKeys returns the user's API keys without the keys themselves
+func (s *AuthService) ListAPIKeys(userID string) ([]models.APIKey, error) {
+	return s.userRepo.GetAPIKeys(userID)
+}
+
+// RevokeAPIKey deletes one of the user's API keys
+func (s *AuthService) RevokeAPIKey(userID, keyID string) error {
+	deleted, err := s.userRepo.DeleteAPIKey(keyID, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ValidateAPIKey looks up an API key and returns claims for its owner. The key
+// grants its scopes only while the owner still has them, and nothing once the
+// owner is deactivated.
+func ValidateAPIKey(key string) (*Claims, error) {
+	return validateAPIKey(repository.NewUserRepository(database.GetDB()), key)
+}
+
+func validateAPIKey(userRepo *repository.UserRepository, key string) (*Claims, error) {
+	record, err := userRepo.GetAPIKeyByHash(hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := userRepo.GetUserByID(record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	accesses := []string(user.Accesses)
+	if len(record.Scopes) > 0 {
+		accesses = make([]string, 0, len(record.Scopes))
+		for _, scope := range record.Scopes {
+			if hasAccess(user.Accesses, scope) {
+				accesses = append(accesses, scope)
+			}
+		}
+	}
+
+	if record.LastUsedAt == nil || time.Since(*record.LastUsedAt) > apiKeyTouchInterval {
+		if err := userRepo.TouchAPIKey(record.ID); err != nil {
+			log.Warn().Err(err).Str("apiKeyId", record.ID).Msg("Failed to record API key use")
+		}
+	}
+
+	return &Claims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Provider: user.Provider,
+		Accesses: accesses,
+		TenantID: user.TenantID,
+		APIKeyID: record.ID,
+	}, nil
+}
+
+// hasAccess reports whether access is one of accesses
+func hasAccess(accesses []string, access string) bool {
+	for _, a := range accesses {
+		if a == access {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// keyRing plays the api_keys table and user u1, an active admin
+type keyRing struct {
+	mu       sync.Mutex
+	keys     map[string][]interface{} // id -> id, user_id, name, prefix, key_hash, scopes
+	inactive bool
+	touched  int
+}
+
+func (k *keyRing) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	columns := []string{"id", "user_id", "name", "prefix", "key_hash", "scopes"}
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`"api_keys"`) && stmt.Mentions("count("):
+		var count int64
+		for _, row := range k.keys {
+			if hasArg(stmt.Args, row[1]) {
+				count++
+			}
+		}
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{count}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"api_keys"`):
+		result := &dbtest.Result{Columns: columns}
+		for _, row := range k.keys {
+			if (stmt.Mentions("key_hash =") && hasArg(stmt.Args, row[4])) || (stmt.Mentions("user_id =") && hasArg(stmt.Args, row[1])) {
+				result.Rows = append(result.Rows, row)
+			}
+		}
+		return result, nil
+	case stmt.Is("INSERT") && stmt.Mentions(`"api_keys"`):
+		row := make([]interface{}, len(columns))
+		for i, column := range columns {
+			row[i], _ = stmt.Value(column)
+		}
+		scopes, _ := row[5].(models.StringArray)
+		row[5] = "{" + strings.Join(scopes, ",") + "}"
+		k.keys[row[0].(string)] = row
+	case stmt.Is("DELETE") && stmt.Mentions(`"api_keys"`):
+		for id, row := range k.keys {
+			if hasArg(stmt.Args, id) && hasArg(stmt.Args, row[1]) {
+				delete(k.keys, id)
+				return &dbtest.Result{Affected: 1}, nil
+			}
+		}
+		return &dbtest.Result{}, nil
+	case stmt.Is("UPDATE") && stmt.Mentions(`"api_keys"`):
+		k.touched++
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "provider", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", "local", "{user,admin}", !k.inactive}},
+		}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+// hasArg reports whether args contains value
+func hasArg(args []interface{}, value interface{}) bool {
+	for _, arg := range args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestKeyRing(t *testing.T) (*AuthService, *repository.UserRepository, *keyRing) {
+	t.Helper()
+
+	ring := &keyRing{keys: map[string][]interface{}{}}
+	db, _ := dbtest.Open(t, ring.answer)
+	repo := repository.NewUserRepository(db)
+	return NewAuthService(repo, nil), repo, ring
+}
+
+func TestAPIKeyAuthenticatesUntilRevoked(t *testing.T) {
+	s, repo, ring := newTestKeyRing(t)
+
+	key, record, err := s.CreateAPIKey("u1", "CI deploys", []string{"user"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() = %v", err)
+	}
+	if !IsAPIKey(key) || !strings.HasPrefix(key, record.Prefix) {
+		t.Errorf("key %.10s... with prefix %q, want a %s key starting with its prefix", key, record.Prefix, APIKeyPrefix)
+	}
+	stored := ring.keys[record.ID]
+	if stored[4] != hashToken(key) {
+		t.Error("the stored key isn't the key's hash")
+	}
+	for _, value := range stored {
+		if value == key {
+			t.Fatal("the key itself was stored")
+		}
+	}
+
+	claims, err := validateAPIKey(repo, key)
+	if err != nil {
+		t.Fatalf("validateAPIKey() = %v", err)
+	}
+	if claims.UserID != "u1" || claims.APIKeyID != record.ID || !reflect.DeepEqual(claims.Accesses, []string{"user"}) {
+		t.Errorf("claims = %+v, want u1 through the key with only its user scope", claims)
+	}
+	if ring.touched != 1 {
+		t.Errorf("last use recorded %d times, want 1", ring.touched)
+	}
+
+	if _, err := validateAPIKey(repo, key+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("validateAPIKey(unknown key) = %v, want ErrInvalidAPIKey", err)
+	}
+
+	if err := s.RevokeAPIKey("u2", record.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey() by another user = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := s.RevokeAPIKey("u1", record.ID); err != nil {
+		t.Fatalf("RevokeAPIKey() = %v", err)
+	}
+	if _, err := validateAPIKey(repo, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("validateAPIKey(revoked key) = %v, want ErrInvalidAPIKey", err)
+	}
+	if err := s.RevokeAPIKey("u1", record.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey() twice = %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		name         string
+		scopes       []string
+		wantErr      error
+		wantAccesses []string
+	}{
+		{"no scopes carries every access", nil, nil, []string{"user", "admin"}},
+		{"scoped to one access", []string{"admin"}, nil, []string{"admin"}},
+		{"scope beyond the user's access", []string{"superadmin"}, ErrInvalidScope, nil},
+	}
+
+	for _, tt := range tests {
+		s, repo, _ := newTestKeyRing(t)
+
+		key, _, err := s.CreateAPIKey("u1", "script", tt.scopes)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CreateAPIKey() = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		claims, err := validateAPIKey(repo, key)
+		if err != nil {
+			t.Fatalf("%s: validateAPIKey() = %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(claims.Accesses, tt.wantAccesses) {
+			t.Errorf("%s: accesses = %v, want %v", tt.name, claims.Accesses, tt.wantAccesses)
+		}
+	}
+}
+
+func TestAPIKeyOfADeactivatedUser(t *testing.T) {
+	s, repo, ring := newTestKeyRing(t)
+
+	key, _, err := s.CreateAPIKey("u1", "script", nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey() = %v", err)
+	}
+	ring.inactive = true
+	if _, err := validateAPIKey(repo, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("validateAPIKey() = %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestAPIKeysPerUserAreCapped(t *testing.T) {
+	s, _, _ := newTestKeyRing(t)
+
+	for i := 0; i < MaxAPIKeysPerUser; i++ {
+		if _, _, err := s.CreateAPIKey("u1", "script", nil); err != nil {
+			t.Fatalf("CreateAPIKey() #%d = %v", i+1, err)
+		}
+	}
+	if _, _, err := s.CreateAPIKey("u1", "script", nil); !errors.Is(err, ErrTooManyAPIKeys) {
+		t.Errorf("CreateAPIKey() past the cap = %v, want ErrTooManyAPIKeys", err)
+	}
+}
@@ -3,20 +3,52 @@ package auth
 import (
 	"bedrud-backend/config"
 	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/notify"
 	"bedrud-backend/internal/repository"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/providers/github"
 	"github.com/markbates/goth/providers/google"
 	"github.com/markbates/goth/providers/twitter"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrSessionNotFound is returned when a session doesn't exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrInvalidCredentials is returned by Login for both unknown emails and wrong passwords
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrInvalidRefreshToken is returned for refresh tokens that are malformed, expired or revoked
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// ErrRegistrationDisabled is returned when local registration is turned off
+var ErrRegistrationDisabled = errors.New("registration is disabled")
+
+// ErrEmailDomainNotAllowed is returned when an email's domain isn't on the allowlist
+var ErrEmailDomainNotAllowed = errors.New("email domain is not allowed")
+
+// ErrInvalidExchangeCode is returned for unknown, expired or already used exchange codes
+var ErrInvalidExchangeCode = errors.New("invalid or expired exchange code")
+
+// ErrNameTooLong is returned for names longer than auth.maxNameLength
+var ErrNameTooLong = errors.New("name is too long")
+
+// ErrEmailTooLong is returned for emails longer than auth.maxEmailLength
+var ErrEmailTooLong = errors.New("email is too long")
+
+// ErrAccountDeactivated is returned when a deactivated user tries to start a session
+var ErrAccountDeactivated = errors.New("account is deactivated")
+
+// ErrTooManySessions is returned when a login would exceed the user's session limit in reject mode
+var ErrTooManySessions = errors.New("too many active sessions")
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -58,26 +90,37 @@ type TokenPair struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
+// SessionInfo carries best-effort client details captured when a session starts
+type SessionInfo struct {
+	UserAgent string
+	IP        string
+}
+
 type AuthService struct {
 	userRepo *repository.UserRepository
+	notifier notify.Notifier
 }
 
-func NewAuthService(userRepo *repository.UserRepository) *AuthService {
+func NewAuthService(userRepo *repository.UserRepository, notifier notify.Notifier) *AuthService {
 	return &AuthService{
 		userRepo: userRepo,
+		notifier: notifier,
 	}
 }
 
-// @Summary Register new user
-// @Description Create a new user account
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Param request body RegisterRequest true "Registration Data"
-// @Success 200 {object} TokenResponse
-// @Failure 400 {object} ErrorResponse
-// @Router /auth/register [post]
+// Register creates a local account
 func (s *AuthService) Register(email, password, name string) (*models.User, error) {
+	authConfig := &config.Get().Auth
+	if !authConfig.AllowLocalRegistration {
+		return nil, ErrRegistrationDisabled
+	}
+	if !EmailDomainAllowed(email, authConfig.AllowedEmailDomains) {
+		return nil, ErrEmailDomainNotAllowed
+	}
+	if err := CheckLengths(email, name); err != nil {
+		return nil, err
+	}
+
 	// Check if user exists
 	existingUser, err := s.userRepo.GetUserByEmail(email)
 	if err != nil {
@@ -88,7 +131,7 @@ func (s *AuthService) Register(email, password, name string) (*models.User, erro
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(password)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +139,7 @@ func (s *AuthService) Register(email, password, name string) (*models.User, erro
 	user := &models.User{
 		ID:        uuid.New().String(),
 		Email:     email,
-		Password:  string(hashedPassword),
+		Password:  hashedPassword,
 		Name:      name,
 		Provider:  "local",
 		Accesses:  models.StringArray{"user"}, // Use our custom type
@@ -113,31 +156,193 @@ func (s *AuthService) Register(email, password, name string) (*models.User, erro
 	return user, nil
 }
 
-// @Summary Login user
-// @Description Authenticate user and get tokens
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Param request body LoginRequest true "Login Data"
-// @Success 200 {object} TokenResponse
-// @Failure 401 {object} ErrorResponse
-// @Router /auth/login [post]
-func (s *AuthService) Login(email, password string) (*LoginResponse, error) {
+// Login checks the credentials and starts a new session
+func (s *AuthService) Login(email, password string, info SessionInfo) (*LoginResponse, error) {
 	user, err := s.userRepo.GetUserByEmail(email)
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		// Burn the same hashing work as a real check so response timing
+		// doesn't reveal which emails are registered
+		verifyDummyPassword(password)
+		s.recordLoginAttempt("", email, info, false)
+		return nil, ErrInvalidCredentials
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	ok, needsRehash, err := VerifyPassword(user.Password, password)
 	if err != nil {
-		return nil, errors.New("invalid password")
+		// OAuth-only accounts have no hash and unknown formats fail before any
+		// hashing; burn the work anyway so timing doesn't single them out
+		verifyDummyPassword(password)
+	}
+	if err != nil || !ok {
+		s.recordLoginAttempt(user.ID, email, info, false)
+		return nil, ErrInvalidCredentials
+	}
+	// Answered like a wrong password so the status of an account isn't revealed
+	if !user.IsActive {
+		s.recordLoginAttempt(user.ID, email, info, false)
+		return nil, ErrInvalidCredentials
+	}
+	if needsRehash {
+		// Move the stored hash over to the configured algorithm while we have the plaintext
+		if hash, err := HashPassword(password); err != nil {
+			log.Warn().Err(err).Str("userId", user.ID).Msg("Failed to rehash password")
+		} else if err := s.userRepo.UpdatePassword(user.ID, hash); err != nil {
+			log.Warn().Err(err).Str("userId", user.ID).Msg("Failed to store rehashed password")
+		} else {
+			user.Password = hash
+		}
+	}
+
+	tokens, err := s.StartSession(user, info)
+	if err != nil {
+		s.recordLoginAttempt(user.ID, email, info, false)
+		return nil, err
+	}
+	s.recordLoginAttempt(user.ID, email, info, true)
+
+	return &LoginResponse{
+		User:  user,
+		Token: *tokens,
+	}, nil
+}
+
+// recordLoginAttempt stores a sign-in attempt for the admin login history.
+// Failing to record one doesn't fail the login.
+func (s *AuthService) recordLoginAttempt(userID, email string, info SessionInfo, success bool) {
+	attempt := &models.LoginAttempt{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Email:     truncate(email, config.MaxFieldLength),
+		IP:        info.IP,
+		UserAgent: truncate(info.UserAgent, 512),
+		Success:   success,
+	}
+	if err := s.userRepo.RecordLoginAttempt(attempt); err != nil {
+		log.Warn().Err(err).Str("userId", userID).Bool("success", success).Msg("Failed to record login attempt")
+	}
+}
+
+// CheckLengths rejects an email or name longer than the configured maximum
+func CheckLengths(email, name string) error {
+	authConfig := &config.Get().Auth
+	if utf8.RuneCountInString(email) > authConfig.MaxEmailLength {
+		return ErrEmailTooLong
+	}
+	if utf8.RuneCountInString(name) > authConfig.MaxNameLength {
+		return ErrNameTooLong
+	}
+	return nil
+}
+
+// TruncateName shortens a name to the configured maximum, for names that come
+// from somewhere the user can't be asked to fix them, such as an OAuth provider
+func TruncateName(name string) string {
+	max := config.Get().Auth.MaxNameLength
+	if utf8.RuneCountInString(name) <= max {
+		return name
+	}
+	return strings.TrimSpace(string([]rune(name)[:max]))
+}
+
+// EmailDomainAllowed reports whether the email's domain is on the allowlist.
+// An empty allowlist allows every domain.
+func EmailDomainAllowed(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range domains {
+		if strings.EqualFold(domain, strings.TrimPrefix(allowed, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthEmailVerified reports whether an OAuth login's email can be trusted: the
+// provider is configured as trusted or flags the address as verified itself
+func OAuthEmailVerified(user goth.User, provider config.OAuth2Config) bool {
+	if provider.TrustEmail {
+		return true
+	}
+	// Google's v2 userinfo says verified_email, OpenID Connect says email_verified
+	for _, key := range []string{"email_verified", "verified_email"} {
+		switch verified := user.RawData[key].(type) {
+		case bool:
+			return verified
+		case string:
+			return strings.EqualFold(verified, "true")
+		}
+	}
+	return false
+}
+
+// OAuthAccesses returns the accesses for a new OAuth account under the policy.
+// A domain entry wins over the default, but only for a verified email, since
+// anyone can claim an unverified address; levels above user also keep user.
+func OAuthAccesses(email string, verified bool, policy config.OAuthAccessConfig) []string {
+	level := policy.Default
+	if at := strings.LastIndex(email, "@"); verified && at >= 0 {
+		domain := email[at+1:]
+		for candidate, domainLevel := range policy.Domains {
+			if strings.EqualFold(domain, strings.TrimPrefix(candidate, "@")) {
+				level = domainLevel
+				break
+			}
+		}
+	}
+
+	switch models.AccessLevel(level) {
+	case models.AccessGuest:
+		return []string{string(models.AccessGuest)}
+	case models.AccessMod, models.AccessAdmin:
+		return []string{string(models.AccessUser), level}
+	default:
+		return []string{string(models.AccessUser)}
+	}
+}
+
+// StartSession records a new device session for the user and issues a token pair bound to it
+func (s *AuthService) StartSession(user *models.User, info SessionInfo) (*TokenPair, error) {
+	if !user.IsActive {
+		return nil, ErrAccountDeactivated
+	}
+	now := time.Now()
+	session := &models.RefreshSession{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		UserAgent:  truncate(info.UserAgent, 512),
+		IP:         info.IP,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(RefreshTokenDuration),
+	}
+
+	if config.Get().Auth.RefreshTokenScheme == RefreshSchemeOpaque {
+		refreshToken, err := randomToken()
+		if err != nil {
+			return nil, errors.New("failed to generate tokens")
+		}
+		session.TokenHash = hashToken(refreshToken)
+		if err := s.createSession(user, session); err != nil {
+			return nil, err
+		}
+		return s.opaqueTokenPair(user, session.ID, refreshToken)
+	}
+
+	if err := s.createSession(user, session); err != nil {
+		return nil, err
 	}
 
 	// Generate tokens
-	accessToken, refreshToken, err := GenerateTokenPair(user.ID, user.Email, user.Accesses, config.Get())
+	accessToken, refreshToken, err := GenerateSessionTokenPair(user.ID, user.Email, user.Accesses, user.TenantID, session.ID, config.Get())
 	if err != nil {
 		return nil, errors.New("failed to generate tokens")
 	}
@@ -147,60 +352,185 @@ func (s *AuthService) Login(email, password string) (*LoginResponse, error) {
 		return nil, errors.New("failed to save refresh token")
 	}
 
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair, rotating the refresh token.
+// Both JWT and opaque refresh tokens are accepted so switching schemes doesn't log users out.
+func (s *AuthService) Refresh(refreshToken string) (*TokenPair, error) {
+	if isOpaqueToken(refreshToken) {
+		return s.refreshOpaque(refreshToken)
+	}
+
+	// Validate the refresh token
+	claims, err := s.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.refreshUser(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate new token pair
+	accessToken, newRefreshToken, err := GenerateSessionTokenPair(user.ID, user.Email, user.Accesses, user.TenantID, claims.SessionID, config.Get())
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+
+	// Update refresh token in database
+	if err := s.userRepo.UpdateRefreshToken(user.ID, newRefreshToken); err != nil {
+		return nil, errors.New("failed to update refresh token")
+	}
+
+	if err := s.TouchSession(claims.SessionID); err != nil {
+		return nil, errors.New("failed to update session")
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+// exchangeCodeTTL is how long an OAuth exchange code can be redeemed
+const exchangeCodeTTL = time.Minute
+
+// CreateExchangeCode issues a one-time code the frontend can swap for a token pair
+func (s *AuthService) CreateExchangeCode(userID string) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.userRepo.CreateExchangeCode(&models.AuthExchangeCode{
+		CodeHash:  hashToken(code),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(exchangeCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemExchangeCode consumes an exchange code and starts a session for its user
+func (s *AuthService) RedeemExchangeCode(code string, info SessionInfo) (*LoginResponse, error) {
+	userID, err := s.userRepo.ConsumeExchangeCode(hashToken(code))
+	if err != nil {
+		return nil, err
+	}
+	if userID == "" {
+		return nil, ErrInvalidExchangeCode
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidExchangeCode
+	}
+
+	tokens, err := s.StartSession(user, info)
+	if err != nil {
+		return nil, err
+	}
+
 	return &LoginResponse{
-		User: user,
-		Token: TokenPair{
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-		},
+		User:  user,
+		Token: *tokens,
 	}, nil
 }
 
-// @Summary Refresh token
-// @Description Get new access token using refresh token
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Param request body map[string]string true "Refresh Token"
-// @Success 200 {object} TokenResponse
-// @Failure 401 {object} ErrorResponse
-// @Router /auth/refresh [post]
+// maxSessions is the user's session limit: their own when an admin set one,
+// auth.maxSessions otherwise. 0 means no limit.
+func maxSessions(user *models.User) int {
+	if user.MaxSessions != nil {
+		return *user.MaxSessions
+	}
+	return config.Get().Auth.MaxSessions
+}
+
+// sessionsToKeep decides how many of a user's active sessions may stay when
+// they start another one under limit. In reject mode a user at the limit
+// can't start another session; in evict mode their least recently used
+// sessions make room for it. A negative result keeps them all.
+func sessionsToKeep(limit int, mode string, active int64) (int, error) {
+	if limit <= 0 || active < int64(limit) {
+		return -1, nil
+	}
+	if mode == config.SessionLimitReject {
+		return 0, ErrTooManySessions
+	}
+	return limit - 1, nil
+}
+
+// createSession stores a new session within the user's session limit. The
+// count, any eviction and the insert share one transaction holding the user's
+// row lock, so parallel logins can't get past the limit.
+func (s *AuthService) createSession(user *models.User, session *models.RefreshSession) error {
+	limit := maxSessions(user)
+	mode := config.Get().Auth.SessionLimit
+	evicted, err := s.userRepo.CreateSessionLimited(session, func(active int64) (int, error) {
+		return sessionsToKeep(limit, mode, active)
+	})
+	if errors.Is(err, ErrTooManySessions) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	if evicted > 0 {
+		log.Info().Str("userId", user.ID).Int64("evicted", evicted).Msg("Evicted sessions over the session limit")
+	}
+	return nil
+}
+
+// TouchSession extends a session after one of its refresh tokens was used
+func (s *AuthService) TouchSession(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return s.userRepo.TouchSession(sessionID, time.Now().Add(RefreshTokenDuration))
+}
+
+// GetUserSessions returns the user's active sessions
+func (s *AuthService) GetUserSessions(userID string) ([]models.RefreshSession, error) {
+	return s.userRepo.GetUserSessions(userID)
+}
+
+// LabelSession sets the device label of one of the user's sessions
+func (s *AuthService) LabelSession(userID, sessionID, label string) error {
+	updated, err := s.userRepo.UpdateSessionLabel(sessionID, userID, truncate(label, 100))
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// UpdateRefreshToken stores the user's latest refresh token
 func (s *AuthService) UpdateRefreshToken(userID, refreshToken string) error {
 	return s.userRepo.UpdateRefreshToken(userID, refreshToken)
 }
 
-// @Summary Get user profile
-// @Description Get current user profile
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Security BearerAuth
-// @Success 200 {object} models.User
-// @Failure 401 {object} ErrorResponse
-// @SecuritySchemes BearerAuth bearerAuth
-// @Router /auth/me [get]
+// GetUserByID returns a user by ID, or nil if none exists
 func (s *AuthService) GetUserByID(userID string) (*models.User, error) {
 	return s.userRepo.GetUserByID(userID)
 }
 
-// @Summary Logout user
-// @Description Invalidate refresh token and logout user
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Security BearerAuth
-// @Param refresh_token body string true "Refresh token to invalidate"
-// @Success 200 {object} map[string]string
-// @Failure 401 {object} ErrorResponse
-// @Router /auth/logout [post]
+// Logout blocks a JWT refresh token until it expires
 func (s *AuthService) Logout(userID string, refreshToken string) error {
 	// Parse the refresh token to get expiration
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.Get().Auth.JWTSecret), nil
-	})
-
-	if err != nil || !token.Valid {
+	claims, err := ValidateToken(refreshToken, config.Get())
+	if err != nil {
 		return errors.New("invalid refresh token")
 	}
 
@@ -208,27 +538,33 @@ func (s *AuthService) Logout(userID string, refreshToken string) error {
 	return s.userRepo.BlockRefreshToken(userID, refreshToken, time.Unix(claims.ExpiresAt.Unix(), 0))
 }
 
-// @Summary Block refresh token
-// @Description Block a refresh token during logout
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Security BearerAuth
-// @Param request body LogoutRequest true "Logout request"
-// @Success 200 {object} map[string]string
-// @Failure 401 {object} ErrorResponse
-// @Router /auth/logout [post]
+// BlockRefreshToken revokes a refresh token and the session it belongs to
 func (s *AuthService) BlockRefreshToken(userID string, refreshToken string) error {
-	// Parse the refresh token to get expiration
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.Get().Auth.JWTSecret), nil
-	})
+	// Opaque tokens live only in their session row, so deleting it is enough
+	if isOpaqueToken(refreshToken) {
+		deleted, err := s.userRepo.DeleteSessionByTokenHash(userID, hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return errors.New("invalid refresh token")
+		}
+		return nil
+	}
 
-	if err != nil || !token.Valid {
+	// Parse the refresh token to get expiration
+	claims, err := ValidateToken(refreshToken, config.Get())
+	if err != nil {
 		return errors.New("invalid refresh token")
 	}
 
+	// End the session the token belongs to
+	if claims.SessionID != "" {
+		if err := s.userRepo.DeleteSession(claims.SessionID); err != nil {
+			return err
+		}
+	}
+
 	// Block the refresh token
 	return s.userRepo.BlockRefreshToken(userID, refreshToken, time.Unix(claims.ExpiresAt.Unix(), 0))
 }
@@ -246,6 +582,17 @@ func (s *AuthService) ValidateRefreshToken(refreshToken string) (*Claims, error)
 		return nil, err
 	}
 
+	// Tokens bound to a session are only valid while the session exists
+	if claims.SessionID != "" {
+		session, err := s.userRepo.GetSession(claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if session == nil || session.UserID != claims.UserID {
+			return nil, errors.New("session has been revoked")
+		}
+	}
+
 	return claims, nil
 }
 
@@ -307,3 +654,12 @@ func Init(cfg *config.Config) {
 	log.Debug().Int("provider_count", len(providers)).Msg("Using providers")
 	goth.UseProviders(providers...)
 }
+
+// truncate shortens s to at most max characters, never splitting one, so the
+// result still fits a varchar(max) column
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -0,0 +1,436 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/markbates/goth"
+)
+
+func TestSessionsToKeep(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		mode     string
+		active   int64
+		wantKeep int
+		wantErr  error
+	}{
+		{"no limit", 0, config.SessionLimitReject, 50, -1, nil},
+		{"reject under the limit", 3, config.SessionLimitReject, 2, -1, nil},
+		{"reject at the limit", 3, config.SessionLimitReject, 3, 0, ErrTooManySessions},
+		{"reject over the limit", 3, config.SessionLimitReject, 5, 0, ErrTooManySessions},
+		{"evict under the limit", 3, config.SessionLimitEvict, 2, -1, nil},
+		{"evict at the limit keeps the newest", 3, config.SessionLimitEvict, 3, 2, nil},
+		{"evict over the limit keeps the newest", 3, config.SessionLimitEvict, 7, 2, nil},
+		{"evict with a limit of one signs out the rest", 1, config.SessionLimitEvict, 4, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, err := sessionsToKeep(tt.limit, tt.mode, tt.active)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && keep != tt.wantKeep {
+				t.Errorf("keep = %d, want %d", keep, tt.wantKeep)
+			}
+		})
+	}
+}
+
+func TestMaxSessionsPrefersTheUsersOwnLimit(t *testing.T) {
+	own := 0
+	if got := maxSessions(&models.User{MaxSessions: &own}); got != 0 {
+		t.Errorf("maxSessions = %d, want the user's own limit 0", got)
+	}
+}
+
+func TestEmailDomainAllowed(t *testing.T) {
+	tests := []struct {
+		email   string
+		domains []string
+		want    bool
+	}{
+		{"ann@example.org", nil, true},
+		{"ann@example.com", []string{"example.com"}, true},
+		{"ann@EXAMPLE.com", []string{"example.com"}, true},
+		{"ann@example.com", []string{"@example.com"}, true},
+		{"ann@example.com", []string{"example.org", "example.com"}, true},
+		{"ann@example.org", []string{"example.com"}, false},
+		{"ann@mail.example.com", []string{"example.com"}, false},
+		{"ann@example.com.evil.test", []string{"example.com"}, false},
+		{"example.com", []string{"example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := EmailDomainAllowed(tt.email, tt.domains); got != tt.want {
+			t.Errorf("EmailDomainAllowed(%q, %v) = %v, want %v", tt.email, tt.domains, got, tt.want)
+		}
+	}
+}
+
+func TestOAuthAccesses(t *testing.T) {
+	policy := config.OAuthAccessConfig{
+		Default: "user",
+		Domains: map[string]string{"example.com": "moderator", "@corp.example": "admin", "contractors.example": "guest"},
+	}
+
+	tests := []struct {
+		email  string
+		policy config.OAuthAccessConfig
+		want   []string
+	}{
+		{"ann@example.org", policy, []string{"user"}},
+		{"ann@example.com", policy, []string{"user", "moderator"}},
+		{"ann@EXAMPLE.com", policy, []string{"user", "moderator"}},
+		{"ann@corp.example", policy, []string{"user", "admin"}},
+		{"ann@contractors.example", policy, []string{"guest"}},
+		{"ann@mail.example.com", policy, []string{"user"}},
+		{"ann@example.org", config.OAuthAccessConfig{Default: "guest"}, []string{"guest"}},
+		{"ann@example.org", config.OAuthAccessConfig{}, []string{"user"}},
+	}
+
+	for _, tt := range tests {
+		if got := OAuthAccesses(tt.email, true, tt.policy); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OAuthAccesses(%q, default %q) = %v, want %v", tt.email, tt.policy.Default, got, tt.want)
+		}
+	}
+}
+
+func TestOAuthAccessesNeedAVerifiedEmailForDomainLevels(t *testing.T) {
+	policy := config.OAuthAccessConfig{
+		Default: "user",
+		Domains: map[string]string{"corp.example": "admin", "contractors.example": "guest"},
+	}
+
+	tests := []struct {
+		email    string
+		verified bool
+		want     []string
+	}{
+		{"ann@corp.example", true, []string{"user", "admin"}},
+		{"ann@corp.example", false, []string{"user"}},
+		{"ann@contractors.example", false, []string{"user"}},
+		{"ann@example.org", false, []string{"user"}},
+	}
+
+	for _, tt := range tests {
+		if got := OAuthAccesses(tt.email, tt.verified, policy); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OAuthAccesses(%q, verified %v) = %v, want %v", tt.email, tt.verified, got, tt.want)
+		}
+	}
+}
+
+func TestOAuthEmailVerified(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawData  map[string]interface{}
+		provider config.OAuth2Config
+		want     bool
+	}{
+		{"OpenID Connect verified", map[string]interface{}{"email_verified": true}, config.OAuth2Config{}, true},
+		{"OpenID Connect unverified", map[string]interface{}{"email_verified": false}, config.OAuth2Config{}, false},
+		{"Google v2 verified", map[string]interface{}{"verified_email": true}, config.OAuth2Config{}, true},
+		{"verified as a string", map[string]interface{}{"email_verified": "True"}, config.OAuth2Config{}, true},
+		{"unverified as a string", map[string]interface{}{"email_verified": "false"}, config.OAuth2Config{}, false},
+		{"no signal", map[string]interface{}{}, config.OAuth2Config{}, false},
+		{"trusted provider", map[string]interface{}{}, config.OAuth2Config{TrustEmail: true}, true},
+	}
+
+	for _, tt := range tests {
+		user := goth.User{Email: "ann@example.com", RawData: tt.rawData}
+		if got := OAuthEmailVerified(user, tt.provider); got != tt.want {
+			t.Errorf("%s: OAuthEmailVerified() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeactivatedAccountsCannotSignIn(t *testing.T) {
+	configtest.Load(t, nil)
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() = %v", err)
+	}
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`"users"`) {
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "password", "provider", "accesses", "is_active"},
+				Rows:    [][]interface{}{{"u1", "ann@example.com", hash, "local", "{user}", false}},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	s := NewAuthService(repository.NewUserRepository(db), nil)
+
+	if _, err := s.StartSession(&models.User{ID: "u1", IsActive: false}, SessionInfo{}); !errors.Is(err, ErrAccountDeactivated) {
+		t.Errorf("StartSession() = %v, want ErrAccountDeactivated", err)
+	}
+	if _, err := s.Login("ann@example.com", "correct horse battery", SessionInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() = %v, want ErrInvalidCredentials", err)
+	}
+	if sessions := fake.Find("INSERT", `"refresh_sessions"`); len(sessions) != 0 {
+		t.Errorf("sessions started for a deactivated account: %v", sessions)
+	}
+}
+
+func TestCheckLengths(t *testing.T) {
+	configtest.Load(t, map[string]interface{}{"auth.maxNameLength": 10, "auth.maxEmailLength": 20})
+
+	tests := []struct {
+		name    string
+		email   string
+		user    string
+		wantErr error
+	}{
+		{"normal", "ann@example.com", "Ann Lee", nil},
+		{"at the limits", "annabel@example.com1", "Annabel Le", nil},
+		{"name over the limit", "ann@example.com", "Annabel Lee", ErrNameTooLong},
+		{"email over the limit", "annabel.lee@example.com", "Ann", ErrEmailTooLong},
+		{"characters, not bytes", "ann@example.com", "Zoë Ångstr", nil},
+		{"multibyte name over the limit", "ann@example.com", "ÉÉÉÉÉÉÉÉÉÉÉ", ErrNameTooLong},
+	}
+
+	for _, tt := range tests {
+		if err := CheckLengths(tt.email, tt.user); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CheckLengths(%q, %q) = %v, want %v", tt.name, tt.email, tt.user, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTruncateName(t *testing.T) {
+	configtest.Load(t, map[string]interface{}{"auth.maxNameLength": 10})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Ann Lee", "Ann Lee"},
+		{"Annabel Le", "Annabel Le"},
+		{"Annabel Lee", "Annabel Le"},
+		{"Ann Lee Smith", "Ann Lee Sm"},
+		{"Annabella Lee", "Annabella"},
+		{"Zoë Ångström", "Zoë Ångstr"},
+	}
+
+	for _, tt := range tests {
+		if got := TruncateName(tt.name); got != tt.want {
+			t.Errorf("TruncateName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLabelSessionTruncatesByCharacter(t *testing.T) {
+	tests := []struct {
+		name  string
+		label string
+		want  string
+	}{
+		{"short", "Ann's laptop", "Ann's laptop"},
+		{"ascii", strings.Repeat("a", 120), strings.Repeat("a", 100)},
+		{"multi-byte", strings.Repeat("ü", 120), strings.Repeat("ü", 100)},
+		{"emoji after ascii", strings.Repeat("a", 99) + "💻💻", strings.Repeat("a", 99) + "💻"},
+	}
+
+	for _, tt := range tests {
+		db, fake := dbtest.Open(t, func(dbtest.Statement) (*dbtest.Result, error) {
+			return &dbtest.Result{Affected: 1}, nil
+		})
+		s := NewAuthService(repository.NewUserRepository(db), nil)
+
+		if err := s.LabelSession("u1", "s1", tt.label); err != nil {
+			t.Fatalf("%s: LabelSession() = %v", tt.name, err)
+		}
+		updates := fake.Find("UPDATE", `"refresh_sessions"`)
+		if len(updates) != 1 {
+			t.Fatalf("%s: %d session updates, want 1", tt.name, len(updates))
+		}
+		got, _ := updates[0].Value("label")
+		if got != tt.want || !utf8.ValidString(got.(string)) {
+			t.Errorf("%s: stored label %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoginRecordsAttempts(t *testing.T) {
+	configtest.Load(t, nil)
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		email       string
+		password    string
+		active      bool
+		wantUser    string
+		wantSuccess bool
+	}{
+		{"successful login", "ann@example.com", "correct horse battery", true, "u1", true},
+		{"wrong password", "ann@example.com", "battery staple", true, "u1", false},
+		{"deactivated account", "ann@example.com", "correct horse battery", false, "u1", false},
+		{"unknown email", "bob@example.com", "correct horse battery", true, "", false},
+	}
+
+	for _, tt := range tests {
+		db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			switch {
+			case stmt.Is("SELECT") && stmt.Mentions("count("):
+				return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+			case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+				result := &dbtest.Result{Columns: []string{"id", "email", "password", "provider", "accesses", "is_active"}}
+				if hasArg(stmt.Args, "ann@example.com") || hasArg(stmt.Args, "u1") {
+					result.Rows = [][]interface{}{{"u1", "ann@example.com", hash, "local", "{user}", tt.active}}
+				}
+				return result, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+		s := NewAuthService(repository.NewUserRepository(db), nil)
+
+		_, err := s.Login(tt.email, tt.password, SessionInfo{IP: "203.0.113.7", UserAgent: "curl/8.0"})
+		if (err == nil) != tt.wantSuccess {
+			t.Fatalf("%s: Login() = %v, want success %v", tt.name, err, tt.wantSuccess)
+		}
+
+		attempts := fake.Find("INSERT", `"login_attempts"`)
+		if len(attempts) != 1 {
+			t.Fatalf("%s: recorded %d attempts, want 1", tt.name, len(attempts))
+		}
+		want := map[string]interface{}{
+			"user_id":    tt.wantUser,
+			"email":      tt.email,
+			"ip":         "203.0.113.7",
+			"user_agent": "curl/8.0",
+			"success":    tt.wantSuccess,
+		}
+		for column, value := range want {
+			if got, _ := attempts[0].Value(column); got != value {
+				t.Errorf("%s: recorded %s = %v, want %v", tt.name, column, got, value)
+			}
+		}
+	}
+}
+
+func TestLoginAttemptsTruncateByCharacter(t *testing.T) {
+	configtest.Load(t, nil)
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") {
+			return &dbtest.Result{Columns: []string{"id"}}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	s := NewAuthService(repository.NewUserRepository(db), nil)
+
+	email := strings.Repeat("é", 300) + "@example.com"
+	userAgent := strings.Repeat("a", 511) + "ü😀"
+	if _, err := s.Login(email, "correct horse battery", SessionInfo{UserAgent: userAgent}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login() = %v, want ErrInvalidCredentials", err)
+	}
+
+	attempts := fake.Find("INSERT", `"login_attempts"`)
+	if len(attempts) != 1 {
+		t.Fatalf("recorded %d attempts, want 1", len(attempts))
+	}
+	want := map[string]string{
+		"email":      strings.Repeat("é", config.MaxFieldLength),
+		"user_agent": strings.Repeat("a", 511) + "ü",
+	}
+	for column, value := range want {
+		got, _ := attempts[0].Value(column)
+		if got != value || !utf8.ValidString(got.(string)) {
+			t.Errorf("recorded %s = %q, want %q", column, got, value)
+		}
+	}
+}
+
+// sessionQuota plays user u1 and their unexpired refresh sessions, least
+// recently used first
+type sessionQuota struct {
+	maxSessions interface{} // the user's own limit, nil for none
+	sessions    []string
+}
+
+func (s *sessionQuota) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions("count("):
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(len(s.sessions))}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "provider", "accesses", "is_active", "max_sessions"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", "local", "{user}", true, s.maxSessions}},
+		}, nil
+	case stmt.Is("DELETE") && stmt.Mentions(`"refresh_sessions"`):
+		keep := 0
+		if stmt.Mentions("NOT IN") {
+			keep = stmt.Args[len(stmt.Args)-1].(int)
+		}
+		if keep > len(s.sessions) {
+			keep = len(s.sessions)
+		}
+		pruned := len(s.sessions) - keep
+		s.sessions = s.sessions[pruned:]
+		return &dbtest.Result{Affected: int64(pruned)}, nil
+	case stmt.Is("INSERT") && stmt.Mentions(`"refresh_sessions"`):
+		id, _ := stmt.Value("id")
+		s.sessions = append(s.sessions, id.(string))
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestStartSessionEnforcesTheSessionLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		limit       int
+		userLimit   interface{}
+		sessions    []string
+		wantErr     error
+		wantKept    []string
+		wantStarted bool
+	}{
+		{"no limit", config.SessionLimitReject, 0, nil, []string{"s1", "s2", "s3"}, nil, []string{"s1", "s2", "s3"}, true},
+		{"reject under the limit", config.SessionLimitReject, 3, nil, []string{"s1", "s2"}, nil, []string{"s1", "s2"}, true},
+		{"reject at the limit", config.SessionLimitReject, 2, nil, []string{"s1", "s2"}, ErrTooManySessions, []string{"s1", "s2"}, false},
+		{"evict under the limit", config.SessionLimitEvict, 3, nil, []string{"s1", "s2"}, nil, []string{"s1", "s2"}, true},
+		{"evict at the limit drops the oldest", config.SessionLimitEvict, 2, nil, []string{"s1", "s2"}, nil, []string{"s2"}, true},
+		{"evict past a lowered limit", config.SessionLimitEvict, 2, nil, []string{"s1", "s2", "s3", "s4"}, nil, []string{"s4"}, true},
+		{"the user's own limit", config.SessionLimitEvict, 5, int64(1), []string{"s1", "s2"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		configtest.Load(t, map[string]interface{}{"auth.maxSessions": tt.limit, "auth.sessionLimit": tt.mode})
+		table := &sessionQuota{maxSessions: tt.userLimit, sessions: append([]string(nil), tt.sessions...)}
+		db, _ := dbtest.Open(t, table.answer)
+		s := NewAuthService(repository.NewUserRepository(db), nil)
+
+		user, err := repository.NewUserRepository(db).GetUserByID("u1")
+		if err != nil {
+			t.Fatalf("%s: GetUserByID() = %v", tt.name, err)
+		}
+		if _, err := s.StartSession(user, SessionInfo{}); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: StartSession() = %v, want %v", tt.name, err, tt.wantErr)
+		}
+
+		kept := table.sessions
+		if tt.wantStarted {
+			if len(kept) != len(tt.wantKept)+1 {
+				t.Errorf("%s: sessions = %v, want %v and the new one", tt.name, kept, tt.wantKept)
+				continue
+			}
+			kept = kept[:len(kept)-1]
+		}
+		if len(kept) != len(tt.wantKept) || (len(kept) > 0 && !reflect.DeepEqual(kept, tt.wantKept)) {
+			t.Errorf("%s: kept sessions %v, want %v", tt.name, kept, tt.wantKept)
+		}
+	}
+}
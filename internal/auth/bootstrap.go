@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/models"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultBootstrapName is used when auth.bootstrap.name is empty
+const defaultBootstrapName = "Administrator"
+
+// BootstrapAdmin creates the superadmin from auth.bootstrap when the database has
+// none yet, so a fresh deployment can be managed without the CLI. It does nothing
+// when bootstrapping is off or any superadmin exists, and reports whether it
+// created the account.
+func (s *AuthService) BootstrapAdmin(cfg config.BootstrapConfig) (bool, error) {
+	email := strings.TrimSpace(cfg.Email)
+	if email == "" {
+		return false, nil
+	}
+
+	admins, err := s.userRepo.GetUsersByAccess(models.AccessSuperAdmin)
+	if err != nil {
+		return false, fmt.Errorf("look up superadmins: %w", err)
+	}
+	if len(admins) > 0 {
+		return false, nil
+	}
+
+	// Promoting an existing account would hand superadmin to whoever registered
+	// the address first, so that is left to the CLI
+	existing, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		return false, fmt.Errorf("look up bootstrap email: %w", err)
+	}
+	if existing != nil {
+		return false, fmt.Errorf("%s already belongs to an account; make it an admin with the CLI instead", email)
+	}
+
+	hashedPassword, err := HashPassword(cfg.Password)
+	if err != nil {
+		return false, fmt.Errorf("hash bootstrap password: %w", err)
+	}
+
+	name := strings.TrimSpace(cfg.Name)
+	if name == "" {
+		name = defaultBootstrapName
+	}
+	if err := CheckLengths(email, name); err != nil {
+		return false, fmt.Errorf("bootstrap admin: %w", err)
+	}
+
+	user := &models.User{
+		ID:        uuid.New().String(),
+		Email:     email,
+		Password:  hashedPassword,
+		Name:      name,
+		Provider:  "local",
+		Accesses:  models.StringArray{"user", "admin", "superadmin"},
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := s.userRepo.CreateUser(user); err != nil {
+		return false, fmt.Errorf("create bootstrap admin: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/repository"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// bootstrapUsers plays the users table, optionally holding a superadmin or an
+// account that already uses the bootstrap email
+type bootstrapUsers struct {
+	superadmin bool
+	emailTaken bool
+}
+
+func (b *bootstrapUsers) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	columns := []string{"id", "email", "provider", "accesses", "is_active"}
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions("accesses @>"):
+		result := &dbtest.Result{Columns: columns}
+		if b.superadmin {
+			result.Rows = [][]interface{}{{"root", "root@example.com", "local", "{user,admin,superadmin}", true}}
+		}
+		return result, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		result := &dbtest.Result{Columns: columns}
+		if b.emailTaken {
+			result.Rows = [][]interface{}{{"u1", "admin@example.com", "local", "{user}", true}}
+		}
+		return result, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	bootstrap := config.BootstrapConfig{Email: "admin@example.com", Password: "correct horse battery"}
+
+	tests := []struct {
+		name        string
+		cfg         config.BootstrapConfig
+		users       bootstrapUsers
+		wantCreated bool
+		wantErr     bool
+	}{
+		{"empty database", bootstrap, bootstrapUsers{}, true, false},
+		{"superadmin exists", bootstrap, bootstrapUsers{superadmin: true}, false, false},
+		{"email already registered", bootstrap, bootstrapUsers{emailTaken: true}, false, true},
+		{"bootstrap off", config.BootstrapConfig{}, bootstrapUsers{}, false, false},
+	}
+
+	for _, tt := range tests {
+		configtest.Load(t, map[string]interface{}{"auth.passwordHash": PasswordHashArgon2id})
+		db, fake := dbtest.Open(t, tt.users.answer)
+		s := NewAuthService(repository.NewUserRepository(db), nil)
+
+		created, err := s.BootstrapAdmin(tt.cfg)
+		if (err != nil) != tt.wantErr || created != tt.wantCreated {
+			t.Errorf("%s: BootstrapAdmin() = %v, %v, want %v and error %v", tt.name, created, err, tt.wantCreated, tt.wantErr)
+		}
+
+		inserts := fake.Find("INSERT", `"users"`)
+		if !tt.wantCreated {
+			if len(inserts) != 0 {
+				t.Errorf("%s: created %v, want no account", tt.name, inserts)
+			}
+			continue
+		}
+		if len(inserts) != 1 {
+			t.Fatalf("%s: %d accounts created, want 1", tt.name, len(inserts))
+		}
+		if email, _ := inserts[0].Value("email"); email != "admin@example.com" {
+			t.Errorf("%s: email = %v, want admin@example.com", tt.name, email)
+		}
+		if name, _ := inserts[0].Value("name"); name != defaultBootstrapName {
+			t.Errorf("%s: name = %v, want %q", tt.name, name, defaultBootstrapName)
+		}
+		if accesses, _ := inserts[0].Value("accesses"); !strings.Contains(fmt.Sprint(accesses), "superadmin") {
+			t.Errorf("%s: accesses = %v, want superadmin", tt.name, accesses)
+		}
+		hash, _ := inserts[0].Value("password")
+		if !strings.HasPrefix(hash.(string), "$argon2id$") {
+			t.Errorf("%s: password stored as %.12s, want an argon2id hash", tt.name, hash)
+		}
+		if ok, _, err := VerifyPassword(hash.(string), bootstrap.Password); !ok || err != nil {
+			t.Errorf("%s: the stored hash doesn't verify the bootstrap password: %v", tt.name, err)
+		}
+	}
+}
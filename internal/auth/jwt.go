@@ -2,29 +2,81 @@ package auth
 
 import (
 	"bedrud-backend/config"
+	"bedrud-backend/internal/models"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// ImpersonationTokenDuration is how long an admin can act as another user per token
+const ImpersonationTokenDuration = 15 * time.Minute
+
+// RefreshTokenDuration is how long a refresh token, and the session it belongs to, stays valid
+const RefreshTokenDuration = time.Hour * 24 * 7 // 7 days
+
 type Claims struct {
-	UserID   string   `json:"userId"`
-	Email    string   `json:"email"`
-	Provider string   `json:"provider"`
-	Accesses []string `json:"accesses"`
+	UserID    string   `json:"userId"`
+	Email     string   `json:"email"`
+	Provider  string   `json:"provider"`
+	Accesses  []string `json:"accesses"`
+	SessionID string   `json:"sessionId,omitempty"`
+	// ImpersonatedBy is the ID of the admin acting as this user, if any
+	ImpersonatedBy string `json:"impersonatedBy,omitempty"`
+	// TenantID scopes the user to one tenant; empty in single-tenant deployments
+	TenantID string `json:"tenantId,omitempty"`
+	// APIKeyID is set when the request was authenticated with an API key
+	APIKeyID string `json:"apiKeyId,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID, email, provider string, accesses []string, cfg *config.Config) (string, error) {
+// CanModerateRooms reports whether the token carries staff rights over every room
+// it can reach: superadmins and global moderators. Moderators manage rooms as if
+// they were room admins but get no rights over user accounts.
+func (c *Claims) CanModerateRooms() bool {
+	for _, access := range c.Accesses {
+		if access == string(models.AccessSuperAdmin) || access == string(models.AccessMod) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessTenant reports whether the token may see resources of the given tenant.
+// Tokens only reach their own tenant, except superadmins without a tenant, who
+// operate the whole deployment.
+func (c *Claims) CanAccessTenant(tenantID string) bool {
+	if c.TenantID == tenantID {
+		return true
+	}
+	if c.TenantID != "" {
+		return false
+	}
+	for _, access := range c.Accesses {
+		if access == "superadmin" {
+			return true
+		}
+	}
+	return false
+}
+
+func GenerateToken(userID, email, provider string, accesses []string, tenantID string, cfg *config.Config) (string, error) {
+	return GenerateSessionToken(userID, email, provider, accesses, tenantID, "", cfg)
+}
+
+// GenerateSessionToken generates an access token that carries the session it was issued for
+func GenerateSessionToken(userID, email, provider string, accesses []string, tenantID, sessionID string, cfg *config.Config) (string, error) {
 	expirationTime := time.Now().Add(time.Duration(cfg.Auth.TokenDuration) * time.Hour)
 
 	claims := &Claims{
-		UserID:   userID,
-		Email:    email,
-		Provider: provider,
-		Accesses: accesses,
+		UserID:    userID,
+		Email:     email,
+		Provider:  provider,
+		Accesses:  accesses,
+		SessionID: sessionID,
+		TenantID:  tenantID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -40,6 +92,8 @@ func GenerateToken(userID, email, provider string, accesses []string, cfg *confi
 	return tokenString, nil
 }
 
+// ValidateToken parses a token and checks its signature. Only algorithms in
+// auth.allowedAlgorithms are accepted, whatever key the token claims to use.
 func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -47,7 +101,7 @@ func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(cfg.Auth.JWTSecret), nil
-	})
+	}, jwt.WithValidMethods(allowedAlgorithms(cfg)))
 
 	if err != nil {
 		return nil, err
@@ -60,21 +114,63 @@ func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
 	return claims, nil
 }
 
+// GenerateImpersonationToken issues a short-lived access token for userID that
+// records which admin is acting as them. No refresh token is issued.
+func GenerateImpersonationToken(userID, email, provider string, accesses []string, tenantID, adminID string, cfg *config.Config) (string, error) {
+	claims := &Claims{
+		UserID:         userID,
+		Email:          email,
+		Provider:       provider,
+		Accesses:       accesses,
+		ImpersonatedBy: adminID,
+		TenantID:       tenantID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ImpersonationTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(cfg.Auth.JWTSecret))
+}
+
+// allowedAlgorithms returns the configured algorithm allowlist, never including "none"
+func allowedAlgorithms(cfg *config.Config) []string {
+	algorithms := make([]string, 0, len(cfg.Auth.AllowedAlgorithms))
+	for _, alg := range cfg.Auth.AllowedAlgorithms {
+		if !strings.EqualFold(alg, "none") {
+			algorithms = append(algorithms, alg)
+		}
+	}
+	if len(algorithms) == 0 {
+		algorithms = append(algorithms, jwt.SigningMethodHS256.Alg())
+	}
+	return algorithms
+}
+
 func GenerateTokenPair(userID, email string, accesses []string, cfg *config.Config) (string, string, error) {
+	return GenerateSessionTokenPair(userID, email, accesses, "", "", cfg)
+}
+
+// GenerateSessionTokenPair generates a token pair whose refresh token is bound to the given session
+func GenerateSessionTokenPair(userID, email string, accesses []string, tenantID, sessionID string, cfg *config.Config) (string, string, error) {
 	// Generate access token
-	accessToken, err := GenerateToken(userID, email, "local", accesses, cfg)
+	accessToken, err := GenerateSessionToken(userID, email, "local", accesses, tenantID, sessionID, cfg)
 	if err != nil {
 		return "", "", err
 	}
 
 	// Generate refresh token
 	refreshClaims := &Claims{
-		UserID:   userID,
-		Email:    email,
-		Provider: "local",
-		Accesses: accesses,
+		UserID:    userID,
+		Email:     email,
+		Provider:  "local",
+		Accesses:  accesses,
+		SessionID: sessionID,
+		TenantID:  tenantID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)), // 7 days
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ID:        uuid.New().String(),
 		},
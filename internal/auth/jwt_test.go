@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/configtest"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "a-test-secret-that-is-long-enough-to-use"
+
+func testClaims() *Claims {
+	return &Claims{
+		UserID:   "u1",
+		Email:    "ann@example.com",
+		Accesses: []string{"user"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestValidateTokenAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() = %v", err)
+	}
+	sign := func(method jwt.SigningMethod, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, testClaims()).SignedString(key)
+		if err != nil {
+			t.Fatalf("signing with %s: %v", method.Alg(), err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		token   string
+		wantErr bool
+	}{
+		{"allowed algorithm", []string{"HS256"}, sign(jwt.SigningMethodHS256, []byte(testSecret)), false},
+		{"disallowed algorithm", []string{"HS256"}, sign(jwt.SigningMethodHS512, []byte(testSecret)), true},
+		{"second allowed algorithm", []string{"HS256", "HS512"}, sign(jwt.SigningMethodHS512, []byte(testSecret)), false},
+		{"empty allowlist falls back to HS256", nil, sign(jwt.SigningMethodHS384, []byte(testSecret)), true},
+		{"none algorithm", []string{"HS256"}, sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType), true},
+		{"none algorithm even when listed", []string{"HS256", "none"}, sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType), true},
+		{"RSA algorithm listed without an RSA key", []string{"HS256", "RS256"}, sign(jwt.SigningMethodRS256, rsaKey), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Auth: config.AuthConfig{JWTSecret: testSecret, AllowedAlgorithms: tt.allowed}}
+			claims, err := ValidateToken(tt.token, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateToken() = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && claims.UserID != "u1" {
+				t.Errorf("UserID = %q, want u1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsTheWrongSecret(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("someone-elses-secret"))
+	if err != nil {
+		t.Fatalf("SignedString() = %v", err)
+	}
+	cfg := &config.Config{Auth: config.AuthConfig{JWTSecret: testSecret, AllowedAlgorithms: []string{"HS256"}}}
+	if _, err := ValidateToken(token, cfg); err == nil {
+		t.Error("ValidateToken() accepted a token signed with another secret")
+	}
+}
+
+func TestTokensCarryTheTenant(t *testing.T) {
+	cfg := configtest.Load(t, nil)
+
+	for _, tenantID := range []string{"acme", ""} {
+		token, err := GenerateToken("u1", "ann@example.com", "local", []string{"user"}, tenantID, cfg)
+		if err != nil {
+			t.Fatalf("GenerateToken() = %v", err)
+		}
+		claims, err := ValidateToken(token, cfg)
+		if err != nil {
+			t.Fatalf("ValidateToken() = %v", err)
+		}
+		if claims.TenantID != tenantID {
+			t.Errorf("TenantID = %q, want %q", claims.TenantID, tenantID)
+		}
+	}
+}
+
+func TestCanAccessTenant(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   Claims
+		tenantID string
+		want     bool
+	}{
+		{"single tenant", Claims{Accesses: []string{"user"}}, "", true},
+		{"own tenant", Claims{TenantID: "acme", Accesses: []string{"user"}}, "acme", true},
+		{"other tenant", Claims{TenantID: "acme", Accesses: []string{"superadmin"}}, "globex", false},
+		{"tenant token on a global resource", Claims{TenantID: "acme", Accesses: []string{"superadmin"}}, "", false},
+		{"global user on a tenant resource", Claims{Accesses: []string{"user", "admin"}}, "acme", false},
+		{"global superadmin on a tenant resource", Claims{Accesses: []string{"superadmin"}}, "acme", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.claims.CanAccessTenant(tt.tenantID); got != tt.want {
+			t.Errorf("%s: CanAccessTenant(%q) = %v, want %v", tt.name, tt.tenantID, got, tt.want)
+		}
+	}
+}
+
+func TestCanModerateRooms(t *testing.T) {
+	tests := []struct {
+		accesses []string
+		want     bool
+	}{
+		{[]string{"superadmin"}, true},
+		{[]string{"user", "moderator"}, true},
+		{[]string{"user", "admin"}, false},
+		{[]string{"user", "guest"}, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		claims := Claims{Accesses: tt.accesses}
+		if got := claims.CanModerateRooms(); got != tt.want {
+			t.Errorf("CanModerateRooms() with %v = %v, want %v", tt.accesses, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms selectable with auth.passwordHash
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+// ErrUnknownPasswordHash is returned for stored hashes no hasher recognises
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHasher hashes and verifies passwords for one algorithm.
+// Hashes carry their own prefix so the algorithm can be told from the stored value.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	// Handles reports whether the stored hash was produced by this hasher
+	Handles(hash string) bool
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (h bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h bcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h bcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type argon2idHasher struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	saltLen int
+	keyLen  uint32
+}
+
+func (h argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, h.keyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h argon2idHasher) Verify(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrUnknownPasswordHash
+	}
+
+	// Parameters come from the stored hash so older settings keep verifying
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, ErrUnknownPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrUnknownPasswordHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, ErrUnknownPasswordHash
+	}
+
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+func (h argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+var passwordHashers = map[string]PasswordHasher{
+	PasswordHashBcrypt: bcryptHasher{cost: bcrypt.DefaultCost},
+	// OWASP's recommended argon2id baseline: 19 MiB, 2 iterations, 1 lane
+	PasswordHashArgon2id: argon2idHasher{memory: 19 * 1024, time: 2, threads: 1, saltLen: 16, keyLen: 32},
+}
+
+// configuredHasher returns the hasher selected in config, defaulting to bcrypt
+func configuredHasher() (string, PasswordHasher) {
+	name := config.Get().Auth.PasswordHash
+	if hasher, ok := passwordHashers[name]; ok {
+		return name, hasher
+	}
+	return PasswordHashBcrypt, passwordHashers[PasswordHashBcrypt]
+}
+
+// HashPassword hashes a password with the configured algorithm
+func HashPassword(password string) (string, error) {
+	_, hasher := configuredHasher()
+	return hasher.Hash(password)
+}
+
+// VerifyPassword checks a password against a stored hash of any supported algorithm.
+// needsRehash is set when the password matched but the hash uses a different
+// algorithm than the one currently configured.
+func VerifyPassword(hash, password string) (ok, needsRehash bool, err error) {
+	current, _ := configuredHasher()
+	for name, hasher := range passwordHashers {
+		if !hasher.Handles(hash) {
+			continue
+		}
+		ok, err = hasher.Verify(hash, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, name != current, nil
+	}
+	return false, false, ErrUnknownPasswordHash
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// verifyDummyPassword runs a password check against a throwaway hash of the
+// configured algorithm, for login attempts against accounts that don't exist.
+// It is a variable so tests can see it run.
+var verifyDummyPassword = func(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy-password-for-timing")
+	})
+	_, _, _ = VerifyPassword(dummyHash, password)
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/repository"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndVerifyPassword(t *testing.T) {
+	tests := []struct {
+		algorithm  string
+		wantPrefix string
+	}{
+		{PasswordHashBcrypt, "$2a$"},
+		{PasswordHashArgon2id, "$argon2id$v=19$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			configtest.Load(t, map[string]interface{}{"auth.passwordHash": tt.algorithm})
+
+			hash, err := HashPassword("correct horse battery")
+			if err != nil {
+				t.Fatalf("HashPassword() = %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.wantPrefix) {
+				t.Errorf("hash = %q, want the %q prefix", hash, tt.wantPrefix)
+			}
+			if again, _ := HashPassword("correct horse battery"); again == hash {
+				t.Error("hashing the same password twice gave the same hash")
+			}
+
+			ok, needsRehash, err := VerifyPassword(hash, "correct horse battery")
+			if err != nil || !ok || needsRehash {
+				t.Errorf("VerifyPassword(right password) = %v, %v, %v, want true, false, nil", ok, needsRehash, err)
+			}
+			ok, needsRehash, err = VerifyPassword(hash, "wrong horse battery")
+			if err != nil || ok || needsRehash {
+				t.Errorf("VerifyPassword(wrong password) = %v, %v, %v, want false, false, nil", ok, needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordAcrossAlgorithms(t *testing.T) {
+	bcryptHash, err := passwordHashers[PasswordHashBcrypt].Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := passwordHashers[PasswordHashArgon2id].Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		configured      string
+		hash            string
+		wantNeedsRehash bool
+	}{
+		{PasswordHashArgon2id, bcryptHash, true},
+		{PasswordHashBcrypt, argonHash, true},
+		{PasswordHashArgon2id, argonHash, false},
+		{PasswordHashBcrypt, bcryptHash, false},
+	}
+
+	for _, tt := range tests {
+		configtest.Load(t, map[string]interface{}{"auth.passwordHash": tt.configured})
+		ok, needsRehash, err := VerifyPassword(tt.hash, "correct horse battery")
+		if err != nil || !ok || needsRehash != tt.wantNeedsRehash {
+			t.Errorf("%s configured, hash %.12s: VerifyPassword() = %v, %v, %v, want true, %v, nil", tt.configured, tt.hash, ok, needsRehash, err, tt.wantNeedsRehash)
+		}
+	}
+}
+
+func TestVerifyPasswordRejectsUnknownHashes(t *testing.T) {
+	configtest.Load(t, nil)
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$broken", "$argon2id$v=18$m=19456,t=2,p=1$c2FsdA$a2V5"} {
+		if ok, _, err := VerifyPassword(hash, "plaintext"); ok || !errors.Is(err, ErrUnknownPasswordHash) {
+			t.Errorf("VerifyPassword(%q) = %v, %v, want false, ErrUnknownPasswordHash", hash, ok, err)
+		}
+	}
+}
+
+// passwordRow plays user u1 whose stored password hash follows UpdatePassword
+type passwordRow struct {
+	mu      sync.Mutex
+	hash    string
+	updates int
+}
+
+func (p *passwordRow) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case stmt.Is("UPDATE") && stmt.Mentions(`"users"`):
+		if hash, ok := stmt.Value("password"); ok {
+			p.hash = hash.(string)
+			p.updates++
+		}
+	case stmt.Is("SELECT") && stmt.Mentions("count("):
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "password", "provider", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", p.hash, "local", "{user}", true}},
+		}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestLoginRehashesOldPasswords(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		configured  string
+		wantUpdates int
+		wantPrefix  string
+	}{
+		{PasswordHashArgon2id, 1, "$argon2id$"},
+		{PasswordHashBcrypt, 0, "$2a$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.configured, func(t *testing.T) {
+			configtest.Load(t, map[string]interface{}{"auth.passwordHash": tt.configured})
+			row := &passwordRow{hash: string(bcryptHash)}
+			db, _ := dbtest.Open(t, row.answer)
+			s := NewAuthService(repository.NewUserRepository(db), nil)
+
+			if _, err := s.Login("ann@example.com", "wrong horse battery", SessionInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("Login(wrong password) = %v, want ErrInvalidCredentials", err)
+			}
+			if row.updates != 0 {
+				t.Fatal("a failed login rehashed the password")
+			}
+
+			if _, err := s.Login("ann@example.com", "correct horse battery", SessionInfo{}); err != nil {
+				t.Fatalf("Login() = %v", err)
+			}
+			if row.updates != tt.wantUpdates || !strings.HasPrefix(row.hash, tt.wantPrefix) {
+				t.Fatalf("%d password updates leaving %.12s, want %d leaving a %s hash", row.updates, row.hash, tt.wantUpdates, tt.wantPrefix)
+			}
+
+			if _, err := s.Login("ann@example.com", "correct horse battery", SessionInfo{}); err != nil {
+				t.Fatalf("Login() with the rehashed password = %v", err)
+			}
+			if row.updates != tt.wantUpdates {
+				t.Errorf("the second login rehashed again: %d updates", row.updates)
+			}
+		})
+	}
+}
+
+func TestLoginFailuresLookAlike(t *testing.T) {
+	configtest.Load(t, nil)
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() = %v", err)
+	}
+	passwords := map[string]string{"ann@example.com": hash, "oauth@example.com": ""}
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions("count("):
+			return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+			result := &dbtest.Result{Columns: []string{"id", "email", "password", "provider", "accesses", "is_active"}}
+			key, _ := stmt.Args[0].(string)
+			if key == "u1" {
+				// Starting a session looks Ann up by ID
+				key = "ann@example.com"
+			}
+			if password, ok := passwords[key]; ok {
+				result.Rows = [][]interface{}{{"u1", key, password, "local", "{user}", true}}
+			}
+			return result, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	s := NewAuthService(repository.NewUserRepository(db), nil)
+
+	var dummies int
+	original := verifyDummyPassword
+	verifyDummyPassword = func(password string) {
+		dummies++
+		original(password)
+	}
+	t.Cleanup(func() { verifyDummyPassword = original })
+
+	tests := []struct {
+		name        string
+		email       string
+		password    string
+		wantErr     error
+		wantDummies int
+	}{
+		{"unknown email", "bob@example.com", "correct horse battery", ErrInvalidCredentials, 1},
+		{"wrong password", "ann@example.com", "wrong horse battery", ErrInvalidCredentials, 0},
+		{"account without a password", "oauth@example.com", "correct horse battery", ErrInvalidCredentials, 1},
+		{"right password", "ann@example.com", "correct horse battery", nil, 0},
+	}
+
+	for _, tt := range tests {
+		dummies = 0
+		_, err := s.Login(tt.email, tt.password, SessionInfo{})
+		if err != tt.wantErr {
+			t.Errorf("%s: Login() = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if dummies != tt.wantDummies {
+			t.Errorf("%s: %d dummy password checks, want %d", tt.name, dummies, tt.wantDummies)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Refresh token schemes selectable with auth.refreshTokenScheme
+const (
+	RefreshSchemeJWT    = "jwt"
+	RefreshSchemeOpaque = "opaque"
+)
+
+// randomToken returns 256 bits of randomness, URL-safe encoded
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex SHA-256 of a token; only hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// rotatedToken derives the token a refresh token is rotated to from the old
+// token and a random salt, so a parallel refresh holding the old token can be
+// handed the same replacement without storing it
+func rotatedToken(refreshToken, salt string) string {
+	mac := hmac.New(sha256.New, []byte(refreshToken))
+	mac.Write([]byte(salt))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isOpaqueToken tells opaque refresh tokens apart from JWTs, which always contain dots
+func isOpaqueToken(token string) bool {
+	return token != "" && !strings.Contains(token, ".")
+}
+
+// refreshOpaque validates an opaque refresh token by lookup and rotates it to
+// a new token
+func (s *AuthService) refreshOpaque(refreshToken string) (*TokenPair, error) {
+	tokenHash := hashToken(refreshToken)
+	session, err := s.userRepo.GetSessionByTokenHash(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return s.refreshRetired(refreshToken, tokenHash)
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.refreshUser(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := randomToken()
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+	newRefreshToken := rotatedToken(refreshToken, salt)
+
+	// Rotation is conditional on the old hash so a token can only be redeemed once
+	rotated, err := s.userRepo.RotateSessionToken(session.ID, tokenHash, hashToken(newRefreshToken), salt, session.ExpiresAt, time.Now().Add(RefreshTokenDuration))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another refresh redeemed it first; within the grace window it is
+		// handed the same new token
+		return s.refreshRetired(refreshToken, tokenHash)
+	}
+
+	return s.opaqueTokenPair(user, session.ID, newRefreshToken)
+}
+
+// refreshRetired handles a refresh with a token that isn't current. The token
+// a session was just rotated away from still refreshes to the same new token
+// within auth.refreshReuseGrace, so parallel refreshes don't sign the user out.
+// Any other token from a session's lineage means the token chain may be in two
+// hands, so the whole session is revoked.
+func (s *AuthService) refreshRetired(refreshToken, tokenHash string) (*TokenPair, error) {
+	retired, err := s.userRepo.GetRetiredRefreshToken(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if retired == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	grace := time.Duration(config.Get().Auth.RefreshReuseGrace) * time.Second
+	if grace > 0 && retired.NextTokenSalt != "" && time.Since(retired.RetiredAt) <= grace {
+		// Only the immediately previous token derives the session's current token
+		nextToken := rotatedToken(refreshToken, retired.NextTokenSalt)
+		session, err := s.userRepo.GetSessionByTokenHash(hashToken(nextToken))
+		if err != nil {
+			return nil, err
+		}
+		if session != nil && session.ID == retired.SessionID && time.Now().Before(session.ExpiresAt) {
+			user, err := s.refreshUser(session.UserID)
+			if err != nil {
+				return nil, err
+			}
+			return s.opaqueTokenPair(user, session.ID, nextToken)
+		}
+	}
+
+	log.Warn().Str("sessionId", retired.SessionID).Msg("Rotated refresh token reused, revoking session")
+	if err := s.userRepo.DeleteSession(retired.SessionID); err != nil {
+		return nil, err
+	}
+	return nil, ErrInvalidRefreshToken
+}
+
+// refreshUser returns the active user a refresh is for. Tokens are issued from
+// the stored user, never from the old token, so changed accesses or tenant
+// take effect on the next refresh.
+func (s *AuthService) refreshUser(userID string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, ErrInvalidRefreshToken
+	}
+	return user, nil
+}
+
+// opaqueTokenPair pairs an opaque refresh token with a fresh access token for the session
+func (s *AuthService) opaqueTokenPair(user *models.User, sessionID, refreshToken string) (*TokenPair, error) {
+	accessToken, err := GenerateSessionToken(user.ID, user.Email, "local", user.Accesses, user.TenantID, sessionID, config.Get())
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sessionTable plays the refresh session tables for user u1
+type sessionTable struct {
+	// rowLock is the session row lock a rotation holds until its transaction
+	// commits, so a parallel rotation waits and then finds the token retired
+	rowLock sync.Mutex
+	pending func() // the holder's rotation, applied when it commits
+
+	mu       sync.Mutex
+	sessions map[string]string // session ID -> current token hash
+	expires  map[string]time.Time
+	retired  map[string]*retiredRow // retired token hash -> lineage entry
+}
+
+type retiredRow struct {
+	sessionID string
+	salt      string
+	retiredAt time.Time
+}
+
+func newSessionTable() *sessionTable {
+	return &sessionTable{sessions: map[string]string{}, expires: map[string]time.Time{}, retired: map[string]*retiredRow{}}
+}
+
+func (s *sessionTable) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	if stmt.Is("UPDATE") && stmt.Mentions(`"refresh_sessions"`) && stmt.Mentions(`"token_hash"=`) {
+		return s.rotate(stmt), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionColumns := []string{"id", "user_id", "token_hash", "expires_at"}
+	switch {
+	case stmt.Is("INSERT") && stmt.Mentions(`"refresh_sessions"`):
+		id, _ := stmt.Value("id")
+		hash, _ := stmt.Value("token_hash")
+		expiresAt, _ := stmt.Value("expires_at")
+		s.sessions[id.(string)] = hash.(string)
+		s.expires[id.(string)] = expiresAt.(time.Time)
+	case stmt.Is("INSERT") && stmt.Mentions(`"retired_refresh_tokens"`):
+		hash, _ := stmt.Value("token_hash")
+		id, _ := stmt.Value("session_id")
+		salt, _ := stmt.Value("next_token_salt")
+		s.retired[hash.(string)] = &retiredRow{sessionID: id.(string), salt: salt.(string), retiredAt: time.Now()}
+		// The retired row is the rotation's last statement; commit it
+		if s.pending != nil {
+			s.pending()
+			s.pending = nil
+			s.rowLock.Unlock()
+		}
+	case stmt.Is("SELECT") && stmt.Mentions(`"refresh_sessions"`) && stmt.Mentions("token_hash"):
+		result := &dbtest.Result{Columns: sessionColumns}
+		for id, hash := range s.sessions {
+			if hash == stmt.Args[0] {
+				result.Rows = append(result.Rows, []interface{}{id, "u1", hash, s.expires[id]})
+			}
+		}
+		return result, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"retired_refresh_tokens"`):
+		result := &dbtest.Result{Columns: []string{"token_hash", "session_id", "next_token_salt", "retired_at"}}
+		if row, ok := s.retired[stmt.Args[0].(string)]; ok {
+			result.Rows = [][]interface{}{{stmt.Args[0], row.sessionID, row.salt, row.retiredAt}}
+		}
+		return result, nil
+	case stmt.Is("DELETE") && stmt.Mentions(`"refresh_sessions"`):
+		var deleted int64
+		for id, hash := range s.sessions {
+			if hasValue(stmt.Args, id) || hasValue(stmt.Args, hash) {
+				delete(s.sessions, id)
+				deleted++
+			}
+		}
+		return &dbtest.Result{Affected: deleted}, nil
+	case stmt.Is("SELECT") && stmt.Mentions("count("):
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(len(s.sessions))}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", "{user}", true}},
+		}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+// rotate plays the conditional token UPDATE. A matching rotation keeps the row
+// locked and stays invisible to other statements until it commits.
+func (s *sessionTable) rotate(stmt dbtest.Statement) *dbtest.Result {
+	s.rowLock.Lock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newHash, _ := stmt.Value("token_hash")
+	expiresAt, _ := stmt.Value("expires_at")
+	id, oldHash := stmt.Args[len(stmt.Args)-2].(string), stmt.Args[len(stmt.Args)-1]
+	if s.sessions[id] != oldHash {
+		s.rowLock.Unlock()
+		return &dbtest.Result{}
+	}
+	s.pending = func() {
+		s.sessions[id] = newHash.(string)
+		s.expires[id] = expiresAt.(time.Time)
+	}
+	return &dbtest.Result{Affected: 1}
+}
+
+// age moves a retired token's retirement back by d
+func (s *sessionTable) age(token string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retired[hashToken(token)].retiredAt = s.retired[hashToken(token)].retiredAt.Add(-d)
+}
+
+func (s *sessionTable) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func hasValue(args []interface{}, value interface{}) bool {
+	for _, arg := range args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newOpaqueTestService(t *testing.T, grace int) (*AuthService, *sessionTable) {
+	t.Helper()
+
+	configtest.Load(t, map[string]interface{}{"auth.refreshTokenScheme": RefreshSchemeOpaque, "auth.refreshReuseGrace": grace})
+	table := newSessionTable()
+	db, _ := dbtest.Open(t, table.answer)
+	return NewAuthService(repository.NewUserRepository(db), nil), table
+}
+
+var testUser = &models.User{ID: "u1", Email: "ann@example.com", Accesses: models.StringArray{"user"}, IsActive: true}
+
+func TestOpaqueRefreshTokens(t *testing.T) {
+	s, table := newOpaqueTestService(t, 10)
+
+	issued, err := s.StartSession(testUser, SessionInfo{})
+	if err != nil {
+		t.Fatalf("StartSession() = %v", err)
+	}
+	if !isOpaqueToken(issued.RefreshToken) {
+		t.Fatalf("refresh token %q isn't opaque", issued.RefreshToken)
+	}
+	for _, hash := range table.sessions {
+		if hash != hashToken(issued.RefreshToken) {
+			t.Errorf("stored %q, want the token's hash", hash)
+		}
+	}
+
+	refreshed, err := s.Refresh(issued.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() = %v", err)
+	}
+	if refreshed.RefreshToken == issued.RefreshToken || !isOpaqueToken(refreshed.RefreshToken) {
+		t.Errorf("refresh returned %q, want a new opaque token", refreshed.RefreshToken)
+	}
+	if claims, err := ValidateToken(refreshed.AccessToken, config.Get()); err != nil || claims.UserID != "u1" {
+		t.Errorf("access token claims %+v, %v, want u1", claims, err)
+	}
+
+	if err := s.BlockRefreshToken("u1", refreshed.RefreshToken); err != nil {
+		t.Fatalf("BlockRefreshToken() = %v", err)
+	}
+	if table.count() != 0 {
+		t.Errorf("%d sessions left after revoking, want 0", table.count())
+	}
+	if _, err := s.Refresh(refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() with a revoked token = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestOpaqueRefreshTokenReuseAfterTheGraceWindow(t *testing.T) {
+	tests := []struct {
+		name  string
+		grace int
+		age   time.Duration // how long ago the token was rotated away
+	}{
+		{"well after the window", 10, time.Minute},
+		{"window disabled", 0, 0},
+	}
+
+	for _, tt := range tests {
+		s, table := newOpaqueTestService(t, tt.grace)
+
+		issued, err := s.StartSession(testUser, SessionInfo{})
+		if err != nil {
+			t.Fatalf("%s: StartSession() = %v", tt.name, err)
+		}
+		refreshed, err := s.Refresh(issued.RefreshToken)
+		if err != nil {
+			t.Fatalf("%s: Refresh() = %v", tt.name, err)
+		}
+		table.age(issued.RefreshToken, tt.age)
+
+		if _, err := s.Refresh(issued.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("%s: Refresh() with a rotated token = %v, want ErrInvalidRefreshToken", tt.name, err)
+		}
+		if table.count() != 0 {
+			t.Errorf("%s: reusing a rotated token left the session alive", tt.name)
+		}
+		if _, err := s.Refresh(refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("%s: Refresh() after reuse = %v, want ErrInvalidRefreshToken", tt.name, err)
+		}
+	}
+}
+
+func TestOpaqueRefreshTokenReuseAnywhereInTheLineage(t *testing.T) {
+	s, table := newOpaqueTestService(t, 10)
+
+	issued, err := s.StartSession(testUser, SessionInfo{})
+	if err != nil {
+		t.Fatalf("StartSession() = %v", err)
+	}
+	current := issued.RefreshToken
+	for i := 0; i < 3; i++ {
+		refreshed, err := s.Refresh(current)
+		if err != nil {
+			t.Fatalf("Refresh() %d = %v", i+1, err)
+		}
+		current = refreshed.RefreshToken
+	}
+
+	// The first token was rotated away three refreshes ago, so even within
+	// the grace window it is reuse
+	if _, err := s.Refresh(issued.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh() with an old token = %v, want ErrInvalidRefreshToken", err)
+	}
+	if table.count() != 0 {
+		t.Error("reusing an old token left the session alive")
+	}
+	if _, err := s.Refresh(current); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() after reuse = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestParallelOpaqueRefreshesWithinTheGraceWindow(t *testing.T) {
+	s, table := newOpaqueTestService(t, 10)
+
+	issued, err := s.StartSession(testUser, SessionInfo{})
+	if err != nil {
+		t.Fatalf("StartSession() = %v", err)
+	}
+
+	const refreshes = 2
+	pairs := make(chan *TokenPair, refreshes)
+	errs := make(chan error, refreshes)
+	var wg sync.WaitGroup
+	for i := 0; i < refreshes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pair, err := s.Refresh(issued.RefreshToken)
+			if err != nil {
+				errs <- err
+				return
+			}
+			pairs <- pair
+		}()
+	}
+	wg.Wait()
+	close(pairs)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Refresh() = %v, want both parallel refreshes to succeed", err)
+	}
+	var tokens []string
+	for pair := range pairs {
+		tokens = append(tokens, pair.RefreshToken)
+	}
+	if len(tokens) != refreshes || tokens[0] != tokens[1] {
+		t.Fatalf("parallel refreshes returned %q, want the same new token twice", tokens)
+	}
+	if table.count() != 1 {
+		t.Fatal("parallel refreshes revoked the session")
+	}
+	if _, err := s.Refresh(tokens[0]); err != nil {
+		t.Errorf("Refresh() with the shared new token = %v", err)
+	}
+}
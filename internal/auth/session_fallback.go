@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/rs/zerolog/log"
+)
+
+// maxSessionCookieValue is the largest encoded session kept in the cookie.
+// Browsers drop cookies over 4096 bytes including name and attributes, which
+// some providers' ID tokens push the OAuth state past.
+const maxSessionCookieValue = 3800
+
+// serverSessionSuffix names the cookie holding the ID of a session whose
+// values live on the server
+const serverSessionSuffix = "_server"
+
+// sessionFilePrefix is what FilesystemStore starts its session file names with
+const sessionFilePrefix = "session_"
+
+// defaultSessionFileAge keeps the files of sessions whose cookie only lasts
+// for the browser session (maxAge 0)
+const defaultSessionFileAge = 24 * time.Hour
+
+// fallbackStore keeps sessions in a cookie and moves one whose encoded values
+// would be too large for a cookie into a file on the server; the browser then
+// only holds the session ID. Which store holds a session is told by the cookie
+// name, and a session that shrinks moves back into the cookie.
+type fallbackStore struct {
+	cookie *sessions.CookieStore
+	server *sessions.FilesystemStore
+	dir    string
+}
+
+func newFallbackStore(secret []byte, dir string, options *sessions.Options) (*fallbackStore, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "bedrud-sessions")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	cookie := sessions.NewCookieStore(secret)
+	cookie.Options = options
+	// The size is checked in Save, so the codecs mustn't reject long values first
+	for _, codec := range cookie.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxLength(0)
+		}
+	}
+
+	server := sessions.NewFilesystemStore(dir, secret)
+	server.MaxLength(0)
+	serverOptions := *options
+	server.Options = &serverOptions
+
+	return &fallbackStore{cookie: cookie, server: server, dir: dir}, nil
+}
+
+// Get returns a session for the given name after adding it to the registry
+func (s *fallbackStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the named session from whichever store holds it. The session is
+// bound to the fallback store so saving it goes through Save.
+func (s *fallbackStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	var (
+		loaded *sessions.Session
+		err    error
+	)
+	if _, cookieErr := r.Cookie(name + serverSessionSuffix); cookieErr == nil {
+		loaded, err = s.server.New(r, name+serverSessionSuffix)
+	} else {
+		loaded, err = s.cookie.New(r, name)
+	}
+
+	session := sessions.NewSession(s, name)
+	session.ID = loaded.ID
+	session.Values = loaded.Values
+	session.Options = loaded.Options
+	session.IsNew = loaded.IsNew
+	return session, err
+}
+
+// Save writes the session to the cookie when it fits, and to the server otherwise
+func (s *fallbackStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// Only sessions held on the server have an ID
+	server := sessions.NewSession(s.server, session.Name()+serverSessionSuffix)
+	server.ID = session.ID
+	server.Values = session.Values
+	serverOptions := *session.Options
+	if serverOptions.MaxAge == 0 {
+		serverOptions.MaxAge = int(defaultSessionFileAge.Seconds())
+	}
+	server.Options = &serverOptions
+
+	if session.Options.MaxAge < 0 {
+		// Deleting the session clears both copies
+		if server.ID != "" {
+			if err := s.server.Save(r, w, server); err != nil {
+				return err
+			}
+			session.ID = ""
+		}
+		return s.cookie.Save(r, w, session)
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.cookie.Codecs...)
+	if err != nil {
+		return err
+	}
+	if len(encoded) <= maxSessionCookieValue {
+		if server.ID != "" {
+			// Back under the limit, so the server copy is no longer needed
+			server.Options.MaxAge = -1
+			if err := s.server.Save(r, w, server); err != nil {
+				return err
+			}
+			session.ID = ""
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		return nil
+	}
+
+	if server.ID == "" {
+		log.Warn().
+			Str("session", session.Name()).
+			Int("size", len(encoded)).
+			Msg("Session too large for a cookie, storing it on the server instead")
+	}
+	if err := s.server.Save(r, w, server); err != nil {
+		return err
+	}
+	session.ID = server.ID
+
+	// Expire the cookie copy from before the session grew
+	expired := *session.Options
+	expired.MaxAge = -1
+	http.SetCookie(w, sessions.NewCookie(session.Name(), "", &expired))
+	return nil
+}
+
+// cleanup removes session files not written to for longer than maxAge
+func (s *fallbackStore) cleanup(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), sessionFilePrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
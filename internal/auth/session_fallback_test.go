@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+const testSessionName = "oauth"
+
+// browser keeps the cookies a store sets across requests, the way a browser would
+type browser struct {
+	cookies map[string]*http.Cookie
+}
+
+func (b *browser) request() *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/auth/google/login", nil)
+	for _, cookie := range b.cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func (b *browser) keep(w *httptest.ResponseRecorder) {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(b.cookies, cookie.Name)
+		} else {
+			b.cookies[cookie.Name] = cookie
+		}
+	}
+}
+
+func newTestFallbackStore(t *testing.T) (*fallbackStore, *browser) {
+	t.Helper()
+
+	store, err := newFallbackStore([]byte("0123456789abcdef0123456789abcdef"), t.TempDir(), &sessions.Options{
+		Path:     "/",
+		MaxAge:   3600,
+		HttpOnly: true,
+	})
+	if err != nil {
+		t.Fatalf("newFallbackStore() = %v", err)
+	}
+	return store, &browser{cookies: make(map[string]*http.Cookie)}
+}
+
+// save stores value in the session and keeps the cookies the store sets
+func save(t *testing.T, store *fallbackStore, b *browser, value string) {
+	t.Helper()
+
+	r := b.request()
+	session, err := store.Get(r, testSessionName)
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	session.Values["state"] = value
+
+	w := httptest.NewRecorder()
+	if err := session.Save(r, w); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+	b.keep(w)
+}
+
+func load(t *testing.T, store *fallbackStore, b *browser) string {
+	t.Helper()
+
+	session, err := store.Get(b.request(), testSessionName)
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	value, _ := session.Values["state"].(string)
+	return value
+}
+
+func sessionFiles(t *testing.T, store *fallbackStore) int {
+	t.Helper()
+
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		t.Fatalf("ReadDir() = %v", err)
+	}
+	n := 0
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), sessionFilePrefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// oversizedValue is too large to fit in a cookie once encoded
+func oversizedValue(t *testing.T) string {
+	t.Helper()
+
+	buf := make([]byte, maxSessionCookieValue)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatalf("rand.Read() = %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func TestSmallSessionStaysInCookie(t *testing.T) {
+	store, b := newTestFallbackStore(t)
+
+	save(t, store, b, "small")
+
+	if _, ok := b.cookies[testSessionName]; !ok {
+		t.Error("no session cookie was set")
+	}
+	if _, ok := b.cookies[testSessionName+serverSessionSuffix]; ok {
+		t.Error("a small session was moved to the server")
+	}
+	if n := sessionFiles(t, store); n != 0 {
+		t.Errorf("%d session files written, want 0", n)
+	}
+	if got := load(t, store, b); got != "small" {
+		t.Errorf("loaded %q, want %q", got, "small")
+	}
+}
+
+func TestOversizedSessionFallsBackToServer(t *testing.T) {
+	store, b := newTestFallbackStore(t)
+	large := oversizedValue(t)
+
+	save(t, store, b, large)
+
+	if _, ok := b.cookies[testSessionName]; ok {
+		t.Error("the oversized session was still set as a cookie")
+	}
+	cookie, ok := b.cookies[testSessionName+serverSessionSuffix]
+	if !ok {
+		t.Fatal("no server session cookie was set")
+	}
+	if len(cookie.Value) > maxSessionCookieValue {
+		t.Errorf("server session cookie is %d bytes, want at most %d", len(cookie.Value), maxSessionCookieValue)
+	}
+	if n := sessionFiles(t, store); n != 1 {
+		t.Errorf("%d session files written, want 1", n)
+	}
+	if got := load(t, store, b); got != large {
+		t.Error("the oversized session didn't load back from the server")
+	}
+}
+
+func TestShrunkSessionMovesBackToCookie(t *testing.T) {
+	store, b := newTestFallbackStore(t)
+
+	save(t, store, b, oversizedValue(t))
+	save(t, store, b, "small")
+
+	if _, ok := b.cookies[testSessionName+serverSessionSuffix]; ok {
+		t.Error("the server session cookie was kept")
+	}
+	if n := sessionFiles(t, store); n != 0 {
+		t.Errorf("%d session files left, want 0", n)
+	}
+	if got := load(t, store, b); got != "small" {
+		t.Errorf("loaded %q, want %q", got, "small")
+	}
+}
+
+func TestCleanupRemovesOldSessionFiles(t *testing.T) {
+	store, _ := newTestFallbackStore(t)
+
+	write := func(name string, age time.Duration) {
+		t.Helper()
+		path := filepath.Join(store.dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		modified := time.Now().Add(-age)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatalf("Chtimes() = %v", err)
+		}
+	}
+	write(sessionFilePrefix+"old", 2*time.Hour)
+	write(sessionFilePrefix+"recent", time.Minute)
+	write("unrelated", 2*time.Hour)
+
+	removed, err := store.cleanup(time.Hour)
+	if err != nil {
+		t.Fatalf("cleanup() = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("cleanup() removed %d files, want 1", removed)
+	}
+	for _, name := range []string{sessionFilePrefix + "recent", "unrelated"} {
+		if _, err := os.Stat(filepath.Join(store.dir, name)); err != nil {
+			t.Errorf("%s was removed", name)
+		}
+	}
+}
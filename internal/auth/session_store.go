@@ -1,24 +1,61 @@
 package auth
 
 import (
+	"bedrud-backend/config"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gorilla/sessions"
 	"github.com/markbates/goth/gothic"
 )
 
-// InitializeSessionStore sets up the gothic session store
-func InitializeSessionStore(secret string) {
-	store := sessions.NewCookieStore([]byte(secret))
-	store.Options = &sessions.Options{
+// sessionStore is the gothic session store set up by InitializeSessionStore
+var sessionStore *fallbackStore
+
+// InitializeSessionStore sets up the gothic session store. Sessions too large
+// for a cookie are kept in files under cookie.FallbackDir.
+func InitializeSessionStore(secret string, cookie config.SessionCookieConfig) error {
+	store, err := newFallbackStore([]byte(secret), cookie.FallbackDir, &sessions.Options{
 		Path:     "/",
-		MaxAge:   86400 * 30,
+		Domain:   cookie.Domain,
+		MaxAge:   cookie.MaxAge,
 		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
+		Secure:   cookie.Secure,
+		SameSite: sameSiteMode(cookie.SameSite),
+	})
+	if err != nil {
+		return err
 	}
+	sessionStore = store
 	gothic.Store = store
+	return nil
+}
+
+// CleanupSessionFiles removes server-side session files older than the
+// session cookie's lifetime and returns how many were removed
+func CleanupSessionFiles() (int, error) {
+	if sessionStore == nil {
+		return 0, nil
+	}
+	maxAge := time.Duration(config.Get().Auth.SessionCookie.MaxAge) * time.Second
+	if maxAge <= 0 {
+		maxAge = defaultSessionFileAge
+	}
+	return sessionStore.cleanup(maxAge)
+}
+
+func sameSiteMode(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
 }
 
 // SetProviderToSession adds the provider to the gothic session
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"bedrud-backend/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/markbates/goth/gothic"
+)
+
+func TestSessionStoreUsesTheCookieConfig(t *testing.T) {
+	previousStore, previousSessions := gothic.Store, sessionStore
+	t.Cleanup(func() { gothic.Store, sessionStore = previousStore, previousSessions })
+
+	tests := []struct {
+		name         string
+		cookie       config.SessionCookieConfig
+		wantSameSite http.SameSite
+	}{
+		{"strict and secure", config.SessionCookieConfig{Domain: "example.com", SameSite: "Strict", Secure: true, MaxAge: 600}, http.SameSiteStrictMode},
+		{"none", config.SessionCookieConfig{SameSite: "none", Secure: true, MaxAge: 60}, http.SameSiteNoneMode},
+		{"lax default", config.SessionCookieConfig{MaxAge: 86400}, http.SameSiteLaxMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cookie.FallbackDir = t.TempDir()
+			if err := InitializeSessionStore("0123456789abcdef0123456789abcdef", tt.cookie); err != nil {
+				t.Fatalf("InitializeSessionStore() = %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/auth/google/login", nil)
+			session, err := gothic.Store.Get(r, gothic.SessionName)
+			if err != nil {
+				t.Fatalf("Get() = %v", err)
+			}
+			session.Values["provider"] = "google"
+			w := httptest.NewRecorder()
+			if err := session.Save(r, w); err != nil {
+				t.Fatalf("Save() = %v", err)
+			}
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("%d cookies set, want 1", len(cookies))
+			}
+			got := cookies[0]
+			if got.Domain != tt.cookie.Domain || got.Secure != tt.cookie.Secure || got.MaxAge != tt.cookie.MaxAge || got.SameSite != tt.wantSameSite {
+				t.Errorf("cookie domain %q, secure %v, max age %d, same site %v; want %q, %v, %d, %v",
+					got.Domain, got.Secure, got.MaxAge, got.SameSite, tt.cookie.Domain, tt.cookie.Secure, tt.cookie.MaxAge, tt.wantSameSite)
+			}
+			if !got.HttpOnly || got.Path != "/" {
+				t.Errorf("cookie HttpOnly %v on path %q, want HttpOnly on /", got.HttpOnly, got.Path)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Package configtest loads a configuration for tests of packages that read it
+// through config.Get. The configuration is the repository's
+// config.yaml.example with the test's overrides applied.
+package configtest
+
+import (
+	"bedrud-backend/config"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load makes the example configuration, with overrides applied, the active
+// configuration and returns it. Overrides are keyed by dotted YAML path, e.g.
+// "auth.refreshTokenScheme".
+func Load(t testing.TB, overrides map[string]interface{}) *config.Config {
+	t.Helper()
+
+	_, file, _, _ := runtime.Caller(0)
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "config.yaml.example"))
+	if err != nil {
+		t.Fatalf("read example config: %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("parse example config: %v", err)
+	}
+	for path, value := range overrides {
+		set(doc, strings.Split(path, "."), value)
+	}
+	data, err = yaml.Marshal(doc)
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.Reload(path)
+	if err != nil {
+		t.Fatalf("config.Reload() = %v", err)
+	}
+	return cfg
+}
+
+// set assigns value at keys, creating missing sections on the way
+func set(doc map[string]interface{}, keys []string, value interface{}) {
+	for _, key := range keys[:len(keys)-1] {
+		section, ok := doc[key].(map[string]interface{})
+		if !ok {
+			section = map[string]interface{}{}
+			doc[key] = section
+		}
+		doc = section
+	}
+	doc[keys[len(keys)-1]] = value
+}
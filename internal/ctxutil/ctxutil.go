@@ -0,0 +1,56 @@
+// Package ctxutil stores and reads request-scoped values on a Fiber context
+// under typed keys, so callers don't repeat magic strings and type assertions.
+package ctxutil
+
+import (
+	"bedrud-backend/internal/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type key int
+
+const (
+	claimsKey key = iota
+	requestIDKey
+	tenantIDKey
+	timeoutBaseKey
+	routeTimeoutKey
+)
+
+// RequestIDKey is the Locals key request IDs are stored under, for middleware
+// such as Fiber's requestid that stores the value itself
+const RequestIDKey = requestIDKey
+
+// SetClaims stores the authenticated user's claims
+func SetClaims(c *fiber.Ctx, claims *auth.Claims) {
+	c.Locals(claimsKey, claims)
+}
+
+// Claims returns the authenticated user's claims; ok is false on routes not behind Protected
+func Claims(c *fiber.Ctx) (*auth.Claims, bool) {
+	claims, ok := c.Locals(claimsKey).(*auth.Claims)
+	return claims, ok && claims != nil
+}
+
+// SetRequestID stores the request's correlation ID
+func SetRequestID(c *fiber.Ctx, id string) {
+	c.Locals(requestIDKey, id)
+}
+
+// RequestID returns the request's correlation ID, if one was assigned
+func RequestID(c *fiber.Ctx) (string, bool) {
+	id, ok := c.Locals(requestIDKey).(string)
+	return id, ok && id != ""
+}
+
+// SetTenantID stores the tenant the request is scoped to
+func SetTenantID(c *fiber.Ctx, tenantID string) {
+	c.Locals(tenantIDKey, tenantID)
+}
+
+// TenantID returns the tenant the request is scoped to; ok is false in single-tenant use
+func TenantID(c *fiber.Ctx) (string, bool) {
+	id, ok := c.Locals(tenantIDKey).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,92 @@
+package ctxutil
+
+import (
+	"bedrud-backend/internal/auth"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// newCtx returns a fresh request context, released when the test ends
+func newCtx(t *testing.T) *fiber.Ctx {
+	t.Helper()
+
+	app := fiber.New()
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	t.Cleanup(func() { app.ReleaseCtx(c) })
+	return c
+}
+
+func TestClaims(t *testing.T) {
+	c := newCtx(t)
+	if claims, ok := Claims(c); ok || claims != nil {
+		t.Errorf("Claims() before SetClaims = %v, %v, want nil, false", claims, ok)
+	}
+
+	want := &auth.Claims{UserID: "u1", Accesses: []string{"user"}}
+	SetClaims(c, want)
+	if got, ok := Claims(c); !ok || got != want {
+		t.Errorf("Claims() = %v, %v, want %v, true", got, ok, want)
+	}
+
+	SetClaims(c, nil)
+	if claims, ok := Claims(c); ok {
+		t.Errorf("Claims() after storing nil = %v, %v, want nil, false", claims, ok)
+	}
+}
+
+func TestClaimsIgnoresTheLegacyKey(t *testing.T) {
+	c := newCtx(t)
+	c.Locals("user", &auth.Claims{UserID: "u1"})
+	if _, ok := Claims(c); ok {
+		t.Error("Claims() read a value stored under the string key \"user\"")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	c := newCtx(t)
+	if id, ok := RequestID(c); ok {
+		t.Errorf("RequestID() before SetRequestID = %q, true, want false", id)
+	}
+
+	SetRequestID(c, "req-1")
+	if id, ok := RequestID(c); !ok || id != "req-1" {
+		t.Errorf("RequestID() = %q, %v, want req-1, true", id, ok)
+	}
+
+	// Fiber's requestid middleware stores the value itself under RequestIDKey
+	c.Locals(RequestIDKey, "req-2")
+	if id, ok := RequestID(c); !ok || id != "req-2" {
+		t.Errorf("RequestID() = %q, %v, want req-2, true", id, ok)
+	}
+
+	SetRequestID(c, "")
+	if _, ok := RequestID(c); ok {
+		t.Error("RequestID() reported an empty ID")
+	}
+}
+
+func TestTenantID(t *testing.T) {
+	c := newCtx(t)
+	if id, ok := TenantID(c); ok {
+		t.Errorf("TenantID() before SetTenantID = %q, true, want false", id)
+	}
+
+	SetTenantID(c, "acme")
+	if id, ok := TenantID(c); !ok || id != "acme" {
+		t.Errorf("TenantID() = %q, %v, want acme, true", id, ok)
+	}
+}
+
+func TestKeysDoNotCollide(t *testing.T) {
+	c := newCtx(t)
+	SetRequestID(c, "req-1")
+	SetTenantID(c, "acme")
+	if _, ok := Claims(c); ok {
+		t.Error("Claims() found a value that was never set")
+	}
+	if id, _ := RequestID(c); id != "req-1" {
+		t.Errorf("RequestID() = %q after SetTenantID, want req-1", id)
+	}
+}
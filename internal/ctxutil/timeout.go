@@ -0,0 +1,42 @@
+package ctxutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// SetTimeoutBase stores the request's user context as it was before any
+// deadline was applied, so route-level timeouts can override the global one
+func SetTimeoutBase(c *fiber.Ctx, ctx context.Context) {
+	c.Locals(timeoutBaseKey, ctx)
+}
+
+// TimeoutBase returns the context stored by SetTimeoutBase; ok is false before any timeout applied
+func TimeoutBase(c *fiber.Ctx) (context.Context, bool) {
+	ctx, ok := c.Locals(timeoutBaseKey).(context.Context)
+	return ctx, ok && ctx != nil
+}
+
+// SetRouteTimeout stores the timeout of the innermost Timeout registration
+func SetRouteTimeout(c *fiber.Ctx, timeout time.Duration) {
+	c.Locals(routeTimeoutKey, timeout)
+}
+
+// RouteTimeout returns the timeout the innermost Timeout gave the request, or 0 if none did
+func RouteTimeout(c *fiber.Ctx) time.Duration {
+	timeout, _ := c.Locals(routeTimeoutKey).(time.Duration)
+	return timeout
+}
+
+// ExtendWriteDeadline moves the connection's write deadline to timeout from now,
+// so a streamed response isn't bound by the server's WriteTimeout. Call it from
+// the body stream writer as the stream progresses: Fiber sets its own deadline
+// once the handler returns, which may be after the writer started.
+func ExtendWriteDeadline(c *fasthttp.RequestCtx, timeout time.Duration) {
+	if timeout > 0 {
+		_ = c.Conn().SetWriteDeadline(time.Now().Add(timeout))
+	}
+}
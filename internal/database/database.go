@@ -2,38 +2,34 @@ package database
 
 import (
 	"bedrud-backend/config"
+	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 var db *gorm.DB
 
+// pingFailing is set while health pings fail, so the recovery can be logged once
+var pingFailing atomic.Bool
+
+// pingTimeout bounds a single health ping
+const pingTimeout = 5 * time.Second
+
 // Initialize sets up the database connection
 func Initialize(cfg *config.DatabaseConfig) error {
 	var err error
 
 	// Create PostgreSQL connection string
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		cfg.Host,
-		cfg.User,
-		cfg.Password,
-		cfg.DBName,
-		cfg.Port,
-		cfg.SSLMode,
-	)
-
-	// Configure GORM
-	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	}
+	dsn := buildDSN(cfg, cfg.Host, cfg.Port, cfg.User, cfg.Password)
 
 	// Connect to PostgreSQL
-	db, err = gorm.Open(postgres.Open(dsn), gormConfig)
+	db, err = gorm.Open(postgres.Open(dsn), gormConfig(cfg))
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to connect to database")
 		return err
@@ -49,10 +45,103 @@ func Initialize(cfg *config.DatabaseConfig) error {
 	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Duration(cfg.MaxLifetime) * time.Minute)
 
+	// Route reads to replicas when any are configured
+	if err := registerReplicas(cfg); err != nil {
+		log.Error().Err(err).Msg("Failed to register database replicas")
+		return err
+	}
+
 	log.Info().Msg("Database connection established successfully")
 	return nil
 }
 
+// gormConfig returns the GORM settings for the configured database
+func gormConfig(cfg *config.DatabaseConfig) *gorm.Config {
+	return &gorm.Config{
+		Logger:      newLogger(cfg.LogLevel, time.Duration(cfg.SlowQueryThreshold)*time.Millisecond),
+		PrepareStmt: cfg.PrepareStmt,
+	}
+}
+
+// registerReplicas sends SELECTs to the configured replicas and everything
+// else to the primary. Without replicas every query uses the primary.
+func registerReplicas(cfg *config.DatabaseConfig) error {
+	if len(cfg.Replicas) == 0 {
+		return nil
+	}
+
+	replicas := make([]gorm.Dialector, 0, len(cfg.Replicas))
+	for _, replica := range cfg.Replicas {
+		user, password := replica.User, replica.Password
+		if user == "" {
+			user, password = cfg.User, cfg.Password
+		}
+		port := replica.Port
+		if port == "" {
+			port = cfg.Port
+		}
+		replicas = append(replicas, postgres.Open(buildDSN(cfg, replica.Host, port, user, password)))
+	}
+
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	}).
+		SetMaxIdleConns(cfg.MaxIdleConns).
+		SetMaxOpenConns(cfg.MaxOpenConns).
+		SetConnMaxLifetime(time.Duration(cfg.MaxLifetime) * time.Minute)
+
+	if err := db.Use(resolver); err != nil {
+		return err
+	}
+
+	log.Info().Int("replicas", len(replicas)).Msg("Database read replicas registered")
+	return nil
+}
+
+// buildDSN creates a PostgreSQL connection string for the given host and credentials
+func buildDSN(cfg *config.DatabaseConfig, host, port, user, password string) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		host,
+		user,
+		password,
+		cfg.DBName,
+		port,
+		cfg.SSLMode,
+	)
+}
+
+// Primary forces the query onto the primary database, for reads that must
+// observe a write made moments earlier
+func Primary(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Write)
+}
+
+// Ping checks the primary connection. database/sql drops connections that fail
+// and dials new ones on the next use, so a successful ping after a failure
+// means the pool has reconnected.
+func Ping() error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		if !pingFailing.Swap(true) {
+			log.Error().Err(err).Msg("Database health ping failed")
+		}
+		return err
+	}
+
+	if pingFailing.Swap(false) {
+		log.Info().Msg("Database connection re-established")
+	}
+	return nil
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return db
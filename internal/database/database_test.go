@@ -0,0 +1,130 @@
+package database
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/dbtest"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// useTestDB points the package's database at a primary that is never dialled
+func useTestDB(t *testing.T, cfg *config.DatabaseConfig) {
+	t.Helper()
+
+	testDB, err := gorm.Open(postgres.Open(buildDSN(cfg, cfg.Host, cfg.Port, cfg.User, cfg.Password)), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() = %v", err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() { db = previous })
+}
+
+func testDatabaseConfig() *config.DatabaseConfig {
+	return &config.DatabaseConfig{
+		Host:     "primary.internal",
+		Port:     "5432",
+		User:     "bedrud",
+		Password: "secret",
+		DBName:   "bedrud",
+		SSLMode:  "disable",
+	}
+}
+
+func TestRegisterReplicasConfiguresTheResolver(t *testing.T) {
+	cfg := testDatabaseConfig()
+	cfg.Replicas = []config.ReplicaConfig{
+		{Host: "replica-1.internal"},
+		{Host: "replica-2.internal", Port: "6432", User: "reader", Password: "other"},
+	}
+	useTestDB(t, cfg)
+
+	if err := registerReplicas(cfg); err != nil {
+		t.Fatalf("registerReplicas() = %v", err)
+	}
+	if _, ok := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()]; !ok {
+		t.Error("the read replica resolver wasn't registered")
+	}
+}
+
+func TestRegisterReplicasWithoutReplicas(t *testing.T) {
+	cfg := testDatabaseConfig()
+	useTestDB(t, cfg)
+
+	if err := registerReplicas(cfg); err != nil {
+		t.Fatalf("registerReplicas() = %v", err)
+	}
+	if _, ok := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()]; ok {
+		t.Error("a resolver was registered without replicas")
+	}
+}
+
+func TestBuildDSN(t *testing.T) {
+	cfg := testDatabaseConfig()
+
+	got := buildDSN(cfg, "replica-2.internal", "6432", "reader", "other")
+	want := "host=replica-2.internal user=reader password=other dbname=bedrud port=6432 sslmode=disable"
+	if got != want {
+		t.Errorf("buildDSN() = %q, want %q", got, want)
+	}
+}
+
+func TestGormConfigPreparesStatements(t *testing.T) {
+	for _, prepare := range []bool{true, false} {
+		cfg := testDatabaseConfig()
+		cfg.PrepareStmt = prepare
+
+		gormCfg := gormConfig(cfg)
+		gormCfg.DisableAutomaticPing = true
+		session, err := gorm.Open(postgres.Open(buildDSN(cfg, cfg.Host, cfg.Port, cfg.User, cfg.Password)), gormCfg)
+		if err != nil {
+			t.Fatalf("gorm.Open() = %v", err)
+		}
+
+		_, prepared := session.ConnPool.(*gorm.PreparedStmtDB)
+		if prepared != prepare || session.PrepareStmt != prepare {
+			t.Errorf("prepareStmt %v: session prepares statements = %v", prepare, prepared)
+		}
+	}
+}
+
+func TestPingLogsFailureAndRecoveryOnce(t *testing.T) {
+	buf := captureLog(t)
+	t.Cleanup(func() { pingFailing.Store(false) })
+
+	// Nothing listens on port 1, so connecting fails at once
+	cfg := testDatabaseConfig()
+	cfg.Host, cfg.Port = "127.0.0.1", "1"
+	useTestDB(t, cfg)
+
+	for i := 0; i < 2; i++ {
+		if err := Ping(); err == nil {
+			t.Fatal("Ping() succeeded without a database")
+		}
+	}
+
+	healthy, _ := dbtest.Open(t, nil)
+	db = healthy
+	for i := 0; i < 2; i++ {
+		if err := Ping(); err != nil {
+			t.Fatalf("Ping() = %v", err)
+		}
+	}
+
+	var messages []interface{}
+	for _, entry := range logEntries(t, buf) {
+		messages = append(messages, entry["message"])
+	}
+	want := []interface{}{"Database health ping failed", "Database connection re-established"}
+	if len(messages) != len(want) || messages[0] != want[0] || messages[1] != want[1] {
+		t.Errorf("logged %v, want %v", messages, want)
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// zerologLogger bridges GORM's logger to zerolog so database logs share the
+// application's formatting
+type zerologLogger struct {
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+func newLogger(level string, slowThreshold time.Duration) logger.Interface {
+	return &zerologLogger{
+		level:         parseLogLevel(level),
+		slowThreshold: slowThreshold,
+	}
+}
+
+// parseLogLevel maps a config value to a GORM log level, defaulting to warn
+func parseLogLevel(level string) logger.LogLevel {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "info":
+		return logger.Info
+	default:
+		return logger.Warn
+	}
+}
+
+func (l *zerologLogger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.level = level
+	return &newLogger
+}
+
+func (l *zerologLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		log.Info().Msg(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *zerologLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		log.Warn().Msg(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *zerologLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		log.Error().Msg(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace logs failed statements at error level and statements slower than the
+// threshold at warn level. At the info GORM level every other executed
+// statement is logged too, at zerolog debug level.
+func (l *zerologLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	slow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+
+	var event *zerolog.Event
+	var msg string
+	switch {
+	case err != nil && l.level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		event, msg = log.Error().Err(err), "Database query failed"
+	case slow && l.level >= logger.Warn:
+		event, msg = log.Warn().Dur("threshold", l.slowThreshold), "Slow database query"
+	case l.level >= logger.Info:
+		event, msg = log.Debug(), "Database query"
+	default:
+		return
+	}
+
+	sql, rows := fc()
+	event.
+		Dur("elapsed", elapsed).
+		Int64("rows", rows).
+		Str("sql", sql).
+		Msg(msg)
+}
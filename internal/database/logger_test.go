@@ -0,0 +1,121 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// captureLog sends the global logger's output to a buffer for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = previous })
+	return &buf
+}
+
+// logEntries decodes the JSON lines written to buf
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q isn't JSON: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestTrace(t *testing.T) {
+	query := func() (string, int64) { return `SELECT * FROM "rooms"`, 3 }
+
+	tests := []struct {
+		name        string
+		level       string
+		elapsed     time.Duration
+		err         error
+		wantLevel   string
+		wantMessage string
+	}{
+		{"slow query", "warn", 200 * time.Millisecond, nil, "warn", "Slow database query"},
+		{"fast query at warn", "warn", time.Millisecond, nil, "", ""},
+		{"fast query at info", "info", time.Millisecond, nil, "debug", "Database query"},
+		{"failed query", "warn", time.Millisecond, errors.New("syntax error"), "error", "Database query failed"},
+		{"failed slow query", "warn", 200 * time.Millisecond, errors.New("syntax error"), "error", "Database query failed"},
+		{"record not found isn't a failure", "warn", time.Millisecond, gorm.ErrRecordNotFound, "", ""},
+		{"slow query at error", "error", 200 * time.Millisecond, nil, "", ""},
+		{"silent", "silent", 200 * time.Millisecond, errors.New("syntax error"), "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+
+			l := newLogger(tt.level, 100*time.Millisecond)
+			l.Trace(context.Background(), time.Now().Add(-tt.elapsed), query, tt.err)
+
+			entries := logEntries(t, buf)
+			if tt.wantLevel == "" {
+				if len(entries) != 0 {
+					t.Errorf("logged %v, want nothing", entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(entries))
+			}
+			entry := entries[0]
+			if entry["level"] != tt.wantLevel || entry["message"] != tt.wantMessage {
+				t.Errorf("logged %v %q, want %v %q", entry["level"], entry["message"], tt.wantLevel, tt.wantMessage)
+			}
+			if entry["sql"] != `SELECT * FROM "rooms"` || entry["rows"] != float64(3) {
+				t.Errorf("logged sql %v and rows %v", entry["sql"], entry["rows"])
+			}
+		})
+	}
+}
+
+func TestTraceWithoutThresholdNeverWarns(t *testing.T) {
+	buf := captureLog(t)
+
+	l := newLogger("warn", 0)
+	l.Trace(context.Background(), time.Now().Add(-time.Minute), func() (string, int64) { return "SELECT 1", 1 }, nil)
+
+	if entries := logEntries(t, buf); len(entries) != 0 {
+		t.Errorf("logged %v, want nothing", entries)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]logger.LogLevel{
+		"silent":  logger.Silent,
+		"error":   logger.Error,
+		"warn":    logger.Warn,
+		"INFO":    logger.Info,
+		"":        logger.Warn,
+		"verbose": logger.Warn,
+	}
+	for value, want := range tests {
+		if got := parseLogLevel(value); got != want {
+			t.Errorf("parseLogLevel(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
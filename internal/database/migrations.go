@@ -2,12 +2,15 @@ package database
 
 import (
 	"bedrud-backend/internal/models"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
-// RunMigrations performs all database migrations
-func RunMigrations() error {
+// RunMigrations performs all database migrations. Rooms stored without a
+// capacity are given defaultMaxParticipants, the configured default.
+func RunMigrations(defaultMaxParticipants int) error {
 	db := GetDB()
 
 	// Disable foreign key checks during migration
@@ -20,15 +23,62 @@ func RunMigrations() error {
 	if err := db.AutoMigrate(&models.BlockedRefreshToken{}); err != nil {
 		return err
 	}
+	if err := db.AutoMigrate(&models.RefreshSession{}); err != nil {
+		return err
+	}
+	// Rotation used to remember only the previous token; the lineage replaces it
+	for _, column := range []string{"previous_token_hash", "rotated_at"} {
+		if db.Migrator().HasColumn(&models.RefreshSession{}, column) {
+			if err := db.Migrator().DropColumn(&models.RefreshSession{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	if err := db.AutoMigrate(&models.RetiredRefreshToken{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&models.AuthExchangeCode{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&models.APIKey{}); err != nil {
+		return err
+	}
 	if err := db.AutoMigrate(&models.Room{}); err != nil {
 		return err
 	}
 	if err := db.AutoMigrate(&models.RoomParticipant{}); err != nil {
 		return err
 	}
+	// Races used to leave several permission rows per participant; keep the
+	// newest so the unique index on (room_id, user_id) can be created
+	if db.Migrator().HasTable(&models.RoomPermissions{}) {
+		if err := db.Exec(`
+        DELETE FROM room_permissions p
+        USING room_permissions newer
+        WHERE p.room_id = newer.room_id AND p.user_id = newer.user_id
+          AND (p.updated_at, p.id) < (newer.updated_at, newer.id)
+    `).Error; err != nil {
+			return err
+		}
+	}
 	if err := db.AutoMigrate(&models.RoomPermissions{}); err != nil {
 		return err
 	}
+	if err := db.AutoMigrate(&models.ParticipantSession{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&models.RateLimitEntry{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&models.LoginAttempt{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&models.SystemSetting{}); err != nil {
+		return err
+	}
 
 	// Add foreign key constraints manually
 	if err := db.Exec(`
@@ -41,6 +91,67 @@ func RunMigrations() error {
 		log.Warn().Err(err).Msg("Failed to add foreign key constraint - might already exist")
 	}
 
+	// Lets admins find users by access level without scanning the table
+	if db.Dialector.Name() == "postgres" {
+		if err := db.Exec(`
+        CREATE INDEX IF NOT EXISTS idx_users_accesses
+        ON users USING GIN (accesses)
+    `).Error; err != nil {
+			log.Warn().Err(err).Msg("Failed to create index on user accesses")
+		}
+	}
+
+	// Room names are checked for case-insensitive clashes on every create
+	if db.Dialector.Name() == "postgres" {
+		if err := db.Exec(`
+        CREATE INDEX IF NOT EXISTS idx_rooms_name_lower
+        ON rooms (LOWER(name))
+    `).Error; err != nil {
+			log.Warn().Err(err).Msg("Failed to create index on lowercased room names")
+		}
+	}
+
+	// OAuth users used to be keyed by the provider's user ID; keep it as the provider identity
+	if err := db.Exec(`
+        UPDATE users
+        SET provider_user_id = id
+        WHERE provider <> 'local' AND (provider_user_id IS NULL OR provider_user_id = '')
+    `).Error; err != nil {
+		log.Warn().Err(err).Msg("Failed to backfill provider user IDs")
+	}
+
+	if err := backfillRoomCapacities(db, defaultMaxParticipants); err != nil {
+		log.Warn().Err(err).Msg("Failed to backfill room capacities")
+	}
+
 	log.Info().Msg("Database migrations completed successfully")
 	return nil
 }
+
+// backfillRoomCapacities gives rooms that were created without a capacity, and
+// so stored as unlimited, the configured default. It runs once per database:
+// a capacity of 0 set later is left alone.
+func backfillRoomCapacities(db *gorm.DB, defaultMaxParticipants int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var done int64
+		if err := tx.Model(&models.SystemSetting{}).Where("key = ?", models.SettingRoomCapacitiesBackfilled).Count(&done).Error; err != nil {
+			return err
+		}
+		if done > 0 {
+			return nil
+		}
+
+		if err := tx.Exec(`
+        UPDATE rooms
+        SET max_participants = ?
+        WHERE max_participants = 0
+    `, defaultMaxParticipants).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.SystemSetting{
+			Key:       models.SettingRoomCapacitiesBackfilled,
+			Value:     "true",
+			UpdatedAt: time.Now(),
+		}).Error
+	})
+}
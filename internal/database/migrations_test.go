@@ -0,0 +1,45 @@
+package database
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"testing"
+)
+
+func TestBackfillRoomCapacitiesRunsOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		done       int64 // marker rows already in system_settings
+		wantUpdate bool
+	}{
+		{"first boot after the fix", 0, true},
+		{"already backfilled", 1, false},
+	}
+
+	for _, tt := range tests {
+		db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			if stmt.Is("SELECT") && stmt.Mentions(`"system_settings"`) {
+				return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{tt.done}}}, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+
+		if err := backfillRoomCapacities(db, 35); err != nil {
+			t.Fatalf("%s: backfillRoomCapacities() = %v", tt.name, err)
+		}
+
+		updates := fake.Find("UPDATE", "rooms")
+		markers := fake.Find("INSERT", `"system_settings"`)
+		if !tt.wantUpdate {
+			if len(updates) != 0 || len(markers) != 0 {
+				t.Errorf("%s: ran %d updates and %d marker inserts, want none", tt.name, len(updates), len(markers))
+			}
+			continue
+		}
+		if len(updates) != 1 || len(updates[0].Args) != 1 || updates[0].Args[0] != 35 {
+			t.Fatalf("%s: updates %+v, want one setting the configured default 35", tt.name, updates)
+		}
+		if len(markers) != 1 {
+			t.Errorf("%s: %d marker inserts, want 1", tt.name, len(markers))
+		}
+	}
+}
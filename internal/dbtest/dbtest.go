@@ -0,0 +1,232 @@
+// Package dbtest runs GORM on a fake database/sql driver, so code built on the
+// repositories can be tested without Postgres. Every statement is answered by
+// a function the test supplies, and statements and transaction boundaries are
+// recorded for the test to inspect.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Transaction events recorded alongside statements
+const (
+	Begin    = "begin"
+	Commit   = "commit"
+	Rollback = "rollback"
+)
+
+// Statement is one SQL statement the code under test ran
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// Is reports whether the statement starts with the given SQL keyword, e.g. "UPDATE"
+func (s Statement) Is(keyword string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(s.Query)), strings.ToUpper(keyword))
+}
+
+// Mentions reports whether the statement's SQL contains text
+func (s Statement) Mentions(text string) bool {
+	return strings.Contains(s.Query, text)
+}
+
+// Value returns the value an INSERT gives column in its first row, or an
+// UPDATE sets it to, and whether the statement sets column at all
+func (s Statement) Value(column string) (interface{}, bool) {
+	switch {
+	case s.Is("INSERT"):
+		start, end := strings.Index(s.Query, "("), strings.Index(s.Query, ")")
+		if start < 0 || end < start {
+			return nil, false
+		}
+		for i, name := range strings.Split(s.Query[start+1:end], ",") {
+			if strings.Trim(name, `" `) == column && i < len(s.Args) {
+				return s.Args[i], true
+			}
+		}
+	case s.Is("UPDATE"):
+		match := regexp.MustCompile(`"` + regexp.QuoteMeta(column) + `"=\$(\d+)`).FindStringSubmatch(s.Query)
+		if match == nil {
+			return nil, false
+		}
+		if n, _ := strconv.Atoi(match[1]); n >= 1 && n <= len(s.Args) {
+			return s.Args[n-1], true
+		}
+	}
+	return nil, false
+}
+
+// Result is how the fake database answers a statement: the rows a query
+// returns and the row count a write reports
+type Result struct {
+	Columns  []string
+	Rows     [][]interface{}
+	Affected int64
+}
+
+// Answer decides the result of a statement. A nil result with a nil error
+// answers with no rows and no affected rows.
+type Answer func(stmt Statement) (*Result, error)
+
+// DB is a fake database
+type DB struct {
+	mu     sync.Mutex
+	events []string
+	stmts  []Statement
+	answer Answer
+}
+
+// Open returns GORM on a fake database answered by answer, which may be nil
+func Open(t testing.TB, answer Answer) (*gorm.DB, *DB) {
+	t.Helper()
+
+	fake := &DB{answer: answer}
+	sqlDB := sql.OpenDB(fake)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open fake database: %v", err)
+	}
+	return db, fake
+}
+
+// Transactions returns the begin, commit and rollback events in order
+func (f *DB) Transactions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var events []string
+	for _, event := range f.events {
+		if event == Begin || event == Commit || event == Rollback {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Statements returns the statements run, in order
+func (f *DB) Statements() []Statement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Statement(nil), f.stmts...)
+}
+
+// Find returns the statements starting with keyword that mention text
+func (f *DB) Find(keyword, text string) []Statement {
+	var found []Statement
+	for _, stmt := range f.Statements() {
+		if stmt.Is(keyword) && stmt.Mentions(text) {
+			found = append(found, stmt)
+		}
+	}
+	return found
+}
+
+func (f *DB) record(event string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+func (f *DB) run(query string, args []driver.NamedValue) (*Result, error) {
+	stmt := Statement{Query: query, Args: make([]interface{}, len(args))}
+	for i, arg := range args {
+		stmt.Args[i] = arg.Value
+	}
+
+	f.mu.Lock()
+	f.events = append(f.events, query)
+	f.stmts = append(f.stmts, stmt)
+	answer := f.answer
+	f.mu.Unlock()
+
+	if answer == nil {
+		return &Result{}, nil
+	}
+	result, err := answer(stmt)
+	if result == nil {
+		result = &Result{}
+	}
+	return result, err
+}
+
+// Connect and Driver make DB a driver.Connector
+func (f *DB) Connect(context.Context) (driver.Conn, error) { return &conn{db: f}, nil }
+func (f *DB) Driver() driver.Driver                        { return fakeDriver{f} }
+
+type fakeDriver struct{ db *DB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &conn{db: d.db}, nil }
+
+type conn struct{ db *DB }
+
+func (c *conn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *conn) Close() error                        { return nil }
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.db.record(Begin)
+	return tx{db: c.db}, nil
+}
+
+// CheckNamedValue passes arguments through as they are, so tests see the
+// values the code under test used
+func (c *conn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.Affected), nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{result: result}, nil
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error   { t.db.record(Commit); return nil }
+func (t tx) Rollback() error { t.db.record(Rollback); return nil }
+
+type rows struct {
+	result *Result
+	next   int
+}
+
+func (r *rows) Columns() []string { return r.result.Columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.Rows) {
+		return io.EOF
+	}
+	for i, value := range r.result.Rows[r.next] {
+		dest[i] = value
+	}
+	r.next++
+	return nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/realtime"
+	"bedrud-backend/internal/repository"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+// maxPendingEvents caps how many events are held between two snapshots
+const maxPendingEvents = 100
+
+// StatsSnapshot represents server-wide counters at a point in time
+type StatsSnapshot struct {
+	TotalUsers         int64 `json:"totalUsers"`
+	ActiveUsers        int64 `json:"activeUsers"`
+	TotalRooms         int64 `json:"totalRooms"`
+	ActiveRooms        int64 `json:"activeRooms"`
+	ActiveParticipants int64 `json:"activeParticipants"`
+}
+
+// StreamMessage is pushed to admin dashboards once per interval
+type StreamMessage struct {
+	Type   string           `json:"type"`
+	Stats  StatsSnapshot    `json:"stats"`
+	Events []realtime.Event `json:"events"`
+	Time   time.Time        `json:"time"`
+}
+
+type AdminStreamHandler struct {
+	hub      *realtime.Hub
+	roomRepo *repository.RoomRepository
+	userRepo *repository.UserRepository
+	interval time.Duration
+}
+
+func NewAdminStreamHandler(hub *realtime.Hub, roomRepo *repository.RoomRepository, userRepo *repository.UserRepository, interval time.Duration) *AdminStreamHandler {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &AdminStreamHandler{
+		hub:      hub,
+		roomRepo: roomRepo,
+		userRepo: userRepo,
+		interval: interval,
+	}
+}
+
+// @Summary Admin status stream
+// @Description WebSocket pushing periodic stats snapshots and room/participant events across all tenants (requires superadmin access without a tenant)
+// @Tags admin
+// @Security BearerAuth
+// @Param access_token query string false "Access token, for clients that can't set headers on WebSocket requests; only read on the upgrade"
+// @Success 101 {object} StreamMessage
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 426 {object} ErrorResponse
+// @Router /admin/stream [get]
+func (h *AdminStreamHandler) Stream(conn *websocket.Conn) {
+	client, err := h.hub.Subscribe()
+	if err != nil {
+		closeStream(conn, websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer h.hub.Unsubscribe(client)
+
+	// Reading is the only way to notice the client went away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	// The connection's buffers are reused once Stream returns, so stop the read
+	// loop and wait for it first
+	defer func() {
+		conn.SetReadDeadline(time.Now())
+		<-done
+	}()
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	if err := h.sendSnapshot(conn, nil); err != nil {
+		return
+	}
+
+	var pending []realtime.Event
+	for {
+		select {
+		case <-done:
+			return
+		case <-client.Shutdown():
+			// Returning closes the connection
+			closeStream(conn, websocket.CloseGoingAway, "server shutting down")
+			return
+		case event, ok := <-client.Events():
+			if !ok {
+				return
+			}
+			if len(pending) < maxPendingEvents {
+				pending = append(pending, event)
+			}
+		case <-ticker.C:
+			if err := h.sendSnapshot(conn, pending); err != nil {
+				return
+			}
+			pending = nil
+		}
+	}
+}
+
+// closeStream sends a close frame so the client knows the stream ended on purpose
+func closeStream(conn *websocket.Conn, code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	if err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline); err != nil {
+		log.Debug().Err(err).Msg("Failed to send close frame")
+	}
+}
+
+func (h *AdminStreamHandler) sendSnapshot(conn *websocket.Conn, events []realtime.Event) error {
+	stats, err := h.collectStats()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to collect stats snapshot")
+	}
+
+	if events == nil {
+		events = []realtime.Event{}
+	}
+
+	return conn.WriteJSON(StreamMessage{
+		Type:   "snapshot",
+		Stats:  stats,
+		Events: events,
+		Time:   time.Now(),
+	})
+}
+
+func (h *AdminStreamHandler) collectStats() (StatsSnapshot, error) {
+	var stats StatsSnapshot
+	var err error
+
+	if stats.TotalUsers, stats.ActiveUsers, err = h.userRepo.CountUsers(); err != nil {
+		return stats, err
+	}
+	if stats.TotalRooms, stats.ActiveRooms, err = h.roomRepo.CountRooms(); err != nil {
+		return stats, err
+	}
+	if stats.ActiveParticipants, err = h.roomRepo.CountAllActiveParticipants(); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
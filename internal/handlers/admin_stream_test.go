@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/realtime"
+	"bedrud-backend/internal/repository"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	fiberws "github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gorilla/websocket"
+)
+
+// serve runs app on a local port until the test ends and returns its address
+func serve(t *testing.T, app *fiber.App) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestAdminStreamSendsSnapshots(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Mentions("count(") {
+			return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(4)}}}, nil
+		}
+		return nil, nil
+	})
+	hub := realtime.NewHub()
+	// Runs after the server shuts down: waits for the stream to end before the
+	// database closes
+	t.Cleanup(func() { hub.Shutdown(context.Background()) })
+	h := NewAdminStreamHandler(hub, repository.NewRoomRepository(db), repository.NewUserRepository(db), 20*time.Millisecond)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/admin/stream", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), fiberws.New(h.Stream))
+	addr := serve(t, app)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/admin/stream", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var first StreamMessage
+	if err := conn.ReadJSON(&first); err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	want := StatsSnapshot{TotalUsers: 4, ActiveUsers: 4, TotalRooms: 4, ActiveRooms: 4, ActiveParticipants: 4}
+	if first.Type != "snapshot" || first.Stats != want {
+		t.Errorf("first message = %+v, want a snapshot of %+v", first, want)
+	}
+
+	// The stream subscribes before its first snapshot, so events published now
+	// arrive with a later one
+	hub.Publish(realtime.EventRoomEnded, map[string]string{"roomId": "r1"})
+	for {
+		var msg StreamMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read snapshot: %v", err)
+		}
+		if len(msg.Events) > 0 {
+			if msg.Events[0].Type != realtime.EventRoomEnded {
+				t.Errorf("event = %+v, want room.ended", msg.Events[0])
+			}
+			break
+		}
+	}
+}
+
+func TestAdminStreamEndsOnHubShutdown(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+	})
+	hub := realtime.NewHub()
+	h := NewAdminStreamHandler(hub, repository.NewRoomRepository(db), repository.NewUserRepository(db), time.Hour)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/admin/stream", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), fiberws.New(h.Stream))
+	addr := serve(t, app)
+
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/admin/stream", nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var first StreamMessage
+		if err := conn.ReadJSON(&first); err != nil {
+			t.Fatalf("read snapshot: %v", err)
+		}
+		conns = append(conns, conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v, want every stream drained", err)
+	}
+
+	for i, conn := range conns {
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("connection %d: read = %v, want a going away close frame", i, err)
+		}
+	}
+
+	// Streams opened after shutdown are turned away at once
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/admin/stream", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("after shutdown: read = %v, want a going away close frame", err)
+	}
+}
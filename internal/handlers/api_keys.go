@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// maxAPIKeyName is the longest name an API key may be given
+const maxAPIKeyName = 100
+
+// APIKeyRequest represents the request to create an API key
+type APIKeyRequest struct {
+	Name   string   `json:"name" example:"CI deploys"`
+	Scopes []string `json:"scopes" example:"user"`
+}
+
+// APIKeyResponse describes an API key without the key itself
+type APIKeyResponse struct {
+	ID         string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name       string     `json:"name" example:"CI deploys"`
+	Prefix     string     `json:"prefix" example:"bdr_a1b2c3"`
+	Scopes     []string   `json:"scopes" example:"user"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// APIKeyCreatedResponse carries a new API key, the only time it is shown
+type APIKeyCreatedResponse struct {
+	APIKeyResponse
+	Key string `json:"key" example:"bdr_a1b2c3..."`
+}
+
+// APIKeyListResponse represents the response for listing API keys
+type APIKeyListResponse struct {
+	APIKeys []APIKeyResponse `json:"apiKeys"`
+}
+
+// @Summary Create an API key
+// @Description Create an API key for the current user. Scopes are access levels the user has; without any the key carries all of them. The key is returned only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body APIKeyRequest true "Key name and scopes"
+// @Success 201 {object} APIKeyCreatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/api-keys [post]
+func (h *AuthHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var input APIKeyRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > maxAPIKeyName {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("name is required and must be at most %d characters", maxAPIKeyName),
+		})
+	}
+
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	key, record, err := h.authService.CreateAPIKey(claims.UserID, name, input.Scopes)
+	switch {
+	case errors.Is(err, auth.ErrInvalidScope):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Scopes may only include access levels you have",
+		})
+	case errors.Is(err, auth.ErrTooManyAPIKeys):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("At most %d API keys are allowed; revoke one first", auth.MaxAPIKeysPerUser),
+		})
+	case err != nil:
+		log.Error().Err(err).Str("userId", claims.UserID).Msg("Failed to create API key")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create API key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(APIKeyCreatedResponse{
+		APIKeyResponse: APIKeyResponse{
+			ID:         record.ID,
+			Name:       record.Name,
+			Prefix:     record.Prefix,
+			Scopes:     record.Scopes,
+			CreatedAt:  record.CreatedAt,
+			LastUsedAt: record.LastUsedAt,
+		},
+		Key: key,
+	})
+}
+
+// @Summary List API keys
+// @Description List the current user's API keys. The keys themselves are never returned.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} APIKeyListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/api-keys [get]
+func (h *AuthHandler) ListAPIKeys(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	keys, err := h.authService.ListAPIKeys(claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch API keys",
+		})
+	}
+
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		scopes := key.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+		response = append(response, APIKeyResponse{
+			ID:         key.ID,
+			Name:       key.Name,
+			Prefix:     key.Prefix,
+			Scopes:     scopes,
+			CreatedAt:  key.CreatedAt,
+			LastUsedAt: key.LastUsedAt,
+		})
+	}
+
+	return c.JSON(APIKeyListResponse{APIKeys: response})
+}
+
+// @Summary Revoke an API key
+// @Description Delete one of the current user's API keys; requests using it are rejected from then on
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/api-keys/{id} [delete]
+func (h *AuthHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	err := h.authService.RevokeAPIKey(claims.UserID, c.Params("id"))
+	if errors.Is(err, auth.ErrAPIKeyNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke API key",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
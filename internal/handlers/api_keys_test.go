@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/middleware"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestManageAPIKeys(t *testing.T) {
+	var mu sync.Mutex
+	var stored []interface{} // id, user_id, name, prefix, key_hash, scopes
+	h, _ := newTestAuthHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		columns := []string{"id", "user_id", "name", "prefix", "key_hash", "scopes"}
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions("count("):
+			return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`"api_keys"`):
+			result := &dbtest.Result{Columns: columns}
+			if stored != nil {
+				result.Rows = [][]interface{}{stored}
+			}
+			return result, nil
+		case stmt.Is("INSERT") && stmt.Mentions(`"api_keys"`):
+			stored = make([]interface{}, len(columns))
+			for i, column := range columns {
+				stored[i], _ = stmt.Value(column)
+			}
+			stored[5] = "{user}"
+		case stmt.Is("DELETE") && stmt.Mentions(`"api_keys"`):
+			if stored == nil || !hasArg(stmt.Args, stored[0]) || !hasArg(stmt.Args, "u1") {
+				return &dbtest.Result{}, nil
+			}
+			stored = nil
+		case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "provider", "accesses", "is_active"},
+				Rows:    [][]interface{}{{"u1", "ann@example.com", "local", "{user}", true}},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	signedInAnn := signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}})
+	app := fiber.New()
+	app.Post("/auth/api-keys", signedInAnn, h.CreateAPIKey)
+	app.Get("/auth/api-keys", signedInAnn, h.ListAPIKeys)
+	app.Delete("/auth/api-keys/:id", signedInAnn, h.RevokeAPIKey)
+
+	var created APIKeyCreatedResponse
+	if status := call(t, app, "POST", "/auth/api-keys", APIKeyRequest{Name: "CI deploys", Scopes: []string{"user"}}, &created); status != fiber.StatusCreated {
+		t.Fatalf("create: status = %d, want %d", status, fiber.StatusCreated)
+	}
+	if !auth.IsAPIKey(created.Key) || created.Name != "CI deploys" {
+		t.Errorf("created %+v, want the CI deploys key returned", created)
+	}
+
+	// The list shows the key's metadata, never the key or its hash
+	resp, err := app.Test(httptest.NewRequest("GET", "/auth/api-keys", nil), -1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(string(body), created.Key) || strings.Contains(string(body), stored[4].(string)) || strings.Contains(string(body), `"key"`) {
+		t.Errorf("list response leaks the key: %s", body)
+	}
+	if !strings.Contains(string(body), created.ID) || !strings.Contains(string(body), created.Prefix) {
+		t.Errorf("list response %s, want the key's ID and prefix", body)
+	}
+
+	if status := call(t, app, "DELETE", "/auth/api-keys/"+created.ID, nil, nil); status != fiber.StatusOK {
+		t.Errorf("revoke: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := call(t, app, "DELETE", "/auth/api-keys/"+created.ID, nil, nil); status != fiber.StatusNotFound {
+		t.Errorf("revoke again: status = %d, want %d", status, fiber.StatusNotFound)
+	}
+
+	tests := []struct {
+		name string
+		req  APIKeyRequest
+		want int
+	}{
+		{"no name", APIKeyRequest{Name: " "}, fiber.StatusBadRequest},
+		{"name too long", APIKeyRequest{Name: strings.Repeat("k", maxAPIKeyName+1)}, fiber.StatusBadRequest},
+		{"scope beyond the user's access", APIKeyRequest{Name: "admin script", Scopes: []string{"admin"}}, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if status := call(t, app, "POST", "/auth/api-keys", tt.req, nil); status != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+}
+
+func TestAPIKeysCannotManageAPIKeys(t *testing.T) {
+	h, fake := newTestAuthHandler(t, nil)
+
+	app := fiber.New()
+	app.Post("/auth/api-keys", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}, APIKeyID: "k1"}), middleware.BlockAPIKeys(), h.CreateAPIKey)
+
+	if status := call(t, app, "POST", "/auth/api-keys", APIKeyRequest{Name: "another"}, nil); status != fiber.StatusForbidden {
+		t.Errorf("status = %d, want %d", status, fiber.StatusForbidden)
+	}
+	if len(fake.Statements()) != 0 {
+		t.Errorf("ran %v, want nothing", fake.Statements())
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/ctxutil"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/pagination"
+	"bedrud-backend/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+type AuditHandler struct {
+	auditRepo *repository.AuditRepository
+	userRepo  *repository.UserRepository
+	roomRepo  *repository.RoomRepository
+}
+
+// AuditListResponse is a page of audit log entries
+type AuditListResponse struct {
+	Entries    []models.AuditLog `json:"entries"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+func NewAuditHandler(auditRepo *repository.AuditRepository, userRepo *repository.UserRepository, roomRepo *repository.RoomRepository) *AuditHandler {
+	return &AuditHandler{
+		auditRepo: auditRepo,
+		userRepo:  userRepo,
+		roomRepo:  roomRepo,
+	}
+}
+
+// auditTargetTypes are the target types audit entries are recorded with
+var auditTargetTypes = map[string]bool{"room": true, "user": true, "system": true}
+
+// @Summary List audit log entries
+// @Description List audited admin actions, newest first. actorId, targetType/targetId and from/to can be combined, e.g. to pull every action one admin took against one room. Admins scoped to a tenant must filter by a room or user of their tenant (requires superadmin access).
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param actorId query string false "Only actions by this user"
+// @Param targetType query string false "Only actions against this kind of target: room, user or system"
+// @Param targetId query string false "Only actions against this target; requires targetType"
+// @Param from query string false "Only entries at or after this time (RFC 3339)"
+// @Param to query string false "Only entries at or before this time (RFC 3339)"
+// @Param cursor query string false "Cursor from the previous page's nextCursor"
+// @Param limit query int false "Page size"
+// @Success 200 {object} AuditListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse "Target not found"
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/audit [get]
+func (h *AuditHandler) List(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	filter := repository.AuditFilter{
+		ActorID:    c.Query("actorId"),
+		TargetType: c.Query("targetType"),
+		TargetID:   c.Query("targetId"),
+	}
+	if filter.TargetType != "" && !auditTargetTypes[filter.TargetType] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "targetType must be room, user or system",
+		})
+	}
+	if filter.TargetID != "" && filter.TargetType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "targetId requires targetType",
+		})
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from must be an RFC 3339 time",
+		})
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "to must be an RFC 3339 time",
+		})
+	}
+
+	cursor, err := pagination.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+	limit := pagination.ClampLimit(c.QueryInt("limit"))
+
+	// Entries carry no tenant, so a tenant admin only sees those about one of
+	// their own rooms or users
+	if claims.TenantID != "" && (filter.TargetID == "" || filter.TargetType == "system") {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Tenant admins must filter by a room or user target",
+		})
+	}
+	if filter.TargetID != "" && !h.canAccessTarget(claims.CanAccessTenant, filter.TargetType, filter.TargetID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Target not found",
+		})
+	}
+
+	entries, next, err := h.auditRepo.ListPage(filter, cursor, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list audit entries")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch audit log",
+		})
+	}
+
+	return c.JSON(AuditListResponse{
+		Entries:    entries,
+		NextCursor: next,
+	})
+}
+
+// canAccessTarget reports whether a room or user target belongs to a tenant
+// the caller may see. Deleted targets only remain visible to global admins.
+func (h *AuditHandler) canAccessTarget(canAccessTenant func(string) bool, targetType, targetID string) bool {
+	switch targetType {
+	case "room":
+		room, err := h.roomRepo.GetRoom(targetID)
+		if err == nil && room != nil {
+			return canAccessTenant(room.TenantID)
+		}
+	case "user":
+		user, err := h.userRepo.GetUserByID(targetID)
+		if err == nil && user != nil {
+			return canAccessTenant(user.TenantID)
+		}
+	}
+	return canAccessTenant("")
+}
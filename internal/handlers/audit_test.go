@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/repository"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestListAuditLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		tenantID   string
+		wantStatus int
+		wantArgs   []interface{} // filter values the audit query must bind
+	}{
+		{"everything", "/admin/audit", "", fiber.StatusOK, nil},
+		{"one room", "/admin/audit?targetType=room&targetId=r1", "", fiber.StatusOK, []interface{}{"room", "r1"}},
+		{"one user", "/admin/audit?targetType=user&targetId=u1", "", fiber.StatusOK, []interface{}{"user", "u1"}},
+		{"actor and room", "/admin/audit?actorId=a1&targetType=room&targetId=r1", "", fiber.StatusOK, []interface{}{"a1", "room", "r1"}},
+		{"unknown target type", "/admin/audit?targetType=tenant&targetId=acme", "", fiber.StatusBadRequest, nil},
+		{"target ID without a type", "/admin/audit?targetId=r1", "", fiber.StatusBadRequest, nil},
+		{"bad time", "/admin/audit?targetType=room&targetId=r1&from=yesterday", "", fiber.StatusBadRequest, nil},
+		{"tenant admin without a target", "/admin/audit?actorId=a1", "acme", fiber.StatusForbidden, nil},
+		{"tenant admin, own room", "/admin/audit?targetType=room&targetId=r1", "acme", fiber.StatusOK, []interface{}{"room", "r1"}},
+		{"tenant admin, another tenant's user", "/admin/audit?targetType=user&targetId=u1", "acme", fiber.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				switch {
+				case stmt.Is("SELECT") && stmt.Mentions(`"audit_logs"`):
+					return &dbtest.Result{
+						Columns: []string{"id", "actor_id", "action", "target_type", "target_id"},
+						Rows:    [][]interface{}{{"e1", "a1", "room.ended", "room", "r1"}},
+					}, nil
+				case stmt.Is("SELECT") && stmt.Mentions(`"rooms"`):
+					return &dbtest.Result{Columns: []string{"id", "name", "tenant_id"}, Rows: [][]interface{}{{"r1", "standup", "acme"}}}, nil
+				case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+					return &dbtest.Result{Columns: []string{"id", "email", "tenant_id"}, Rows: [][]interface{}{{"u1", "ann@example.com", "globex"}}}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+			h := NewAuditHandler(repository.NewAuditRepository(db), repository.NewUserRepository(db), repository.NewRoomRepository(db))
+
+			app := fiber.New()
+			app.Get("/admin/audit", signedIn(&auth.Claims{UserID: "root", TenantID: tt.tenantID, Accesses: []string{"superadmin"}}), h.List)
+
+			var resp AuditListResponse
+			if status := call(t, app, "GET", tt.target, nil, &resp); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			queries := fake.Find("SELECT", `"audit_logs"`)
+			if tt.wantStatus != fiber.StatusOK {
+				if len(queries) != 0 {
+					t.Errorf("ran %d audit queries for a rejected request", len(queries))
+				}
+				return
+			}
+
+			if len(queries) != 1 {
+				t.Fatalf("%d audit queries, want 1", len(queries))
+			}
+			for _, arg := range tt.wantArgs {
+				if !hasArg(queries[0].Args, arg) {
+					t.Errorf("query %q with %v doesn't filter on %v", queries[0].Query, queries[0].Args, arg)
+				}
+			}
+			if len(resp.Entries) != 1 || resp.Entries[0].ID != "e1" {
+				t.Errorf("entries = %+v, want e1", resp.Entries)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"bedrud-backend/config"
@@ -46,11 +48,56 @@ func (r *responseWriter) WriteHeader(statusCode int) {
 	r.ctx.Status(statusCode)
 }
 
+// ProviderInfo describes an enabled OAuth provider for rendering login buttons
+type ProviderInfo struct {
+	Name        string `json:"name" example:"google"`
+	DisplayName string `json:"displayName" example:"Google"`
+	LoginURL    string `json:"loginUrl" example:"/auth/google/login"`
+}
+
+// @Summary List OAuth providers
+// @Description List the OAuth providers that are configured and can be used to log in
+// @Tags auth
+// @Produce json
+// @Success 200 {array} ProviderInfo
+// @Router /auth/providers [get]
+func (h *AuthHandler) ListProviders(c *fiber.Ctx) error {
+	candidates := []struct {
+		name        string
+		displayName string
+		config      config.OAuth2Config
+	}{
+		{"google", "Google", h.config.Auth.Google},
+		{"github", "GitHub", h.config.Auth.Github},
+		{"twitter", "Twitter", h.config.Auth.Twitter},
+	}
+
+	providers := make([]ProviderInfo, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !candidate.config.Enabled() {
+			continue
+		}
+
+		displayName := candidate.config.DisplayName
+		if displayName == "" {
+			displayName = candidate.displayName
+		}
+		providers = append(providers, ProviderInfo{
+			Name:        candidate.name,
+			DisplayName: displayName,
+			LoginURL:    "/auth/" + candidate.name + "/login",
+		})
+	}
+
+	return c.JSON(providers)
+}
+
 // @Summary Begin OAuth authentication
 // @Description Initiates the OAuth authentication process with the specified provider
 // @Tags auth
 // @Produce json
 // @Param provider path string true "Authentication provider (google, github, twitter)"
+// @Param redirect query string false "Frontend to return to after login; must be on auth.allowedRedirectURLs"
 // @Success 302 {string} string "Redirect to provider's auth page"
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -59,6 +106,25 @@ func BeginAuthHandler(c *fiber.Ctx) error {
 	provider := c.Params("provider")
 	log.Debug().Str("provider", provider).Msg("BeginAuthHandler called with provider")
 
+	// Remember a client-chosen frontend for the callback, but only an allowlisted one
+	if redirect := c.Query("redirect"); redirect != "" {
+		frontend, ok := allowedRedirect(redirect, config.Get().Auth.RedirectAllowlist())
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Redirect URL is not allowed",
+			})
+		}
+		c.Cookie(&fiber.Cookie{
+			Name:     redirectCookieName,
+			Value:    frontend,
+			Path:     "/auth",
+			MaxAge:   int(redirectCookieTTL.Seconds()),
+			Secure:   c.Protocol() == "https",
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+	}
+
 	// Create a proper http.Request with all necessary fields
 	req := &http.Request{
 		Method: "GET",
@@ -104,7 +170,7 @@ func BeginAuthHandler(c *fiber.Ctx) error {
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /auth/{provider}/callback [get]
-func CallbackHandler(c *fiber.Ctx) error {
+func (h *AuthHandler) CallbackHandler(c *fiber.Ctx) error {
 	provider := c.Params("provider")
 	log.Debug().Str("provider", provider).Msg("CallbackHandler called with provider")
 
@@ -129,27 +195,47 @@ func CallbackHandler(c *fiber.Ctx) error {
 	gothUser, err := gothic.CompleteUserAuth(w, req)
 	if err != nil {
 		log.Error().Err(err).Str("provider", provider).Msg("Failed to complete auth")
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to complete authentication",
-		})
+		return h.callbackError(c, fiber.StatusInternalServerError, "auth_failed", "Failed to complete authentication")
 	}
 
+	if !auth.EmailDomainAllowed(gothUser.Email, config.Get().Auth.AllowedEmailDomains) {
+		log.Warn().Str("provider", provider).Msg("OAuth login from a domain that isn't allowed")
+		return h.callbackError(c, fiber.StatusForbidden, "domain_not_allowed", "Email domain is not allowed")
+	}
+
+	// A name can be shortened without harm, but a cut-off email is someone else's
+	if errors.Is(auth.CheckLengths(gothUser.Email, ""), auth.ErrEmailTooLong) {
+		log.Warn().Str("provider", provider).Msg("OAuth login with an email longer than allowed")
+		return h.callbackError(c, fiber.StatusBadRequest, "email_too_long", "Email address is too long")
+	}
+
+	providerConfig, _ := config.Get().Auth.OAuthProvider(gothUser.Provider)
+	verified := auth.OAuthEmailVerified(gothUser, providerConfig)
+
 	// Create or update user in database
 	userRepo := repository.NewUserRepository(database.GetDB())
 	dbUser := &models.User{
-		ID:        gothUser.UserID,
-		Email:     gothUser.Email,
-		Name:      gothUser.Name,
-		Provider:  gothUser.Provider,
-		AvatarURL: gothUser.AvatarURL,
-		Accesses:  []string{string(models.AccessUser)}, // Add default access
+		Email:          gothUser.Email,
+		Name:           auth.TruncateName(gothUser.Name),
+		Provider:       gothUser.Provider,
+		ProviderUserID: gothUser.UserID,
+		AvatarURL:      gothUser.AvatarURL,
+		Accesses:       auth.OAuthAccesses(gothUser.Email, verified, config.Get().Auth.OAuthAccess), // only used if the account is new
+		IsActive:       true,
+		EmailVerified:  verified,
 	}
 
-	if err := userRepo.CreateOrUpdateUser(dbUser); err != nil {
-		log.Error().Err(err).Msg("Failed to create/update user")
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error: "Failed to process user data",
-		})
+	if err := persistOAuthUser(userRepo, dbUser); err != nil {
+		if errors.Is(err, repository.ErrEmailInUse) {
+			log.Warn().Str("provider", provider).Msg("OAuth login for an email that belongs to another account")
+			return h.callbackError(c, fiber.StatusConflict, "account_exists", "An account with this email already exists; sign in with its original method")
+		}
+		log.Error().Err(err).Str("provider", provider).Msg("Failed to create/update user")
+		return h.callbackError(c, fiber.StatusInternalServerError, "user_error", "Failed to process user data")
+	}
+	if !dbUser.IsActive {
+		log.Warn().Str("provider", provider).Str("userId", dbUser.ID).Msg("OAuth login for a deactivated account")
+		return h.callbackError(c, fiber.StatusForbidden, "account_deactivated", "Account is deactivated")
 	}
 
 	// Generate JWT token
@@ -159,41 +245,32 @@ func CallbackHandler(c *fiber.Ctx) error {
 		dbUser.Email,
 		dbUser.Provider,
 		dbUser.Accesses, // Add accesses
+		dbUser.TenantID,
 		cfg,
 	)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to generate JWT token")
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error: "Failed to generate authentication token",
-		})
+		return h.callbackError(c, fiber.StatusInternalServerError, "token_error", "Failed to generate authentication token")
 	}
 
 	// Set token in cookie
-	cookie := fiber.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Expires:  time.Now().Add(time.Duration(cfg.Auth.TokenDuration) * time.Hour),
-		HTTPOnly: true,
-		Secure:   c.Protocol() == "https",
-		SameSite: "Lax",
-	}
-	c.Cookie(&cookie)
+	c.Cookie(tokenCookie(c, &cfg.Auth, token))
 
-	// If frontend URL is provided in config, redirect there with token
-	if cfg.Auth.FrontendURL != "" {
-		frontendURL, err := url.Parse(cfg.Auth.FrontendURL)
-		if err != nil {
-			log.Error().Err(err).Msg("Invalid frontend URL in config")
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-				Error: "Invalid frontend configuration",
-			})
+	// If a frontend is configured or was chosen at login, redirect there
+	if frontend := h.callbackFrontend(c); frontend != "" {
+		params := url.Values{}
+		if cfg.Auth.LegacyTokenRedirect {
+			params.Set("token", token)
+		} else {
+			// Hand out a one-time code so the token never appears in the URL
+			code, err := h.authService.CreateExchangeCode(dbUser.ID)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to create exchange code")
+				return h.callbackError(c, fiber.StatusInternalServerError, "token_error", "Failed to generate authentication token")
+			}
+			params.Set("code", code)
 		}
-
-		frontendURL.Path = fmt.Sprintf("/auth/callback")
-		q := frontendURL.Query()
-		q.Set("token", token)
-		frontendURL.RawQuery = q.Encode()
-		return c.Redirect(frontendURL.String())
+		return redirectToFrontend(c, frontend, params)
 	}
 
 	// Otherwise return JSON response
@@ -208,3 +285,129 @@ func CallbackHandler(c *fiber.Ctx) error {
 		Token: token,
 	})
 }
+
+// oauthPersistAttempts bounds how often the callback retries a user upsert that hit a transient database error
+const oauthPersistAttempts = 3
+
+// persistOAuthUser upserts the OAuth user, retrying transient database errors
+// with a short backoff so a blip doesn't abort the login
+func persistOAuthUser(userRepo *repository.UserRepository, user *models.User) error {
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := userRepo.FindOrCreateByProvider(user)
+		if err == nil || attempt >= oauthPersistAttempts || !database.IsTransient(err) {
+			return err
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Msg("Transient error saving OAuth user, retrying")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// callbackError reports an OAuth callback failure. SPA clients are redirected
+// back to the frontend with an error code; API clients get a JSON error.
+func (h *AuthHandler) callbackError(c *fiber.Ctx, status int, code, message string) error {
+	cfg := config.Get()
+	if frontend := h.callbackFrontend(c); frontend != "" && !cfg.Auth.LegacyTokenRedirect {
+		params := url.Values{}
+		params.Set("error", code)
+		return redirectToFrontend(c, frontend, params)
+	}
+
+	return c.Status(status).JSON(ErrorResponse{
+		Error: message,
+	})
+}
+
+// redirectCookieName holds the frontend chosen with ?redirect= between the OAuth login and callback
+const redirectCookieName = "oauth_redirect"
+
+// redirectCookieTTL bounds how long an OAuth login may take before the chosen frontend is forgotten
+const redirectCookieTTL = 10 * time.Minute
+
+// allowedRedirect reports whether target points at one of the allowed frontends,
+// comparing scheme and host. It returns the matching frontend's origin.
+func allowedRedirect(target string, allowed []string) (string, bool) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", false
+	}
+
+	for _, raw := range allowed {
+		a, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(a.Scheme, u.Scheme) && strings.EqualFold(a.Host, u.Host) {
+			return a.Scheme + "://" + a.Host, true
+		}
+	}
+	return "", false
+}
+
+// callbackFrontend picks the frontend for the OAuth callback: the one chosen at
+// login if it is still allowed, otherwise the configured FrontendURL
+func (h *AuthHandler) callbackFrontend(c *fiber.Ctx) string {
+	cfg := config.Get()
+	if chosen := c.Cookies(redirectCookieName); chosen != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:     redirectCookieName,
+			Path:     "/auth",
+			Expires:  time.Unix(0, 0),
+			HTTPOnly: true,
+		})
+		if frontend, ok := allowedRedirect(chosen, cfg.Auth.RedirectAllowlist()); ok {
+			return frontend
+		}
+		log.Warn().Str("redirect", chosen).Msg("Ignoring OAuth redirect that is no longer allowed")
+	}
+	return cfg.Auth.FrontendURL
+}
+
+// redirectToFrontend redirects to the frontend's OAuth callback page with the given query parameters
+func redirectToFrontend(c *fiber.Ctx, frontend string, params url.Values) error {
+	frontendURL, err := url.Parse(frontend)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid frontend URL in config")
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: "Invalid frontend configuration",
+		})
+	}
+
+	frontendURL.Path = "/auth/callback"
+	q := frontendURL.Query()
+	for key, values := range params {
+		for _, value := range values {
+			q.Add(key, value)
+		}
+	}
+	frontendURL.RawQuery = q.Encode()
+	return c.Redirect(frontendURL.String())
+}
+
+// tokenCookie builds the JWT cookie from the configured attributes
+func tokenCookie(c *fiber.Ctx, cfg *config.AuthConfig, token string) *fiber.Cookie {
+	cookieCfg := cfg.Cookie
+
+	maxAge := time.Duration(cookieCfg.MaxAge) * time.Second
+	if maxAge <= 0 {
+		maxAge = time.Duration(cfg.TokenDuration) * time.Hour
+	}
+
+	secure := c.Protocol() == "https"
+	if cookieCfg.Secure != nil {
+		secure = *cookieCfg.Secure
+	}
+
+	return &fiber.Cookie{
+		Name:     cookieCfg.Name,
+		Value:    token,
+		Domain:   cookieCfg.Domain,
+		Path:     cookieCfg.Path,
+		Expires:  time.Now().Add(maxAge),
+		HTTPOnly: true,
+		Secure:   secure,
+		SameSite: cookieCfg.SameSite,
+	}
+}
@@ -2,9 +2,14 @@ package handlers
 
 import (
 	"bedrud-backend/config"
+	"errors"
+
 	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
+	"bedrud-backend/internal/repository"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
 )
 
 type AuthHandler struct {
@@ -19,6 +24,18 @@ func NewAuthHandler(authService *auth.AuthService, cfg *config.Config) *AuthHand
 	}
 }
 
+// Register creates a local account and signs it in
+// @Summary Register new user
+// @Description Create a local account and get a token pair
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body auth.RegisterRequest true "Registration data"
+// @Success 200 {object} auth.TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/register [post]
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var input struct {
 		Email    string `json:"email"`
@@ -33,37 +50,49 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	}
 
 	user, err := h.authService.Register(input.Email, input.Password, input.Name)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+	if errors.Is(err, auth.ErrRegistrationDisabled) || errors.Is(err, auth.ErrEmailDomainNotAllowed) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
-
-	accessToken, refreshToken, err := auth.GenerateTokenPair(
-		user.ID,
-		user.Email,
-		user.Accesses, // Add accesses
-		h.config,
-	)
+	if errors.Is(err, repository.ErrConflict) {
+		// Lost a race with another registration for the same email
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "user already exists",
+		})
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate tokens",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
 
-	err = h.authService.UpdateRefreshToken(user.ID, refreshToken)
+	tokens, err := h.authService.StartSession(user, sessionInfo(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save refresh token",
+			"error": "Failed to generate tokens",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
 	})
 }
 
+// Login handles email/password sign-in
+// @Summary Login user
+// @Description Authenticate with email and password and get a token pair
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body auth.LoginRequest true "Login data"
+// @Success 200 {object} auth.LoginResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Session limit reached"
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var input struct {
 		Email    string `json:"email"`
@@ -76,17 +105,21 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
-	loginResponse, err := h.authService.Login(input.Email, input.Password)
-	if err != nil {
+	loginResponse, err := h.authService.Login(input.Email, input.Password, sessionInfo(c))
+	if errors.Is(err, auth.ErrTooManySessions) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Too many active sessions; sign out on another device first",
+		})
+	}
+	if errors.Is(err, auth.ErrInvalidCredentials) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
-
-	// Check if user is active
-	if !loginResponse.User.IsActive {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Account is deactivated",
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to log in")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log in",
 		})
 	}
 
@@ -117,42 +150,39 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate the refresh token
-	claims, err := h.authService.ValidateRefreshToken(input.RefreshToken)
-	if err != nil {
+	tokens, err := h.authService.Refresh(input.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid or expired refresh token",
 		})
 	}
-
-	// Generate new token pair
-	accessToken, refreshToken, err := auth.GenerateTokenPair(
-		claims.UserID,
-		claims.Email,
-		claims.Accesses, // Add accesses from claims
-		h.config,
-	)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate tokens",
-		})
-	}
-
-	// Update refresh token in database
-	if err := h.authService.UpdateRefreshToken(claims.UserID, refreshToken); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update refresh token",
+			"error": "Failed to refresh tokens",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
 	})
 }
 
+// GetMe returns the signed-in user
+// @Summary Get user profile
+// @Description Get the current user's profile
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.User
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/me [get]
 func (h *AuthHandler) GetMe(c *fiber.Ctx) error {
-	claims := c.Locals("user").(*auth.Claims)
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
 	user, err := h.authService.GetUserByID(claims.UserID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -163,12 +193,76 @@ func (h *AuthHandler) GetMe(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// ExchangeRequest represents the OAuth code exchange request payload
+type ExchangeRequest struct {
+	Code string `json:"code" example:"q8ZkD3..."`
+}
+
+// ExchangeCode swaps a one-time OAuth exchange code for a token pair
+// @Summary Exchange OAuth code
+// @Description Swap the one-time code from the OAuth callback redirect for a token pair
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ExchangeRequest true "Exchange code"
+// @Success 200 {object} auth.LoginResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Account is deactivated"
+// @Failure 409 {object} ErrorResponse "Session limit reached"
+// @Router /auth/exchange [post]
+func (h *AuthHandler) ExchangeCode(c *fiber.Ctx) error {
+	var input ExchangeRequest
+	if err := c.BodyParser(&input); err != nil || input.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input - expected JSON with code field",
+		})
+	}
+
+	loginResponse, err := h.authService.RedeemExchangeCode(input.Code, sessionInfo(c))
+	if errors.Is(err, auth.ErrInvalidExchangeCode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired code",
+		})
+	}
+	if errors.Is(err, auth.ErrAccountDeactivated) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account is deactivated",
+		})
+	}
+	if errors.Is(err, auth.ErrTooManySessions) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Too many active sessions; sign out on another device first",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to exchange code",
+		})
+	}
+
+	return c.JSON(loginResponse)
+}
+
 // LogoutRequest represents the logout request payload
 type LogoutRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
 // Logout handles user logout
+// @Summary Logout user
+// @Description Revoke the given refresh token and the session it belongs to
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body LogoutRequest true "Logout request"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Not allowed while impersonating"
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/logout [post]
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	var input LogoutRequest
 	if err := c.BodyParser(&input); err != nil {
@@ -178,7 +272,10 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	}
 
 	// Get user from context (set by auth middleware)
-	claims := c.Locals("user").(*auth.Claims)
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
 
 	// Block refresh token
 	err := h.authService.BlockRefreshToken(claims.UserID, input.RefreshToken)
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exchangeCodes answers the exchange code statements from an in-memory table
+// and serves user u1 for everything else
+type exchangeCodes struct {
+	mu    sync.Mutex
+	users map[string]string // code hash -> user ID
+}
+
+func (e *exchangeCodes) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case stmt.Is("INSERT") && stmt.Mentions("auth_exchange_codes"):
+		e.users[stmt.Args[0].(string)] = stmt.Args[1].(string)
+		return &dbtest.Result{Affected: 1}, nil
+	case stmt.Is("DELETE") && stmt.Mentions("auth_exchange_codes"):
+		hash := stmt.Args[0].(string)
+		result := &dbtest.Result{Columns: []string{"code_hash", "user_id", "expires_at", "created_at"}}
+		if userID, ok := e.users[hash]; ok {
+			delete(e.users, hash)
+			result.Rows = [][]interface{}{{hash, userID, time.Now().Add(time.Minute), time.Now()}}
+			result.Affected = 1
+		}
+		return result, nil
+	case stmt.Is("SELECT") && stmt.Mentions("count("):
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "name", "provider", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", "Ann", "google", "{user}", true}},
+		}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestExchangeCode(t *testing.T) {
+	configtest.Load(t, nil)
+	codes := &exchangeCodes{users: map[string]string{}}
+	h, _ := newTestAuthHandler(t, codes.answer)
+
+	code, err := h.authService.CreateExchangeCode("u1")
+	if err != nil {
+		t.Fatalf("CreateExchangeCode() = %v", err)
+	}
+	if _, stored := codes.users[code]; stored {
+		t.Error("the exchange code was stored in the clear")
+	}
+
+	app := fiber.New()
+	app.Post("/auth/exchange", h.ExchangeCode)
+
+	var resp auth.LoginResponse
+	if status := call(t, app, "POST", "/auth/exchange", ExchangeRequest{Code: code}, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if resp.User == nil || resp.User.ID != "u1" {
+		t.Errorf("user = %+v, want u1", resp.User)
+	}
+	if resp.Token.AccessToken == "" || resp.Token.RefreshToken == "" {
+		t.Errorf("tokens = %+v, want an access and a refresh token", resp.Token)
+	}
+
+	if status := call(t, app, "POST", "/auth/exchange", ExchangeRequest{Code: code}, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("reusing the code: status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+}
+
+func TestExchangeCodeRejectsUnknownCodes(t *testing.T) {
+	configtest.Load(t, nil)
+	h, fake := newTestAuthHandler(t, (&exchangeCodes{users: map[string]string{}}).answer)
+
+	app := fiber.New()
+	app.Post("/auth/exchange", h.ExchangeCode)
+
+	if status := call(t, app, "POST", "/auth/exchange", ExchangeRequest{Code: "made-up"}, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if sessions := fake.Find("INSERT", "refresh_sessions"); len(sessions) != 0 {
+		t.Errorf("started %d sessions for an unknown code", len(sessions))
+	}
+}
+
+func TestRegisterHonoursTheRegistrationSettings(t *testing.T) {
+	tests := []struct {
+		name       string
+		overrides  map[string]interface{}
+		email      string
+		wantStatus int
+	}{
+		{"registration open", nil, "ann@example.com", fiber.StatusOK},
+		{"registration disabled", map[string]interface{}{"auth.allowLocalRegistration": false}, "ann@example.com", fiber.StatusForbidden},
+		{"allowed domain", map[string]interface{}{"auth.allowedEmailDomains": []string{"example.com"}}, "ann@Example.com", fiber.StatusOK},
+		{"disallowed domain", map[string]interface{}{"auth.allowedEmailDomains": []string{"example.com"}}, "ann@example.org", fiber.StatusForbidden},
+		{"lookalike subdomain", map[string]interface{}{"auth.allowedEmailDomains": []string{"example.com"}}, "ann@evil.example.com", fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configtest.Load(t, tt.overrides)
+			h, fake := newTestAuthHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				switch {
+				case stmt.Is("SELECT") && stmt.Mentions("FOR UPDATE"):
+					return &dbtest.Result{Columns: []string{"id"}, Rows: [][]interface{}{{"u1"}}}, nil
+				case stmt.Is("SELECT") && stmt.Mentions("count("):
+					return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+
+			app := fiber.New()
+			app.Post("/auth/register", h.Register)
+
+			body := map[string]string{"email": tt.email, "password": "correct horse battery", "name": "Ann"}
+			if status := call(t, app, "POST", "/auth/register", body, nil); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			created := len(fake.Find("INSERT", `"users"`)) > 0
+			if want := tt.wantStatus == fiber.StatusOK; created != want {
+				t.Errorf("created a user = %v, want %v", created, want)
+			}
+		})
+	}
+}
+
+func TestRegisterChecksNameAndEmailLengths(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		user       string
+		wantStatus int
+	}{
+		{"normal", "ann@example.com", "Ann Lee", fiber.StatusOK},
+		{"name at the limit", "ann@example.com", "Annabel Le", fiber.StatusOK},
+		{"name over the limit", "ann@example.com", "Annabel Lee", fiber.StatusBadRequest},
+		{"email over the limit", "annabel.lee@example.com", "Ann", fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configtest.Load(t, map[string]interface{}{"auth.maxNameLength": 10, "auth.maxEmailLength": 20})
+			h, fake := newTestAuthHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				switch {
+				case stmt.Is("SELECT") && stmt.Mentions("FOR UPDATE"):
+					return &dbtest.Result{Columns: []string{"id"}, Rows: [][]interface{}{{"u1"}}}, nil
+				case stmt.Is("SELECT") && stmt.Mentions("count("):
+					return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(0)}}}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+
+			app := fiber.New()
+			app.Post("/auth/register", h.Register)
+
+			body := map[string]string{"email": tt.email, "password": "correct horse battery", "name": tt.user}
+			if status := call(t, app, "POST", "/auth/register", body, nil); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			inserts := fake.Find("INSERT", `"users"`)
+			if tt.wantStatus != fiber.StatusOK {
+				if len(inserts) != 0 {
+					t.Errorf("created a user with an over-long field")
+				}
+				return
+			}
+			if len(inserts) != 1 || !hasArg(inserts[0].Args, tt.user) {
+				t.Errorf("user inserts = %v, want one named %q", inserts, tt.user)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// setTokenCookie returns the token cookie set for a request under cfg
+func setTokenCookie(t *testing.T, cfg *config.AuthConfig) *http.Cookie {
+	t.Helper()
+
+	app := fiber.New()
+	app.Get("/callback", func(c *fiber.Ctx) error {
+		c.Cookie(tokenCookie(c, cfg, "token-value"))
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/callback", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("set %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+func TestTokenCookieAttributes(t *testing.T) {
+	secure := true
+	cookie := setTokenCookie(t, &config.AuthConfig{
+		TokenDuration: 24,
+		Cookie: config.CookieConfig{
+			Name:     "bedrud_token",
+			Domain:   "example.com",
+			Path:     "/api",
+			SameSite: "None",
+			Secure:   &secure,
+			MaxAge:   600,
+		},
+	})
+
+	if cookie.Name != "bedrud_token" || cookie.Value != "token-value" {
+		t.Errorf("cookie %s=%s, want bedrud_token=token-value", cookie.Name, cookie.Value)
+	}
+	if cookie.Domain != "example.com" || cookie.Path != "/api" {
+		t.Errorf("domain %q, path %q, want example.com and /api", cookie.Domain, cookie.Path)
+	}
+	if cookie.SameSite != http.SameSiteNoneMode || !cookie.Secure || !cookie.HttpOnly {
+		t.Errorf("sameSite %v, secure %v, httpOnly %v, want None, secure and HTTP only", cookie.SameSite, cookie.Secure, cookie.HttpOnly)
+	}
+	if until := time.Until(cookie.Expires); until < 9*time.Minute || until > 10*time.Minute {
+		t.Errorf("cookie expires in %v, want the configured 10 minutes", until)
+	}
+}
+
+func TestTokenCookieDefaults(t *testing.T) {
+	cookie := setTokenCookie(t, &config.AuthConfig{
+		TokenDuration: 24,
+		Cookie:        config.CookieConfig{Name: "jwt", Path: "/", SameSite: "Lax"},
+	})
+
+	if cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("sameSite = %v, want Lax", cookie.SameSite)
+	}
+	if cookie.Secure {
+		t.Error("cookie is secure on a plain HTTP request without secure configured")
+	}
+	if until := time.Until(cookie.Expires); until < 23*time.Hour || until > 24*time.Hour {
+		t.Errorf("cookie expires in %v, want the token duration of 24h", until)
+	}
+}
+
+func TestListProviders(t *testing.T) {
+	google := config.OAuth2Config{ClientID: "google-id", ClientSecret: "google-secret"}
+	tests := []struct {
+		name string
+		auth config.AuthConfig
+		want []ProviderInfo
+	}{
+		{"none configured", config.AuthConfig{}, []ProviderInfo{}},
+		{
+			"only Google configured",
+			config.AuthConfig{Google: google, Github: config.OAuth2Config{ClientID: "github-id"}},
+			[]ProviderInfo{{Name: "google", DisplayName: "Google", LoginURL: "/auth/google/login"}},
+		},
+		{
+			"custom display name",
+			config.AuthConfig{Twitter: config.OAuth2Config{ClientID: "x-id", ClientSecret: "x-secret", DisplayName: "X"}},
+			[]ProviderInfo{{Name: "twitter", DisplayName: "X", LoginURL: "/auth/twitter/login"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(nil, &config.Config{Auth: tt.auth})
+			app := fiber.New()
+			app.Get("/auth/providers", h.ListProviders)
+
+			var got []ProviderInfo
+			if status := call(t, app, "GET", "/auth/providers", nil, &got); status != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("providers = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListProvidersHidesSecrets(t *testing.T) {
+	h := NewAuthHandler(nil, &config.Config{Auth: config.AuthConfig{
+		Google: config.OAuth2Config{ClientID: "google-id", ClientSecret: "google-secret"},
+	}})
+	app := fiber.New()
+	app.Get("/auth/providers", h.ListProviders)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/auth/providers", nil))
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the response: %v", err)
+	}
+	for _, secret := range []string{"google-id", "google-secret"} {
+		if strings.Contains(string(body), secret) {
+			t.Errorf("response %s contains %q", body, secret)
+		}
+	}
+}
+
+func TestAllowedRedirect(t *testing.T) {
+	allowed := []string{"https://app.example.com", "https://staging.example.com:8443/login"}
+
+	tests := []struct {
+		target     string
+		wantOrigin string
+		wantOK     bool
+	}{
+		{"https://app.example.com/rooms/standup", "https://app.example.com", true},
+		{"https://APP.example.com", "https://app.example.com", true},
+		{"https://staging.example.com:8443/", "https://staging.example.com:8443", true},
+		{"https://staging.example.com/", "", false},
+		{"http://app.example.com", "", false},
+		{"https://evil.example.com", "", false},
+		{"https://app.example.com.evil.example.com", "", false},
+		{"https://app.example.com@evil.example.com", "", false},
+		{"https://user@app.example.com", "", false},
+		{"//app.example.com", "", false},
+		{"javascript:alert(1)", "", false},
+		{"/rooms", "", false},
+	}
+
+	for _, tt := range tests {
+		origin, ok := allowedRedirect(tt.target, allowed)
+		if origin != tt.wantOrigin || ok != tt.wantOK {
+			t.Errorf("allowedRedirect(%q) = %q, %v, want %q, %v", tt.target, origin, ok, tt.wantOrigin, tt.wantOK)
+		}
+	}
+}
+
+func TestOAuthRedirect(t *testing.T) {
+	t.Setenv("AUTH_FRONTEND_URL", "https://app.example.com")
+	configtest.Load(t, map[string]interface{}{
+		"auth.allowedRedirectURLs": []string{"https://partner.example.org"},
+	})
+
+	app := fiber.New()
+	app.Get("/auth/:provider", BeginAuthHandler)
+	app.Get("/auth/:provider/callback", func(c *fiber.Ctx) error {
+		return c.SendString((&AuthHandler{}).callbackFrontend(c))
+	})
+
+	t.Run("login", func(t *testing.T) {
+		tests := []struct {
+			redirect   string
+			wantCookie string
+		}{
+			{"https://partner.example.org/welcome", "https://partner.example.org"},
+			{"https://app.example.com/", "https://app.example.com"},
+			{"https://evil.example.com/", ""},
+		}
+
+		for _, tt := range tests {
+			resp, err := app.Test(httptest.NewRequest("GET", "/auth/google?redirect="+url.QueryEscape(tt.redirect), nil), -1)
+			if err != nil {
+				t.Fatalf("app.Test() = %v", err)
+			}
+			var chosen string
+			for _, cookie := range resp.Cookies() {
+				if cookie.Name == redirectCookieName {
+					chosen = cookie.Value
+				}
+			}
+			if chosen != tt.wantCookie {
+				t.Errorf("redirect %s: remembered %q, want %q", tt.redirect, chosen, tt.wantCookie)
+			}
+			if tt.wantCookie == "" && resp.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("redirect %s: status = %d, want %d", tt.redirect, resp.StatusCode, fiber.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		tests := []struct {
+			cookie string
+			want   string
+		}{
+			{"", "https://app.example.com"},
+			{"https://partner.example.org", "https://partner.example.org"},
+			{"https://evil.example.com", "https://app.example.com"},
+		}
+
+		for _, tt := range tests {
+			req := httptest.NewRequest("GET", "/auth/google/callback", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: redirectCookieName, Value: tt.cookie})
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test() = %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.want {
+				t.Errorf("cookie %q: frontend = %q, want %q", tt.cookie, body, tt.want)
+			}
+		}
+	})
+}
+
+// flakyUsers fails the first failures provider lookups with err, then finds no
+// account so the user gets created
+func flakyUsers(t *testing.T, failures int, err error) (*repository.UserRepository, *int) {
+	t.Helper()
+
+	lookups := 0
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions("provider_user_id") {
+			lookups++
+			if lookups <= failures {
+				return nil, err
+			}
+			return &dbtest.Result{Columns: []string{"id"}}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	return repository.NewUserRepository(db), &lookups
+}
+
+func TestPersistOAuthUser(t *testing.T) {
+	transient := &pgconn.PgError{Code: "40001"}
+
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		wantErr     bool
+		wantLookups int
+	}{
+		{"first try", 0, nil, false, 1},
+		{"transient failure succeeds on retry", 1, transient, false, 2},
+		{"persistent transient failure", oauthPersistAttempts, transient, true, oauthPersistAttempts},
+		{"other failures aren't retried", 1, errors.New("permission denied"), true, 1},
+	}
+
+	for _, tt := range tests {
+		userRepo, lookups := flakyUsers(t, tt.failures, tt.err)
+		user := &models.User{Email: "ann@example.com", Provider: "google", ProviderUserID: "12345"}
+
+		err := persistOAuthUser(userRepo, user)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: persistOAuthUser() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if *lookups != tt.wantLookups {
+			t.Errorf("%s: %d attempts, want %d", tt.name, *lookups, tt.wantLookups)
+		}
+		if !tt.wantErr && user.ID == "" {
+			t.Errorf("%s: the user wasn't created", tt.name)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/account"
+	"bedrud-backend/internal/ctxutil"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/livekit/protocol/livekit"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxChatMute is the longest timed chat mute; longer ones should be a block
+const maxChatMute = 7 * 24 * time.Hour
+
+// ChatMuteRequest mutes a participant's chat. Duration is in seconds; without
+// it the participant is blocked from chatting until their state is reset.
+type ChatMuteRequest struct {
+	Duration int `json:"duration" example:"600"`
+}
+
+// ChatMuteResponse describes the chat mute now in force
+type ChatMuteResponse struct {
+	UserID         string     `json:"userId"`
+	IsChatBlocked  bool       `json:"isChatBlocked"`  // blocked until reset
+	ChatMutedUntil *time.Time `json:"chatMutedUntil"` // end of a timed mute
+}
+
+// @Summary Mute a participant's chat
+// @Description Stop a participant from sending chat messages, for duration seconds or, without one, until their state is reset. A timed mute lifts itself once it runs out. Chat travels over LiveKit data messages and LiveKit can't restrict those by topic, so a muted participant can't send any data messages, including non-chat ones such as reactions (room admins and moderators only).
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param userId path string true "User ID"
+// @Param request body ChatMuteRequest false "Mute duration"
+// @Success 200 {object} ChatMuteResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/participants/{userId}/chat-mute [post]
+func (h *RoomHandler) ChatMuteParticipant(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	userID := c.Params("userId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var req ChatMuteRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	duration := time.Duration(req.Duration) * time.Second
+	if req.Duration < 0 || duration > maxChatMute {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("duration must be between 1 and %d seconds, or omitted to block chat until reset", int(maxChatMute.Seconds())),
+		})
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can mute chat",
+		})
+	}
+
+	user, err := h.roomRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Participant not found",
+		})
+	}
+
+	var until *time.Time
+	if duration > 0 {
+		end := time.Now().Add(duration)
+		until = &end
+	}
+	found, err := h.roomRepo.MuteChat(room.ID, user.ID, until)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to mute participant chat")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to mute chat",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Participant not found",
+		})
+	}
+
+	// Chat travels over LiveKit data messages, so the mute is applied there;
+	// join tokens issued while it lasts carry no data publishing either
+	h.setUserDataPublishing(c.UserContext(), room.Name, user, false)
+	_ = h.auditRepo.Record(claims.UserID, models.AuditRoomChatMuted, "room", room.ID, map[string]interface{}{
+		"userId":   user.ID,
+		"duration": req.Duration,
+	})
+
+	participant, err := h.roomRepo.GetParticipant(room.ID, user.ID)
+	if err != nil || participant == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load participant",
+		})
+	}
+	return c.JSON(ChatMuteResponse{
+		UserID:         user.ID,
+		IsChatBlocked:  participant.IsChatBlocked,
+		ChatMutedUntil: participant.ChatMutedUntil,
+	})
+}
+
+// activeChatMute returns when the participant's timed chat mute ends, or nil
+// when none is running
+func activeChatMute(participant *models.RoomParticipant) *time.Time {
+	if participant.ChatMutedUntil == nil || !time.Now().Before(*participant.ChatMutedUntil) {
+		return nil
+	}
+	return participant.ChatMutedUntil
+}
+
+// chatAllowed reports whether a participant may chat right now: their room
+// permissions allow it and no chat mute is in force. Participants who joined
+// before joiner permissions existed have no permissions row and get the room's.
+func (h *RoomHandler) chatAllowed(room *models.Room, userID string) (bool, error) {
+	participant, err := h.roomRepo.GetParticipant(room.ID, userID)
+	if err != nil {
+		return false, err
+	}
+	if participant != nil && participant.ChatMuted() {
+		return false, nil
+	}
+
+	permissions, err := h.roomRepo.GetParticipantPermissions(room.ID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return room.JoinerPermissions.CanChat, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return permissions.CanChat, nil
+}
+
+// applyChatPermission brings the user's LiveKit data publishing in line with
+// chatAllowed. Failures are logged; the next join token carries the right grant.
+func (h *RoomHandler) applyChatPermission(ctx context.Context, room *models.Room, userID string) {
+	canChat, err := h.chatAllowed(room, userID)
+	if err != nil {
+		log.Warn().Err(err).Str("room", room.Name).Str("userId", userID).Msg("Failed to load chat permission")
+		return
+	}
+	user, err := h.roomRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		log.Warn().Err(err).Str("room", room.Name).Str("userId", userID).Msg("Failed to load user for chat permission")
+		return
+	}
+	h.setUserDataPublishing(ctx, room.Name, user, canChat)
+}
+
+// setDataPublishing grants or revokes a LiveKit participant's right to send
+// data messages, leaving the rest of their permissions as they are
+func (h *RoomHandler) setDataPublishing(ctx context.Context, roomName string, lkParticipant *livekit.ParticipantInfo, allowed bool) error {
+	permission, _ := proto.Clone(lkParticipant.GetPermission()).(*livekit.ParticipantPermission)
+	if permission == nil {
+		return nil
+	}
+	if permission.GetCanPublishData() == allowed {
+		return nil
+	}
+	permission.CanPublishData = allowed
+
+	_, err := h.roomService.UpdateParticipant(ctx, &livekit.UpdateParticipantRequest{
+		Room:       roomName,
+		Identity:   lkParticipant.GetIdentity(),
+		Permission: permission,
+	})
+	return err
+}
+
+// setUserDataPublishing applies setDataPublishing to every connection the user
+// has in the room. Failures are logged: the room may not exist in LiveKit, and
+// a participant who joins later is handled by EnforceChatMute.
+func (h *RoomHandler) setUserDataPublishing(ctx context.Context, roomName string, user *models.User, allowed bool) {
+	res, err := h.roomService.ListParticipants(ctx, &livekit.ListParticipantsRequest{
+		Room: roomName,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("room", roomName).Msg("Failed to list LiveKit participants")
+		return
+	}
+
+	for _, p := range res.GetParticipants() {
+		if !account.IsUserIdentity(h.identityStrategy, p.GetIdentity(), user) {
+			continue
+		}
+		if err := h.setDataPublishing(ctx, roomName, p, allowed); err != nil {
+			log.Warn().Err(err).
+				Str("room", roomName).
+				Str("identity", p.GetIdentity()).
+				Bool("allowed", allowed).
+				Msg("Failed to update LiveKit data permission")
+		}
+	}
+}
+
+// EnforceChatMute handles a participant_joined webhook: a participant whose
+// chat is muted joins with data publishing turned off again
+func (h *RoomHandler) EnforceChatMute(ctx context.Context, roomName string, lkParticipant *livekit.ParticipantInfo) error {
+	room, err := h.roomRepo.GetRoomByName(roomName)
+	if err != nil || room == nil {
+		return err
+	}
+
+	muted, err := h.roomRepo.GetChatMutes(room.ID)
+	if err != nil {
+		return err
+	}
+	for _, participant := range muted {
+		if participant.User != nil && account.IsUserIdentity(h.identityStrategy, lkParticipant.GetIdentity(), participant.User) {
+			return h.setDataPublishing(ctx, room.Name, lkParticipant, false)
+		}
+	}
+	return nil
+}
+
+// SweepChatMutes lifts timed chat mutes that have run out, giving the
+// participants back data publishing in LiveKit where their permissions allow
+// chat. It returns how many mutes were lifted.
+func (h *RoomHandler) SweepChatMutes(ctx context.Context) (int, error) {
+	expired, err := h.roomRepo.ExpireChatMutes()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, participant := range expired {
+		if participant.Room == nil || !participant.Room.IsActive {
+			continue
+		}
+		// A chat block or a room permission without chat still applies
+		h.applyChatPermission(ctx, participant.Room, participant.UserID)
+	}
+	return len(expired), nil
+}
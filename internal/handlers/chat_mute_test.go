@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/livekit/protocol/livekit"
+)
+
+// chatMuteRoom plays room r1 named standup with participant u2, whose chat
+// mute follows the updates run against it
+type chatMuteRoom struct {
+	mu      sync.Mutex
+	blocked bool
+	until   interface{} // time.Time or nil
+}
+
+func (f *chatMuteRoom) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "name", "is_active", "expires_at", "joiner_can_chat"},
+			Rows:    [][]interface{}{{"r1", "standup", true, time.Now().Add(time.Hour), true}},
+		}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+		result := &dbtest.Result{Columns: []string{"id", "room_id", "user_id", "is_active", "is_chat_blocked", "chat_muted_until"}}
+		until, timed := f.until.(time.Time)
+		if stmt.Mentions("chat_muted_until <=") && (!timed || until.After(stmt.Args[0].(time.Time))) {
+			return result, nil
+		}
+		result.Rows = [][]interface{}{{"p2", "r1", "u2", true, f.blocked, f.until}}
+		return result, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`):
+		return &dbtest.Result{Columns: []string{"room_id", "user_id", "can_chat"}, Rows: [][]interface{}{{"r1", "u2", true}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "name", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u2", "bob@example.com", "Bob", "{user}", true}},
+		}, nil
+	case stmt.Is("UPDATE") && stmt.Mentions(`"room_participants"`):
+		if v, ok := stmt.Value("is_chat_blocked"); ok {
+			f.blocked = v.(bool)
+		}
+		if v, ok := stmt.Value("chat_muted_until"); ok {
+			f.until = v
+		}
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+// connections returns u2's LiveKit connection, allowed to send data messages or not
+func connections(canPublishData bool) map[string][]*livekit.ParticipantInfo {
+	return map[string][]*livekit.ParticipantInfo{"standup": {{
+		Identity:   "u2",
+		Permission: &livekit.ParticipantPermission{CanPublish: true, CanSubscribe: true, CanPublishData: canPublishData},
+	}}}
+}
+
+func TestTimedChatMuteBlocksThenExpires(t *testing.T) {
+	room := &chatMuteRoom{}
+	h, fake := newTestRoomHandler(t, room.answer)
+	h.identityStrategy = config.IdentityUserID
+	lk := newFakeRoomService("standup")
+	lk.participants = connections(true)
+	h.roomService = lk
+
+	app := fiber.New()
+	app.Post("/rooms/:roomId/participants/:userId/chat-mute", signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}}), h.ChatMuteParticipant)
+
+	var resp ChatMuteResponse
+	if status := call(t, app, "POST", "/rooms/r1/participants/u2/chat-mute", ChatMuteRequest{Duration: 600}, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if resp.IsChatBlocked || resp.ChatMutedUntil == nil || time.Until(*resp.ChatMutedUntil) < 9*time.Minute {
+		t.Errorf("response = %+v, want a timed mute for about 10 minutes", resp)
+	}
+	if len(lk.updates) != 1 || lk.updates[0].Identity != "u2" || lk.updates[0].Permission.CanPublishData {
+		t.Errorf("LiveKit participant updates = %v, want u2's data publishing turned off", lk.updates)
+	}
+	r1, _ := h.roomRepo.GetRoom("r1")
+	if allowed, err := h.chatAllowed(r1, "u2"); allowed || err != nil {
+		t.Errorf("while muted: chatAllowed() = %v, %v, want false", allowed, err)
+	}
+	if audits := fake.Find("INSERT", `"audit_logs"`); len(audits) != 1 {
+		t.Errorf("audit entries = %v, want the mute", audits)
+	}
+
+	// The mute runs out; it no longer applies even before the sweep clears it
+	room.mu.Lock()
+	room.until = time.Now().Add(-time.Second)
+	room.mu.Unlock()
+	lk.participants = connections(false)
+
+	if allowed, err := h.chatAllowed(r1, "u2"); !allowed || err != nil {
+		t.Errorf("after expiry: chatAllowed() = %v, %v, want true", allowed, err)
+	}
+
+	lifted, err := h.SweepChatMutes(context.Background())
+	if err != nil || lifted != 1 {
+		t.Fatalf("SweepChatMutes() = %d, %v, want 1 lifted", lifted, err)
+	}
+	if room.until != nil {
+		t.Errorf("chat_muted_until = %v after the sweep, want it cleared", room.until)
+	}
+	if len(lk.updates) != 2 || !lk.updates[1].Permission.CanPublishData {
+		t.Errorf("LiveKit participant updates = %v, want u2's data publishing back on", lk.updates)
+	}
+
+	if lifted, err := h.SweepChatMutes(context.Background()); err != nil || lifted != 0 {
+		t.Errorf("second SweepChatMutes() = %d, %v, want nothing left to lift", lifted, err)
+	}
+}
+
+func TestChatMuteParticipant(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        interface{}
+		wantStatus  int
+		wantBlocked bool
+		wantTimed   bool
+	}{
+		{"without a duration", nil, fiber.StatusOK, true, false},
+		{"timed", ChatMuteRequest{Duration: 60}, fiber.StatusOK, false, true},
+		{"negative duration", ChatMuteRequest{Duration: -1}, fiber.StatusBadRequest, false, false},
+		{"longer than a week", ChatMuteRequest{Duration: int(maxChatMute.Seconds()) + 1}, fiber.StatusBadRequest, false, false},
+	}
+
+	for _, tt := range tests {
+		room := &chatMuteRoom{}
+		h, _ := newTestRoomHandler(t, room.answer)
+		h.identityStrategy = config.IdentityUserID
+		lk := newFakeRoomService("standup")
+		lk.participants = connections(true)
+		h.roomService = lk
+
+		app := fiber.New()
+		app.Post("/rooms/:roomId/participants/:userId/chat-mute", signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}}), h.ChatMuteParticipant)
+
+		if status := call(t, app, "POST", "/rooms/r1/participants/u2/chat-mute", tt.body, nil); status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+		_, timed := room.until.(time.Time)
+		if room.blocked != tt.wantBlocked || timed != tt.wantTimed {
+			t.Errorf("%s: blocked %v, timed %v, want %v and %v", tt.name, room.blocked, timed, tt.wantBlocked, tt.wantTimed)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var errDisplayNameTaken = errors.New("another participant in this room is already using this name")
+
+// checkDisplayName holds a name chosen for use in a room to the rules user
+// names follow: not blank, within auth.maxNameLength and free of control
+// characters
+func checkDisplayName(name string) error {
+	max := config.Get().Auth.MaxNameLength
+	if strings.TrimSpace(name) == "" || utf8.RuneCountInString(name) > max {
+		return fmt.Errorf("name must be between 1 and %d characters", max)
+	}
+	for _, ch := range name {
+		if unicode.IsControl(ch) {
+			return errors.New("name must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// uniqueDisplayName picks the in-room name for a joining participant. With
+// reject, a name already used by an active participant is an error; with
+// suffix, " (2)", " (3)", ... is appended until the name is free. Names are
+// compared ignoring case and surrounding space.
+func uniqueDisplayName(name string, taken []string, mode string) (string, error) {
+	name = strings.TrimSpace(name)
+	if mode != config.DisplayNamesReject && mode != config.DisplayNamesSuffix {
+		return name, nil
+	}
+
+	used := make(map[string]bool, len(taken))
+	for _, other := range taken {
+		used[strings.ToLower(strings.TrimSpace(other))] = true
+	}
+	if !used[strings.ToLower(name)] {
+		return name, nil
+	}
+	if mode == config.DisplayNamesReject {
+		return "", errDisplayNameTaken
+	}
+
+	for n := 2; ; n++ {
+		candidate := name + " (" + strconv.Itoa(n) + ")"
+		if !used[strings.ToLower(candidate)] {
+			return candidate, nil
+		}
+	}
+}
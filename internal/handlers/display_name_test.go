@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"errors"
+	"testing"
+)
+
+func TestUniqueDisplayName(t *testing.T) {
+	tests := []struct {
+		name    string
+		taken   []string
+		mode    string
+		want    string
+		wantErr error
+	}{
+		{"Alex", []string{"alex"}, config.DisplayNamesOff, "Alex", nil},
+		{"Alex", []string{"Sam"}, config.DisplayNamesReject, "Alex", nil},
+		{"Alex", []string{" alex "}, config.DisplayNamesReject, "", errDisplayNameTaken},
+		{"Alex", []string{"Sam"}, config.DisplayNamesSuffix, "Alex", nil},
+		{"Alex", []string{"ALEX"}, config.DisplayNamesSuffix, "Alex (2)", nil},
+		{"Alex", []string{"Alex", "alex (2)"}, config.DisplayNamesSuffix, "Alex (3)", nil},
+		{"  Alex ", nil, config.DisplayNamesSuffix, "Alex", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := uniqueDisplayName(tt.name, tt.taken, tt.mode)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("uniqueDisplayName(%q, %q, %s) = %q, %v, want %q, %v", tt.name, tt.taken, tt.mode, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/livekit/protocol/livekit"
+)
+
+// signedIn stands in for middleware.Protected, signing every request in with claims
+func signedIn(claims *auth.Claims) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctxutil.SetClaims(c, claims)
+		if claims.TenantID != "" {
+			ctxutil.SetTenantID(c, claims.TenantID)
+		}
+		return c.Next()
+	}
+}
+
+// call sends a request with an optional JSON body to app and decodes the JSON
+// response into out, if given. It returns the status code.
+func call(t *testing.T, app *fiber.App, method, target string, body, out interface{}) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode response: %v", method, target, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// hasArg reports whether args contains value
+func hasArg(args []interface{}, value interface{}) bool {
+	for _, arg := range args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeRoomService is a LiveKit room service holding rooms in memory. Methods
+// the tests don't need panic through the nil embedded interface.
+type fakeRoomService struct {
+	RoomService
+
+	mu        sync.Mutex
+	rooms     map[string]*livekit.Room
+	created   []*livekit.CreateRoomRequest
+	deleted   []string
+	createErr map[string]error // room name -> error CreateRoom fails with
+	deleteErr map[string]error // room name -> error DeleteRoom fails with
+
+	participants map[string][]*livekit.ParticipantInfo // room name -> participants
+	removed      []*livekit.RoomParticipantIdentity
+	mutes        []*livekit.MuteRoomTrackRequest
+	updates      []*livekit.UpdateParticipantRequest
+	metadata     []*livekit.UpdateRoomMetadataRequest
+	sent         []*livekit.SendDataRequest
+}
+
+func newFakeRoomService(names ...string) *fakeRoomService {
+	f := &fakeRoomService{rooms: map[string]*livekit.Room{}}
+	for _, name := range names {
+		f.rooms[name] = &livekit.Room{Name: name}
+	}
+	return f
+}
+
+func (f *fakeRoomService) ListRooms(_ context.Context, req *livekit.ListRoomsRequest) (*livekit.ListRoomsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &livekit.ListRoomsResponse{}
+	for _, name := range req.Names {
+		if room, ok := f.rooms[name]; ok {
+			resp.Rooms = append(resp.Rooms, room)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeRoomService) CreateRoom(_ context.Context, req *livekit.CreateRoomRequest) (*livekit.Room, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.created = append(f.created, req)
+	if err := f.createErr[req.Name]; err != nil {
+		return nil, err
+	}
+	if room, ok := f.rooms[req.Name]; ok {
+		return room, nil
+	}
+	room := &livekit.Room{Name: req.Name, MaxParticipants: req.MaxParticipants, Metadata: req.Metadata}
+	f.rooms[req.Name] = room
+	return room, nil
+}
+
+func (f *fakeRoomService) DeleteRoom(_ context.Context, req *livekit.DeleteRoomRequest) (*livekit.DeleteRoomResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.deleteErr[req.Room]; err != nil {
+		return nil, err
+	}
+	f.deleted = append(f.deleted, req.Room)
+	delete(f.rooms, req.Room)
+	return &livekit.DeleteRoomResponse{}, nil
+}
+
+func (f *fakeRoomService) ListParticipants(_ context.Context, req *livekit.ListParticipantsRequest) (*livekit.ListParticipantsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &livekit.ListParticipantsResponse{Participants: f.participants[req.Room]}, nil
+}
+
+func (f *fakeRoomService) RemoveParticipant(_ context.Context, req *livekit.RoomParticipantIdentity) (*livekit.RemoveParticipantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.removed = append(f.removed, req)
+	if participants, ok := f.participants[req.Room]; ok {
+		var left []*livekit.ParticipantInfo
+		for _, p := range participants {
+			if p.Identity != req.Identity {
+				left = append(left, p)
+			}
+		}
+		f.participants[req.Room] = left
+	}
+	return &livekit.RemoveParticipantResponse{}, nil
+}
+
+func (f *fakeRoomService) MutePublishedTrack(_ context.Context, req *livekit.MuteRoomTrackRequest) (*livekit.MuteRoomTrackResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.mutes = append(f.mutes, req)
+	return &livekit.MuteRoomTrackResponse{}, nil
+}
+
+func (f *fakeRoomService) UpdateParticipant(_ context.Context, req *livekit.UpdateParticipantRequest) (*livekit.ParticipantInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.updates = append(f.updates, req)
+	return &livekit.ParticipantInfo{Identity: req.Identity, Permission: req.Permission}, nil
+}
+
+func (f *fakeRoomService) UpdateRoomMetadata(_ context.Context, req *livekit.UpdateRoomMetadataRequest) (*livekit.Room, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.metadata = append(f.metadata, req)
+	room, ok := f.rooms[req.Room]
+	if !ok {
+		return nil, errors.New("room not found")
+	}
+	room.Metadata = req.Metadata
+	return room, nil
+}
+
+func (f *fakeRoomService) SendData(_ context.Context, req *livekit.SendDataRequest) (*livekit.SendDataResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, req)
+	return &livekit.SendDataResponse{}, nil
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/account"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/realtime"
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/livekit/protocol/livekit"
+	"github.com/rs/zerolog/log"
+)
+
+// idleKickCallTimeout bounds each LiveKit call the idle sweep makes, so one
+// unresponsive room can't hold up the rest
+const idleKickCallTimeout = 10 * time.Second
+
+// publishingMedia reports whether a LiveKit participant has an unmuted track,
+// which counts as activity whatever the database says
+func publishingMedia(lkParticipant *livekit.ParticipantInfo) bool {
+	for _, track := range lkParticipant.GetTracks() {
+		if !track.GetMuted() {
+			return true
+		}
+	}
+	return false
+}
+
+// listening reports whether a LiveKit connection is connected and can take in
+// media someone else in the room publishes. Listen-only and muted attendees
+// are present this way without ever publishing or updating their state.
+func listening(lkParticipant *livekit.ParticipantInfo, all []*livekit.ParticipantInfo) bool {
+	if lkParticipant.GetState() != livekit.ParticipantInfo_ACTIVE {
+		return false
+	}
+	if permission := lkParticipant.GetPermission(); permission != nil && !permission.GetCanSubscribe() {
+		return false
+	}
+	for _, other := range all {
+		if other.GetSid() != lkParticipant.GetSid() && publishingMedia(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// lkLastActivity returns when a LiveKit connection was last known to be active:
+// the later of the participant's own last activity and the connection's join
+func lkLastActivity(participant *models.RoomParticipant, lkParticipant *livekit.ParticipantInfo) time.Time {
+	last := participant.LastActivity()
+	if joined := time.Unix(lkParticipant.GetJoinedAt(), 0); joined.After(last) {
+		return joined
+	}
+	return last
+}
+
+// SweepIdleParticipants removes participants idle for longer than idle from
+// the rooms that have kickIdle set. A LiveKit connection is idle when it
+// publishes no unmuted track, isn't connected and subscribed to someone
+// else's media, and neither it nor the participant has shown any activity
+// within idle; participants with no connection left are marked as
+// having left. Failures in one room are logged and the sweep moves on. It
+// returns how many participants were removed.
+func (h *RoomHandler) SweepIdleParticipants(ctx context.Context, idle time.Duration) (int, error) {
+	rooms, err := h.roomRepo.GetRoomsKickingIdle()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-idle)
+	removed := 0
+	for _, room := range rooms {
+		n, err := h.kickIdleInRoom(ctx, &room, cutoff)
+		removed += n
+		if err != nil {
+			log.Warn().Err(err).Str("room", room.Name).Msg("Failed to remove idle participants")
+		}
+	}
+	return removed, nil
+}
+
+// kickIdleInRoom removes the room's participants whose last activity is before cutoff
+func (h *RoomHandler) kickIdleInRoom(ctx context.Context, room *models.Room, cutoff time.Time) (int, error) {
+	participants, err := h.roomRepo.GetActiveParticipantsWithUsers(room.ID)
+	if err != nil || len(participants) == 0 {
+		return 0, err
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, idleKickCallTimeout)
+	res, err := h.roomService.ListParticipants(listCtx, &livekit.ListParticipantsRequest{
+		Room: room.Name,
+	})
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i := range participants {
+		participant := &participants[i]
+		if participant.User == nil {
+			continue
+		}
+
+		// Under the userId+device strategy a user may have several connections;
+		// they stay in the room while any of them is active
+		stillActive := false
+		for _, p := range res.GetParticipants() {
+			if !account.IsUserIdentity(h.identityStrategy, p.GetIdentity(), participant.User) {
+				continue
+			}
+			if publishingMedia(p) || listening(p, res.GetParticipants()) || !lkLastActivity(participant, p).Before(cutoff) {
+				stillActive = true
+				continue
+			}
+			removeCtx, cancel := context.WithTimeout(ctx, idleKickCallTimeout)
+			_, err := h.roomService.RemoveParticipant(removeCtx, &livekit.RoomParticipantIdentity{
+				Room:     room.Name,
+				Identity: p.GetIdentity(),
+			})
+			cancel()
+			if err != nil {
+				log.Warn().Err(err).Str("room", room.Name).Str("identity", p.GetIdentity()).Msg("Failed to remove idle LiveKit participant")
+				stillActive = true
+			}
+		}
+		if stillActive || !participant.LastActivity().Before(cutoff) {
+			continue
+		}
+
+		if err := h.roomRepo.RemoveParticipant(room.ID, participant.UserID); err != nil {
+			return removed, err
+		}
+		removed++
+		log.Info().Str("room", room.Name).Str("userId", participant.UserID).Msg("Removed idle participant")
+		h.hub.Publish(realtime.EventParticipantLeft, fiber.Map{
+			"roomId": room.ID,
+			"userId": participant.UserID,
+			"reason": "idle",
+		})
+	}
+	return removed, nil
+}
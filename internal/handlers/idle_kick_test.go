@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/dbtest"
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// idleRoom answers for room r1 named standup, which removes idle participants.
+// Each participant row is user ID, joined_at and last_active_at.
+type idleRoom struct {
+	participants [][]interface{}
+}
+
+func (r *idleRoom) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "name", "is_active", "settings_kick_idle"},
+			Rows:    [][]interface{}{{"r1", "standup", true, true}},
+		}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+		result := &dbtest.Result{Columns: []string{"id", "room_id", "user_id", "is_active", "joined_at", "last_active_at"}}
+		for _, p := range r.participants {
+			result.Rows = append(result.Rows, []interface{}{"p-" + p[0].(string), "r1", p[0], true, p[1], p[2]})
+		}
+		return result, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+		result := &dbtest.Result{Columns: []string{"id", "email"}}
+		for _, p := range r.participants {
+			result.Rows = append(result.Rows, []interface{}{p[0], p[0].(string) + "@example.com"})
+		}
+		return result, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+// leftUsers returns the users the database marked as having left, in order
+func leftUsers(fake *dbtest.DB) []string {
+	var users []string
+	for _, stmt := range fake.Find("UPDATE", `"room_participants"`) {
+		if active, ok := stmt.Value("is_active"); !ok || active != false {
+			continue
+		}
+		for _, arg := range stmt.Args {
+			if id, ok := arg.(string); ok && id != "r1" {
+				users = append(users, id)
+			}
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// removedIdentities returns the LiveKit identities removed from the room, sorted
+func removedIdentities(lk *fakeRoomService) []string {
+	var identities []string
+	for _, req := range lk.removed {
+		identities = append(identities, req.Identity)
+	}
+	sort.Strings(identities)
+	return identities
+}
+
+func TestSweepIdleParticipants(t *testing.T) {
+	now := time.Now()
+	longAgo := now.Add(-2 * time.Hour)
+	recently := now.Add(-time.Minute)
+
+	room := &idleRoom{participants: [][]interface{}{
+		{"u1", longAgo, nil},      // connected, but silent since joining
+		{"u2", longAgo, recently}, // updated their state a minute ago
+		{"u3", recently, nil},     // just joined
+		{"u4", longAgo, nil},      // gone from LiveKit without leaving
+		{"u5", longAgo, nil},      // rejoined LiveKit a minute ago
+	}}
+	h, fake := newTestRoomHandler(t, room.answer)
+	h.identityStrategy = config.IdentityUserIDDevice
+	lk := newFakeRoomService()
+	lk.participants = map[string][]*livekit.ParticipantInfo{
+		"standup": {
+			{Sid: "PA_1", Identity: "u1#laptop", State: livekit.ParticipantInfo_ACTIVE, JoinedAt: longAgo.Unix()},
+			{Sid: "PA_2", Identity: "u2#laptop", State: livekit.ParticipantInfo_ACTIVE, JoinedAt: longAgo.Unix()},
+			{Sid: "PA_3", Identity: "u3#laptop", State: livekit.ParticipantInfo_ACTIVE, JoinedAt: recently.Unix()},
+			{Sid: "PA_5a", Identity: "u5#laptop", State: livekit.ParticipantInfo_ACTIVE, JoinedAt: longAgo.Unix()},
+			{Sid: "PA_5b", Identity: "u5#phone", State: livekit.ParticipantInfo_ACTIVE, JoinedAt: recently.Unix()},
+		},
+	}
+	h.roomService = lk
+
+	removed, err := h.SweepIdleParticipants(context.Background(), 30*time.Minute)
+	if err != nil {
+		t.Fatalf("SweepIdleParticipants() = %v", err)
+	}
+
+	if want := []string{"u1#laptop", "u5#laptop"}; !reflect.DeepEqual(removedIdentities(lk), want) {
+		t.Errorf("removed from LiveKit %v, want %v", removedIdentities(lk), want)
+	}
+	if want := []string{"u1", "u4"}; !reflect.DeepEqual(leftUsers(fake), want) || removed != len(want) {
+		t.Errorf("SweepIdleParticipants() = %d, marked %v as left, want %v", removed, leftUsers(fake), want)
+	}
+}
+
+func TestSweepIdleParticipantsKeepsMediaAudiences(t *testing.T) {
+	longAgo := time.Now().Add(-2 * time.Hour)
+
+	tests := []struct {
+		name        string
+		connections []*livekit.ParticipantInfo
+		wantRemoved []string
+	}{
+		{
+			name: "publishing an unmuted track",
+			connections: []*livekit.ParticipantInfo{
+				{Sid: "PA_1", Identity: "u1#laptop", State: livekit.ParticipantInfo_ACTIVE, Tracks: []*livekit.TrackInfo{{Sid: "TR_mic"}}},
+			},
+		},
+		{
+			name: "publishing only muted tracks",
+			connections: []*livekit.ParticipantInfo{
+				{Sid: "PA_1", Identity: "u1#laptop", State: livekit.ParticipantInfo_ACTIVE, Tracks: []*livekit.TrackInfo{{Sid: "TR_mic", Muted: true}}},
+			},
+			wantRemoved: []string{"u1#laptop"},
+		},
+		{
+			name: "listening to someone else",
+			connections: []*livekit.ParticipantInfo{
+				{Sid: "PA_1", Identity: "u1#laptop", State: livekit.ParticipantInfo_ACTIVE},
+				{Sid: "PA_2", Identity: "u2#laptop", State: livekit.ParticipantInfo_ACTIVE, Tracks: []*livekit.TrackInfo{{Sid: "TR_mic"}}},
+			},
+		},
+		{
+			name: "not allowed to subscribe",
+			connections: []*livekit.ParticipantInfo{
+				{Sid: "PA_1", Identity: "u1#laptop", State: livekit.ParticipantInfo_ACTIVE, Permission: &livekit.ParticipantPermission{}},
+				{Sid: "PA_2", Identity: "u2#laptop", State: livekit.ParticipantInfo_ACTIVE, Tracks: []*livekit.TrackInfo{{Sid: "TR_mic"}}},
+			},
+			wantRemoved: []string{"u1#laptop"},
+		},
+		{
+			name: "still connecting",
+			connections: []*livekit.ParticipantInfo{
+				{Sid: "PA_1", Identity: "u1#laptop", State: livekit.ParticipantInfo_JOINING},
+				{Sid: "PA_2", Identity: "u2#laptop", State: livekit.ParticipantInfo_ACTIVE, Tracks: []*livekit.TrackInfo{{Sid: "TR_mic"}}},
+			},
+			wantRemoved: []string{"u1#laptop"},
+		},
+	}
+
+	for _, tt := range tests {
+		// u2, when connected, publishes, so only u1 can be idle
+		room := &idleRoom{participants: [][]interface{}{{"u1", longAgo, nil}}}
+		h, _ := newTestRoomHandler(t, room.answer)
+		h.identityStrategy = config.IdentityUserIDDevice
+		lk := newFakeRoomService()
+		lk.participants = map[string][]*livekit.ParticipantInfo{"standup": tt.connections}
+		h.roomService = lk
+
+		if _, err := h.SweepIdleParticipants(context.Background(), 30*time.Minute); err != nil {
+			t.Fatalf("%s: SweepIdleParticipants() = %v", tt.name, err)
+		}
+		if got := removedIdentities(lk); !reflect.DeepEqual(got, tt.wantRemoved) {
+			t.Errorf("%s: removed from LiveKit %v, want %v", tt.name, got, tt.wantRemoved)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	lkauth "github.com/livekit/protocol/auth"
+)
+
+func testRoomHandler() *RoomHandler {
+	return &RoomHandler{
+		apiKey:    "test-key",
+		apiSecret: "test-secret-that-is-long-enough-to-sign",
+		tokens:    newTokenCache(time.Minute),
+	}
+}
+
+func TestDecodeJoinToken(t *testing.T) {
+	h := testRoomHandler()
+
+	for _, canChat := range []bool{true, false} {
+		token, err := h.newJoinToken("Ann", "standup", "u1#laptop", canChat)
+		if err != nil {
+			t.Fatalf("newJoinToken() = %v", err)
+		}
+
+		decoded, err := h.decodeToken(token)
+		if err != nil {
+			t.Fatalf("decodeToken() = %v", err)
+		}
+
+		if decoded.Identity != "u1#laptop" || decoded.Name != "Ann" || decoded.Room != "standup" {
+			t.Errorf("decoded identity %q, name %q, room %q", decoded.Identity, decoded.Name, decoded.Room)
+		}
+		if decoded.Grants == nil || !decoded.Grants.RoomJoin {
+			t.Fatalf("decoded grants %+v, want a room join grant", decoded.Grants)
+		}
+		if got := decoded.Grants.GetCanPublishData(); got != canChat {
+			t.Errorf("canChat %v: decoded canPublishData %v", canChat, got)
+		}
+		if decoded.ExpiresAt == nil {
+			t.Fatal("decoded token has no expiry")
+		}
+		if until := time.Until(*decoded.ExpiresAt); until < joinTokenValidity-time.Minute || until > joinTokenValidity {
+			t.Errorf("decoded token expires in %v, want about %v", until, joinTokenValidity)
+		}
+	}
+}
+
+func TestDecodeTokenRejectsForeignTokens(t *testing.T) {
+	h := testRoomHandler()
+
+	sign := func(key, secret string) string {
+		t.Helper()
+		at := lkauth.NewAccessToken(key, secret)
+		at.AddGrant(&lkauth.VideoGrant{RoomJoin: true, Room: "standup"}).
+			SetIdentity("u1").
+			SetValidFor(time.Hour)
+		token, err := at.ToJWT()
+		if err != nil {
+			t.Fatalf("ToJWT() = %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not a JWT", "not-a-token"},
+		{"another API key", sign("other-key", h.apiSecret)},
+		{"our API key with another secret", sign(h.apiKey, "another-secret-that-is-long-enough")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if decoded, err := h.decodeToken(tt.token); err == nil {
+				t.Errorf("decodeToken() = %+v, want an error", decoded)
+			}
+		})
+	}
+}
+
+func TestDecodeTokenRejectsExpiredTokens(t *testing.T) {
+	h := testRoomHandler()
+
+	// The LiveKit SDK won't mint an expired token, so sign one directly
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":   h.apiKey,
+		"sub":   "u1",
+		"nbf":   now.Add(-2 * time.Hour).Unix(),
+		"exp":   now.Add(-time.Hour).Unix(),
+		"video": map[string]interface{}{"roomJoin": true, "room": "standup"},
+	}).SignedString([]byte(h.apiSecret))
+	if err != nil {
+		t.Fatalf("SignedString() = %v", err)
+	}
+
+	if decoded, err := h.decodeToken(token); err == nil {
+		t.Errorf("decodeToken() = %+v, want an error", decoded)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/livekit/protocol/livekit"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// LiveKit webhook event names acted on
+const (
+	webhookTrackPublished    = "track_published"
+	webhookParticipantJoined = "participant_joined"
+)
+
+type LiveKitWebhookHandler struct {
+	verifier *webhook.Verifier
+	rooms    *RoomHandler
+}
+
+func NewLiveKitWebhookHandler(verifier *webhook.Verifier, rooms *RoomHandler) *LiveKitWebhookHandler {
+	return &LiveKitWebhookHandler{
+		verifier: verifier,
+		rooms:    rooms,
+	}
+}
+
+// Receive handles a signed LiveKit webhook. Events we don't act on are acknowledged
+// so LiveKit doesn't retry them.
+func (h *LiveKitWebhookHandler) Receive(c *fiber.Ctx) error {
+	body := c.Body()
+	if err := h.verifier.Verify(c.Get(fiber.HeaderAuthorization), body); err != nil {
+		log.Warn().Err(err).Str("ip", c.IP()).Msg("Rejected LiveKit webhook")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid webhook signature",
+		})
+	}
+
+	var event livekit.WebhookEvent
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, &event); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid webhook payload",
+		})
+	}
+
+	switch event.GetEvent() {
+	case webhookTrackPublished:
+		err := h.rooms.EnforceTrackMute(c.UserContext(), event.GetRoom().GetName(), event.GetParticipant(), event.GetTrack())
+		if err != nil {
+			// The periodic sweep catches anything missed here
+			log.Error().Err(err).Str("room", event.GetRoom().GetName()).Msg("Failed to enforce mute on published track")
+		}
+	case webhookParticipantJoined:
+		if err := h.rooms.EnforceChatMute(c.UserContext(), event.GetRoom().GetName(), event.GetParticipant()); err != nil {
+			log.Error().Err(err).Str("room", event.GetRoom().GetName()).Msg("Failed to enforce chat mute on joined participant")
+		}
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
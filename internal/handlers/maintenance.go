@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/ctxutil"
+	"bedrud-backend/internal/middleware"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/repository"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+type MaintenanceHandler struct {
+	auditRepo    *repository.AuditRepository
+	settingsRepo *repository.SettingsRepository
+}
+
+// MaintenanceStatus reports or sets whether maintenance mode is on
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled" example:"true"`
+}
+
+func NewMaintenanceHandler(auditRepo *repository.AuditRepository, settingsRepo *repository.SettingsRepository) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		auditRepo:    auditRepo,
+		settingsRepo: settingsRepo,
+	}
+}
+
+// Sync applies the maintenance flag stored in the database, so a change made
+// through another instance reaches this one. Until the flag has been stored,
+// the config value applies.
+func (h *MaintenanceHandler) Sync() error {
+	value, found, err := h.settingsRepo.Get(models.SettingMaintenanceMode)
+	if err != nil || !found {
+		return err
+	}
+	middleware.SetMaintenance(value == "true")
+	return nil
+}
+
+// @Summary Get maintenance mode
+// @Description Report whether maintenance mode is on (requires superadmin access without a tenant)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MaintenanceStatus
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/maintenance [get]
+func (h *MaintenanceHandler) Get(c *fiber.Ctx) error {
+	return c.JSON(MaintenanceStatus{
+		Enabled: middleware.MaintenanceEnabled(),
+	})
+}
+
+// @Summary Set maintenance mode
+// @Description Turn maintenance mode on or off on every instance; while on, non-admin requests get 503 (requires superadmin access without a tenant)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MaintenanceStatus true "Maintenance mode"
+// @Success 200 {object} MaintenanceStatus
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/maintenance [put]
+func (h *MaintenanceHandler) Set(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var input MaintenanceStatus
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	if err := h.settingsRepo.Set(models.SettingMaintenanceMode, strconv.FormatBool(input.Enabled)); err != nil {
+		log.Error().Err(err).Msg("Failed to store maintenance mode")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update maintenance mode",
+		})
+	}
+	middleware.SetMaintenance(input.Enabled)
+
+	_ = h.auditRepo.Record(claims.UserID, models.AuditMaintenanceToggled, "system", "", map[string]interface{}{
+		"enabled": input.Enabled,
+	})
+
+	return c.JSON(MaintenanceStatus{
+		Enabled: middleware.MaintenanceEnabled(),
+	})
+}
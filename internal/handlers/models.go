@@ -1,5 +1,8 @@
 package handlers
 
+// Response structs carry timestamps as time.Time, which encoding/json writes as
+// RFC 3339 strings in UTC or with an offset; don't pre-format them.
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error" example:"Error message"`
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/account"
+	"bedrud-backend/internal/models"
+	"context"
+	"fmt"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/rs/zerolog/log"
+)
+
+// mutedByRoom reports whether an admin mute or video-off on the participant
+// covers the track. Screen shares aren't covered by either flag.
+func mutedByRoom(participant *models.RoomParticipant, track *livekit.TrackInfo) bool {
+	switch track.GetSource() {
+	case livekit.TrackSource_MICROPHONE:
+		return participant.IsMuted
+	case livekit.TrackSource_CAMERA:
+		return participant.IsVideoOff
+	case livekit.TrackSource_UNKNOWN:
+		switch track.GetType() {
+		case livekit.TrackType_AUDIO:
+			return participant.IsMuted
+		case livekit.TrackType_VIDEO:
+			return participant.IsVideoOff
+		}
+	}
+	return false
+}
+
+// enforceParticipantMutes re-mutes the tracks a LiveKit participant publishes
+// against an admin mute recorded in the database. enforced holds the room's
+// participants with such a mute, with their users. It returns how many tracks
+// were muted.
+func (h *RoomHandler) enforceParticipantMutes(ctx context.Context, roomName string, lkParticipant *livekit.ParticipantInfo, tracks []*livekit.TrackInfo, enforced []models.RoomParticipant) (int, error) {
+	for i := range enforced {
+		participant := &enforced[i]
+		if participant.User == nil || !account.IsUserIdentity(h.identityStrategy, lkParticipant.GetIdentity(), participant.User) {
+			continue
+		}
+
+		muted := 0
+		for _, track := range tracks {
+			if track.GetMuted() || !mutedByRoom(participant, track) {
+				continue
+			}
+			_, err := h.roomService.MutePublishedTrack(ctx, &livekit.MuteRoomTrackRequest{
+				Room:     roomName,
+				Identity: lkParticipant.GetIdentity(),
+				TrackSid: track.GetSid(),
+				Muted:    true,
+			})
+			if err != nil {
+				return muted, fmt.Errorf("mute track %s of %s: %w", track.GetSid(), lkParticipant.GetIdentity(), err)
+			}
+			log.Info().
+				Str("room", roomName).
+				Str("identity", lkParticipant.GetIdentity()).
+				Str("track", track.GetSid()).
+				Msg("Re-muted track published against an admin mute")
+			muted++
+		}
+		return muted, nil
+	}
+	return 0, nil
+}
+
+// EnforceTrackMute handles a track_published webhook: if the publisher is
+// muted by a room admin, the new track is muted again right away
+func (h *RoomHandler) EnforceTrackMute(ctx context.Context, roomName string, lkParticipant *livekit.ParticipantInfo, track *livekit.TrackInfo) error {
+	room, err := h.roomRepo.GetRoomByName(roomName)
+	if err != nil || room == nil {
+		return err
+	}
+
+	enforced, err := h.roomRepo.GetEnforcedMutes(room.ID)
+	if err != nil || len(enforced) == 0 {
+		return err
+	}
+
+	_, err = h.enforceParticipantMutes(ctx, room.Name, lkParticipant, []*livekit.TrackInfo{track}, enforced)
+	return err
+}
+
+// SweepMutes compares every room that has admin-muted participants with LiveKit
+// and re-mutes tracks that slipped through, e.g. while webhooks were missed.
+// Failures in one room are logged and the sweep moves on. It returns how many
+// tracks were muted.
+func (h *RoomHandler) SweepMutes(ctx context.Context) (int, error) {
+	rooms, err := h.roomRepo.GetRoomsWithEnforcedMutes()
+	if err != nil {
+		return 0, err
+	}
+
+	muted := 0
+	for _, room := range rooms {
+		enforced, err := h.roomRepo.GetEnforcedMutes(room.ID)
+		if err != nil {
+			return muted, err
+		}
+
+		res, err := h.roomService.ListParticipants(ctx, &livekit.ListParticipantsRequest{
+			Room: room.Name,
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("room", room.Name).Msg("Failed to list LiveKit participants")
+			continue
+		}
+
+		for _, p := range res.GetParticipants() {
+			n, err := h.enforceParticipantMutes(ctx, room.Name, p, p.GetTracks(), enforced)
+			muted += n
+			if err != nil {
+				log.Warn().Err(err).Str("room", room.Name).Msg("Failed to enforce mute")
+			}
+		}
+	}
+	return muted, nil
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/webhook"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	lkauth "github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// mutedParticipant answers for room r1 named standup, in which a room admin
+// muted u2's microphone but left their video alone
+func mutedParticipant(stmt dbtest.Statement) (*dbtest.Result, error) {
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "name", "is_active"},
+			Rows:    [][]interface{}{{"r1", "standup", true}},
+		}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "room_id", "user_id", "is_active", "is_muted", "is_video_off"},
+			Rows:    [][]interface{}{{"p2", "r1", "u2", true, true, false}},
+		}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "name"},
+			Rows:    [][]interface{}{{"u2", "bob@example.com", "Bob"}},
+		}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestMutedByRoom(t *testing.T) {
+	muted := &models.RoomParticipant{IsMuted: true}
+	videoOff := &models.RoomParticipant{IsVideoOff: true}
+
+	tests := []struct {
+		name        string
+		participant *models.RoomParticipant
+		track       *livekit.TrackInfo
+		want        bool
+	}{
+		{"muted microphone", muted, &livekit.TrackInfo{Source: livekit.TrackSource_MICROPHONE}, true},
+		{"muted camera", muted, &livekit.TrackInfo{Source: livekit.TrackSource_CAMERA}, false},
+		{"video off camera", videoOff, &livekit.TrackInfo{Source: livekit.TrackSource_CAMERA}, true},
+		{"video off screen share", videoOff, &livekit.TrackInfo{Source: livekit.TrackSource_SCREEN_SHARE, Type: livekit.TrackType_VIDEO}, false},
+		{"muted unknown audio", muted, &livekit.TrackInfo{Type: livekit.TrackType_AUDIO}, true},
+		{"video off unknown video", videoOff, &livekit.TrackInfo{Type: livekit.TrackType_VIDEO}, true},
+	}
+
+	for _, tt := range tests {
+		if got := mutedByRoom(tt.participant, tt.track); got != tt.want {
+			t.Errorf("%s: mutedByRoom() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// signWebhook returns the Authorization header LiveKit sends with body
+func signWebhook(t *testing.T, key, secret string, body []byte) string {
+	t.Helper()
+
+	sum := sha256.Sum256(body)
+	token, err := lkauth.NewAccessToken(key, secret).
+		SetSha256(base64.StdEncoding.EncodeToString(sum[:])).
+		ToJWT()
+	if err != nil {
+		t.Fatalf("ToJWT() = %v", err)
+	}
+	return token
+}
+
+func TestWebhookReMutesTracksPublishedAgainstAnAdminMute(t *testing.T) {
+	const secret = "webhook-secret-that-is-long-enough-to-sign"
+	microphone := &livekit.TrackInfo{Sid: "TR_mic", Type: livekit.TrackType_AUDIO, Source: livekit.TrackSource_MICROPHONE}
+
+	tests := []struct {
+		name      string
+		identity  string
+		track     *livekit.TrackInfo
+		secret    string
+		wantCode  int
+		wantMuted bool
+	}{
+		{"muted participant's microphone", "u2#laptop", microphone, secret, fiber.StatusOK, true},
+		{"muted participant's camera", "u2#laptop", &livekit.TrackInfo{Sid: "TR_cam", Type: livekit.TrackType_VIDEO, Source: livekit.TrackSource_CAMERA}, secret, fiber.StatusOK, false},
+		{"microphone published muted", "u2#laptop", &livekit.TrackInfo{Sid: "TR_mic", Source: livekit.TrackSource_MICROPHONE, Muted: true}, secret, fiber.StatusOK, false},
+		{"another participant's microphone", "u3#laptop", microphone, secret, fiber.StatusOK, false},
+		{"bad signature", "u2#laptop", microphone, "some-other-secret-that-is-long-enough", fiber.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		h, _ := newTestRoomHandler(t, mutedParticipant)
+		h.identityStrategy = config.IdentityUserIDDevice
+		lk := newFakeRoomService()
+		h.roomService = lk
+
+		verifier := webhook.NewVerifier(&config.LiveKitConfig{APIKey: "main", APISecret: secret})
+		app := fiber.New()
+		app.Post("/webhooks/livekit", NewLiveKitWebhookHandler(verifier, h).Receive)
+
+		body, err := protojson.Marshal(&livekit.WebhookEvent{
+			Event:       webhookTrackPublished,
+			Room:        &livekit.Room{Name: "standup"},
+			Participant: &livekit.ParticipantInfo{Identity: tt.identity},
+			Track:       tt.track,
+		})
+		if err != nil {
+			t.Fatalf("protojson.Marshal() = %v", err)
+		}
+		req := httptest.NewRequest("POST", "/webhooks/livekit", strings.NewReader(string(body)))
+		req.Header.Set(fiber.HeaderContentType, "application/webhook+json")
+		req.Header.Set(fiber.HeaderAuthorization, signWebhook(t, "main", tt.secret, body))
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test() = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.wantCode)
+		}
+
+		muted := len(lk.mutes) == 1 && lk.mutes[0].Room == "standup" && lk.mutes[0].Identity == tt.identity && lk.mutes[0].TrackSid == tt.track.Sid && lk.mutes[0].Muted
+		if muted != tt.wantMuted || (!tt.wantMuted && len(lk.mutes) > 0) {
+			t.Errorf("%s: mute requests = %v, want a re-mute %v", tt.name, lk.mutes, tt.wantMuted)
+		}
+	}
+}
+
+func TestSweepMutes(t *testing.T) {
+	h, _ := newTestRoomHandler(t, mutedParticipant)
+	h.identityStrategy = config.IdentityUserIDDevice
+	lk := newFakeRoomService()
+	lk.participants = map[string][]*livekit.ParticipantInfo{
+		"standup": {
+			{Identity: "u2#laptop", Tracks: []*livekit.TrackInfo{
+				{Sid: "TR_mic", Source: livekit.TrackSource_MICROPHONE},
+				{Sid: "TR_cam", Source: livekit.TrackSource_CAMERA},
+			}},
+			{Identity: "u2#phone", Tracks: []*livekit.TrackInfo{
+				{Sid: "TR_phone_mic", Source: livekit.TrackSource_MICROPHONE, Muted: true},
+			}},
+			{Identity: "u3#laptop", Tracks: []*livekit.TrackInfo{
+				{Sid: "TR_other_mic", Source: livekit.TrackSource_MICROPHONE},
+			}},
+		},
+	}
+	h.roomService = lk
+
+	muted, err := h.SweepMutes(context.Background())
+	if err != nil {
+		t.Fatalf("SweepMutes() = %v", err)
+	}
+	if muted != 1 || len(lk.mutes) != 1 || lk.mutes[0].TrackSid != "TR_mic" || lk.mutes[0].Identity != "u2#laptop" {
+		t.Errorf("SweepMutes() muted %d tracks with %v, want only TR_mic of u2#laptop", muted, lk.mutes)
+	}
+}
@@ -2,28 +2,60 @@
 package handlers
 
 import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/account"
 	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
 	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/pagination"
+	"bedrud-backend/internal/realtime"
 	"bedrud-backend/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	lkauth "github.com/livekit/protocol/auth" // Changed import alias
 	"github.com/livekit/protocol/livekit"
 	lksdk "github.com/livekit/server-sdk-go/v2"
 	"github.com/rs/zerolog/log"
+	"github.com/twitchtv/twirp"
 )
 
 // CreateRoomRequest represents the request body for creating a new room
 type CreateRoomRequest struct {
-	Name            string              `json:"name" example:"my-room"`
-	MaxParticipants int                 `json:"maxParticipants,omitempty" example:"20"`
-	Settings        models.RoomSettings `json:"settings"`
+	Name            string                   `json:"name" example:"my-room"`
+	MaxParticipants int                      `json:"maxParticipants,omitempty" example:"20"`
+	Settings        models.RoomSettingsInput `json:"settings"`
+	Metadata        map[string]string        `json:"metadata,omitempty"`
+	// JoinerPermissions overrides the server's joiner permissions for this room;
+	// omitted fields keep the server's value
+	JoinerPermissions *models.JoinerPermissionsInput `json:"joinerPermissions,omitempty"`
+	// Region pins the room to one of the configured LiveKit regions
+	Region string `json:"region,omitempty" example:"eu-west"`
+
+	// APIVersion picks how the body is read; see CreateRoomV1 and CreateRoomV2
+	APIVersion string `json:"apiVersion,omitempty" example:"v2"`
+	// ExpiresIn is the room's lifetime in seconds (v2 only)
+	ExpiresIn int `json:"expiresIn,omitempty" example:"3600"`
+}
+
+// UpdateRoomMetadataRequest represents the request body for replacing a room's metadata
+type UpdateRoomMetadataRequest struct {
+	Metadata map[string]string `json:"metadata"`
 }
 
 // JoinRoomRequest represents the request body for joining a room
 type JoinRoomRequest struct {
 	RoomName string `json:"roomName" example:"my-room"`
+	// DeviceID distinguishes tabs/devices under the userId+device identity strategy
+	DeviceID string `json:"deviceId,omitempty" example:"laptop-1"`
 }
 
 // RoomResponse represents the response for room operations
@@ -36,7 +68,9 @@ type RoomResponse struct {
 	MaxParticipants int                 `json:"maxParticipants"`
 	ExpiresAt       time.Time           `json:"expiresAt"`
 	Settings        models.RoomSettings `json:"settings"`
+	Metadata        models.StringMap    `json:"metadata,omitempty"`
 	LiveKitHost     string              `json:"livekitHost,omitempty"`
+	Region          string              `json:"region,omitempty"`
 }
 
 // AdminRoomResponse represents the detailed room information for admins
@@ -45,6 +79,29 @@ type AdminRoomResponse struct {
 	Participants []ParticipantInfo `json:"participants"`
 }
 
+// maxBulkRooms caps how many rooms one bulk request may create
+const maxBulkRooms = 100
+
+// BulkCreateRoomsRequest represents the request body for creating many rooms at once
+type BulkCreateRoomsRequest struct {
+	Rooms []CreateRoomRequest `json:"rooms"`
+}
+
+// BulkCreateRoomResult reports the outcome for one room of a bulk request
+type BulkCreateRoomResult struct {
+	Index int           `json:"index"`
+	Name  string        `json:"name"`
+	Room  *RoomResponse `json:"room,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// BulkCreateRoomsResponse represents the per-item results of a bulk room creation
+type BulkCreateRoomsResponse struct {
+	Created int                    `json:"created"`
+	Failed  int                    `json:"failed"`
+	Results []BulkCreateRoomResult `json:"results"`
+}
+
 type ParticipantInfo struct {
 	ID            string    `json:"id"`
 	UserID        string    `json:"userId"`
@@ -55,29 +112,341 @@ type ParticipantInfo struct {
 	IsMuted       bool      `json:"isMuted"`
 	IsVideoOff    bool      `json:"isVideoOff"`
 	IsChatBlocked bool      `json:"isChatBlocked"`
+	SelfMuted     bool      `json:"selfMuted"`
+	SelfVideoOff  bool      `json:"selfVideoOff"`
+	HandRaised    bool      `json:"handRaised"`
+	DisplayName   string    `json:"displayName"` // in-room name; differs from name when suffixed
 	Permissions   string    `json:"permissions"`
 }
 
+// ParticipantSessionInfo is one join/leave cycle in a room's history
+type ParticipantSessionInfo struct {
+	ID              string     `json:"id"`
+	UserID          string     `json:"userId"`
+	JoinedAt        time.Time  `json:"joinedAt"`
+	LeftAt          *time.Time `json:"leftAt"`
+	DurationSeconds int64      `json:"durationSeconds"` // up to now for sessions still open
+}
+
+// RoomHistoryResponse is a room's participant session log
+type RoomHistoryResponse struct {
+	RoomID   string                   `json:"roomId"`
+	Sessions []ParticipantSessionInfo `json:"sessions"`
+}
+
+// MyParticipantResponse is the caller's own state in a room
+type MyParticipantResponse struct {
+	RoomID        string           `json:"roomId"`
+	UserID        string           `json:"userId"`
+	JoinedAt      time.Time        `json:"joinedAt"`
+	LeftAt        *time.Time       `json:"leftAt"`
+	IsActive      bool             `json:"isActive"`
+	IsApproved    bool             `json:"isApproved"`
+	IsMuted       bool             `json:"isMuted"`
+	IsVideoOff    bool             `json:"isVideoOff"`
+	IsChatBlocked bool             `json:"isChatBlocked"`
+	SelfMuted     bool             `json:"selfMuted"`
+	SelfVideoOff  bool             `json:"selfVideoOff"`
+	HandRaised    bool             `json:"handRaised"`
+	DisplayName   string           `json:"displayName"`
+	Permissions   *PermissionsInfo `json:"permissions"`
+
+	// ChatMutedUntil is when a timed chat mute ends; isChatBlocked is true until then
+	ChatMutedUntil *time.Time `json:"chatMutedUntil,omitempty"`
+}
+
+// UpdateMyStateRequest represents a participant's self-reported state; omitted fields are left unchanged
+type UpdateMyStateRequest struct {
+	IsMuted    *bool `json:"isMuted"`
+	IsVideoOff *bool `json:"isVideoOff"`
+	HandRaised *bool `json:"handRaised"`
+}
+
+// ParticipantListResponse represents a page of a room's active participants
+type ParticipantListResponse struct {
+	Participants []ParticipantInfo `json:"participants"`
+	pagination.Meta
+}
+
+// Setting sources reported by GetRoomSettings
+const (
+	settingSourceDefault  = "default"
+	settingSourceExplicit = "explicit"
+)
+
+// RoomSettingsResponse represents the settings in force for a room. Sources maps
+// each setting to "default" when it matches the server default and "explicit"
+// when the room overrides it.
+type RoomSettingsResponse struct {
+	RoomID   string              `json:"roomId"`
+	Settings models.RoomSettings `json:"settings"`
+	Sources  map[string]string   `json:"sources"`
+}
+
+// RoomStatsResponse counts rooms by status
+type RoomStatsResponse struct {
+	Total       int64 `json:"total"`
+	Active      int64 `json:"active"`      // open and not yet expired
+	Expired     int64 `json:"expired"`     // open past their expiry, waiting for cleanup
+	Inactive    int64 `json:"inactive"`    // closed for any reason
+	Deactivated int64 `json:"deactivated"` // closed by an admin; included in inactive
+}
+
+// RoomMembershipResponse tells a client whether the caller is part of a room.
+// The participant flags are false for a room the caller never joined.
+type RoomMembershipResponse struct {
+	IsParticipant bool `json:"isParticipant"` // the caller has joined the room at some point
+	IsActive      bool `json:"isActive"`      // the caller is in the room now
+	IsApproved    bool `json:"isApproved"`
+	RoomJoinable  bool `json:"roomJoinable"` // the room is open and not expired
+}
+
+// Lifetime bounds for admin-issued room tokens
+const (
+	defaultAdminTokenTTL = 24 * time.Hour
+	minAdminTokenTTL     = time.Minute
+	maxAdminTokenTTL     = 24 * time.Hour
+)
+
+// maxIdentityLength bounds identities and names set on admin-issued tokens
+const maxIdentityLength = 128
+
+// AdminTokenRequest narrows an admin-issued room token. Omitted fields keep the
+// defaults: full publish/subscribe rights, 24 hours, and the user's own identity and name.
+type AdminTokenRequest struct {
+	CanPublish     *bool  `json:"canPublish,omitempty"`
+	CanSubscribe   *bool  `json:"canSubscribe,omitempty"`
+	CanPublishData *bool  `json:"canPublishData,omitempty"`
+	Hidden         bool   `json:"hidden,omitempty"`   // invisible to other participants
+	Recorder       bool   `json:"recorder,omitempty"` // marks the participant as a recorder
+	TTLSeconds     int    `json:"ttlSeconds,omitempty" example:"3600"`
+	Identity       string `json:"identity,omitempty"`
+	Name           string `json:"name,omitempty"`
+	// ReplaceIdentity allows an identity another participant is using; LiveKit
+	// disconnects that participant when the token is used
+	ReplaceIdentity bool `json:"replaceIdentity,omitempty"`
+}
+
+// validate checks the request against the limits and returns the token lifetime
+func (r AdminTokenRequest) validate() (time.Duration, error) {
+	ttl := defaultAdminTokenTTL
+	if r.TTLSeconds != 0 {
+		ttl = time.Duration(r.TTLSeconds) * time.Second
+		if ttl < minAdminTokenTTL || ttl > maxAdminTokenTTL {
+			return 0, fmt.Errorf("ttlSeconds must be between %d and %d", int(minAdminTokenTTL.Seconds()), int(maxAdminTokenTTL.Seconds()))
+		}
+	}
+	if utf8.RuneCountInString(r.Identity) > maxIdentityLength {
+		return 0, fmt.Errorf("identity must be at most %d characters", maxIdentityLength)
+	}
+	if r.Name != "" {
+		if err := checkDisplayName(strings.TrimSpace(r.Name)); err != nil {
+			return 0, err
+		}
+	}
+	for _, ch := range r.Identity {
+		if unicode.IsControl(ch) {
+			return 0, errors.New("identity must not contain control characters")
+		}
+	}
+	return ttl, nil
+}
+
+// AdminTokenResponse carries an admin-issued room token
+type AdminTokenResponse struct {
+	Token     string    `json:"token"`
+	Identity  string    `json:"identity"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// EnsureRoomResponse reports the state of a room after making sure it exists in LiveKit
+type EnsureRoomResponse struct {
+	RoomResponse
+	// Created is true when the LiveKit room was missing and had to be created
+	Created bool `json:"created"`
+}
+
+// UserRoomInfo represents a user's membership in a single room
+type UserRoomInfo struct {
+	RoomID        string           `json:"roomId"`
+	RoomName      string           `json:"roomName"`
+	RoomIsActive  bool             `json:"roomIsActive"`
+	JoinedAt      time.Time        `json:"joinedAt"`
+	LeftAt        *time.Time       `json:"leftAt"`
+	IsActive      bool             `json:"isActive"`
+	IsMuted       bool             `json:"isMuted"`
+	IsVideoOff    bool             `json:"isVideoOff"`
+	IsChatBlocked bool             `json:"isChatBlocked"`
+	Permissions   *PermissionsInfo `json:"permissions"`
+}
+
+// PermissionsInfo represents a participant's permissions in a room
+type PermissionsInfo struct {
+	IsAdmin         bool `json:"isAdmin"`
+	CanKick         bool `json:"canKick"`
+	CanMuteAudio    bool `json:"canMuteAudio"`
+	CanDisableVideo bool `json:"canDisableVideo"`
+	CanChat         bool `json:"canChat"`
+}
+
+// UserRoomsResponse represents a page of a user's rooms
+type UserRoomsResponse struct {
+	Rooms []UserRoomInfo `json:"rooms"`
+	pagination.Meta
+	Limit int `json:"limit"` // Deprecated: same as pageSize
+}
+
+// RoomService is the subset of the LiveKit room service API used by the handlers
+type RoomService interface {
+	CreateRoom(ctx context.Context, req *livekit.CreateRoomRequest) (*livekit.Room, error)
+	ListRooms(ctx context.Context, req *livekit.ListRoomsRequest) (*livekit.ListRoomsResponse, error)
+	DeleteRoom(ctx context.Context, req *livekit.DeleteRoomRequest) (*livekit.DeleteRoomResponse, error)
+	ListParticipants(ctx context.Context, req *livekit.ListParticipantsRequest) (*livekit.ListParticipantsResponse, error)
+	MutePublishedTrack(ctx context.Context, req *livekit.MuteRoomTrackRequest) (*livekit.MuteRoomTrackResponse, error)
+	UpdateRoomMetadata(ctx context.Context, req *livekit.UpdateRoomMetadataRequest) (*livekit.Room, error)
+	UpdateParticipant(ctx context.Context, req *livekit.UpdateParticipantRequest) (*livekit.ParticipantInfo, error)
+	RemoveParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.RemoveParticipantResponse, error)
+	SendData(ctx context.Context, req *livekit.SendDataRequest) (*livekit.SendDataResponse, error)
+}
+
 type RoomHandler struct {
-	roomRepo    *repository.RoomRepository
-	livekitHost string
-	apiKey      string
-	apiSecret   string
-	roomService *lksdk.RoomServiceClient
+	roomRepo         *repository.RoomRepository
+	livekitHost      string
+	apiKey           string
+	apiSecret        string
+	identityStrategy string
+	roomService      RoomService
+	roomsConfig      *config.RoomsConfig
+	hub              *realtime.Hub
+	tokens           *tokenCache
+	auditRepo        *repository.AuditRepository
+	livekitConfig    *config.LiveKitConfig
 }
 
-func NewRoomHandler(host, apiKey, apiSecret string, roomRepo *repository.RoomRepository) *RoomHandler {
+func NewRoomHandler(livekitConfig *config.LiveKitConfig, roomRepo *repository.RoomRepository, roomsConfig *config.RoomsConfig, hub *realtime.Hub, auditRepo *repository.AuditRepository) *RoomHandler {
 	return &RoomHandler{
-		roomRepo:    roomRepo,
-		livekitHost: host,
-		apiKey:      apiKey,
-		apiSecret:   apiSecret,
-		roomService: lksdk.NewRoomServiceClient(host, apiKey, apiSecret),
+		roomRepo:         roomRepo,
+		auditRepo:        auditRepo,
+		livekitHost:      livekitConfig.Host,
+		apiKey:           livekitConfig.APIKey,
+		apiSecret:        livekitConfig.APISecret,
+		identityStrategy: livekitConfig.IdentityStrategy,
+		roomService:      lksdk.NewRoomServiceClient(livekitConfig.Host, livekitConfig.APIKey, livekitConfig.APISecret),
+		roomsConfig:      roomsConfig,
+		hub:              hub,
+		tokens:           newTokenCache(time.Duration(livekitConfig.TokenCacheTTL) * time.Second),
+		livekitConfig:    livekitConfig,
+	}
+}
+
+// participantIdentity returns the LiveKit identity for a user according to the
+// configured strategy. Under userId+device a random device ID is used when the
+// client doesn't send one, so two tabs never collide.
+func (h *RoomHandler) participantIdentity(user *models.User, deviceID string) string {
+	switch h.identityStrategy {
+	case config.IdentityUserID:
+		return user.ID
+	case config.IdentityUserIDDevice:
+		if deviceID == "" {
+			deviceID = uuid.New().String()[:8]
+		}
+		return user.ID + "#" + deviceID
+	default:
+		return user.Email
+	}
+}
+
+// unmuteUserTracks asks LiveKit to unmute every muted track the user publishes in
+// the room, across all of their connections. LiveKit only honours remote unmutes
+// when enable_remote_unmute is set, so failures are logged rather than returned.
+func (h *RoomHandler) unmuteUserTracks(ctx context.Context, room *models.Room, user *models.User) {
+	res, err := h.roomService.ListParticipants(ctx, &livekit.ListParticipantsRequest{
+		Room: room.Name,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("room", room.Name).Msg("Failed to list LiveKit participants")
+		return
+	}
+
+	for _, p := range res.GetParticipants() {
+		if !account.IsUserIdentity(h.identityStrategy, p.GetIdentity(), user) {
+			continue
+		}
+		for _, track := range p.GetTracks() {
+			if !track.GetMuted() {
+				continue
+			}
+			_, err := h.roomService.MutePublishedTrack(ctx, &livekit.MuteRoomTrackRequest{
+				Room:     room.Name,
+				Identity: p.GetIdentity(),
+				TrackSid: track.GetSid(),
+				Muted:    false,
+			})
+			if err != nil {
+				log.Warn().Err(err).
+					Str("room", room.Name).
+					Str("identity", p.GetIdentity()).
+					Str("track", track.GetSid()).
+					Msg("Failed to unmute LiveKit track")
+			}
+		}
+	}
+}
+
+// regionNode validates a requested region and returns the LiveKit node ID to
+// pin the room to; no region means no pinning
+func (h *RoomHandler) regionNode(region string) (string, error) {
+	if region == "" {
+		return "", nil
+	}
+	node, ok := h.livekitConfig.RegionNode(region)
+	if !ok {
+		return "", fmt.Errorf("unknown region %q", region)
+	}
+	return node, nil
+}
+
+// defaultSettings returns the configured settings for fields a client omits
+func (h *RoomHandler) defaultSettings() models.RoomSettings {
+	defaults := h.roomsConfig.DefaultSettings
+	return models.RoomSettings{
+		AllowChat:       defaults.AllowChat,
+		AllowVideo:      defaults.AllowVideo,
+		AllowAudio:      defaults.AllowAudio,
+		RequireApproval: defaults.RequireApproval,
+		KickIdle:        defaults.KickIdle,
+	}
+}
+
+// maxParticipants resolves the capacity requested for a new room, using the
+// configured default when none was given
+func (h *RoomHandler) maxParticipants(requested int) (int, error) {
+	if requested < 0 {
+		return 0, errors.New("maxParticipants must not be negative")
+	}
+	if requested == 0 {
+		return h.roomsConfig.DefaultMaxParticipants, nil
+	}
+	return requested, nil
+}
+
+// joinerPermissions returns the configured joiner permissions with the room's own overrides applied
+func (h *RoomHandler) joinerPermissions(custom *models.JoinerPermissionsInput) models.JoinerPermissions {
+	defaults := h.roomsConfig.JoinerPermissions
+	permissions := models.JoinerPermissions{
+		CanKick:         defaults.CanKick,
+		CanMuteAudio:    defaults.CanMuteAudio,
+		CanDisableVideo: defaults.CanDisableVideo,
+		CanChat:         defaults.CanChat,
 	}
+	if custom != nil {
+		permissions = custom.Resolve(permissions)
+	}
+	return permissions
 }
 
 // @Summary Create a new room
-// @Description Creates a new room with LiveKit integration
+// @Description Creates a new room with LiveKit integration. The body is read under its apiVersion: v1 (the default) or v2, which adds expiresIn.
 // @Tags rooms
 // @Accept json
 // @Produce json
@@ -86,6 +455,7 @@ func NewRoomHandler(host, apiKey, apiSecret string, roomRepo *repository.RoomRep
 // @Success 200 {object} RoomResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /create-room [post]
 func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 	var req CreateRoomRequest
@@ -95,13 +465,68 @@ func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 		})
 	}
 
+	lifetime, err := req.applyVersion()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	name, err := normalizeRoomName(req.Name, h.roomsConfig.LowercaseNames)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	req.Name = name
+
+	metadata, err := validateRoomMetadata(req.Metadata)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	nodeID, err := h.regionNode(req.Region)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	maxParticipants, err := h.maxParticipants(req.MaxParticipants)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Get user from context
-	claims := c.Locals("user").(*auth.Claims)
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	// Names differing only in case would be confusing to join, so treat them as taken
+	existing, err := h.roomRepo.GetRoomByNameInsensitive(name)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check room name")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create room",
+		})
+	}
+	if existing != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Room name is already taken",
+		})
+	}
 
 	// Create LiveKit room
-	_, err := h.roomService.CreateRoom(c.Context(), &livekit.CreateRoomRequest{
+	_, err = h.roomService.CreateRoom(c.UserContext(), &livekit.CreateRoomRequest{
 		Name:            req.Name,
-		MaxParticipants: uint32(req.MaxParticipants),
+		MaxParticipants: uint32(maxParticipants),
+		Metadata:        metadata.String(),
+		NodeId:          nodeID,
 	})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create LiveKit room")
@@ -111,7 +536,25 @@ func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 	}
 
 	// Create room in our database
-	room, err := h.roomRepo.CreateRoom(claims.UserID, req.Name, req.Settings)
+	settings := req.Settings.Resolve(h.defaultSettings())
+	room, err := h.roomRepo.CreateRoom(repository.CreateRoomParams{
+		CreatedBy: claims.UserID,
+		TenantID:  claims.TenantID,
+		Name:      req.Name,
+		Settings:  settings,
+		Joiner:    h.joinerPermissions(req.JoinerPermissions),
+		Metadata:  metadata,
+		Region:    req.Region,
+		Lifetime:  lifetime,
+
+		MaxParticipants: maxParticipants,
+	})
+	if errors.Is(err, repository.ErrConflict) {
+		// Another request took the name after the check above
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Room name is already taken",
+		})
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create room in database")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -119,6 +562,12 @@ func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 		})
 	}
 
+	h.hub.Publish(realtime.EventRoomCreated, fiber.Map{
+		"roomId":    room.ID,
+		"name":      room.Name,
+		"createdBy": room.CreatedBy,
+	})
+
 	return c.JSON(RoomResponse{
 		ID:              room.ID,
 		Name:            room.Name,
@@ -127,65 +576,103 @@ func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 		MaxParticipants: room.MaxParticipants,
 		ExpiresAt:       room.ExpiresAt,
 		Settings:        room.Settings,
+		Metadata:        room.Metadata,
+		Region:          room.Region,
 	})
 }
 
-// @Summary Join a room
-// @Description Join an existing room and get access token
+// RefreshJoinTokenRequest represents the request body for extending a LiveKit token
+type RefreshJoinTokenRequest struct {
+	// DeviceID must match the one sent when joining under the userId+device identity strategy
+	DeviceID string `json:"deviceId,omitempty" example:"laptop-1"`
+}
+
+// @Summary Refresh a LiveKit join token
+// @Description Issue a fresh LiveKit token for a room the caller is already in, without rejoining
 // @Tags rooms
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body JoinRoomRequest true "Room join parameters"
+// @Param roomName path string true "Room name"
+// @Param request body RefreshJoinTokenRequest false "Device details"
 // @Success 200 {object} RoomResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
-// @Router /join-room [post]
-func (h *RoomHandler) JoinRoom(c *fiber.Ctx) error {
-	var req JoinRoomRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomName}/refresh-token [post]
+func (h *RoomHandler) RefreshJoinToken(c *fiber.Ctx) error {
+	var req RefreshJoinTokenRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
 	}
 
-	claims := c.Locals("user").(*auth.Claims)
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
 
-	// Get room from database
-	room, err := h.roomRepo.GetRoomByName(req.RoomName)
-	if err != nil || room == nil {
+	user, err := h.roomRepo.GetUserByID(claims.UserID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	room, err := h.findRoomByName(c.Params("roomName"))
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Room not found",
 		})
 	}
 
-	// Check if room is active and not expired
-	if !room.IsActive || time.Now().After(room.ExpiresAt) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+	if !room.IsJoinable() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Room is not active or has expired",
 		})
 	}
 
-	// Add participant to room
-	err = h.roomRepo.AddParticipant(room.ID, claims.UserID)
+	// Kicked participants and everyone in an ended room are no longer active
+	participant, err := h.roomRepo.GetParticipant(room.ID, claims.UserID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to add participant to room")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to join room",
+			"error": "Failed to refresh token",
+		})
+	}
+	if participant == nil || !participant.IsActive {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You are not an active participant of this room",
+		})
+	}
+	if room.Settings.RequireApproval && !participant.IsApproved {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You have not been approved to join this room",
 		})
 	}
 
-	// Generate LiveKit token
-	at := lkauth.NewAccessToken(h.apiKey, h.apiSecret) // Changed to lkauth
-	grant := &lkauth.VideoGrant{                       // Changed to lkauth
-		RoomJoin: true,
-		Room:     req.RoomName,
+	// A client refreshing its token is still connected
+	if err := h.roomRepo.TouchParticipant(room.ID, claims.UserID); err != nil {
+		log.Warn().Err(err).Str("room", room.Name).Msg("Failed to record participant activity")
 	}
-	at.AddGrant(grant).
-		SetIdentity(claims.Email).
-		SetValidFor(time.Hour)
 
-	token, err := at.ToJWT()
+	// Keep the name the participant joined under, which may have been suffixed
+	displayName := participant.DisplayName
+	if displayName == "" {
+		displayName = user.Name
+	}
+	canChat, err := h.chatAllowed(room, claims.UserID)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to load chat permission")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh token",
+		})
+	}
+	token, err := h.newJoinToken(displayName, room.Name, h.participantIdentity(user, req.DeviceID), canChat)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
@@ -201,113 +688,1749 @@ func (h *RoomHandler) JoinRoom(c *fiber.Ctx) error {
 		MaxParticipants: room.MaxParticipants,
 		ExpiresAt:       room.ExpiresAt,
 		Settings:        room.Settings,
+		Metadata:        room.Metadata,
 		LiveKitHost:     h.livekitHost,
 	})
 }
 
-// @Summary List all rooms (Admin only)
-// @Description Get detailed information about all rooms (requires superadmin access)
-// @Tags admin
-// @Accept json
+// RoomNameAvailability reports whether a room name can be used
+type RoomNameAvailability struct {
+	Available bool `json:"available"`
+}
+
+// @Summary Check room name availability
+// @Description Check whether a room name is free to use, ignoring case
+// @Tags rooms
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} AdminRoomResponse
+// @Param name query string true "Room name"
+// @Success 200 {object} RoomNameAvailability
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
-// @Failure 403 {object} ErrorResponse
-// @Router /admin/rooms [get]
-func (h *RoomHandler) AdminListRooms(c *fiber.Ctx) error {
-	var rooms []models.Room
-	rooms, err := h.roomRepo.GetAllRooms()
+// @Failure 429 {object} ErrorResponse
+// @Router /rooms/available [get]
+func (h *RoomHandler) CheckRoomName(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	name, err := normalizeRoomName(c.Query("name"), h.roomsConfig.LowercaseNames)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch rooms",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
 
-	var response []AdminRoomResponse
-	for _, room := range rooms {
-		participants, err := h.roomRepo.GetRoomParticipantsWithUsers(room.ID)
-		if err != nil {
-			continue
-		}
-
-		var participantInfos []ParticipantInfo
-		for _, p := range participants {
-			info := ParticipantInfo{
-				ID:            p.ID,
-				UserID:        p.UserID,
-				JoinedAt:      p.JoinedAt,
-				IsActive:      p.IsActive,
-				IsMuted:       p.IsMuted,
-				IsVideoOff:    p.IsVideoOff,
-				IsChatBlocked: p.IsChatBlocked,
-			}
-
-			// Safely access User information
-			if p.User != nil {
-				info.Email = p.User.Email
-				info.Name = p.User.Name
-			}
-
-			participantInfos = append(participantInfos, info)
-		}
-
-		response = append(response, AdminRoomResponse{
-			RoomResponse: RoomResponse{
-				ID:              room.ID,
-				Name:            room.Name,
-				CreatedBy:       room.CreatedBy,
-				IsActive:        room.IsActive,
-				MaxParticipants: room.MaxParticipants,
-				ExpiresAt:       room.ExpiresAt,
-				Settings:        room.Settings,
-			},
-			Participants: participantInfos,
+	room, err := h.roomRepo.GetRoomByNameInsensitive(name)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check room name")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check room name",
 		})
 	}
 
-	return c.JSON(response)
+	// Names are unique across tenants, so another tenant's room still takes the
+	// name; only whether it is taken is told, never whose room it is
+	if room != nil && !claims.CanAccessTenant(room.TenantID) {
+		return c.JSON(RoomNameAvailability{Available: false})
+	}
+
+	return c.JSON(RoomNameAvailability{
+		Available: room == nil,
+	})
 }
 
-// @Summary Generate room token (Admin only)
-// @Description Generate a new token for any user to join a room (requires superadmin access)
-// @Tags admin
+// @Summary Join a room
+// @Description Join an existing room and get access token
+// @Tags rooms
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param roomId path string true "Room ID"
-// @Param userId query string true "User ID to generate token for"
-// @Success 200 {object} map[string]string
+// @Param request body JoinRoomRequest true "Room join parameters"
+// @Success 200 {object} RoomResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Router /admin/rooms/{roomId}/token [post]
-func (h *RoomHandler) AdminGenerateToken(c *fiber.Ctx) error {
-	roomID := c.Params("roomId")
-	userID := c.Query("userId")
+// @Router /join-room [post]
+func (h *RoomHandler) JoinRoom(c *fiber.Ctx) error {
+	var req JoinRoomRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
 
-	room, err := h.roomRepo.GetRoom(roomID)
-	if err != nil || room == nil {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	user, err := h.roomRepo.GetUserByID(claims.UserID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	// Get room from database
+	room, err := h.findRoomByName(req.RoomName)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	// Check if room is active and not expired
+	if room.DeactivatedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Room has been deactivated",
+		})
+	}
+	if !room.IsJoinable() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Room is not active or has expired",
+		})
+	}
+
+	// Make sure LiveKit still knows the room; it may have restarted or closed an empty room
+	if _, err := h.ensureLiveKitRoom(c.UserContext(), room); err != nil {
+		log.Warn().Err(err).Str("room", room.Name).Msg("Failed to reconcile LiveKit room")
+	}
+
+	// The capacity and name checks and the insert share one transaction that
+	// holds the room lock, so concurrent joins can't overfill the room or pick
+	// the same name
+	var displayName string
+	err = h.roomRepo.WithTx(func(tx repository.TxRepos) error {
+		if err := tx.Rooms.LockRoom(room.ID); err != nil {
+			return err
+		}
+		if err := checkCapacity(tx.Rooms, room, claims.UserID); err != nil {
+			return err
+		}
+
+		displayName = strings.TrimSpace(user.Name)
+		if h.roomsConfig.UniqueDisplayNames != config.DisplayNamesOff {
+			taken, err := tx.Rooms.GetActiveDisplayNames(room.ID, claims.UserID)
+			if err != nil {
+				return err
+			}
+			displayName, err = uniqueDisplayName(user.Name, taken, h.roomsConfig.UniqueDisplayNames)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Rooms.AddParticipant(room.ID, claims.UserID, displayName, room.JoinerPermissions)
+	})
+	switch {
+	case errors.Is(err, errRoomFull):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Room is full",
+		})
+	case errors.Is(err, errDisplayNameTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrForeignKey):
+		// The room was purged while the join was under way
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	case err != nil:
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to add participant to room")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to join room",
+		})
+	}
+
+	h.hub.Publish(realtime.EventParticipantJoined, fiber.Map{
+		"roomId": room.ID,
+		"userId": claims.UserID,
+	})
+
+	// Generate LiveKit token
+	canChat, err := h.chatAllowed(room, claims.UserID)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to load chat permission")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+	token, err := h.joinToken(user, displayName, room.Name, req.DeviceID, canChat)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	return c.JSON(RoomResponse{
+		ID:              room.ID,
+		Name:            room.Name,
+		Token:           token,
+		CreatedBy:       room.CreatedBy,
+		IsActive:        room.IsActive,
+		MaxParticipants: room.MaxParticipants,
+		ExpiresAt:       room.ExpiresAt,
+		Settings:        room.Settings,
+		Metadata:        room.Metadata,
+		LiveKitHost:     h.livekitHost,
+	})
+}
+
+var errRoomFull = errors.New("room is full")
+
+// checkCapacity returns errRoomFull if the room is at its participant limit,
+// except for someone who is already in the room (e.g. reconnecting)
+func checkCapacity(rooms *repository.RoomRepository, room *models.Room, userID string) error {
+	if room.MaxParticipants == 0 {
+		return nil
+	}
+	count, err := rooms.CountActiveParticipants(room.ID)
+	if err != nil {
+		return err
+	}
+	if count < int64(room.MaxParticipants) {
+		return nil
+	}
+	existing, err := rooms.GetParticipant(room.ID, userID)
+	if err != nil {
+		return err
+	}
+	if existing == nil || !existing.IsActive {
+		return errRoomFull
+	}
+	return nil
+}
+
+// joinTokenValidity is how long a LiveKit join token is valid
+const joinTokenValidity = time.Hour
+
+// joinToken returns a LiveKit token for joining a room, reusing a cached one
+// when the same identity recently joined with the same grant. An identity made
+// up from a random device ID never joins again, so its token isn't cached.
+func (h *RoomHandler) joinToken(user *models.User, displayName, roomName, deviceID string, canChat bool) (string, error) {
+	identity := h.participantIdentity(user, deviceID)
+	reuse := h.identityStrategy != config.IdentityUserIDDevice || deviceID != ""
+
+	key := h.joinTokenKey(displayName, roomName, identity, canChat)
+	if reuse {
+		if token, ok := h.tokens.get(key); ok {
+			return token, nil
+		}
+	}
+
+	token, err := h.newJoinToken(displayName, roomName, identity, canChat)
+	if err != nil {
+		return "", err
+	}
+	if reuse {
+		h.tokens.put(key, user.ID, token)
+	}
+	return token, nil
+}
+
+// newJoinToken always mints a LiveKit join token with a full validity period
+func (h *RoomHandler) newJoinToken(displayName, roomName, identity string, canChat bool) (string, error) {
+	at := lkauth.NewAccessToken(h.apiKey, h.apiSecret)
+	at.AddGrant(joinGrant(roomName, canChat)).
+		SetIdentity(identity).
+		SetName(displayName).
+		SetValidFor(joinTokenValidity)
+
+	return at.ToJWT()
+}
+
+func (h *RoomHandler) joinTokenKey(displayName, roomName, identity string, canChat bool) tokenCacheKey {
+	return tokenCacheKey{
+		room:      roomName,
+		identity:  identity,
+		grantHash: grantHash(joinGrant(roomName, canChat), displayName, joinTokenValidity),
+	}
+}
+
+// joinGrant is the LiveKit grant given to room participants. Chat travels over
+// data messages, so participants who may not chat can't publish data.
+func joinGrant(roomName string, canChat bool) *lkauth.VideoGrant {
+	grant := &lkauth.VideoGrant{
+		RoomJoin: true,
+		Room:     roomName,
+	}
+	if !canChat {
+		grant.SetCanPublishData(false)
+	}
+	return grant
+}
+
+// updateParticipantPermissions changes a participant's permissions, recording
+// action in the audit log in the same transaction, and drops their cached join
+// tokens so the next join picks up the new grant
+func (h *RoomHandler) updateParticipantPermissions(actorID string, room *models.Room, userID string, permissions models.RoomPermissions, action string, details map[string]interface{}) error {
+	err := h.roomRepo.WithTx(func(tx repository.TxRepos) error {
+		if err := tx.Rooms.UpdateParticipantPermissions(room.ID, userID, permissions); err != nil {
+			return err
+		}
+		return tx.Audit.Record(actorID, action, "room", room.ID, details)
+	})
+	if err != nil {
+		return err
+	}
+	h.tokens.invalidateUser(room.Name, userID)
+	return nil
+}
+
+// ensureLiveKitRoom creates the LiveKit room for a database room if LiveKit doesn't
+// have it, reporting whether it had to be created
+func (h *RoomHandler) ensureLiveKitRoom(ctx context.Context, room *models.Room) (bool, error) {
+	existing, err := h.roomService.ListRooms(ctx, &livekit.ListRoomsRequest{
+		Names: []string{room.Name},
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(existing.GetRooms()) > 0 {
+		return false, nil
+	}
+
+	log.Info().Str("room", room.Name).Msg("LiveKit room missing, recreating")
+
+	// A region dropped from the config since leaves the room unpinned
+	nodeID, _ := h.livekitConfig.RegionNode(room.Region)
+
+	// CreateRoom returns the existing room if another join recreated it meanwhile
+	_, err = h.roomService.CreateRoom(ctx, &livekit.CreateRoomRequest{
+		Name:            room.Name,
+		MaxParticipants: uint32(room.MaxParticipants),
+		Metadata:        room.Metadata.String(),
+		NodeId:          nodeID,
+	})
+	return err == nil, err
+}
+
+// isRoomAdmin reports whether the user may manage the room: superadmins and
+// global moderators may manage any room they can see, everyone else needs
+// admin permissions in the room
+func (h *RoomHandler) isRoomAdmin(claims *auth.Claims, roomID string) bool {
+	if claims.CanModerateRooms() {
+		return true
+	}
+
+	permissions, err := h.roomRepo.GetParticipantPermissions(roomID, claims.UserID)
+	return err == nil && permissions.IsAdmin
+}
+
+// SweepExpiredRooms ends rooms that outlived their expiry, batchSize at a time:
+// each room is deleted from LiveKit and then closed in the database, so no long
+// transaction is held. It stops at the first failure, leaving the remaining
+// rooms for the next run, and returns how many rooms were ended.
+func (h *RoomHandler) SweepExpiredRooms(ctx context.Context, batchSize int) (int, error) {
+	ended := 0
+	for {
+		rooms, err := h.roomRepo.GetExpiredRooms(batchSize)
+		if err != nil {
+			return ended, err
+		}
+
+		for _, room := range rooms {
+			_, err := h.roomService.DeleteRoom(ctx, &livekit.DeleteRoomRequest{
+				Room: room.Name,
+			})
+			if err != nil {
+				var twirpErr twirp.Error
+				if !errors.As(err, &twirpErr) || twirpErr.Code() != twirp.NotFound {
+					return ended, fmt.Errorf("delete LiveKit room %s: %w", room.Name, err)
+				}
+			}
+
+			if err := h.roomRepo.EndRoom(room.ID); err != nil {
+				return ended, fmt.Errorf("end room %s: %w", room.Name, err)
+			}
+			h.tokens.invalidateRoom(room.Name)
+
+			h.hub.Publish(realtime.EventRoomEnded, fiber.Map{
+				"roomId":  room.ID,
+				"name":    room.Name,
+				"expired": true,
+			})
+			ended++
+		}
+
+		if len(rooms) < batchSize {
+			return ended, nil
+		}
+	}
+}
+
+// @Summary End a room
+// @Description Disconnect everyone from a room and close it, keeping its history (room admins and moderators only)
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/end [post]
+func (h *RoomHandler) EndRoom(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can end the room",
+		})
+	}
+
+	// Disconnect everyone; a room LiveKit already closed is fine
+	_, err = h.roomService.DeleteRoom(c.UserContext(), &livekit.DeleteRoomRequest{
+		Room: room.Name,
+	})
+	if err != nil {
+		var twirpErr twirp.Error
+		if !errors.As(err, &twirpErr) || twirpErr.Code() != twirp.NotFound {
+			log.Error().Err(err).Str("room", room.Name).Msg("Failed to delete LiveKit room")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to end room",
+			})
+		}
+	}
+
+	if err := h.roomRepo.EndRoom(room.ID); err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to end room in database")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to end room",
+		})
+	}
+	h.tokens.invalidateRoom(room.Name)
+
+	h.hub.Publish(realtime.EventRoomEnded, fiber.Map{
+		"roomId":  room.ID,
+		"name":    room.Name,
+		"endedBy": claims.UserID,
+	})
+	_ = h.auditRepo.Record(claims.UserID, models.AuditRoomEnded, "room", room.ID, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Room ended",
+	})
+}
+
+// @Summary Deactivate a room
+// @Description Close a room to new joins while keeping it for later (room admins and moderators only)
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/deactivate [post]
+func (h *RoomHandler) DeactivateRoom(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can deactivate the room",
+		})
+	}
+
+	if err := h.roomRepo.DeactivateRoom(room.ID); errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	} else if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to deactivate room")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to deactivate room",
+		})
+	}
+	h.tokens.invalidateRoom(room.Name)
+	_ = h.auditRepo.Record(claims.UserID, models.AuditRoomDeactivated, "room", room.ID, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Room deactivated",
+	})
+}
+
+// @Summary Reactivate a room
+// @Description Open a deactivated or expired room to joins again (room admins and moderators only)
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} models.Room
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/reactivate [post]
+func (h *RoomHandler) ReactivateRoom(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can reactivate the room",
+		})
+	}
+
+	if err := h.roomRepo.ReactivateRoom(room); err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to reactivate room")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reactivate room",
+		})
+	}
+
+	_ = h.auditRepo.Record(claims.UserID, models.AuditRoomReactivated, "room", room.ID, nil)
+
+	room, err = h.roomRepo.GetRoom(room.ID)
+	if err != nil || room == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load room",
+		})
+	}
+
+	return c.JSON(room)
+}
+
+// @Summary Pre-warm a room
+// @Description Make sure the room exists in LiveKit, creating it if missing, and extend its expiry. No token is issued and nobody joins (room admins and moderators only).
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} EnsureRoomResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/ensure [post]
+func (h *RoomHandler) EnsureRoom(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(c.Params("roomId"))
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can pre-warm the room",
+		})
+	}
+
+	// Ended, deactivated or expired rooms have to be reactivated explicitly
+	if !room.IsJoinable() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Room is not active or has expired",
+		})
+	}
+
+	created, err := h.ensureLiveKitRoom(c.UserContext(), room)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to ensure LiveKit room")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create LiveKit room",
+		})
+	}
+
+	expiresAt := time.Now().Add(repository.RoomLifetime)
+	if err := h.roomRepo.ExtendRoomExpiry(room.ID, expiresAt); err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to extend room expiry")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to extend room expiry",
+		})
+	}
+	if expiresAt.After(room.ExpiresAt) {
+		room.ExpiresAt = expiresAt
+	}
+
+	return c.JSON(EnsureRoomResponse{
+		RoomResponse: RoomResponse{
+			ID:              room.ID,
+			Name:            room.Name,
+			CreatedBy:       room.CreatedBy,
+			IsActive:        room.IsActive,
+			MaxParticipants: room.MaxParticipants,
+			ExpiresAt:       room.ExpiresAt,
+			Settings:        room.Settings,
+			Metadata:        room.Metadata,
+		},
+		Created: created,
+	})
+}
+
+// @Summary Update room metadata
+// @Description Replace the metadata LiveKit shares with the room's participants (room admins and moderators only)
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param request body UpdateRoomMetadataRequest true "New metadata"
+// @Success 200 {object} RoomResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/metadata [patch]
+func (h *RoomHandler) UpdateRoomMetadata(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var req UpdateRoomMetadataRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	metadata, err := validateRoomMetadata(req.Metadata)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	room, err := h.roomRepo.GetRoom(c.Params("roomId"))
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can update room metadata",
+		})
+	}
+
+	if err := h.roomRepo.UpdateRoomMetadata(room.ID, metadata); errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	} else if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to update room metadata")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update room metadata",
+		})
+	}
+	room.Metadata = metadata
+	_ = h.auditRepo.Record(claims.UserID, models.AuditRoomMetadataUpdated, "room", room.ID, map[string]interface{}{
+		"metadata": metadata,
+	})
+
+	// An inactive room has no LiveKit counterpart; it picks the metadata up when recreated
+	if room.IsActive {
+		_, err := h.roomService.UpdateRoomMetadata(c.UserContext(), &livekit.UpdateRoomMetadataRequest{
+			Room:     room.Name,
+			Metadata: metadata.String(),
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("room", room.Name).Msg("Failed to push room metadata to LiveKit")
+		}
+	}
+
+	return c.JSON(RoomResponse{
+		ID:              room.ID,
+		Name:            room.Name,
+		CreatedBy:       room.CreatedBy,
+		IsActive:        room.IsActive,
+		MaxParticipants: room.MaxParticipants,
+		ExpiresAt:       room.ExpiresAt,
+		Settings:        room.Settings,
+		Metadata:        room.Metadata,
+	})
+}
+
+// @Summary Update a participant's permissions
+// @Description Change what a participant may do in a room (room admins and moderators only). A room always keeps at least one admin.
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param userId path string true "User ID"
+// @Param request body PermissionsInfo true "New permissions"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/participants/{userId}/permissions [put]
+func (h *RoomHandler) UpdatePermissions(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	userID := c.Params("userId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var req PermissionsInfo
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can change permissions",
+		})
+	}
+
+	// Participants who joined before joiner permissions existed may have no
+	// permissions row yet; the update creates it
+	participant, err := h.roomRepo.GetParticipant(room.ID, userID)
+	if err != nil || participant == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Participant not found",
+		})
+	}
+
+	permissions := models.RoomPermissions{
+		IsAdmin:         req.IsAdmin,
+		CanKick:         req.CanKick,
+		CanMuteAudio:    req.CanMuteAudio,
+		CanDisableVideo: req.CanDisableVideo,
+		CanChat:         req.CanChat,
+	}
+	err = h.updateParticipantPermissions(claims.UserID, room, userID, permissions, models.AuditRoomPermissionsUpdated, map[string]interface{}{
+		"userId":          userID,
+		"isAdmin":         req.IsAdmin,
+		"canKick":         req.CanKick,
+		"canMuteAudio":    req.CanMuteAudio,
+		"canDisableVideo": req.CanDisableVideo,
+		"canChat":         req.CanChat,
+	})
+	if errors.Is(err, repository.ErrLastRoomAdmin) {
+		message := "Cannot remove the room's last admin"
+		if userID == claims.UserID {
+			message = "You are the room's last admin; promote someone else before giving up admin rights"
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to update permissions")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update permissions",
+		})
+	}
+
+	// Connected clients pick up a changed chat permission right away
+	if room.IsActive {
+		h.applyChatPermission(c.UserContext(), room, userID)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Permissions updated",
+	})
+}
+
+// @Summary Reset a participant's in-room state
+// @Description Clear a participant's mute, video-off and chat-block flags and any chat mute, and unmute their tracks in LiveKit (room admins and moderators only)
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/participants/{userId}/reset-state [post]
+func (h *RoomHandler) ResetParticipantState(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	userID := c.Params("userId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can reset participant state",
+		})
+	}
+
+	user, err := h.roomRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Participant not found",
+		})
+	}
+
+	found, err := h.roomRepo.ResetParticipantState(room.ID, user.ID)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to reset participant state")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset participant state",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Participant not found",
+		})
+	}
+
+	h.unmuteUserTracks(c.UserContext(), room, user)
+	h.applyChatPermission(c.UserContext(), room, user.ID)
+	_ = h.auditRepo.Record(claims.UserID, models.AuditRoomParticipantReset, "room", room.ID, map[string]interface{}{
+		"userId": user.ID,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Participant state reset",
+	})
+}
+
+// @Summary Promote a participant to room admin
+// @Description Make a participant a co-host: room admin with every management permission (room admins and moderators only)
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} PermissionsInfo
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/participants/{userId}/promote [post]
+func (h *RoomHandler) PromoteParticipant(c *fiber.Ctx) error {
+	return h.setRoomAdmin(c, true)
+}
+
+// @Summary Demote a room admin
+// @Description Take a participant's room admin rights away, returning their management permissions to the room's joiner defaults. The room's last admin can't be demoted (room admins and moderators only).
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} PermissionsInfo
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/participants/{userId}/demote [post]
+func (h *RoomHandler) DemoteParticipant(c *fiber.Ctx) error {
+	return h.setRoomAdmin(c, false)
+}
+
+// setRoomAdmin promotes or demotes a participant. Promotion grants every
+// management permission; demotion falls back to the room's joiner permissions
+// for them and leaves the participant's chat permission as it was.
+func (h *RoomHandler) setRoomAdmin(c *fiber.Ctx, admin bool) error {
+	roomID := c.Params("roomId")
+	userID := c.Params("userId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	if !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room admins can change who else is an admin",
+		})
+	}
+
+	participant, err := h.roomRepo.GetParticipant(room.ID, userID)
+	if err != nil || participant == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Participant not found",
+		})
+	}
+
+	// Participants who joined before joiner permissions existed have no row yet
+	canChat := room.JoinerPermissions.CanChat
+	if current, err := h.roomRepo.GetParticipantPermissions(room.ID, userID); err == nil {
+		canChat = current.CanChat
+	}
+
+	permissions := models.RoomPermissions{
+		IsAdmin:         true,
+		CanKick:         true,
+		CanMuteAudio:    true,
+		CanDisableVideo: true,
+		CanChat:         true,
+	}
+	action := models.AuditRoomAdminPromoted
+	if !admin {
+		permissions = models.RoomPermissions{
+			CanKick:         room.JoinerPermissions.CanKick,
+			CanMuteAudio:    room.JoinerPermissions.CanMuteAudio,
+			CanDisableVideo: room.JoinerPermissions.CanDisableVideo,
+			CanChat:         canChat,
+		}
+		action = models.AuditRoomAdminDemoted
+	}
+
+	err = h.updateParticipantPermissions(claims.UserID, room, userID, permissions, action, map[string]interface{}{
+		"userId": userID,
+	})
+	if errors.Is(err, repository.ErrLastRoomAdmin) {
+		message := "Cannot demote the room's last admin"
+		if userID == claims.UserID {
+			message = "You are the room's last admin; promote someone else before stepping down"
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Bool("admin", admin).Msg("Failed to change room admin")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update permissions",
+		})
+	}
+
+	return c.JSON(PermissionsInfo{
+		IsAdmin:         permissions.IsAdmin,
+		CanKick:         permissions.CanKick,
+		CanMuteAudio:    permissions.CanMuteAudio,
+		CanDisableVideo: permissions.CanDisableVideo,
+		CanChat:         permissions.CanChat,
+	})
+}
+
+// @Summary Get effective room settings
+// @Description Get the settings in force for a room and whether each one is the server default or a room override (room participants, moderators and superadmins only)
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} RoomSettingsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/settings [get]
+func (h *RoomHandler) GetRoomSettings(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(c.Params("roomId"))
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	self, err := h.roomRepo.GetParticipant(room.ID, claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch room settings",
+		})
+	}
+	if self == nil && !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room participants can view room settings",
+		})
+	}
+
+	// Omitted settings are resolved when the room is created, so a stored value
+	// equal to the current default is reported as the default
+	defaults := h.defaultSettings()
+	source := func(value, def bool) string {
+		if value == def {
+			return settingSourceDefault
+		}
+		return settingSourceExplicit
+	}
+
+	return c.JSON(RoomSettingsResponse{
+		RoomID:   room.ID,
+		Settings: room.Settings,
+		Sources: map[string]string{
+			"allowChat":       source(room.Settings.AllowChat, defaults.AllowChat),
+			"allowVideo":      source(room.Settings.AllowVideo, defaults.AllowVideo),
+			"allowAudio":      source(room.Settings.AllowAudio, defaults.AllowAudio),
+			"requireApproval": source(room.Settings.RequireApproval, defaults.RequireApproval),
+			"kickIdle":        source(room.Settings.KickIdle, defaults.KickIdle),
+		},
+	})
+}
+
+// @Summary List active participants
+// @Description List a room's active participants one page at a time (room participants, moderators and superadmins only)
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param page query int false "Page number" default(1)
+// @Param pageSize query int false "Participants per page" default(50)
+// @Success 200 {object} ParticipantListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/participants [get]
+func (h *RoomHandler) ListParticipants(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	self, err := h.roomRepo.GetParticipant(room.ID, claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch participants",
+		})
+	}
+	if self == nil && !h.isRoomAdmin(claims, room.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only room participants can list participants",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := pagination.ClampLimit(c.QueryInt("pageSize"))
+
+	participants, total, err := h.roomRepo.GetActiveParticipantsPage(room.ID, page, pageSize)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to fetch participants")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch participants",
+		})
+	}
+
+	infos := make([]ParticipantInfo, 0, len(participants))
+	for _, p := range participants {
+		info := ParticipantInfo{
+			ID:            p.ID,
+			UserID:        p.UserID,
+			JoinedAt:      p.JoinedAt,
+			IsActive:      p.IsActive,
+			IsMuted:       p.IsMuted,
+			IsVideoOff:    p.IsVideoOff,
+			IsChatBlocked: p.ChatMuted(),
+			SelfMuted:     p.SelfMuted,
+			SelfVideoOff:  p.SelfVideoOff,
+			HandRaised:    p.HandRaised,
+			DisplayName:   p.DisplayName,
+		}
+		if p.User != nil {
+			info.Email = p.User.Email
+			info.Name = p.User.Name
+		}
+		infos = append(infos, info)
+	}
+
+	return c.JSON(ParticipantListResponse{
+		Participants: infos,
+		Meta:         pagination.NewMeta(total, page, pageSize),
+	})
+}
+
+// @Summary Check my membership of a room
+// @Description Report whether the caller has joined a room and is still in it, without issuing a token. Clients use it to choose between "join" and "rejoin".
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomName path string true "Room name"
+// @Success 200 {object} RoomMembershipResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomName}/membership [get]
+func (h *RoomHandler) GetMembership(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.findRoomByName(c.Params("roomName"))
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	joined, active, approved, err := h.roomRepo.GetMembership(room.ID, claims.UserID)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to check membership")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check membership",
+		})
+	}
+
+	// Nobody is in a room that has expired, even before cleanup ends it
+	joinable := room.IsJoinable()
+	return c.JSON(RoomMembershipResponse{
+		IsParticipant: joined,
+		IsActive:      active && joinable,
+		IsApproved:    approved,
+		RoomJoinable:  joinable,
+	})
+}
+
+// @Summary Get my participant state
+// @Description Get the caller's participant record and permissions in a room
+// @Tags rooms
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} MyParticipantResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/me [get]
+func (h *RoomHandler) GetMyParticipant(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	participant, err := h.roomRepo.GetParticipant(roomID, claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch participant",
+		})
+	}
+	if participant == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "You are not a participant of this room",
+		})
+	}
+
+	response := MyParticipantResponse{
+		RoomID:        participant.RoomID,
+		UserID:        participant.UserID,
+		JoinedAt:      participant.JoinedAt,
+		LeftAt:        participant.LeftAt,
+		IsActive:      participant.IsActive,
+		IsApproved:    participant.IsApproved,
+		IsMuted:       participant.IsMuted,
+		IsVideoOff:    participant.IsVideoOff,
+		IsChatBlocked: participant.ChatMuted(),
+		SelfMuted:     participant.SelfMuted,
+		SelfVideoOff:  participant.SelfVideoOff,
+		HandRaised:    participant.HandRaised,
+		DisplayName:   participant.DisplayName,
+	}
+	response.ChatMutedUntil = activeChatMute(participant)
+
+	// Participants who joined before joiner permissions existed may have no permissions row
+	if permissions, err := h.roomRepo.GetParticipantPermissions(roomID, claims.UserID); err == nil {
+		response.Permissions = &PermissionsInfo{
+			IsAdmin:         permissions.IsAdmin,
+			CanKick:         permissions.CanKick,
+			CanMuteAudio:    permissions.CanMuteAudio,
+			CanDisableVideo: permissions.CanDisableVideo,
+			CanChat:         permissions.CanChat,
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// sendRoomData delivers an event to everyone connected to the room in LiveKit
+// as a reliable data message on the event's topic. Delivery is best effort:
+// a failure is logged and the request carries on.
+func (h *RoomHandler) sendRoomData(ctx context.Context, room *models.Room, topic string, payload interface{}) {
+	if !room.IsActive {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Str("topic", topic).Msg("Failed to encode room data")
+		return
+	}
+	_, err = h.roomService.SendData(ctx, &livekit.SendDataRequest{
+		Room:  room.Name,
+		Data:  data,
+		Kind:  livekit.DataPacket_RELIABLE,
+		Topic: &topic,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("room", room.Name).Str("topic", topic).Msg("Failed to send room data to LiveKit")
+	}
+}
+
+// @Summary Update my participant state
+// @Description Self-report mute, video and hand-raise state in a room. Unmuting is refused while a room admin has muted the caller. Changes reach the room's participants as a LiveKit data message on the "participant.state" topic.
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param request body UpdateMyStateRequest true "State changes"
+// @Success 200 {object} MyParticipantResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /rooms/{roomId}/me/state [patch]
+func (h *RoomHandler) UpdateMyState(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var req UpdateMyStateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	participant, err := h.roomRepo.GetParticipant(roomID, claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch participant",
+		})
+	}
+	if participant == nil || !participant.IsActive {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "You are not in this room",
+		})
+	}
+
+	// Admin-enforced state can't be lifted by the participant
+	if req.IsMuted != nil && !*req.IsMuted && participant.IsMuted {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You have been muted by a room admin",
+		})
+	}
+	if req.IsVideoOff != nil && !*req.IsVideoOff && participant.IsVideoOff {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Your video has been disabled by a room admin",
+		})
+	}
+
+	updates := map[string]interface{}{}
+	if req.IsMuted != nil {
+		updates["self_muted"] = *req.IsMuted
+		participant.SelfMuted = *req.IsMuted
+	}
+	if req.IsVideoOff != nil {
+		updates["self_video_off"] = *req.IsVideoOff
+		participant.SelfVideoOff = *req.IsVideoOff
+	}
+	if req.HandRaised != nil {
+		updates["hand_raised"] = *req.HandRaised
+		participant.HandRaised = *req.HandRaised
+	}
+
+	changed := len(updates) > 0
+
+	// Even an empty update shows the participant is still there
+	updates["last_active_at"] = time.Now()
+	if err := h.roomRepo.UpdateParticipantStatus(roomID, claims.UserID, updates); err != nil {
+		log.Error().Err(err).Str("roomId", roomID).Msg("Failed to update participant state")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update state",
+		})
+	}
+
+	if changed {
+		event := fiber.Map{
+			"roomId":        roomID,
+			"userId":        claims.UserID,
+			"isMuted":       participant.IsMuted || participant.SelfMuted,
+			"isVideoOff":    participant.IsVideoOff || participant.SelfVideoOff,
+			"handRaised":    participant.HandRaised,
+			"adminMuted":    participant.IsMuted,
+			"adminVideoOff": participant.IsVideoOff,
+		}
+		h.hub.Publish(realtime.EventParticipantState, event)
+		h.sendRoomData(c.UserContext(), room, realtime.EventParticipantState, event)
+	}
+
+	response := MyParticipantResponse{
+		RoomID:        participant.RoomID,
+		UserID:        participant.UserID,
+		JoinedAt:      participant.JoinedAt,
+		LeftAt:        participant.LeftAt,
+		IsActive:      participant.IsActive,
+		IsApproved:    participant.IsApproved,
+		IsMuted:       participant.IsMuted,
+		IsVideoOff:    participant.IsVideoOff,
+		IsChatBlocked: participant.ChatMuted(),
+		SelfMuted:     participant.SelfMuted,
+		SelfVideoOff:  participant.SelfVideoOff,
+		HandRaised:    participant.HandRaised,
+		DisplayName:   participant.DisplayName,
+	}
+	response.ChatMutedUntil = activeChatMute(participant)
+	return c.JSON(response)
+}
+
+// @Summary List all rooms (Admin only)
+// @Description Get detailed information about all rooms (requires superadmin access)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} AdminRoomResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/rooms [get]
+func (h *RoomHandler) AdminListRooms(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var rooms []models.Room
+	var err error
+	if claims.TenantID != "" {
+		rooms, err = h.roomRepo.GetRoomsByTenant(claims.TenantID)
+	} else {
+		rooms, err = h.roomRepo.GetAllRooms()
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch rooms",
+		})
+	}
+
+	var response []AdminRoomResponse
+	for _, room := range rooms {
+		participants, err := h.roomRepo.GetRoomParticipantsWithUsers(room.ID)
+		if err != nil {
+			continue
+		}
+
+		var participantInfos []ParticipantInfo
+		for _, p := range participants {
+			info := ParticipantInfo{
+				ID:            p.ID,
+				UserID:        p.UserID,
+				JoinedAt:      p.JoinedAt,
+				IsActive:      p.IsActive,
+				IsMuted:       p.IsMuted,
+				IsVideoOff:    p.IsVideoOff,
+				IsChatBlocked: p.ChatMuted(),
+				SelfMuted:     p.SelfMuted,
+				SelfVideoOff:  p.SelfVideoOff,
+				HandRaised:    p.HandRaised,
+				DisplayName:   p.DisplayName,
+			}
+
+			// Safely access User information
+			if p.User != nil {
+				info.Email = p.User.Email
+				info.Name = p.User.Name
+			}
+
+			participantInfos = append(participantInfos, info)
+		}
+
+		response = append(response, AdminRoomResponse{
+			RoomResponse: RoomResponse{
+				ID:              room.ID,
+				Name:            room.Name,
+				CreatedBy:       room.CreatedBy,
+				IsActive:        room.IsActive,
+				MaxParticipants: room.MaxParticipants,
+				ExpiresAt:       room.ExpiresAt,
+				Settings:        room.Settings,
+				Metadata:        room.Metadata,
+				Region:          room.Region,
+			},
+			Participants: participantInfos,
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// @Summary Count rooms by status (Admin only)
+// @Description Count the rooms in each lifecycle state, limited to the caller's tenant if they have one (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} RoomStatsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/rooms/stats [get]
+func (h *RoomHandler) AdminRoomStats(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	counts, err := h.roomRepo.CountRoomsByStatus(claims.TenantID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to count rooms")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count rooms",
+		})
+	}
+
+	return c.JSON(RoomStatsResponse{
+		Total:       counts.Total,
+		Active:      counts.Active,
+		Expired:     counts.Expired,
+		Inactive:    counts.Inactive,
+		Deactivated: counts.Deactivated,
+	})
+}
+
+// @Summary Create rooms in bulk (Admin only)
+// @Description Create up to 100 rooms owned by the caller; each item succeeds or fails on its own (requires superadmin access)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BulkCreateRoomsRequest true "Rooms to create"
+// @Success 200 {object} BulkCreateRoomsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/rooms/bulk [post]
+func (h *RoomHandler) AdminBulkCreateRooms(c *fiber.Ctx) error {
+	var req BulkCreateRoomsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if len(req.Rooms) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No rooms given",
+		})
+	}
+	if len(req.Rooms) > maxBulkRooms {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("At most %d rooms can be created at once", maxBulkRooms),
+		})
+	}
+
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	response := BulkCreateRoomsResponse{
+		Results: make([]BulkCreateRoomResult, 0, len(req.Rooms)),
+	}
+	seen := make(map[string]bool, len(req.Rooms))
+	for i, spec := range req.Rooms {
+		result := BulkCreateRoomResult{Index: i, Name: spec.Name}
+		room, err := h.bulkCreateRoom(c, claims.UserID, claims.TenantID, spec, seen)
+		if err != nil {
+			result.Error = err.Error()
+			response.Failed++
+		} else {
+			result.Name = room.Name
+			result.Room = &RoomResponse{
+				ID:              room.ID,
+				Name:            room.Name,
+				CreatedBy:       room.CreatedBy,
+				IsActive:        room.IsActive,
+				MaxParticipants: room.MaxParticipants,
+				ExpiresAt:       room.ExpiresAt,
+				Settings:        room.Settings,
+				Metadata:        room.Metadata,
+				Region:          room.Region,
+			}
+			response.Created++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	return c.JSON(response)
+}
+
+// bulkCreateRoom creates one room of a bulk request. The LiveKit room is created
+// inside the database transaction so a LiveKit failure leaves no rows behind.
+// Errors are safe to return to the caller.
+func (h *RoomHandler) bulkCreateRoom(c *fiber.Ctx, createdBy, tenantID string, spec CreateRoomRequest, seen map[string]bool) (*models.Room, error) {
+	lifetime, err := spec.applyVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := normalizeRoomName(spec.Name, h.roomsConfig.LowercaseNames)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.ToLower(name)
+	if seen[key] {
+		return nil, errors.New("duplicate room name in request")
+	}
+	seen[key] = true
+
+	existing, err := h.roomRepo.GetRoomByNameInsensitive(name)
+	if err != nil {
+		log.Error().Err(err).Str("room", name).Msg("Failed to check room name")
+		return nil, errors.New("failed to create room")
+	}
+	if existing != nil {
+		return nil, errors.New("room name is already taken")
+	}
+
+	metadata, err := validateRoomMetadata(spec.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeID, err := h.regionNode(spec.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	maxParticipants, err := h.maxParticipants(spec.MaxParticipants)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := spec.Settings.Resolve(h.defaultSettings())
+	params := repository.CreateRoomParams{
+		CreatedBy: createdBy,
+		TenantID:  tenantID,
+		Name:      name,
+		Settings:  settings,
+		Joiner:    h.joinerPermissions(spec.JoinerPermissions),
+		Metadata:  metadata,
+		Region:    spec.Region,
+		Lifetime:  lifetime,
+
+		MaxParticipants: maxParticipants,
+	}
+	room, err := h.roomRepo.CreateRoomProvisioned(params, func(room *models.Room) error {
+		_, err := h.roomService.CreateRoom(c.UserContext(), &livekit.CreateRoomRequest{
+			Name:            room.Name,
+			MaxParticipants: uint32(room.MaxParticipants),
+			Metadata:        room.Metadata.String(),
+			NodeId:          nodeID,
+		})
+		return err
+	})
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, errors.New("room name is already taken")
+	}
+	if err != nil {
+		log.Error().Err(err).Str("room", name).Msg("Failed to create room in bulk")
+		return nil, errors.New("failed to create room")
+	}
+
+	h.hub.Publish(realtime.EventRoomCreated, fiber.Map{
+		"roomId":    room.ID,
+		"name":      room.Name,
+		"createdBy": room.CreatedBy,
+	})
+	return room, nil
+}
+
+// @Summary Generate room token (Admin only)
+// @Description Generate a token for any user to join a room (requires superadmin access). The optional body narrows the grant, e.g. for viewer-only or recorder tokens; without it the token has full join rights for 24 hours.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Param userId query string true "User ID to generate token for"
+// @Param request body AdminTokenRequest false "Grant, lifetime and identity overrides"
+// @Success 200 {object} AdminTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Identity or name in use by another participant"
+// @Router /admin/rooms/{roomId}/token [post]
+func (h *RoomHandler) AdminGenerateToken(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	userID := c.Query("userId")
+
+	var req AdminTokenRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	ttl, err := req.validate()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Room not found",
 		})
 	}
+	if !room.IsJoinable() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Room is not active or has expired",
+		})
+	}
 
 	user, err := h.roomRepo.GetUserByID(userID)
-	if err != nil || user == nil {
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
 
-	at := lkauth.NewAccessToken(h.apiKey, h.apiSecret)
+	identity := strings.TrimSpace(req.Identity)
+	if identity == "" {
+		identity = h.participantIdentity(user, "")
+	} else if !req.ReplaceIdentity {
+		inUse, err := h.identityInUse(c.UserContext(), room, identity, user.ID)
+		if err != nil {
+			log.Error().Err(err).Str("room", room.Name).Msg("Failed to check identity")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+		if inUse {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Another participant is using this identity; set replaceIdentity to take it over",
+			})
+		}
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = user.Name
+	} else if h.roomsConfig.UniqueDisplayNames != config.DisplayNamesOff {
+		// Held to the room's unique name policy like a joining participant
+		taken, err := h.roomRepo.GetActiveDisplayNames(room.ID, user.ID)
+		if err != nil {
+			log.Error().Err(err).Str("room", room.Name).Msg("Failed to check display name")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+		if name, err = uniqueDisplayName(name, taken, h.roomsConfig.UniqueDisplayNames); err != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// Unset publish/subscribe flags mean LiveKit's default of full rights
 	grant := &lkauth.VideoGrant{
-		RoomJoin: true,
-		Room:     room.Name,
+		RoomJoin:       true,
+		Room:           room.Name,
+		CanPublish:     req.CanPublish,
+		CanSubscribe:   req.CanSubscribe,
+		CanPublishData: req.CanPublishData,
+		Hidden:         req.Hidden,
+		Recorder:       req.Recorder,
 	}
+
+	at := lkauth.NewAccessToken(h.apiKey, h.apiSecret)
 	at.AddGrant(grant).
-		SetIdentity(user.Email).
-		SetValidFor(time.Hour * 24)
+		SetIdentity(identity).
+		SetName(name).
+		SetValidFor(ttl)
 
 	token, err := at.ToJWT()
 	if err != nil {
@@ -316,7 +2439,177 @@ func (h *RoomHandler) AdminGenerateToken(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"token": token,
+	// A token nobody can trace back to the admin who issued it is not handed out
+	err = h.auditRepo.Record(claims.UserID, models.AuditRoomTokenIssued, "room", room.ID, map[string]interface{}{
+		"userId":     user.ID,
+		"identity":   identity,
+		"name":       name,
+		"ttlSeconds": int(ttl.Seconds()),
+		"grant":      grant,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit entry",
+		})
+	}
+
+	return c.JSON(AdminTokenResponse{
+		Token:     token,
+		Identity:  identity,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+}
+
+// identityInUse reports whether a LiveKit identity is connected to the room, or
+// belongs to an active participant other than the user the token is for
+func (h *RoomHandler) identityInUse(ctx context.Context, room *models.Room, identity, userID string) (bool, error) {
+	participants, err := h.roomRepo.GetActiveParticipantsWithUsers(room.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, participant := range participants {
+		if participant.UserID != userID && participant.User != nil && account.IsUserIdentity(h.identityStrategy, identity, participant.User) {
+			return true, nil
+		}
+	}
+
+	res, err := h.roomService.ListParticipants(ctx, &livekit.ListParticipantsRequest{
+		Room: room.Name,
+	})
+	if err != nil {
+		// The LiveKit room may not exist yet, in which case nobody is connected
+		log.Warn().Err(err).Str("room", room.Name).Msg("Failed to list LiveKit participants")
+		return false, nil
+	}
+	for _, p := range res.GetParticipants() {
+		if p.GetIdentity() == identity {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// @Summary Get room participant history (Admin only)
+// @Description List every join/leave cycle in a room with its duration (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} RoomHistoryResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/rooms/{roomId}/history [get]
+func (h *RoomHandler) AdminRoomHistory(c *fiber.Ctx) error {
+	roomID := c.Params("roomId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	room, err := h.roomRepo.GetRoom(roomID)
+	if err != nil || room == nil || !claims.CanAccessTenant(room.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Room not found",
+		})
+	}
+
+	sessions, err := h.roomRepo.GetParticipantSessions(room.ID)
+	if err != nil {
+		log.Error().Err(err).Str("room", room.Name).Msg("Failed to fetch participant sessions")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch room history",
+		})
+	}
+
+	response := RoomHistoryResponse{
+		RoomID:   room.ID,
+		Sessions: make([]ParticipantSessionInfo, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, ParticipantSessionInfo{
+			ID:              session.ID,
+			UserID:          session.UserID,
+			JoinedAt:        session.JoinedAt,
+			LeftAt:          session.LeftAt,
+			DurationSeconds: int64(session.Duration().Seconds()),
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// @Summary List a user's rooms (Admin only)
+// @Description Get every room a user participates in with their status and permissions (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param page query int false "Page number, starting at 1"
+// @Param limit query int false "Page size"
+// @Success 200 {object} UserRoomsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/rooms [get]
+func (h *RoomHandler) AdminListUserRooms(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	user, err := h.roomRepo.GetUserByID(userID)
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := pagination.ClampLimit(c.QueryInt("limit"))
+
+	participants, total, err := h.roomRepo.GetUserRoomsWithPermissions(userID, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch rooms",
+		})
+	}
+
+	rooms := make([]UserRoomInfo, 0, len(participants))
+	for _, p := range participants {
+		info := UserRoomInfo{
+			RoomID:        p.RoomID,
+			JoinedAt:      p.JoinedAt,
+			LeftAt:        p.LeftAt,
+			IsActive:      p.IsActive,
+			IsMuted:       p.IsMuted,
+			IsVideoOff:    p.IsVideoOff,
+			IsChatBlocked: p.ChatMuted(),
+		}
+		if p.Room != nil {
+			info.RoomName = p.Room.Name
+			info.RoomIsActive = p.Room.IsActive
+		}
+		if p.Permission != nil {
+			info.Permissions = &PermissionsInfo{
+				IsAdmin:         p.Permission.IsAdmin,
+				CanKick:         p.Permission.CanKick,
+				CanMuteAudio:    p.Permission.CanMuteAudio,
+				CanDisableVideo: p.Permission.CanDisableVideo,
+				CanChat:         p.Permission.CanChat,
+			}
+		}
+		rooms = append(rooms, info)
+	}
+
+	return c.JSON(UserRoomsResponse{
+		Rooms: rooms,
+		Meta:  pagination.NewMeta(total, page, limit),
+		Limit: limit,
 	})
 }
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"encoding/csv"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminExportParticipants(t *testing.T) {
+	joined := time.Date(2024, 3, 9, 14, 0, 0, 0, time.UTC)
+	left := joined.Add(45 * time.Minute)
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "name", "is_active"},
+				Rows:    [][]interface{}{{"r1", "Team standup!", true}},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "room_id", "user_id", "display_name", "joined_at", "left_at", "is_active"},
+				Rows: [][]interface{}{
+					{"p1", "r1", "u1", "", joined, left, false},
+					{"p2", "r1", "u2", "Bob (2)", joined.Add(time.Minute), nil, true},
+				},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "name"},
+				Rows: [][]interface{}{
+					{"u1", "ann@example.com", "=Ann"},
+					{"u2", "bob@example.com", "Bob"},
+				},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	app := fiber.New()
+	app.Get("/admin/rooms/:roomId/participants.csv", signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}), h.AdminExportParticipants)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/rooms/r1/participants.csv", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if got := resp.Header.Get(fiber.HeaderContentType); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/csv", got)
+	}
+	if got, want := resp.Header.Get(fiber.HeaderContentDisposition), `attachment; filename="Team_standup_-participants.csv"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	want := [][]string{
+		{"name", "email", "joined_at", "left_at", "active"},
+		{"'=Ann", "ann@example.com", "2024-03-09T14:00:00Z", "2024-03-09T14:45:00Z", "false"},
+		{"Bob (2)", "bob@example.com", "2024-03-09T14:01:00Z", "", "true"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV = %q, want %q", rows, want)
+	}
+}
+
+func TestAdminExportParticipantsOfAnotherTenant(t *testing.T) {
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{
+			Columns: []string{"id", "name", "tenant_id", "is_active"},
+			Rows:    [][]interface{}{{"r1", "standup", "acme", true}},
+		}, nil
+	})
+
+	app := fiber.New()
+	app.Get("/admin/rooms/:roomId/participants.csv", signedIn(&auth.Claims{UserID: "root", TenantID: "globex", Accesses: []string{"superadmin"}}), h.AdminExportParticipants)
+
+	if status := call(t, app, "GET", "/admin/rooms/r1/participants.csv", nil, nil); status != fiber.StatusNotFound {
+		t.Errorf("status = %d, want %d", status, fiber.StatusNotFound)
+	}
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/models"
+	"errors"
+)
+
+// maxRoomMetadataBytes bounds the JSON form of a room's metadata, which LiveKit
+// forwards to every participant
+const maxRoomMetadataBytes = 4096
+
+var errRoomMetadataSize = errors.New("room metadata must be at most 4096 bytes as JSON")
+
+// validateRoomMetadata converts client metadata to its stored form and checks its size
+func validateRoomMetadata(metadata map[string]string) (models.StringMap, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	m := models.StringMap(metadata)
+	if len(m.String()) > maxRoomMetadataBytes {
+		return nil, errRoomMetadataSize
+	}
+	return m, nil
+}
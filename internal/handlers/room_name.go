@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/models"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Room name length bounds, in characters
+const (
+	minRoomNameLength = 3
+	maxRoomNameLength = 64
+)
+
+var (
+	errRoomNameEmpty   = errors.New("room name is required")
+	errRoomNameLength  = errors.New("room name must be between 3 and 64 characters")
+	errRoomNameCharset = errors.New("room name may only contain letters, digits, '-', '_' and '.'")
+)
+
+// normalizeRoomName trims a room name, optionally lowercases it, and checks it
+// against the characters LiveKit and URLs handle without surprises.
+func normalizeRoomName(name string, lowercase bool) (string, error) {
+	name = strings.TrimSpace(name)
+	if lowercase {
+		name = strings.ToLower(name)
+	}
+
+	if name == "" {
+		return "", errRoomNameEmpty
+	}
+	if n := utf8.RuneCountInString(name); n < minRoomNameLength || n > maxRoomNameLength {
+		return "", errRoomNameLength
+	}
+	for _, r := range name {
+		if !isRoomNameRune(r) {
+			return "", errRoomNameCharset
+		}
+	}
+
+	return name, nil
+}
+
+// findRoomByName looks up the room a client named, returning nil when there is
+// none. The name is normalised the way new room names are, but rooms named
+// before the current rules, with mixed case or other characters, are still
+// found by their exact name.
+func (h *RoomHandler) findRoomByName(raw string) (*models.Room, error) {
+	raw = strings.TrimSpace(raw)
+	if name, err := normalizeRoomName(raw, h.roomsConfig.LowercaseNames); err == nil {
+		room, err := h.roomRepo.GetRoomByName(name)
+		if err != nil || room != nil || name == raw {
+			return room, err
+		}
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	return h.roomRepo.GetRoomByName(raw)
+}
+
+func isRoomNameRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r == '-', r == '_', r == '.':
+		return true
+	}
+	return false
+}
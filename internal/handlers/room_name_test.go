@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNormalizeRoomName(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		lowercase bool
+		want      string
+		wantErr   error
+	}{
+		{"valid", "team-standup_2.0", false, "team-standup_2.0", nil},
+		{"surrounding whitespace is trimmed", "  standup \t", false, "standup", nil},
+		{"case is kept", "StandUp", false, "StandUp", nil},
+		{"lowercased when configured", "StandUp", true, "standup", nil},
+		{"shortest", "abc", false, "abc", nil},
+		{"longest", strings.Repeat("a", maxRoomNameLength), false, strings.Repeat("a", maxRoomNameLength), nil},
+		{"empty", "", false, "", errRoomNameEmpty},
+		{"whitespace only", "   \t", false, "", errRoomNameEmpty},
+		{"too short", "ab", false, "", errRoomNameLength},
+		{"too long", strings.Repeat("a", maxRoomNameLength+1), false, "", errRoomNameLength},
+		{"inner space", "team standup", false, "", errRoomNameCharset},
+		{"slash", "team/standup", false, "", errRoomNameCharset},
+		{"non-ASCII letters", "réunion", false, "", errRoomNameCharset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeRoomName(tt.raw, tt.lowercase)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("normalizeRoomName(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeRoomName(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateRoomRejectsInvalidNames(t *testing.T) {
+	h, fake := newTestRoomHandler(t, nil)
+	lk := newFakeRoomService()
+	h.roomService = lk
+
+	app := fiber.New()
+	app.Post("/create-room", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.CreateRoom)
+
+	for _, name := range []string{"   ", "team standup", strings.Repeat("a", maxRoomNameLength+1)} {
+		if status := call(t, app, "POST", "/create-room", CreateRoomRequest{Name: name}, nil); status != fiber.StatusBadRequest {
+			t.Errorf("CreateRoom(%q): status = %d, want %d", name, status, fiber.StatusBadRequest)
+		}
+	}
+	if len(lk.created) != 0 || len(fake.Statements()) != 0 {
+		t.Errorf("invalid names reached LiveKit (%d) or the database (%d)", len(lk.created), len(fake.Statements()))
+	}
+}
@@ -0,0 +1,1905 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/realtime"
+	"bedrud-backend/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	lkauth "github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	"github.com/twitchtv/twirp"
+)
+
+// newTestRoomHandler returns testRoomHandler backed by a fake database and an
+// empty fake LiveKit
+func newTestRoomHandler(t *testing.T, answer dbtest.Answer) (*RoomHandler, *dbtest.DB) {
+	t.Helper()
+
+	db, fake := dbtest.Open(t, answer)
+	h := testRoomHandler()
+	h.roomRepo = repository.NewRoomRepository(db)
+	h.auditRepo = repository.NewAuditRepository(db)
+	h.roomService = newFakeRoomService()
+	h.livekitConfig = &config.LiveKitConfig{}
+	h.roomsConfig = &config.RoomsConfig{}
+	h.hub = realtime.NewHub()
+	return h, fake
+}
+
+// roomRow answers a room lookup with an active room r1 named standup
+func roomRow() *dbtest.Result {
+	return &dbtest.Result{
+		Columns: []string{"id", "name", "is_active", "max_participants"},
+		Rows:    [][]interface{}{{"r1", "standup", true, int64(20)}},
+	}
+}
+
+func TestAdminListUserRooms(t *testing.T) {
+	now := time.Now()
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+			return &dbtest.Result{Columns: []string{"id", "email"}, Rows: [][]interface{}{{"u1", "ann@example.com"}}}, nil
+		case stmt.Is("SELECT") && stmt.Mentions("count("):
+			return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(3)}}}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "room_id", "user_id", "joined_at", "is_active", "is_muted", "is_video_off", "is_chat_blocked", "Room__id", "Room__name", "Room__is_active"},
+				Rows: [][]interface{}{
+					{"p1", "r1", "u1", now, true, true, false, false, "r1", "standup", true},
+					{"p2", "r2", "u1", now.Add(-time.Hour), false, false, true, true, "r2", "retro", false},
+					{"p3", "r3", "u1", now.Add(-2 * time.Hour), true, false, false, false, "r3", "planning", true},
+				},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "room_id", "user_id", "is_admin", "can_kick", "can_mute_audio", "can_disable_video", "can_chat"},
+				Rows: [][]interface{}{
+					{"perm1", "r1", "u1", true, true, true, true, true},
+					{"perm2", "r2", "u1", false, false, false, false, false},
+				},
+			}, nil
+		}
+		return nil, nil
+	})
+
+	app := fiber.New()
+	app.Get("/admin/users/:id/rooms", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), h.AdminListUserRooms)
+
+	var resp UserRoomsResponse
+	if status := call(t, app, "GET", "/admin/users/u1/rooms?limit=10", nil, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if resp.Total != 3 || len(resp.Rooms) != 3 {
+		t.Fatalf("listed %d of %d rooms, want 3 of 3", len(resp.Rooms), resp.Total)
+	}
+
+	standup, retro, planning := resp.Rooms[0], resp.Rooms[1], resp.Rooms[2]
+	if standup.RoomName != "standup" || !standup.IsActive || !standup.IsMuted || standup.IsChatBlocked {
+		t.Errorf("standup = %+v, want active and muted", standup)
+	}
+	if p := standup.Permissions; p == nil || !p.IsAdmin || !p.CanKick || !p.CanChat {
+		t.Errorf("standup permissions = %+v, want a room admin", p)
+	}
+	if retro.RoomName != "retro" || retro.IsActive || !retro.IsVideoOff || !retro.IsChatBlocked || retro.RoomIsActive {
+		t.Errorf("retro = %+v, want left, video off and chat blocked in an inactive room", retro)
+	}
+	if p := retro.Permissions; p == nil || p.IsAdmin || p.CanChat {
+		t.Errorf("retro permissions = %+v, want no admin and no chat", p)
+	}
+	if planning.Permissions != nil {
+		t.Errorf("planning permissions = %+v, want none", planning.Permissions)
+	}
+}
+
+func TestAdminListUserRoomsUnknownUser(t *testing.T) {
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Columns: []string{"id"}}, nil
+	})
+
+	app := fiber.New()
+	app.Get("/admin/users/:id/rooms", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), h.AdminListUserRooms)
+
+	if status := call(t, app, "GET", "/admin/users/missing/rooms", nil, nil); status != fiber.StatusNotFound {
+		t.Errorf("status = %d, want %d", status, fiber.StatusNotFound)
+	}
+}
+
+func TestEnsureLiveKitRoom(t *testing.T) {
+	room := &models.Room{Name: "standup", MaxParticipants: 12}
+
+	t.Run("missing room is recreated", func(t *testing.T) {
+		lk := newFakeRoomService()
+		h := testRoomHandler()
+		h.roomService = lk
+		h.livekitConfig = &config.LiveKitConfig{}
+
+		created, err := h.ensureLiveKitRoom(context.Background(), room)
+		if err != nil || !created {
+			t.Fatalf("ensureLiveKitRoom() = %v, %v, want true, nil", created, err)
+		}
+		if len(lk.created) != 1 || lk.created[0].Name != "standup" || lk.created[0].MaxParticipants != 12 {
+			t.Errorf("created %v, want standup for 12 participants", lk.created)
+		}
+	})
+
+	t.Run("existing room is left alone", func(t *testing.T) {
+		lk := newFakeRoomService("standup")
+		h := testRoomHandler()
+		h.roomService = lk
+		h.livekitConfig = &config.LiveKitConfig{}
+
+		created, err := h.ensureLiveKitRoom(context.Background(), room)
+		if err != nil || created {
+			t.Fatalf("ensureLiveKitRoom() = %v, %v, want false, nil", created, err)
+		}
+		if len(lk.created) != 0 {
+			t.Errorf("created %v, want nothing", lk.created)
+		}
+	})
+}
+
+func TestDefaultSettingsFollowTheConfig(t *testing.T) {
+	h := testRoomHandler()
+	h.roomsConfig = &config.RoomsConfig{
+		DefaultSettings: config.RoomSettingsConfig{AllowChat: true, AllowAudio: true, RequireApproval: true},
+	}
+
+	var req CreateRoomRequest
+	if err := json.Unmarshal([]byte(`{"name": "standup", "settings": {"allowChat": false}}`), &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	want := models.RoomSettings{AllowAudio: true, RequireApproval: true}
+	if got := req.Settings.Resolve(h.defaultSettings()); got != want {
+		t.Errorf("settings = %+v, want %+v", got, want)
+	}
+}
+
+func TestJoinTokenIdentity(t *testing.T) {
+	user := &models.User{ID: "u1", Email: "ann@example.com", Name: "Ann"}
+
+	tests := []struct {
+		strategy string
+		deviceID string
+		want     string
+	}{
+		{config.IdentityEmail, "laptop", "ann@example.com"},
+		{config.IdentityUserID, "laptop", "u1"},
+		{config.IdentityUserIDDevice, "laptop", "u1#laptop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			h := testRoomHandler()
+			h.identityStrategy = tt.strategy
+
+			token, err := h.joinToken(user, "Ann (guest)", "standup", tt.deviceID, true)
+			if err != nil {
+				t.Fatalf("joinToken() = %v", err)
+			}
+			decoded, err := h.decodeToken(token)
+			if err != nil {
+				t.Fatalf("decodeToken() = %v", err)
+			}
+			if decoded.Identity != tt.want || decoded.Name != "Ann (guest)" {
+				t.Errorf("identity %q, name %q, want %q and the display name", decoded.Identity, decoded.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestParticipantIdentityWithoutDevice(t *testing.T) {
+	h := testRoomHandler()
+	h.identityStrategy = config.IdentityUserIDDevice
+	user := &models.User{ID: "u1", Email: "ann@example.com"}
+
+	first, second := h.participantIdentity(user, ""), h.participantIdentity(user, "")
+	if !strings.HasPrefix(first, "u1#") || len(first) <= len("u1#") {
+		t.Errorf("participantIdentity() = %q, want u1# and a device ID", first)
+	}
+	if first == second {
+		t.Errorf("two tabs without a device ID both got %q", first)
+	}
+}
+
+func TestEndRoom(t *testing.T) {
+	h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`) {
+			return roomRow(), nil
+		}
+		return &dbtest.Result{Affected: 3}, nil
+	})
+	lk := newFakeRoomService("standup")
+	h.roomService = lk
+	events, err := h.hub.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+
+	app := fiber.New()
+	app.Post("/rooms/:roomId/end", signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}}), h.EndRoom)
+
+	if status := call(t, app, "POST", "/rooms/r1/end", nil, nil); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	if len(lk.deleted) != 1 || lk.deleted[0] != "standup" {
+		t.Errorf("deleted LiveKit rooms %v, want standup", lk.deleted)
+	}
+
+	left := fake.Find("UPDATE", `"room_participants"`)
+	if len(left) != 1 || !left[0].Mentions(`"left_at"`) || !hasArg(left[0].Args, "r1") || !hasArg(left[0].Args, false) {
+		t.Errorf("participant updates = %v, want every participant of r1 marked inactive with a leave time", left)
+	}
+	closed := fake.Find("UPDATE", `"rooms"`)
+	if len(closed) != 1 || !hasArg(closed[0].Args, false) || !hasArg(closed[0].Args, "r1") {
+		t.Errorf("room updates = %v, want r1 deactivated", closed)
+	}
+	if deletes := fake.Find("DELETE", ""); len(deletes) != 0 {
+		t.Errorf("deleted %v, want the history kept", deletes)
+	}
+	for _, event := range fake.Transactions() {
+		if event == dbtest.Rollback {
+			t.Errorf("transactions = %v, want every one committed", fake.Transactions())
+			break
+		}
+	}
+
+	select {
+	case event := <-events.Events():
+		if event.Type != realtime.EventRoomEnded {
+			t.Errorf("event = %s, want %s", event.Type, realtime.EventRoomEnded)
+		}
+	default:
+		t.Error("no room ended event was published")
+	}
+}
+
+func TestModeratorsEndAnyRoomOfTheirTenant(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     *auth.Claims
+		wantStatus int
+	}{
+		{"moderator outside the room", &auth.Claims{UserID: "mod", TenantID: "acme", Accesses: []string{"user", "moderator"}}, fiber.StatusOK},
+		{"other tenant's moderator", &auth.Claims{UserID: "mod", TenantID: "globex", Accesses: []string{"moderator"}}, fiber.StatusNotFound},
+		{"admin without room rights", &auth.Claims{UserID: "u2", TenantID: "acme", Accesses: []string{"user", "admin"}}, fiber.StatusForbidden},
+		{"user without room rights", &auth.Claims{UserID: "u2", TenantID: "acme", Accesses: []string{"user"}}, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			switch {
+			case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+				return &dbtest.Result{
+					Columns: []string{"id", "name", "is_active", "tenant_id"},
+					Rows:    [][]interface{}{{"r1", "standup", true, "acme"}},
+				}, nil
+			case stmt.Is("SELECT"):
+				return &dbtest.Result{Columns: []string{"id"}}, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+		lk := newFakeRoomService("standup")
+		h.roomService = lk
+
+		app := fiber.New()
+		app.Post("/rooms/:roomId/end", signedIn(tt.claims), h.EndRoom)
+
+		if status := call(t, app, "POST", "/rooms/r1/end", nil, nil); status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+		if ended := len(lk.deleted) == 1; ended != (tt.wantStatus == fiber.StatusOK) {
+			t.Errorf("%s: deleted LiveKit rooms %v", tt.name, lk.deleted)
+		}
+	}
+}
+
+// fakeRoom plays a single room r1 named standup whose status follows the
+// updates run against it, and user u1 who joins it
+type fakeRoom struct {
+	mu            sync.Mutex
+	isActive      bool
+	expiresAt     time.Time
+	deactivatedAt interface{}
+}
+
+func (f *fakeRoom) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "name", "is_active", "expires_at", "deactivated_at"},
+			Rows:    [][]interface{}{{"r1", "standup", f.isActive, f.expiresAt, f.deactivatedAt}},
+		}, nil
+	case stmt.Is("UPDATE") && stmt.Mentions(`UPDATE "rooms"`):
+		if v, ok := stmt.Value("is_active"); ok {
+			f.isActive = v.(bool)
+		}
+		if v, ok := stmt.Value("deactivated_at"); ok {
+			f.deactivatedAt = v
+		}
+		if v, ok := stmt.Value("expires_at"); ok {
+			f.expiresAt = v.(time.Time)
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "name", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", "Ann", "{user}", true}},
+		}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestDeactivatedRoomRejectsJoins(t *testing.T) {
+	room := &fakeRoom{isActive: true, expiresAt: time.Now().Add(time.Hour)}
+	h, _ := newTestRoomHandler(t, room.answer)
+
+	moderator := signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}})
+	app := fiber.New()
+	app.Post("/rooms/join", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.JoinRoom)
+	app.Post("/rooms/:roomId/deactivate", moderator, h.DeactivateRoom)
+	app.Post("/rooms/:roomId/reactivate", moderator, h.ReactivateRoom)
+
+	join := func() int {
+		return call(t, app, "POST", "/rooms/join", JoinRoomRequest{RoomName: "standup"}, nil)
+	}
+
+	if status := join(); status != fiber.StatusOK {
+		t.Fatalf("joining the open room: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := call(t, app, "POST", "/rooms/r1/deactivate", nil, nil); status != fiber.StatusOK {
+		t.Fatalf("deactivate: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := join(); status != fiber.StatusBadRequest {
+		t.Errorf("joining the deactivated room: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+	if status := call(t, app, "POST", "/rooms/r1/reactivate", nil, nil); status != fiber.StatusOK {
+		t.Fatalf("reactivate: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := join(); status != fiber.StatusOK {
+		t.Errorf("joining the reactivated room: status = %d, want %d", status, fiber.StatusOK)
+	}
+}
+
+func TestReactivateRefreshesAnExpiredRoom(t *testing.T) {
+	room := &fakeRoom{expiresAt: time.Now().Add(-time.Hour), deactivatedAt: time.Now().Add(-2 * time.Hour)}
+	h, _ := newTestRoomHandler(t, room.answer)
+
+	app := fiber.New()
+	app.Post("/rooms/:roomId/reactivate", signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}}), h.ReactivateRoom)
+
+	var resp models.Room
+	if status := call(t, app, "POST", "/rooms/r1/reactivate", nil, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if !resp.IsActive || resp.DeactivatedAt != nil || !resp.ExpiresAt.After(time.Now()) {
+		t.Errorf("room = active %v, deactivated %v, expires %v, want open with a fresh expiry", resp.IsActive, resp.DeactivatedAt, resp.ExpiresAt)
+	}
+}
+
+func TestAdminRoomHistoryDurations(t *testing.T) {
+	joined := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	left := joined.Add(5 * time.Minute)
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return roomRow(), nil
+		case stmt.Is("SELECT") && stmt.Mentions(`"participant_sessions"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "room_id", "user_id", "joined_at", "left_at"},
+				Rows: [][]interface{}{
+					{"s1", "r1", "u1", joined, left},
+					{"s2", "r1", "u1", time.Now().Add(-time.Minute), nil},
+				},
+			}, nil
+		}
+		return nil, nil
+	})
+
+	app := fiber.New()
+	app.Get("/admin/rooms/:roomId/history", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), h.AdminRoomHistory)
+
+	var resp RoomHistoryResponse
+	if status := call(t, app, "GET", "/admin/rooms/r1/history", nil, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if len(resp.Sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(resp.Sessions))
+	}
+	if got := resp.Sessions[0].DurationSeconds; got != 300 {
+		t.Errorf("closed session lasted %ds, want 300", got)
+	}
+	if got := resp.Sessions[1].DurationSeconds; got < 59 || got > 61 {
+		t.Errorf("open session has lasted %ds, want about 60 so far", got)
+	}
+}
+
+func TestCheckRoomName(t *testing.T) {
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		result := &dbtest.Result{Columns: []string{"id", "name", "tenant_id"}}
+		// Two rooms exist: Standup in the caller's deployment and Retro in tenant acme
+		if name, ok := stmt.Args[0].(string); ok && stmt.Mentions("LOWER(name) = LOWER(") {
+			switch strings.ToLower(name) {
+			case "standup":
+				result.Rows = [][]interface{}{{"r1", "Standup", ""}}
+			case "retro":
+				result.Rows = [][]interface{}{{"r2", "Retro", "acme"}}
+			}
+		}
+		return result, nil
+	})
+
+	app := fiber.New()
+	app.Get("/rooms/available", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.CheckRoomName)
+
+	tests := []struct {
+		name          string
+		wantStatus    int
+		wantAvailable bool
+	}{
+		{"standup", fiber.StatusOK, false},
+		{"STANDUP", fiber.StatusOK, false},
+		{"retro", fiber.StatusOK, false},
+		{"planning", fiber.StatusOK, true},
+		{"no", fiber.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp map[string]interface{}
+			status := call(t, app, "GET", "/rooms/available?name="+tt.name, nil, &resp)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status != fiber.StatusOK {
+				return
+			}
+			if len(resp) != 1 || resp["available"] != tt.wantAvailable {
+				t.Errorf("response = %v, want only available: %v", resp, tt.wantAvailable)
+			}
+		})
+	}
+}
+
+// roomAdmins plays room r1 with participants u1 and u2, answering permission
+// lookups and upserts from an in-memory table of who is an admin
+type roomAdmins struct {
+	mu    sync.Mutex
+	admin map[string]bool // user ID -> is admin
+}
+
+func (f *roomAdmins) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	columns := []string{"room_id", "user_id", "is_admin"}
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+		return roomRow(), nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+		return &dbtest.Result{
+			Columns: []string{"room_id", "user_id", "is_active"},
+			Rows:    [][]interface{}{{"r1", stmt.Args[1], true}},
+		}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`) && stmt.Mentions("FOR UPDATE"):
+		result := &dbtest.Result{Columns: columns}
+		for userID, admin := range f.admin {
+			if admin {
+				result.Rows = append(result.Rows, []interface{}{"r1", userID, true})
+			}
+		}
+		return result, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`):
+		userID := stmt.Args[1].(string)
+		return &dbtest.Result{Columns: columns, Rows: [][]interface{}{{"r1", userID, f.admin[userID]}}}, nil
+	case stmt.Is("INSERT") && stmt.Mentions(`"room_permissions"`):
+		userID, _ := stmt.Value("user_id")
+		admin, _ := stmt.Value("is_admin")
+		f.admin[userID.(string)] = admin.(bool)
+		return &dbtest.Result{Affected: 1}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestRoomKeepsAnAdmin(t *testing.T) {
+	tests := []struct {
+		name        string
+		admins      map[string]bool
+		actor       *auth.Claims
+		method      string
+		target      string
+		body        interface{}
+		wantStatus  int
+		wantError   string
+		wantAdminU1 bool
+	}{
+		{
+			name:        "last admin demotes themselves",
+			admins:      map[string]bool{"u1": true, "u2": false},
+			actor:       &auth.Claims{UserID: "u1", Accesses: []string{"user"}},
+			method:      "POST",
+			target:      "/rooms/r1/participants/u1/demote",
+			wantStatus:  fiber.StatusConflict,
+			wantError:   "You are the room's last admin; promote someone else before stepping down",
+			wantAdminU1: true,
+		},
+		{
+			name:        "last admin revokes their own admin permission",
+			admins:      map[string]bool{"u1": true, "u2": false},
+			actor:       &auth.Claims{UserID: "u1", Accesses: []string{"user"}},
+			method:      "PUT",
+			target:      "/rooms/r1/participants/u1/permissions",
+			body:        PermissionsInfo{CanChat: true},
+			wantStatus:  fiber.StatusConflict,
+			wantError:   "You are the room's last admin; promote someone else before giving up admin rights",
+			wantAdminU1: true,
+		},
+		{
+			name:        "moderator demotes the last admin",
+			admins:      map[string]bool{"u1": true, "u2": false},
+			actor:       &auth.Claims{UserID: "mod", Accesses: []string{"moderator"}},
+			method:      "POST",
+			target:      "/rooms/r1/participants/u1/demote",
+			wantStatus:  fiber.StatusConflict,
+			wantError:   "Cannot demote the room's last admin",
+			wantAdminU1: true,
+		},
+		{
+			name:        "admin steps down once there is another",
+			admins:      map[string]bool{"u1": true, "u2": true},
+			actor:       &auth.Claims{UserID: "u1", Accesses: []string{"user"}},
+			method:      "POST",
+			target:      "/rooms/r1/participants/u1/demote",
+			wantStatus:  fiber.StatusOK,
+			wantAdminU1: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admins := &roomAdmins{admin: tt.admins}
+			h, fake := newTestRoomHandler(t, admins.answer)
+
+			app := fiber.New()
+			app.Post("/rooms/:roomId/participants/:userId/demote", signedIn(tt.actor), h.DemoteParticipant)
+			app.Put("/rooms/:roomId/participants/:userId/permissions", signedIn(tt.actor), h.UpdatePermissions)
+
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if status := call(t, app, tt.method, tt.target, tt.body, &resp); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if resp.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", resp.Error, tt.wantError)
+			}
+			if admins.admin["u1"] != tt.wantAdminU1 {
+				t.Errorf("u1 is admin = %v, want %v", admins.admin["u1"], tt.wantAdminU1)
+			}
+			if tt.wantStatus == fiber.StatusConflict && len(fake.Find("INSERT", `"audit_logs"`)) != 0 {
+				t.Error("recorded an audit entry for a refused change")
+			}
+		})
+	}
+}
+
+func TestPromoteAndDemoteParticipant(t *testing.T) {
+	tests := []struct {
+		name        string
+		actor       *auth.Claims
+		target      string
+		wantStatus  int
+		wantAdminU2 bool
+		wantFlags   map[string]interface{}
+		wantAudit   string
+	}{
+		{
+			name:        "admin promotes a participant",
+			actor:       &auth.Claims{UserID: "u1", Accesses: []string{"user"}},
+			target:      "/rooms/r1/participants/u2/promote",
+			wantStatus:  fiber.StatusOK,
+			wantAdminU2: true,
+			wantFlags:   map[string]interface{}{"is_admin": true, "can_kick": true, "can_mute_audio": true, "can_disable_video": true, "can_chat": true},
+			wantAudit:   models.AuditRoomAdminPromoted,
+		},
+		{
+			name:       "admin demotes a co-host",
+			actor:      &auth.Claims{UserID: "u1", Accesses: []string{"user"}},
+			target:     "/rooms/r1/participants/u3/demote",
+			wantStatus: fiber.StatusOK,
+			wantFlags:  map[string]interface{}{"is_admin": false, "can_kick": false, "can_mute_audio": false, "can_disable_video": false},
+			wantAudit:  models.AuditRoomAdminDemoted,
+		},
+		{
+			name:       "participant without admin rights",
+			actor:      &auth.Claims{UserID: "u2", Accesses: []string{"user"}},
+			target:     "/rooms/r1/participants/u2/promote",
+			wantStatus: fiber.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		admins := &roomAdmins{admin: map[string]bool{"u1": true, "u2": false, "u3": true}}
+		h, fake := newTestRoomHandler(t, admins.answer)
+
+		app := fiber.New()
+		app.Post("/rooms/:roomId/participants/:userId/promote", signedIn(tt.actor), h.PromoteParticipant)
+		app.Post("/rooms/:roomId/participants/:userId/demote", signedIn(tt.actor), h.DemoteParticipant)
+
+		if status := call(t, app, "POST", tt.target, nil, nil); status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+			continue
+		}
+		if admins.admin["u2"] != tt.wantAdminU2 {
+			t.Errorf("%s: u2 is admin = %v, want %v", tt.name, admins.admin["u2"], tt.wantAdminU2)
+		}
+
+		upserts := fake.Find("INSERT", `"room_permissions"`)
+		audits := fake.Find("INSERT", `"audit_logs"`)
+		if tt.wantStatus != fiber.StatusOK {
+			if len(upserts) != 0 || len(audits) != 0 {
+				t.Errorf("%s: changed permissions %v and audited %v, want nothing", tt.name, upserts, audits)
+			}
+			continue
+		}
+		if len(upserts) != 1 {
+			t.Fatalf("%s: %d permission upserts, want 1", tt.name, len(upserts))
+		}
+		for column, want := range tt.wantFlags {
+			if got, _ := upserts[0].Value(column); got != want {
+				t.Errorf("%s: %s = %v, want %v", tt.name, column, got, want)
+			}
+		}
+		if len(audits) != 1 || !hasArg(audits[0].Args, tt.wantAudit) {
+			t.Errorf("%s: audit entries = %v, want %s", tt.name, audits, tt.wantAudit)
+		}
+	}
+}
+
+func TestExpiredRoomIsNotJoinableAnywhere(t *testing.T) {
+	h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "name", "is_active", "expires_at"},
+				Rows:    [][]interface{}{{"r1", "standup", true, time.Now().Add(-time.Minute)}},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			return &dbtest.Result{
+				Columns: []string{"room_id", "user_id", "is_active", "is_approved"},
+				Rows:    [][]interface{}{{"r1", "u1", true, true}},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`):
+			return &dbtest.Result{Columns: []string{"room_id", "user_id", "can_chat"}, Rows: [][]interface{}{{"r1", "u1", true}}}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "name", "accesses", "is_active"},
+				Rows:    [][]interface{}{{"u1", "ann@example.com", "Ann", "{user}", true}},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	h.identityStrategy = config.IdentityUserID
+	lk := newFakeRoomService()
+	h.roomService = lk
+
+	user := signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}})
+	root := signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}})
+	app := fiber.New()
+	app.Post("/rooms/join", user, h.JoinRoom)
+	app.Post("/rooms/:roomName/refresh-token", user, h.RefreshJoinToken)
+	app.Get("/rooms/:roomName/membership", user, h.GetMembership)
+	app.Post("/admin/rooms/:roomId/token", root, h.AdminGenerateToken)
+	app.Post("/rooms/:roomId/ensure", root, h.EnsureRoom)
+
+	tests := []struct {
+		method     string
+		target     string
+		body       interface{}
+		wantStatus int
+	}{
+		{"POST", "/rooms/join", JoinRoomRequest{RoomName: "standup"}, fiber.StatusBadRequest},
+		{"POST", "/rooms/standup/refresh-token", nil, fiber.StatusForbidden},
+		{"POST", "/admin/rooms/r1/token?userId=u1", nil, fiber.StatusBadRequest},
+		{"POST", "/rooms/r1/ensure", nil, fiber.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		var resp map[string]interface{}
+		if status := call(t, app, tt.method, tt.target, tt.body, &resp); status != tt.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.target, status, tt.wantStatus)
+		}
+		if _, ok := resp["token"]; ok {
+			t.Errorf("%s %s: a token was issued", tt.method, tt.target)
+		}
+	}
+
+	var membership RoomMembershipResponse
+	if status := call(t, app, "GET", "/rooms/standup/membership", nil, &membership); status != fiber.StatusOK {
+		t.Fatalf("membership: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if membership.RoomJoinable || membership.IsActive {
+		t.Errorf("membership = %+v, want the room not joinable and u1 not in it", membership)
+	}
+
+	if len(lk.created) != 0 {
+		t.Errorf("created LiveKit rooms %v, want none", lk.created)
+	}
+	if writes := append(fake.Find("INSERT", ""), fake.Find("UPDATE", "")...); len(writes) != 0 {
+		t.Errorf("wrote %v, want nothing", writes)
+	}
+}
+
+func TestRefreshJoinToken(t *testing.T) {
+	tests := []struct {
+		name              string
+		roomActive        bool
+		participant       bool
+		participantActive bool
+		wantStatus        int
+	}{
+		{"active participant", true, true, true, fiber.StatusOK},
+		{"kicked participant", true, true, false, fiber.StatusForbidden},
+		{"never joined", true, false, false, fiber.StatusForbidden},
+		{"ended room", false, true, false, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				switch {
+				case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+					return &dbtest.Result{
+						Columns: []string{"id", "name", "is_active", "expires_at"},
+						Rows:    [][]interface{}{{"r1", "standup", tt.roomActive, time.Now().Add(time.Hour)}},
+					}, nil
+				case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+					result := &dbtest.Result{Columns: []string{"room_id", "user_id", "display_name", "is_active", "is_approved"}}
+					if tt.participant {
+						result.Rows = [][]interface{}{{"r1", "u1", "Ann (2)", tt.participantActive, true}}
+					}
+					return result, nil
+				case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`):
+					return &dbtest.Result{Columns: []string{"room_id", "user_id", "can_chat"}, Rows: [][]interface{}{{"r1", "u1", true}}}, nil
+				case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+					return &dbtest.Result{
+						Columns: []string{"id", "email", "name", "accesses", "is_active"},
+						Rows:    [][]interface{}{{"u1", "ann@example.com", "Ann", "{user}", true}},
+					}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+			h.identityStrategy = config.IdentityUserID
+
+			app := fiber.New()
+			app.Post("/rooms/:roomName/refresh-token", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.RefreshJoinToken)
+
+			var resp RoomResponse
+			if status := call(t, app, "POST", "/rooms/standup/refresh-token", nil, &resp); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantStatus != fiber.StatusOK {
+				if resp.Token != "" {
+					t.Error("a token was issued")
+				}
+				return
+			}
+
+			decoded, err := h.decodeToken(resp.Token)
+			if err != nil {
+				t.Fatalf("decodeToken() = %v", err)
+			}
+			if decoded.Identity != "u1" || decoded.Name != "Ann (2)" || decoded.Room != "standup" {
+				t.Errorf("token for %q named %q in %q, want u1 under the name they joined with in standup", decoded.Identity, decoded.Name, decoded.Room)
+			}
+			if !decoded.Grants.GetCanPublishData() {
+				t.Error("the token dropped the participant's chat permission")
+			}
+			if decoded.ExpiresAt == nil || !decoded.ExpiresAt.After(time.Now()) {
+				t.Errorf("token expires at %v, want a fresh expiry", decoded.ExpiresAt)
+			}
+			if joins := fake.Find("INSERT", `"room_participants"`); len(joins) != 0 {
+				t.Errorf("refreshing re-ran the join: %v", joins)
+			}
+		})
+	}
+}
+
+func TestGetMyParticipant(t *testing.T) {
+	mutedUntil := time.Now().Add(10 * time.Minute)
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return roomRow(), nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			result := &dbtest.Result{Columns: []string{"room_id", "user_id", "display_name", "is_active", "is_approved", "is_muted", "is_video_off", "chat_muted_until"}}
+			if stmt.Args[1] == "u1" {
+				result.Rows = [][]interface{}{{"r1", "u1", "Ann", true, true, true, false, mutedUntil}}
+			}
+			return result, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`):
+			result := &dbtest.Result{Columns: []string{"room_id", "user_id", "is_admin", "can_kick", "can_chat"}}
+			if stmt.Args[1] == "u1" {
+				result.Rows = [][]interface{}{{"r1", "u1", false, true, true}}
+			}
+			return result, nil
+		}
+		return &dbtest.Result{}, nil
+	})
+
+	t.Run("participant", func(t *testing.T) {
+		app := fiber.New()
+		app.Get("/rooms/:roomId/me", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.GetMyParticipant)
+
+		var resp MyParticipantResponse
+		if status := call(t, app, "GET", "/rooms/r1/me", nil, &resp); status != fiber.StatusOK {
+			t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+		}
+		if resp.UserID != "u1" || !resp.IsActive || !resp.IsApproved || !resp.IsMuted || resp.IsVideoOff {
+			t.Errorf("state = %+v, want u1 active, approved, muted and with video on", resp)
+		}
+		if !resp.IsChatBlocked || resp.ChatMutedUntil == nil || !resp.ChatMutedUntil.Equal(mutedUntil) {
+			t.Errorf("chat blocked %v until %v, want blocked until %v", resp.IsChatBlocked, resp.ChatMutedUntil, mutedUntil)
+		}
+		want := &PermissionsInfo{CanKick: true, CanChat: true}
+		if resp.Permissions == nil || *resp.Permissions != *want {
+			t.Errorf("permissions = %+v, want %+v", resp.Permissions, want)
+		}
+	})
+
+	t.Run("non-participant", func(t *testing.T) {
+		app := fiber.New()
+		app.Get("/rooms/:roomId/me", signedIn(&auth.Claims{UserID: "u2", Accesses: []string{"user"}}), h.GetMyParticipant)
+
+		if status := call(t, app, "GET", "/rooms/r1/me", nil, nil); status != fiber.StatusNotFound {
+			t.Errorf("status = %d, want %d", status, fiber.StatusNotFound)
+		}
+	})
+}
+
+func TestAdminBulkCreateRooms(t *testing.T) {
+	h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`) {
+			result := &dbtest.Result{Columns: []string{"id", "name", "is_active"}}
+			if hasArg(stmt.Args, "taken") {
+				result.Rows = [][]interface{}{{"r0", "taken", true}}
+			}
+			return result, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	lk := newFakeRoomService()
+	lk.createErr = map[string]error{"broken": errors.New("livekit unavailable")}
+	h.roomService = lk
+
+	app := fiber.New()
+	app.Post("/admin/rooms/bulk", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), h.AdminBulkCreateRooms)
+
+	req := BulkCreateRoomsRequest{Rooms: []CreateRoomRequest{
+		{Name: "alpha"},
+		{Name: "taken"},
+		{Name: "Alpha"},
+		{Name: "broken"},
+		{Name: "beta"},
+	}}
+	var resp BulkCreateRoomsResponse
+	if status := call(t, app, "POST", "/admin/rooms/bulk", req, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	if resp.Created != 2 || resp.Failed != 3 || len(resp.Results) != 5 {
+		t.Fatalf("created %d, failed %d, %d results, want 2, 3 and 5", resp.Created, resp.Failed, len(resp.Results))
+	}
+	wantErrors := []string{"", "room name is already taken", "duplicate room name in request", "failed to create room", ""}
+	for i, result := range resp.Results {
+		if result.Index != i || result.Error != wantErrors[i] {
+			t.Errorf("result %d = index %d, error %q, want error %q", i, result.Index, result.Error, wantErrors[i])
+		}
+		if created := result.Room != nil && result.Room.ID != ""; created != (wantErrors[i] == "") {
+			t.Errorf("result %d: room = %+v, want one only on success", i, result.Room)
+		}
+	}
+
+	if len(lk.rooms) != 2 || lk.rooms["alpha"] == nil || lk.rooms["beta"] == nil {
+		t.Errorf("LiveKit rooms = %v, want alpha and beta", lk.rooms)
+	}
+	rollbacks := 0
+	for _, event := range fake.Transactions() {
+		if event == dbtest.Rollback {
+			rollbacks++
+		}
+	}
+	if rollbacks != 1 {
+		t.Errorf("transactions = %v, want only the room LiveKit failed for rolled back", fake.Transactions())
+	}
+}
+
+func TestGetRoomSettingsMarksDefaults(t *testing.T) {
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "name", "is_active", "settings_allow_chat", "settings_allow_video", "settings_allow_audio", "settings_require_approval", "settings_kick_idle"},
+				Rows:    [][]interface{}{{"r1", "standup", true, false, true, true, false, false}},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			return &dbtest.Result{Columns: []string{"room_id", "user_id", "is_active"}, Rows: [][]interface{}{{"r1", "u1", true}}}, nil
+		}
+		return &dbtest.Result{}, nil
+	})
+	h.roomsConfig = &config.RoomsConfig{DefaultSettings: config.RoomSettingsConfig{AllowChat: true, AllowVideo: true, AllowAudio: true}}
+
+	app := fiber.New()
+	app.Get("/rooms/:roomId/settings", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.GetRoomSettings)
+
+	var resp RoomSettingsResponse
+	if status := call(t, app, "GET", "/rooms/r1/settings", nil, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	want := models.RoomSettings{AllowVideo: true, AllowAudio: true}
+	if resp.Settings != want {
+		t.Errorf("settings = %+v, want %+v", resp.Settings, want)
+	}
+	wantSources := map[string]string{
+		"allowChat":       settingSourceExplicit,
+		"allowVideo":      settingSourceDefault,
+		"allowAudio":      settingSourceDefault,
+		"requireApproval": settingSourceDefault,
+		"kickIdle":        settingSourceDefault,
+	}
+	for name, source := range wantSources {
+		if resp.Sources[name] != source {
+			t.Errorf("source of %s = %q, want %q", name, resp.Sources[name], source)
+		}
+	}
+	if len(resp.Sources) != len(wantSources) {
+		t.Errorf("sources = %v, want %v", resp.Sources, wantSources)
+	}
+}
+
+func TestResetParticipantState(t *testing.T) {
+	answer := func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return roomRow(), nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			return &dbtest.Result{Columns: []string{"room_id", "user_id", "is_active"}, Rows: [][]interface{}{{"r1", "u1", true}}}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_permissions"`):
+			return &dbtest.Result{Columns: []string{"room_id", "user_id", "can_chat"}, Rows: [][]interface{}{{"r1", "u1", true}}}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "name", "accesses", "is_active"},
+				Rows:    [][]interface{}{{"u1", "ann@example.com", "Ann", "{user}", true}},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	}
+
+	t.Run("moderator", func(t *testing.T) {
+		h, fake := newTestRoomHandler(t, answer)
+		h.identityStrategy = config.IdentityUserID
+		lk := newFakeRoomService("standup")
+		lk.participants = map[string][]*livekit.ParticipantInfo{"standup": {{
+			Identity:   "u1",
+			Permission: &livekit.ParticipantPermission{CanSubscribe: true, CanPublish: true},
+			Tracks: []*livekit.TrackInfo{
+				{Sid: "TR_audio", Type: livekit.TrackType_AUDIO, Muted: true},
+				{Sid: "TR_video", Type: livekit.TrackType_VIDEO},
+			},
+		}}}
+		h.roomService = lk
+
+		app := fiber.New()
+		app.Post("/rooms/:roomId/participants/:userId/reset-state", signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}}), h.ResetParticipantState)
+
+		if status := call(t, app, "POST", "/rooms/r1/participants/u1/reset-state", nil, nil); status != fiber.StatusOK {
+			t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+		}
+
+		updates := fake.Find("UPDATE", `"room_participants"`)
+		if len(updates) != 1 {
+			t.Fatalf("participant updates = %v, want one", updates)
+		}
+		for _, flag := range []string{"is_muted", "is_video_off", "is_chat_blocked"} {
+			if value, ok := updates[0].Value(flag); !ok || value != false {
+				t.Errorf("%s set to %v, want false", flag, value)
+			}
+		}
+
+		if len(lk.mutes) != 1 || lk.mutes[0].TrackSid != "TR_audio" || lk.mutes[0].Muted {
+			t.Errorf("LiveKit track mutes = %v, want TR_audio unmuted", lk.mutes)
+		}
+		if len(lk.updates) != 1 || !lk.updates[0].Permission.CanPublishData {
+			t.Errorf("LiveKit participant updates = %v, want chat allowed again", lk.updates)
+		}
+		if audits := fake.Find("INSERT", `"audit_logs"`); len(audits) != 1 || !hasArg(audits[0].Args, models.AuditRoomParticipantReset) {
+			t.Errorf("audit entries = %v, want the reset", audits)
+		}
+	})
+
+	t.Run("participant without admin rights", func(t *testing.T) {
+		h, fake := newTestRoomHandler(t, answer)
+		lk := newFakeRoomService("standup")
+		h.roomService = lk
+
+		app := fiber.New()
+		app.Post("/rooms/:roomId/participants/:userId/reset-state", signedIn(&auth.Claims{UserID: "u2", Accesses: []string{"user"}}), h.ResetParticipantState)
+
+		if status := call(t, app, "POST", "/rooms/r1/participants/u1/reset-state", nil, nil); status != fiber.StatusForbidden {
+			t.Errorf("status = %d, want %d", status, fiber.StatusForbidden)
+		}
+		if updates := fake.Find("UPDATE", ""); len(updates) != 0 || len(lk.mutes) != 0 {
+			t.Errorf("updated %v and unmuted %v, want nothing changed", updates, lk.mutes)
+		}
+	})
+}
+
+func TestRoomMetadata(t *testing.T) {
+	h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`) && hasArg(stmt.Args, "r1") {
+			return roomRow(), nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	lk := newFakeRoomService()
+	h.roomService = lk
+
+	admin := signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}})
+	app := fiber.New()
+	app.Post("/create-room", admin, h.CreateRoom)
+	app.Patch("/rooms/:roomId/metadata", admin, h.UpdateRoomMetadata)
+
+	t.Run("at creation", func(t *testing.T) {
+		req := CreateRoomRequest{Name: "standup", Metadata: map[string]string{"topic": "planning"}}
+		var resp RoomResponse
+		if status := call(t, app, "POST", "/create-room", req, &resp); status != fiber.StatusOK {
+			t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+		}
+		if resp.Metadata["topic"] != "planning" {
+			t.Errorf("metadata = %v, want the topic", resp.Metadata)
+		}
+		if len(lk.created) != 1 || lk.created[0].Metadata != `{"topic":"planning"}` {
+			t.Errorf("LiveKit create requests = %v, want the metadata passed on", lk.created)
+		}
+		inserts := fake.Find("INSERT", `"rooms"`)
+		if len(inserts) != 1 {
+			t.Fatalf("room inserts = %v, want one", inserts)
+		}
+		if stored, ok := inserts[0].Value("metadata"); !ok || !strings.Contains(fmt.Sprint(stored), "planning") {
+			t.Errorf("stored metadata = %v, want the topic", stored)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		body := UpdateRoomMetadataRequest{Metadata: map[string]string{"topic": "retro"}}
+		var resp RoomResponse
+		if status := call(t, app, "PATCH", "/rooms/r1/metadata", body, &resp); status != fiber.StatusOK {
+			t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+		}
+		if resp.Metadata["topic"] != "retro" {
+			t.Errorf("metadata = %v, want the new topic", resp.Metadata)
+		}
+		updates := fake.Find("UPDATE", `"rooms" SET "metadata"`)
+		if len(updates) != 1 {
+			t.Fatalf("room metadata updates = %v, want one", updates)
+		}
+		if stored, ok := updates[0].Value("metadata"); !ok || !strings.Contains(fmt.Sprint(stored), "retro") {
+			t.Errorf("stored metadata = %v, want the new topic", stored)
+		}
+		if len(lk.metadata) != 1 || lk.metadata[0].Room != "standup" || lk.metadata[0].Metadata != `{"topic":"retro"}` {
+			t.Errorf("LiveKit metadata updates = %v, want the new topic pushed to standup", lk.metadata)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		before := len(fake.Statements())
+		body := UpdateRoomMetadataRequest{Metadata: map[string]string{"notes": strings.Repeat("x", maxRoomMetadataBytes)}}
+		if status := call(t, app, "PATCH", "/rooms/r1/metadata", body, nil); status != fiber.StatusBadRequest {
+			t.Errorf("status = %d, want %d", status, fiber.StatusBadRequest)
+		}
+		if len(fake.Statements()) != before {
+			t.Error("oversized metadata reached the database")
+		}
+	})
+}
+
+func TestUpdateMyState(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name          string
+		adminMuted    bool
+		req           UpdateMyStateRequest
+		wantStatus    int
+		wantUpdates   map[string]interface{}
+		wantBroadcast bool
+	}{
+		{
+			name:          "raise hand and mute",
+			req:           UpdateMyStateRequest{IsMuted: &yes, HandRaised: &yes},
+			wantStatus:    fiber.StatusOK,
+			wantUpdates:   map[string]interface{}{"self_muted": true, "hand_raised": true},
+			wantBroadcast: true,
+		},
+		{
+			name:          "unmute",
+			req:           UpdateMyStateRequest{IsMuted: &no},
+			wantStatus:    fiber.StatusOK,
+			wantUpdates:   map[string]interface{}{"self_muted": false},
+			wantBroadcast: true,
+		},
+		{
+			name:        "heartbeat only",
+			req:         UpdateMyStateRequest{},
+			wantStatus:  fiber.StatusOK,
+			wantUpdates: map[string]interface{}{},
+		},
+		{
+			name:       "unmute while muted by an admin",
+			adminMuted: true,
+			req:        UpdateMyStateRequest{IsMuted: &no},
+			wantStatus: fiber.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				switch {
+				case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+					return roomRow(), nil
+				case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+					return &dbtest.Result{
+						Columns: []string{"room_id", "user_id", "is_active", "is_muted"},
+						Rows:    [][]interface{}{{"r1", "u1", true, tt.adminMuted}},
+					}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+			lk := newFakeRoomService("standup")
+			h.roomService = lk
+			client, err := h.hub.Subscribe()
+			if err != nil {
+				t.Fatalf("Subscribe() = %v", err)
+			}
+
+			app := fiber.New()
+			app.Patch("/rooms/:roomId/me/state", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.UpdateMyState)
+
+			if status := call(t, app, "PATCH", "/rooms/r1/me/state", tt.req, nil); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+
+			updates := fake.Find("UPDATE", `"room_participants"`)
+			if tt.wantUpdates == nil {
+				if len(updates) != 0 {
+					t.Errorf("a refused change wrote %v", updates)
+				}
+			} else if len(updates) != 1 {
+				t.Fatalf("%d participant updates, want 1", len(updates))
+			} else {
+				for column, want := range tt.wantUpdates {
+					if got, ok := updates[0].Value(column); !ok || got != want {
+						t.Errorf("%s = %v (set %v), want %v", column, got, ok, want)
+					}
+				}
+				if _, ok := updates[0].Value("last_active_at"); !ok {
+					t.Error("last_active_at not refreshed")
+				}
+			}
+
+			select {
+			case event := <-client.Events():
+				if !tt.wantBroadcast {
+					t.Fatalf("unexpected %s event", event.Type)
+				}
+				data := event.Data.(fiber.Map)
+				if event.Type != realtime.EventParticipantState || data["userId"] != "u1" || data["roomId"] != "r1" {
+					t.Errorf("event = %+v, want the state of u1 in r1", event)
+				}
+				if want := tt.req.HandRaised != nil && *tt.req.HandRaised; data["handRaised"] != want {
+					t.Errorf("handRaised = %v, want %v", data["handRaised"], want)
+				}
+			default:
+				if tt.wantBroadcast {
+					t.Error("no participant state event published")
+				}
+			}
+
+			if !tt.wantBroadcast {
+				if len(lk.sent) != 0 {
+					t.Errorf("sent %d room data messages, want none", len(lk.sent))
+				}
+				return
+			}
+			if len(lk.sent) != 1 {
+				t.Fatalf("sent %d room data messages, want 1", len(lk.sent))
+			}
+			sent := lk.sent[0]
+			if sent.Room != "standup" || sent.GetTopic() != realtime.EventParticipantState || sent.Kind != livekit.DataPacket_RELIABLE {
+				t.Errorf("room data = %s on %q (%v), want standup on %q, reliable", sent.Room, sent.GetTopic(), sent.Kind, realtime.EventParticipantState)
+			}
+			var payload map[string]interface{}
+			if err := json.Unmarshal(sent.Data, &payload); err != nil || payload["userId"] != "u1" {
+				t.Errorf("room data payload = %s (%v), want the state of u1", sent.Data, err)
+			}
+		})
+	}
+}
+
+// expiringRooms plays rooms that are all past their expiry, in expiry order,
+// until EndRoom closes them
+type expiringRooms struct {
+	mu      sync.Mutex
+	ids     []string
+	active  map[string]bool
+	batches int
+}
+
+func newExpiringRooms(n int) *expiringRooms {
+	e := &expiringRooms{active: map[string]bool{}}
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("r%d", i)
+		e.ids = append(e.ids, id)
+		e.active[id] = true
+	}
+	return e
+}
+
+func (e *expiringRooms) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`) && stmt.Mentions("expires_at <"):
+		e.batches++
+		limit := stmt.Args[len(stmt.Args)-1].(int)
+		result := &dbtest.Result{Columns: []string{"id", "name", "is_active"}}
+		for _, id := range e.ids {
+			if e.active[id] && len(result.Rows) < limit {
+				result.Rows = append(result.Rows, []interface{}{id, "room-" + id, true})
+			}
+		}
+		return result, nil
+	case stmt.Is("UPDATE") && stmt.Mentions(`"rooms"`):
+		if active, ok := stmt.Value("is_active"); ok && active == false {
+			e.active[stmt.Args[len(stmt.Args)-1].(string)] = false
+		}
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func (e *expiringRooms) stillActive() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	n := 0
+	for _, active := range e.active {
+		if active {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSweepExpiredRooms(t *testing.T) {
+	tests := []struct {
+		rooms       int
+		batchSize   int
+		wantBatches int
+	}{
+		{7, 3, 3},
+		{6, 3, 3},
+		{2, 100, 1},
+		{0, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d rooms in batches of %d", tt.rooms, tt.batchSize), func(t *testing.T) {
+			rooms := newExpiringRooms(tt.rooms)
+			h, _ := newTestRoomHandler(t, rooms.answer)
+			lk := h.roomService.(*fakeRoomService)
+			client, err := h.hub.Subscribe()
+			if err != nil {
+				t.Fatalf("Subscribe() = %v", err)
+			}
+
+			ended, err := h.SweepExpiredRooms(context.Background(), tt.batchSize)
+			if err != nil {
+				t.Fatalf("SweepExpiredRooms() = %v", err)
+			}
+			if ended != tt.rooms || rooms.stillActive() != 0 {
+				t.Errorf("ended %d rooms leaving %d active, want %d ended and none left", ended, rooms.stillActive(), tt.rooms)
+			}
+			if rooms.batches != tt.wantBatches {
+				t.Errorf("fetched %d batches, want %d", rooms.batches, tt.wantBatches)
+			}
+			if len(lk.deleted) != tt.rooms {
+				t.Errorf("deleted %d LiveKit rooms, want %d", len(lk.deleted), tt.rooms)
+			}
+			if len(client.Events()) != tt.rooms {
+				t.Errorf("published %d room.ended events, want %d", len(client.Events()), tt.rooms)
+			}
+		})
+	}
+}
+
+func TestSweepExpiredRoomsStopsAtALiveKitFailure(t *testing.T) {
+	rooms := newExpiringRooms(5)
+	h, _ := newTestRoomHandler(t, rooms.answer)
+	lk := h.roomService.(*fakeRoomService)
+	lk.deleteErr = map[string]error{
+		"room-r2": twirp.NotFoundError("room not found"),
+		"room-r4": errors.New("connection refused"),
+	}
+
+	ended, err := h.SweepExpiredRooms(context.Background(), 2)
+	if err == nil {
+		t.Fatal("SweepExpiredRooms() = nil, want the LiveKit error")
+	}
+	if ended != 3 || rooms.stillActive() != 2 {
+		t.Errorf("ended %d rooms leaving %d active, want 3 ended and r4 and r5 left", ended, rooms.stillActive())
+	}
+	if !rooms.active["r4"] || !rooms.active["r5"] {
+		t.Errorf("active rooms = %v, want r4 and r5 left for the next run", rooms.active)
+	}
+}
+
+func TestRoomsAreScopedToTheirTenant(t *testing.T) {
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "name", "is_active", "tenant_id"},
+				Rows:    [][]interface{}{{"r1", "standup", true, "acme"}},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			return &dbtest.Result{
+				Columns: []string{"room_id", "user_id", "is_active", "is_approved"},
+				Rows:    [][]interface{}{{"r1", stmt.Args[1], true, true}},
+			}, nil
+		}
+		return &dbtest.Result{}, nil
+	})
+
+	tests := []struct {
+		name       string
+		claims     *auth.Claims
+		wantStatus int
+	}{
+		{"same tenant", &auth.Claims{UserID: "u1", TenantID: "acme", Accesses: []string{"user"}}, fiber.StatusOK},
+		{"other tenant", &auth.Claims{UserID: "u2", TenantID: "globex", Accesses: []string{"user"}}, fiber.StatusNotFound},
+		{"other tenant's superadmin", &auth.Claims{UserID: "u3", TenantID: "globex", Accesses: []string{"superadmin"}}, fiber.StatusNotFound},
+		{"no tenant", &auth.Claims{UserID: "u4", Accesses: []string{"user"}}, fiber.StatusNotFound},
+		{"deployment superadmin", &auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}, fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/rooms/:roomId/me", signedIn(tt.claims), h.GetMyParticipant)
+
+			if status := call(t, app, "GET", "/rooms/r1/me", nil, nil); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestEnsureRoom(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	answer := func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`) {
+			return &dbtest.Result{
+				Columns: []string{"id", "name", "is_active", "max_participants", "expires_at"},
+				Rows:    [][]interface{}{{"r1", "standup", true, int64(20), expiresAt}},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	}
+
+	tests := []struct {
+		name        string
+		livekit     []string
+		wantCreated bool
+	}{
+		{"missing room", nil, true},
+		{"existing room", []string{"standup"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, fake := newTestRoomHandler(t, answer)
+			lk := newFakeRoomService(tt.livekit...)
+			h.roomService = lk
+
+			app := fiber.New()
+			app.Post("/rooms/:roomId/ensure", signedIn(&auth.Claims{UserID: "mod", Accesses: []string{"moderator"}}), h.EnsureRoom)
+
+			var resp EnsureRoomResponse
+			if status := call(t, app, "POST", "/rooms/r1/ensure", nil, &resp); status != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+			}
+			if resp.Created != tt.wantCreated || resp.ID != "r1" || !resp.IsActive {
+				t.Errorf("response = %+v, want active room r1 with created %v", resp, tt.wantCreated)
+			}
+			if !resp.ExpiresAt.After(expiresAt) {
+				t.Errorf("expires at %v, want extended past %v", resp.ExpiresAt, expiresAt)
+			}
+
+			wantCreates := 0
+			if tt.wantCreated {
+				wantCreates = 1
+			}
+			if len(lk.created) != wantCreates {
+				t.Errorf("%d LiveKit create requests, want %d", len(lk.created), wantCreates)
+			}
+			if _, ok := lk.rooms["standup"]; !ok {
+				t.Error("the LiveKit room doesn't exist afterwards")
+			}
+			if extended := fake.Find("UPDATE", `"expires_at"`); len(extended) != 1 {
+				t.Errorf("expiry updates = %v, want one", extended)
+			}
+			if joins := fake.Find("INSERT", `"room_participants"`); len(joins) != 0 {
+				t.Errorf("ensuring the room added participants: %v", joins)
+			}
+		})
+	}
+
+	t.Run("not a room admin", func(t *testing.T) {
+		h, _ := newTestRoomHandler(t, answer)
+		lk := newFakeRoomService()
+		h.roomService = lk
+
+		app := fiber.New()
+		app.Post("/rooms/:roomId/ensure", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.EnsureRoom)
+
+		if status := call(t, app, "POST", "/rooms/r1/ensure", nil, nil); status != fiber.StatusForbidden {
+			t.Errorf("status = %d, want %d", status, fiber.StatusForbidden)
+		}
+		if len(lk.created) != 0 {
+			t.Errorf("%d LiveKit create requests, want none", len(lk.created))
+		}
+	})
+}
+
+// storedRoomValue returns the value last written to a rooms column
+func storedRoomValue(fake *dbtest.DB, column string) interface{} {
+	var value interface{}
+	for _, stmt := range fake.Statements() {
+		if !stmt.Mentions(`"rooms"`) {
+			continue
+		}
+		if v, ok := stmt.Value(column); ok && (stmt.Is("INSERT") || stmt.Is("UPDATE")) {
+			value = v
+		}
+	}
+	return value
+}
+
+func TestCreateRoomJoinerPermissions(t *testing.T) {
+	no := false
+	tests := []struct {
+		name   string
+		custom *models.JoinerPermissionsInput
+		want   map[string]interface{}
+	}{
+		{"server defaults", nil, map[string]interface{}{"joiner_can_kick": false, "joiner_can_mute_audio": true, "joiner_can_chat": true}},
+		{"room override", &models.JoinerPermissionsInput{CanChat: &no}, map[string]interface{}{"joiner_can_kick": false, "joiner_can_mute_audio": true, "joiner_can_chat": false}},
+	}
+
+	for _, tt := range tests {
+		h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			if stmt.Is("SELECT") {
+				return &dbtest.Result{Columns: []string{"id"}}, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+		h.roomsConfig.JoinerPermissions = config.JoinerPermissionsConfig{CanMuteAudio: true, CanChat: true}
+		h.roomsConfig.DefaultMaxParticipants = 20
+
+		app := fiber.New()
+		app.Post("/room/create", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.CreateRoom)
+
+		req := CreateRoomRequest{Name: "standup", JoinerPermissions: tt.custom}
+		if status := call(t, app, "POST", "/room/create", req, nil); status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, fiber.StatusOK)
+		}
+
+		inserts := fake.Find("INSERT", `"rooms"`)
+		if len(inserts) != 1 {
+			t.Fatalf("%s: %d rooms created, want 1", tt.name, len(inserts))
+		}
+		for column, value := range tt.want {
+			if got := storedRoomValue(fake, column); got != value {
+				t.Errorf("%s: %s = %v, want %v", tt.name, column, got, value)
+			}
+		}
+		if got, _ := inserts[0].Value("max_participants"); got != 20 {
+			t.Errorf("%s: max_participants = %v, want 20", tt.name, got)
+		}
+	}
+}
+
+func TestCreateRoomStoresExplicitFalseSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]interface{}
+	}{
+		{"omitted settings", `{"name": "standup"}`,
+			map[string]interface{}{"settings_allow_chat": true, "settings_allow_video": true, "settings_allow_audio": true, "settings_require_approval": false}},
+		{"empty settings", `{"name": "standup", "settings": {}}`,
+			map[string]interface{}{"settings_allow_chat": true, "settings_allow_video": true, "settings_allow_audio": true, "settings_require_approval": false}},
+		{"explicit false", `{"name": "standup", "settings": {"allowChat": false, "allowVideo": false}}`,
+			map[string]interface{}{"settings_allow_chat": false, "settings_allow_video": false, "settings_allow_audio": true, "settings_require_approval": false}},
+		{"explicit true", `{"name": "standup", "settings": {"requireApproval": true}}`,
+			map[string]interface{}{"settings_allow_chat": true, "settings_allow_video": true, "settings_allow_audio": true, "settings_require_approval": true}},
+	}
+
+	for _, tt := range tests {
+		h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			if stmt.Is("SELECT") {
+				return &dbtest.Result{Columns: []string{"id"}}, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+		h.roomsConfig.DefaultSettings = config.RoomSettingsConfig{AllowChat: true, AllowVideo: true, AllowAudio: true}
+
+		app := fiber.New()
+		app.Post("/room/create", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.CreateRoom)
+
+		if status := call(t, app, "POST", "/room/create", json.RawMessage(tt.body), nil); status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, fiber.StatusOK)
+		}
+		for column, value := range tt.want {
+			if got := storedRoomValue(fake, column); got != value {
+				t.Errorf("%s: %s = %v, want %v", tt.name, column, got, value)
+			}
+		}
+	}
+}
+
+func TestCreateRoomRegion(t *testing.T) {
+	tests := []struct {
+		name       string
+		region     string
+		wantStatus int
+		wantNode   string
+	}{
+		{"no region", "", fiber.StatusOK, ""},
+		{"pinned region", "eu-west", fiber.StatusOK, "node-eu-1"},
+		{"region without a node", "us-east", fiber.StatusOK, ""},
+		{"unknown region", "mars", fiber.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			if stmt.Is("SELECT") {
+				return &dbtest.Result{Columns: []string{"id"}}, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+		h.livekitConfig.Regions = map[string]string{"eu-west": "node-eu-1", "us-east": ""}
+		lk := newFakeRoomService()
+		h.roomService = lk
+
+		app := fiber.New()
+		app.Post("/room/create", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.CreateRoom)
+
+		var resp RoomResponse
+		req := CreateRoomRequest{Name: "standup", Region: tt.region}
+		if status := call(t, app, "POST", "/room/create", req, &resp); status != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+
+		if tt.wantStatus != fiber.StatusOK {
+			if len(lk.created) != 0 || len(fake.Find("INSERT", `"rooms"`)) != 0 {
+				t.Errorf("%s: the room was created in LiveKit (%d) or the database", tt.name, len(lk.created))
+			}
+			continue
+		}
+		if len(lk.created) != 1 || lk.created[0].NodeId != tt.wantNode {
+			t.Errorf("%s: LiveKit rooms created %v, want one on node %q", tt.name, lk.created, tt.wantNode)
+		}
+		if got := storedRoomValue(fake, "region"); got != tt.region {
+			t.Errorf("%s: stored region = %v, want %q", tt.name, got, tt.region)
+		}
+		if resp.Region != tt.region {
+			t.Errorf("%s: response region = %q, want %q", tt.name, resp.Region, tt.region)
+		}
+	}
+}
+
+func TestCreateRoomLosingTheNameRaceIsConflict(t *testing.T) {
+	// The name check finds nothing, but another request inserts the name first
+	h, _ := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT"):
+			return &dbtest.Result{Columns: []string{"id"}}, nil
+		case stmt.Is("INSERT") && stmt.Mentions(`"rooms"`):
+			return nil, &pgconn.PgError{Code: "23505", ConstraintName: "idx_rooms_name"}
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	app := fiber.New()
+	app.Post("/room/create", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.CreateRoom)
+
+	if status := call(t, app, "POST", "/room/create", CreateRoomRequest{Name: "standup"}, nil); status != fiber.StatusConflict {
+		t.Errorf("status = %d, want %d", status, fiber.StatusConflict)
+	}
+}
+
+func TestJoinRoomDisplayNames(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantStatus int
+		wantName   string
+	}{
+		{config.DisplayNamesOff, fiber.StatusOK, "Ann"},
+		{config.DisplayNamesReject, fiber.StatusConflict, ""},
+		{config.DisplayNamesSuffix, fiber.StatusOK, "Ann (3)"},
+	}
+
+	for _, tt := range tests {
+		room := &fakeRoom{isActive: true, expiresAt: time.Now().Add(time.Hour)}
+		h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			if stmt.Is("SELECT") && stmt.Mentions("display_name") {
+				return &dbtest.Result{Columns: []string{"display_name"}, Rows: [][]interface{}{{"ann"}, {"Ann (2)"}}}, nil
+			}
+			return room.answer(stmt)
+		})
+		h.roomsConfig.UniqueDisplayNames = tt.mode
+
+		app := fiber.New()
+		app.Post("/rooms/join", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.JoinRoom)
+
+		if status := call(t, app, "POST", "/rooms/join", JoinRoomRequest{RoomName: "standup"}, nil); status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.mode, status, tt.wantStatus)
+		}
+
+		joins := fake.Find("INSERT", `"room_participants"`)
+		if tt.wantName == "" {
+			if len(joins) != 0 {
+				t.Errorf("%s: participant stored despite the name clash", tt.mode)
+			}
+			continue
+		}
+		if len(joins) != 1 {
+			t.Fatalf("%s: %d participant inserts, want 1", tt.mode, len(joins))
+		}
+		if got, _ := joins[0].Value("display_name"); got != tt.wantName {
+			t.Errorf("%s: display_name = %v, want %q", tt.mode, got, tt.wantName)
+		}
+	}
+}
+
+func TestAdminGenerateToken(t *testing.T) {
+	configtest.Load(t, nil)
+	h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "name", "is_active", "expires_at"},
+				Rows:    [][]interface{}{{"r1", "standup", true, time.Now().Add(time.Hour)}},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "room_id", "user_id", "is_active"},
+				Rows:    [][]interface{}{{"p3", "r1", "u3", true}},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+			users := &dbtest.Result{Columns: []string{"id", "email", "name", "accesses", "is_active"}}
+			if hasArg(stmt.Args, "u2") {
+				users.Rows = append(users.Rows, []interface{}{"u2", "bob@example.com", "Bob", "{user}", true})
+			}
+			if hasArg(stmt.Args, "u3") {
+				users.Rows = append(users.Rows, []interface{}{"u3", "cy@example.com", "Cy", "{user}", true})
+			}
+			return users, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	h.identityStrategy = config.IdentityUserID
+	h.roomsConfig.UniqueDisplayNames = config.DisplayNamesOff
+
+	app := fiber.New()
+	app.Post("/admin/rooms/:roomId/token", signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}), h.AdminGenerateToken)
+
+	yes, no := true, false
+	tests := []struct {
+		name         string
+		body         interface{}
+		wantStatus   int
+		wantIdentity string
+		wantName     string
+		wantTTL      time.Duration
+		wantGrant    func(*lkauth.VideoGrant) bool
+	}{
+		{
+			name:         "defaults",
+			wantStatus:   fiber.StatusOK,
+			wantIdentity: "u2",
+			wantName:     "Bob",
+			wantTTL:      24 * time.Hour,
+			wantGrant: func(g *lkauth.VideoGrant) bool {
+				return g.RoomJoin && g.Room == "standup" && g.CanPublish == nil && g.CanSubscribe == nil && !g.Recorder
+			},
+		},
+		{
+			name:         "viewer only",
+			body:         AdminTokenRequest{CanPublish: &no, CanPublishData: &no, CanSubscribe: &yes, TTLSeconds: 600, Identity: "viewer-1", Name: "Viewer"},
+			wantStatus:   fiber.StatusOK,
+			wantIdentity: "viewer-1",
+			wantName:     "Viewer",
+			wantTTL:      10 * time.Minute,
+			wantGrant: func(g *lkauth.VideoGrant) bool {
+				return !g.GetCanPublish() && !g.GetCanPublishData() && g.GetCanSubscribe()
+			},
+		},
+		{
+			name:         "recorder",
+			body:         AdminTokenRequest{CanPublish: &no, Hidden: true, Recorder: true, Identity: "recorder"},
+			wantStatus:   fiber.StatusOK,
+			wantIdentity: "recorder",
+			wantName:     "Bob",
+			wantTTL:      24 * time.Hour,
+			wantGrant: func(g *lkauth.VideoGrant) bool {
+				return g.Hidden && g.Recorder && !g.GetCanPublish()
+			},
+		},
+		{name: "lifetime too short", body: AdminTokenRequest{TTLSeconds: 30}, wantStatus: fiber.StatusBadRequest},
+		{name: "lifetime too long", body: AdminTokenRequest{TTLSeconds: 86401}, wantStatus: fiber.StatusBadRequest},
+		{name: "identity too long", body: AdminTokenRequest{Identity: strings.Repeat("x", maxIdentityLength+1)}, wantStatus: fiber.StatusBadRequest},
+		{name: "identity of another participant", body: AdminTokenRequest{Identity: "u3"}, wantStatus: fiber.StatusConflict},
+		{
+			name:         "identity taken over",
+			body:         AdminTokenRequest{Identity: "u3", ReplaceIdentity: true},
+			wantStatus:   fiber.StatusOK,
+			wantIdentity: "u3",
+			wantName:     "Bob",
+			wantTTL:      24 * time.Hour,
+			wantGrant:    func(g *lkauth.VideoGrant) bool { return g.RoomJoin },
+		},
+	}
+
+	for _, tt := range tests {
+		audits := len(fake.Find("INSERT", `"audit_logs"`))
+
+		var resp AdminTokenResponse
+		var out interface{}
+		if tt.wantStatus == fiber.StatusOK {
+			out = &resp
+		}
+		if status := call(t, app, "POST", "/admin/rooms/r1/token?userId=u2", tt.body, out); status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != fiber.StatusOK {
+			continue
+		}
+
+		decoded, err := h.decodeToken(resp.Token)
+		if err != nil {
+			t.Fatalf("%s: decodeToken() = %v", tt.name, err)
+		}
+		if decoded.Identity != tt.wantIdentity || resp.Identity != tt.wantIdentity || decoded.Name != tt.wantName {
+			t.Errorf("%s: identity %q (response %q), name %q, want %q and %q", tt.name, decoded.Identity, resp.Identity, decoded.Name, tt.wantIdentity, tt.wantName)
+		}
+		if decoded.ExpiresAt == nil || time.Until(*decoded.ExpiresAt) > tt.wantTTL || time.Until(*decoded.ExpiresAt) < tt.wantTTL-time.Minute {
+			t.Errorf("%s: expires at %v, want in %v", tt.name, decoded.ExpiresAt, tt.wantTTL)
+		}
+		if decoded.Grants == nil || !tt.wantGrant(decoded.Grants) {
+			t.Errorf("%s: grant = %+v", tt.name, decoded.Grants)
+		}
+		if len(fake.Find("INSERT", `"audit_logs"`)) != audits+1 {
+			t.Errorf("%s: token issued without an audit entry", tt.name)
+		}
+	}
+}
+
+func TestGetMembership(t *testing.T) {
+	tests := []struct {
+		name        string
+		participant []interface{} // is_active, is_approved; nil if u1 never joined
+		expiresAt   time.Time
+		want        RoomMembershipResponse
+	}{
+		{"active", []interface{}{true, true}, time.Now().Add(time.Hour), RoomMembershipResponse{IsParticipant: true, IsActive: true, IsApproved: true, RoomJoinable: true}},
+		{"left", []interface{}{false, true}, time.Now().Add(time.Hour), RoomMembershipResponse{IsParticipant: true, IsApproved: true, RoomJoinable: true}},
+		{"never joined", nil, time.Now().Add(time.Hour), RoomMembershipResponse{RoomJoinable: true}},
+		{"room expired", []interface{}{true, true}, time.Now().Add(-time.Minute), RoomMembershipResponse{IsParticipant: true, IsApproved: true}},
+	}
+
+	for _, tt := range tests {
+		h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			switch {
+			case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+				return &dbtest.Result{
+					Columns: []string{"id", "name", "is_active", "expires_at"},
+					Rows:    [][]interface{}{{"r1", "standup", true, tt.expiresAt}},
+				}, nil
+			case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+				result := &dbtest.Result{Columns: []string{"is_active", "is_approved"}}
+				if tt.participant != nil {
+					result.Rows = [][]interface{}{tt.participant}
+				}
+				return result, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+
+		app := fiber.New()
+		app.Get("/rooms/:roomName/membership", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.GetMembership)
+
+		var resp RoomMembershipResponse
+		if status := call(t, app, "GET", "/rooms/standup/membership", nil, &resp); status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, fiber.StatusOK)
+		}
+		if resp != tt.want {
+			t.Errorf("%s: membership = %+v, want %+v", tt.name, resp, tt.want)
+		}
+		if lookups := fake.Find("SELECT", `FROM "room_participants"`); len(lookups) != 1 || !hasArg(lookups[0].Args, "u1") {
+			t.Errorf("%s: participant lookups = %v, want one for u1", tt.name, lookups)
+		}
+	}
+}
+
+func TestAdminRoomStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+	}{
+		{"superadmin", &auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}},
+		{"tenant admin", &auth.Claims{UserID: "admin", TenantID: "t1", Accesses: []string{"superadmin"}}},
+	}
+
+	for _, tt := range tests {
+		h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			return &dbtest.Result{
+				Columns: []string{"total", "active", "expired", "inactive", "deactivated"},
+				Rows:    [][]interface{}{{int64(7), int64(3), int64(1), int64(3), int64(2)}},
+			}, nil
+		})
+		app := fiber.New()
+		app.Get("/admin/rooms/stats", signedIn(tt.claims), h.AdminRoomStats)
+
+		var resp RoomStatsResponse
+		if status := call(t, app, "GET", "/admin/rooms/stats", nil, &resp); status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, fiber.StatusOK)
+		}
+		want := RoomStatsResponse{Total: 7, Active: 3, Expired: 1, Inactive: 3, Deactivated: 2}
+		if resp != want {
+			t.Errorf("%s: response = %+v, want %+v", tt.name, resp, want)
+		}
+
+		queries := fake.Find("SELECT", `"rooms"`)
+		if len(queries) != 1 {
+			t.Fatalf("%s: %d room queries, want 1", tt.name, len(queries))
+		}
+		if scoped := hasArg(queries[0].Args, "t1"); scoped != (tt.claims.TenantID != "") {
+			t.Errorf("%s: query scoped to the tenant = %v, want %v", tt.name, scoped, !scoped)
+		}
+	}
+}
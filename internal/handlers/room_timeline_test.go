@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// timelineRow is a row of the timeline query's union
+type timelineRow struct {
+	typ, actorID, userID, details, key string
+	at                                 time.Time
+}
+
+// timelineDB answers the timeline query over rows the way Postgres would:
+// filtered by the window and cursor, ordered by time and key, and limited
+func timelineDB(rows []timelineRow) dbtest.Answer {
+	bound := func(stmt dbtest.Statement, pattern string) (interface{}, bool) {
+		match := regexp.MustCompile(pattern).FindStringSubmatch(stmt.Query)
+		if match == nil {
+			return nil, false
+		}
+		n, _ := strconv.Atoi(match[1])
+		return stmt.Args[n-1], true
+	}
+
+	return func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`) {
+			return roomRow(), nil
+		}
+		if !stmt.Mentions(") timeline") {
+			return nil, nil
+		}
+
+		var page []timelineRow
+		for _, row := range rows {
+			if from, ok := bound(stmt, `occurred_at >= \$(\d+)`); ok && row.at.Before(from.(time.Time)) {
+				continue
+			}
+			if to, ok := bound(stmt, `occurred_at <= \$(\d+)`); ok && row.at.After(to.(time.Time)) {
+				continue
+			}
+			if at, ok := bound(stmt, `\(occurred_at, sort_key\) > \(\$(\d+)`); ok {
+				key, _ := bound(stmt, `\(occurred_at, sort_key\) > \(\$\d+, \$(\d+)\)`)
+				if row.at.Before(at.(time.Time)) || row.at.Equal(at.(time.Time)) && row.key <= key.(string) {
+					continue
+				}
+			}
+			page = append(page, row)
+		}
+		sort.Slice(page, func(i, j int) bool {
+			if !page[i].at.Equal(page[j].at) {
+				return page[i].at.Before(page[j].at)
+			}
+			return page[i].key < page[j].key
+		})
+		if limit, ok := bound(stmt, `LIMIT \$(\d+)`); ok && len(page) > limit.(int) {
+			page = page[:limit.(int)]
+		}
+
+		result := &dbtest.Result{Columns: []string{"type", "occurred_at", "actor_id", "user_id", "details", "sort_key"}}
+		for _, row := range page {
+			result.Rows = append(result.Rows, []interface{}{row.typ, row.at, row.actorID, row.userID, row.details, row.key})
+		}
+		return result, nil
+	}
+}
+
+func TestAdminRoomTimeline(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	// Rows from every source, out of order and with some sharing an instant
+	h, _ := newTestRoomHandler(t, timelineDB([]timelineRow{
+		{typ: models.AuditRoomMetadataUpdated, actorID: "mod", details: `{"metadata":{"topic":"retro"}}`, key: "3:a1", at: at(20)},
+		{typ: TimelineParticipantLeft, userID: "u1", key: "2:s1", at: at(30)},
+		{typ: TimelineParticipantJoined, userID: "u1", key: "1:s1", at: at(5)},
+		{typ: TimelineParticipantJoined, userID: "u2", key: "1:s2", at: at(0)},
+		{typ: TimelineRoomCreated, actorID: "mod", key: "0:r1", at: at(0)},
+		{typ: models.AuditRoomChatMuted, actorID: "mod", details: `{"userId":"u2"}`, key: "3:a2", at: at(30)},
+		{typ: models.AuditRoomEnded, actorID: "mod", key: "3:a3", at: at(45)},
+	}))
+
+	app := fiber.New()
+	app.Get("/admin/rooms/:roomId/timeline", signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}), h.AdminRoomTimeline)
+
+	type event struct{ typ, userID string }
+	want := []event{
+		{TimelineRoomCreated, ""},
+		{TimelineParticipantJoined, "u2"},
+		{TimelineParticipantJoined, "u1"},
+		{models.AuditRoomMetadataUpdated, ""},
+		{TimelineParticipantLeft, "u1"},
+		{models.AuditRoomChatMuted, "u2"},
+		{models.AuditRoomEnded, ""},
+	}
+
+	t.Run("all pages", func(t *testing.T) {
+		var got []event
+		var last time.Time
+		cursor := ""
+		for pages := 1; ; pages++ {
+			if pages > len(want) {
+				t.Fatal("pagination didn't end")
+			}
+			var resp RoomTimelineResponse
+			target := "/admin/rooms/r1/timeline?limit=3&cursor=" + url.QueryEscape(cursor)
+			if status := call(t, app, "GET", target, nil, &resp); status != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+			}
+			for _, e := range resp.Events {
+				if e.At.Before(last) {
+					t.Errorf("%s at %v comes after an event at %v", e.Type, e.At, last)
+				}
+				last = e.At
+				got = append(got, event{e.Type, e.UserID})
+			}
+			if cursor = resp.NextCursor; cursor == "" {
+				break
+			}
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("event %d = %v, want %v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("time window", func(t *testing.T) {
+		var resp RoomTimelineResponse
+		target := "/admin/rooms/r1/timeline?from=" + url.QueryEscape(at(5).Format(time.RFC3339)) + "&to=" + url.QueryEscape(at(30).Format(time.RFC3339))
+		if status := call(t, app, "GET", target, nil, &resp); status != fiber.StatusOK {
+			t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+		}
+		if len(resp.Events) != 4 || resp.Events[0].Type != TimelineParticipantJoined || resp.Events[3].Type != models.AuditRoomChatMuted {
+			t.Errorf("events = %+v, want the four from u1 joining to u2 being muted", resp.Events)
+		}
+	})
+
+	t.Run("bad window", func(t *testing.T) {
+		if status := call(t, app, "GET", "/admin/rooms/r1/timeline?from=yesterday", nil, nil); status != fiber.StatusBadRequest {
+			t.Errorf("status = %d, want %d", status, fiber.StatusBadRequest)
+		}
+	})
+}
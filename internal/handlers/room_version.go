@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/repository"
+	"fmt"
+	"time"
+)
+
+// Create-room body versions, chosen with the apiVersion field. A body without
+// one is read as v1, so clients written before versioning keep working.
+//
+//	v1: name, maxParticipants, settings, metadata, joinerPermissions, region
+//	v2: everything in v1, plus expiresIn, the room's lifetime in seconds
+//	    (default and maximum: repository.RoomLifetime)
+//
+// Fields a version doesn't know are ignored and take their default, so a v1
+// body carrying expiresIn still gets the standard lifetime.
+const (
+	CreateRoomV1 = "v1"
+	CreateRoomV2 = "v2"
+)
+
+// minRoomLifetime is the shortest lifetime a v2 body may ask for
+const minRoomLifetime = time.Minute
+
+// applyVersion reads req under its apiVersion, dropping fields the version
+// doesn't know, and returns the lifetime the room should be created with
+func (req *CreateRoomRequest) applyVersion() (time.Duration, error) {
+	switch req.APIVersion {
+	case "", CreateRoomV1:
+		req.APIVersion = CreateRoomV1
+		req.ExpiresIn = 0
+		return repository.RoomLifetime, nil
+
+	case CreateRoomV2:
+		if req.ExpiresIn == 0 {
+			return repository.RoomLifetime, nil
+		}
+		lifetime := time.Duration(req.ExpiresIn) * time.Second
+		if req.ExpiresIn < 0 || lifetime < minRoomLifetime || lifetime > repository.RoomLifetime {
+			return 0, fmt.Errorf("expiresIn must be between %d and %d seconds",
+				int(minRoomLifetime.Seconds()), int(repository.RoomLifetime.Seconds()))
+		}
+		return lifetime, nil
+
+	default:
+		return 0, fmt.Errorf("unsupported apiVersion %q; use %s or %s", req.APIVersion, CreateRoomV1, CreateRoomV2)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/repository"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestApplyVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          CreateRoomRequest
+		wantLifetime time.Duration
+		wantVersion  string
+		wantErr      bool
+	}{
+		{"no version reads as v1", CreateRoomRequest{}, repository.RoomLifetime, CreateRoomV1, false},
+		{"v1", CreateRoomRequest{APIVersion: "v1"}, repository.RoomLifetime, CreateRoomV1, false},
+		{"v1 ignores expiresIn", CreateRoomRequest{APIVersion: "v1", ExpiresIn: 600}, repository.RoomLifetime, CreateRoomV1, false},
+		{"v2 without expiresIn", CreateRoomRequest{APIVersion: "v2"}, repository.RoomLifetime, CreateRoomV2, false},
+		{"v2 with expiresIn", CreateRoomRequest{APIVersion: "v2", ExpiresIn: 3600}, time.Hour, CreateRoomV2, false},
+		{"v2 at the shortest lifetime", CreateRoomRequest{APIVersion: "v2", ExpiresIn: 60}, time.Minute, CreateRoomV2, false},
+		{"v2 at the longest lifetime", CreateRoomRequest{APIVersion: "v2", ExpiresIn: 86400}, repository.RoomLifetime, CreateRoomV2, false},
+		{"v2 too short", CreateRoomRequest{APIVersion: "v2", ExpiresIn: 59}, 0, "", true},
+		{"v2 too long", CreateRoomRequest{APIVersion: "v2", ExpiresIn: 86401}, 0, "", true},
+		{"v2 negative", CreateRoomRequest{APIVersion: "v2", ExpiresIn: -1}, 0, "", true},
+		{"unknown version", CreateRoomRequest{APIVersion: "v3"}, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		req := tt.req
+		lifetime, err := req.applyVersion()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: applyVersion() = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if lifetime != tt.wantLifetime {
+			t.Errorf("%s: lifetime = %v, want %v", tt.name, lifetime, tt.wantLifetime)
+		}
+		if req.APIVersion != tt.wantVersion {
+			t.Errorf("%s: apiVersion = %q, want %q", tt.name, req.APIVersion, tt.wantVersion)
+		}
+	}
+}
+
+func TestCreateRoomAcceptsEveryBodyVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantLifetime time.Duration
+	}{
+		{"v1 body from before versioning", `{"name":"standup","maxParticipants":10,"settings":{"allowChat":true}}`, fiber.StatusOK, repository.RoomLifetime},
+		{"v1 body with a v2 field", `{"name":"standup","apiVersion":"v1","expiresIn":600}`, fiber.StatusOK, repository.RoomLifetime},
+		{"v2 body", `{"name":"standup","apiVersion":"v2","expiresIn":3600}`, fiber.StatusOK, time.Hour},
+		{"v2 body with a lifetime out of range", `{"name":"standup","apiVersion":"v2","expiresIn":30}`, fiber.StatusBadRequest, 0},
+		{"unknown version", `{"name":"standup","apiVersion":"v9"}`, fiber.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		h, fake := newTestRoomHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			if stmt.Is("SELECT") {
+				return &dbtest.Result{Columns: []string{"id"}}, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+		lk := newFakeRoomService()
+		h.roomService = lk
+
+		app := fiber.New()
+		app.Post("/room/create", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"user"}}), h.CreateRoom)
+
+		before := time.Now()
+		var resp RoomResponse
+		if status := call(t, app, "POST", "/room/create", json.RawMessage(tt.body), &resp); status != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+
+		if tt.wantStatus != fiber.StatusOK {
+			if len(lk.created) != 0 || len(fake.Find("INSERT", `"rooms"`)) != 0 {
+				t.Errorf("%s: the room was created in LiveKit (%d) or the database", tt.name, len(lk.created))
+			}
+			continue
+		}
+		if resp.Name != "standup" || len(lk.created) != 1 {
+			t.Errorf("%s: created %q, %d LiveKit rooms, want standup once", tt.name, resp.Name, len(lk.created))
+		}
+		expiresAt, ok := storedRoomValue(fake, "expires_at").(time.Time)
+		if !ok {
+			t.Fatalf("%s: stored expires_at = %v, want a time", tt.name, storedRoomValue(fake, "expires_at"))
+		}
+		if lifetime := expiresAt.Sub(before); lifetime < tt.wantLifetime || lifetime > tt.wantLifetime+time.Minute {
+			t.Errorf("%s: room expires in %v, want %v", tt.name, lifetime, tt.wantLifetime)
+		}
+	}
+}
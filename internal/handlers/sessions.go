@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
+	"bedrud-backend/internal/models"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SessionResponse represents one of the user's signed-in devices
+type SessionResponse struct {
+	ID         string    `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Label      string    `json:"label" example:"Work laptop"`
+	UserAgent  string    `json:"userAgent" example:"Mozilla/5.0"`
+	IP         string    `json:"ip" example:"203.0.113.x"`
+	Current    bool      `json:"current" example:"true"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// SessionListResponse represents the response for listing sessions
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// SessionLabelRequest represents the request to label a session
+type SessionLabelRequest struct {
+	Label string `json:"label" example:"Work laptop"`
+}
+
+// sessionInfo captures the client details stored with a new session
+func sessionInfo(c *fiber.Ctx) auth.SessionInfo {
+	return auth.SessionInfo{
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IP:        c.IP(),
+	}
+}
+
+// @Summary List sessions
+// @Description List the current user's signed-in devices
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SessionListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Not allowed while impersonating"
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/sessions [get]
+func (h *AuthHandler) ListSessions(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	sessions, err := h.authService.GetUserSessions(claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch sessions",
+		})
+	}
+
+	isAdmin := hasAdminAccess(claims)
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		ip := session.IP
+		if !isAdmin {
+			ip = redactIP(ip)
+		}
+		response = append(response, SessionResponse{
+			ID:         session.ID,
+			Label:      session.Label,
+			UserAgent:  session.UserAgent,
+			IP:         ip,
+			Current:    session.ID == claims.SessionID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+		})
+	}
+
+	return c.JSON(SessionListResponse{Sessions: response})
+}
+
+// @Summary Label a session
+// @Description Set the device label of one of the current user's sessions
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Param request body SessionLabelRequest true "New label"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/sessions/{id} [patch]
+func (h *AuthHandler) LabelSession(c *fiber.Ctx) error {
+	var input SessionLabelRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	err := h.authService.LabelSession(claims.UserID, c.Params("id"), strings.TrimSpace(input.Label))
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update session",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session updated successfully",
+	})
+}
+
+// hasAdminAccess reports whether the claims grant admin or superadmin access
+func hasAdminAccess(claims *auth.Claims) bool {
+	for _, access := range claims.Accesses {
+		if access == string(models.AccessAdmin) || access == "superadmin" {
+			return true
+		}
+	}
+	return false
+}
+
+// redactIP hides the host part of an address: the last octet of IPv4 and
+// everything past the /48 prefix of IPv6
+func redactIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.x", v4[0], v4[1], v4[2])
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "x"
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestAuthHandler(t *testing.T, answer dbtest.Answer) (*AuthHandler, *dbtest.DB) {
+	t.Helper()
+
+	db, fake := dbtest.Open(t, answer)
+	return NewAuthHandler(auth.NewAuthService(repository.NewUserRepository(db), nil), nil), fake
+}
+
+func TestListSessions(t *testing.T) {
+	now := time.Now()
+	h, _ := newTestAuthHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if !stmt.Is("SELECT") || !stmt.Mentions("refresh_sessions") {
+			return nil, nil
+		}
+		return &dbtest.Result{
+			Columns: []string{"id", "user_id", "label", "user_agent", "ip", "created_at", "last_used_at", "expires_at"},
+			Rows: [][]interface{}{
+				{"s1", "u1", "Work laptop", "Firefox", "203.0.113.7", now, now, now.Add(time.Hour)},
+				{"s2", "u1", "", "Safari", "2001:db8:1234:5678::1", now, now.Add(-time.Hour), now.Add(time.Hour)},
+			},
+		}, nil
+	})
+
+	tests := []struct {
+		name     string
+		accesses []string
+		wantIPs  []string
+	}{
+		{"users see redacted addresses", []string{"user"}, []string{"203.0.113.x", "2001:db8:1234::x"}},
+		{"admins see full addresses", []string{"admin"}, []string{"203.0.113.7", "2001:db8:1234:5678::1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/auth/sessions", signedIn(&auth.Claims{UserID: "u1", SessionID: "s1", Accesses: tt.accesses}), h.ListSessions)
+
+			var resp SessionListResponse
+			if status := call(t, app, "GET", "/auth/sessions", nil, &resp); status != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+			}
+			if len(resp.Sessions) != 2 {
+				t.Fatalf("listed %d sessions, want 2", len(resp.Sessions))
+			}
+
+			first, second := resp.Sessions[0], resp.Sessions[1]
+			if first.ID != "s1" || first.Label != "Work laptop" || !first.Current {
+				t.Errorf("first session = %+v, want the labelled current one", first)
+			}
+			if second.ID != "s2" || second.Current {
+				t.Errorf("second session = %+v, want another device", second)
+			}
+			if first.IP != tt.wantIPs[0] || second.IP != tt.wantIPs[1] {
+				t.Errorf("IPs = %q, %q, want %q", first.IP, second.IP, tt.wantIPs)
+			}
+		})
+	}
+}
+
+func TestLabelSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		label      string
+		found      bool
+		wantStatus int
+		wantLabel  string
+	}{
+		{"labels the session", "  Work laptop  ", true, fiber.StatusOK, "Work laptop"},
+		{"truncates long labels", strings.Repeat("a", 150), true, fiber.StatusOK, strings.Repeat("a", 100)},
+		{"another user's or missing session", "Phone", false, fiber.StatusNotFound, "Phone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, fake := newTestAuthHandler(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				if stmt.Is("UPDATE") && tt.found {
+					return &dbtest.Result{Affected: 1}, nil
+				}
+				return nil, nil
+			})
+
+			app := fiber.New()
+			app.Patch("/auth/sessions/:id", signedIn(&auth.Claims{UserID: "u1"}), h.LabelSession)
+
+			if status := call(t, app, "PATCH", "/auth/sessions/s1", SessionLabelRequest{Label: tt.label}, nil); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+
+			updates := fake.Find("UPDATE", "refresh_sessions")
+			if len(updates) != 1 {
+				t.Fatalf("ran %d session updates, want 1", len(updates))
+			}
+			args := updates[0].Args
+			if !hasArg(args, tt.wantLabel) || !hasArg(args, "s1") || !hasArg(args, "u1") {
+				t.Errorf("update args = %v, want label %q scoped to session s1 of user u1", args, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestRedactIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.7":           "203.0.113.x",
+		"::ffff:203.0.113.7":    "203.0.113.x",
+		"2001:db8:1234:5678::1": "2001:db8:1234::x",
+		"not an address":        "",
+		"":                      "",
+	}
+	for ip, want := range tests {
+		if got := redactIP(ip); got != want {
+			t.Errorf("redactIP(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
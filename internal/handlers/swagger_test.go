@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSwaggerRoutesAreUnique checks that every @Router annotation sits on an
+// HTTP handler and that no route is declared twice, which swag would reject
+func TestSwaggerRoutesAreUnique(t *testing.T) {
+	seen := map[string]string{}
+	fset := token.NewFileSet()
+	for _, dir := range []string{".", "../auth", "../../cmd/server"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+			if err != nil {
+				t.Fatalf("parse %s: %v", path, err)
+			}
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Doc == nil {
+					continue
+				}
+				for _, comment := range fn.Doc.List {
+					fields := strings.Fields(strings.TrimPrefix(comment.Text, "//"))
+					if len(fields) != 3 || fields[0] != "@Router" {
+						continue
+					}
+					route := fields[2] + " " + fields[1]
+					where := fset.Position(fn.Pos()).String()
+					if other, dup := seen[route]; dup {
+						t.Errorf("%s is annotated on both %s and %s", route, other, where)
+					}
+					seen[route] = where
+					if !isHandler(fn) {
+						t.Errorf("%s is annotated on %s, which isn't an HTTP handler", route, where)
+					}
+				}
+			}
+		}
+	}
+	if _, ok := seen["[post] /auth/logout"]; !ok {
+		t.Errorf("no handler is annotated for [post] /auth/logout")
+	}
+}
+
+// isHandler reports whether fn takes a *fiber.Ctx, or a *websocket.Conn for
+// stream endpoints
+func isHandler(fn *ast.FuncDecl) bool {
+	for _, param := range fn.Type.Params.List {
+		star, ok := param.Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		if sel, ok := star.X.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Ctx" || sel.Sel.Name == "Conn") {
+			return true
+		}
+	}
+	return false
+}
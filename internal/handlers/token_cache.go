@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	lkauth "github.com/livekit/protocol/auth"
+)
+
+// tokenCacheSweepSize is how many entries the cache holds before expired ones are swept on insert
+const tokenCacheSweepSize = 1024
+
+type tokenCacheKey struct {
+	room      string
+	identity  string
+	grantHash string
+}
+
+type tokenCacheEntry struct {
+	token     string
+	userID    string
+	expiresAt time.Time
+}
+
+// tokenCache reuses LiveKit join tokens for repeated joins with the same grant,
+// so reconnect storms don't mint a new token each time. A zero TTL disables it.
+type tokenCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[tokenCacheKey]tokenCacheEntry
+}
+
+func newTokenCache(ttl time.Duration) *tokenCache {
+	return &tokenCache{
+		ttl:     ttl,
+		entries: make(map[tokenCacheKey]tokenCacheEntry),
+	}
+}
+
+// grantHash fingerprints everything that ends up in the token besides room and identity
+func grantHash(grant *lkauth.VideoGrant, name string, validFor time.Duration) string {
+	data, _ := json.Marshal(struct {
+		Grant    *lkauth.VideoGrant
+		Name     string
+		ValidFor time.Duration
+	}{grant, name, validFor})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns a cached token that is still within the cache window
+func (c *tokenCache) get(key tokenCacheKey) (string, bool) {
+	if c.ttl <= 0 {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.token, true
+}
+
+// put caches a freshly issued token for the user it was issued to
+func (c *tokenCache) put(key tokenCacheKey, userID, token string) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= tokenCacheSweepSize {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	c.entries[key] = tokenCacheEntry{
+		token:     token,
+		userID:    userID,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// invalidateUser drops the user's cached tokens for a room, e.g. after their permissions changed
+func (c *tokenCache) invalidateUser(room, userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if k.room == room && entry.userID == userID {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// invalidateRoom drops every cached token for a room
+func (c *tokenCache) invalidateRoom(room string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if k.room == room {
+			delete(c.entries, k)
+		}
+	}
+}
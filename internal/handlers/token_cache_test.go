@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/models"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cachedTokens returns how many tokens the cache holds
+func cachedTokens(c *tokenCache) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func TestRepeatedJoinsReuseTheToken(t *testing.T) {
+	h := testRoomHandler()
+	h.identityStrategy = config.IdentityUserID
+	user := &models.User{ID: "u1", Email: "ann@example.com"}
+
+	first, err := h.joinToken(user, "Ann", "standup", "", true)
+	if err != nil {
+		t.Fatalf("joinToken() = %v", err)
+	}
+	second, err := h.joinToken(user, "Ann", "standup", "", true)
+	if err != nil {
+		t.Fatalf("joinToken() = %v", err)
+	}
+	if first != second || cachedTokens(h.tokens) != 1 {
+		t.Errorf("two identical joins gave different tokens or cached %d, want the same token", cachedTokens(h.tokens))
+	}
+
+	// A different grant is a different token
+	if _, err := h.joinToken(user, "Ann", "standup", "", false); err != nil {
+		t.Fatalf("joinToken() = %v", err)
+	}
+	if cachedTokens(h.tokens) != 2 {
+		t.Errorf("cached %d tokens, want one per grant", cachedTokens(h.tokens))
+	}
+}
+
+func TestPermissionChangeBustsTheTokenCache(t *testing.T) {
+	h, _ := newTestRoomHandler(t, nil)
+	h.identityStrategy = config.IdentityUserID
+	room := &models.Room{ID: "r1", Name: "standup"}
+
+	for _, userID := range []string{"u1", "u2"} {
+		if _, err := h.joinToken(&models.User{ID: userID}, "Ann", room.Name, "", true); err != nil {
+			t.Fatalf("joinToken() = %v", err)
+		}
+	}
+
+	err := h.updateParticipantPermissions("admin", room, "u1", models.RoomPermissions{CanChat: false}, models.AuditRoomPermissionsUpdated, nil)
+	if err != nil {
+		t.Fatalf("updateParticipantPermissions() = %v", err)
+	}
+
+	key := h.joinTokenKey("Ann", room.Name, "u1", true)
+	if _, ok := h.tokens.get(key); ok {
+		t.Error("u1's token survived their permission change")
+	}
+	if _, ok := h.tokens.get(h.joinTokenKey("Ann", room.Name, "u2", true)); !ok {
+		t.Error("u2's token was dropped by u1's permission change")
+	}
+}
+
+func TestRandomDeviceTokensAreNotCached(t *testing.T) {
+	h := testRoomHandler()
+	h.identityStrategy = config.IdentityUserIDDevice
+
+	if _, err := h.joinToken(&models.User{ID: "u1"}, "Ann", "standup", "", true); err != nil {
+		t.Fatalf("joinToken() = %v", err)
+	}
+	if n := cachedTokens(h.tokens); n != 0 {
+		t.Errorf("cached %d tokens for a random device, want none", n)
+	}
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	c := newTokenCache(20 * time.Millisecond)
+	key := tokenCacheKey{room: "standup", identity: "u1"}
+	c.put(key, "u1", "token")
+
+	if _, ok := c.get(key); !ok {
+		t.Fatal("fresh token wasn't cached")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.get(key); ok {
+		t.Error("token outlived the cache TTL")
+	}
+
+	disabled := newTokenCache(0)
+	disabled.put(key, "u1", "token")
+	if _, ok := disabled.get(key); ok {
+		t.Error("a zero TTL cache returned a token")
+	}
+}
+
+// Run with -race
+func TestTokenCacheConcurrentUse(t *testing.T) {
+	c := newTokenCache(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := tokenCacheKey{room: "standup", identity: fmt.Sprintf("u%d", j%10)}
+				c.put(key, key.identity, "token")
+				c.get(key)
+				if j%50 == 0 {
+					c.invalidateUser("standup", key.identity)
+					c.invalidateRoom("other")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -1,13 +1,25 @@
 package handlers
 
 import (
+	"bedrud-backend/config"
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/pagination"
 	"bedrud-backend/internal/repository"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
 )
 
 type UsersHandler struct {
-	userRepo *repository.UserRepository
+	userRepo  *repository.UserRepository
+	auditRepo *repository.AuditRepository
 }
 
 // UserListResponse represents the response for listing users
@@ -17,6 +29,12 @@ type UserListResponse struct {
 	Users []UserDetails `json:"users"`
 }
 
+// UserPageResponse represents one page of a user search
+type UserPageResponse struct {
+	Users []UserDetails `json:"users"`
+	pagination.Meta
+}
+
 // UserDetails represents detailed user information
 // @Description Detailed information about a user
 type UserDetails struct {
@@ -38,8 +56,11 @@ type UserDetails struct {
 	// @Description List of user's access levels
 	Accesses []string `json:"accesses" example:"user,admin"`
 
-	// @Description Account creation timestamp
-	CreatedAt string `json:"createdAt" example:"2025-01-01 12:00:00"`
+	// @Description Account creation timestamp (RFC 3339)
+	CreatedAt time.Time `json:"createdAt" example:"2025-01-01T12:00:00Z"`
+
+	// @Description The user's own session limit, when set; 0 means no limit
+	MaxSessions *int `json:"maxSessions,omitempty" example:"3"`
 }
 
 // UserStatusUpdateRequest represents the request to update user status
@@ -48,15 +69,52 @@ type UserStatusUpdateRequest struct {
 	Active bool `json:"active" example:"true"`
 }
 
+// UserAccessesUpdateRequest represents the request to replace a user's accesses
+// @Description Request body for updating user accesses
+type UserAccessesUpdateRequest struct {
+	Accesses []string `json:"accesses" example:"user,admin"`
+}
+
+// UserUpdateRequest represents a partial update of a user; omitted fields are left unchanged
+// @Description Request body for updating a user; only the fields present are changed
+type UserUpdateRequest struct {
+	Active   *bool    `json:"active,omitempty" example:"true"`
+	Name     *string  `json:"name,omitempty" example:"John Doe"`
+	Accesses []string `json:"accesses,omitempty" example:"user,admin"`
+	// MaxSessions sets the user's own session limit (0 for none); -1 returns
+	// them to auth.maxSessions
+	MaxSessions *int `json:"maxSessions,omitempty" example:"3"`
+}
+
+// BlockedTokenInfo describes a revoked refresh token without the token itself
+type BlockedTokenInfo struct {
+	ID        string    `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// BlockedTokenListResponse is a page of a user's blocked refresh tokens
+type BlockedTokenListResponse struct {
+	Tokens     []BlockedTokenInfo `json:"tokens"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+}
+
+// LoginAttemptListResponse is a page of a user's login attempts
+type LoginAttemptListResponse struct {
+	Attempts   []models.LoginAttempt `json:"attempts"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
 // UserStatusUpdateResponse represents the response for status update
 // @Description Response for user status update
 type UserStatusUpdateResponse struct {
 	Message string `json:"message" example:"User status updated successfully"`
 }
 
-func NewUsersHandler(userRepo *repository.UserRepository) *UsersHandler {
+func NewUsersHandler(userRepo *repository.UserRepository, auditRepo *repository.AuditRepository) *UsersHandler {
 	return &UsersHandler{
-		userRepo: userRepo,
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
 	}
 }
 
@@ -72,7 +130,18 @@ func NewUsersHandler(userRepo *repository.UserRepository) *UsersHandler {
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /admin/users [get]
 func (h *UsersHandler) ListUsers(c *fiber.Ctx) error {
-	users, err := h.userRepo.GetAllUsers()
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var users []models.User
+	var err error
+	if claims.TenantID != "" {
+		users, err = h.userRepo.GetUsersByTenant(claims.TenantID)
+	} else {
+		users, err = h.userRepo.GetAllUsers()
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch users",
@@ -88,13 +157,72 @@ func (h *UsersHandler) ListUsers(c *fiber.Ctx) error {
 			Provider:  user.Provider,
 			IsActive:  user.IsActive,
 			Accesses:  user.Accesses,
-			CreatedAt: user.CreatedAt.Format("2006-01-02 15:04:05"),
+			CreatedAt: user.CreatedAt,
 		})
 	}
 
 	return c.JSON(UserListResponse{Users: response})
 }
 
+// @Summary List users by access level
+// @Description List the users holding an access level, one page at a time, oldest first (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param level path string true "Access level" Enums(superadmin, admin, moderator, user, guest)
+// @Param page query int false "Page number" default(1)
+// @Param pageSize query int false "Users per page" default(50)
+// @Success 200 {object} UserPageResponse
+// @Failure 400 {object} ErrorResponse "Unknown access level"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/by-access/{level} [get]
+func (h *UsersHandler) ListUsersByAccess(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	level := c.Params("level")
+	if !models.IsValidAccessLevel(level) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown access level: " + level,
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := pagination.ClampLimit(c.QueryInt("pageSize"))
+
+	users, total, err := h.userRepo.GetUsersByAccessPage(models.AccessLevel(level), claims.TenantID, page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch users",
+		})
+	}
+
+	response := make([]UserDetails, 0, len(users))
+	for _, user := range users {
+		response = append(response, UserDetails{
+			ID:        user.ID,
+			Email:     user.Email,
+			Name:      user.Name,
+			Provider:  user.Provider,
+			IsActive:  user.IsActive,
+			Accesses:  user.Accesses,
+			CreatedAt: user.CreatedAt,
+		})
+	}
+
+	return c.JSON(UserPageResponse{
+		Users: response,
+		Meta:  pagination.NewMeta(total, page, pageSize),
+	})
+}
+
 // @Summary Update user status
 // @Description Activate or deactivate a user (requires superadmin access)
 // @Tags admin
@@ -112,6 +240,10 @@ func (h *UsersHandler) ListUsers(c *fiber.Ctx) error {
 // @Router /admin/users/{id}/status [put]
 func (h *UsersHandler) UpdateUserStatus(c *fiber.Ctx) error {
 	userID := c.Params("id")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
 	var input UserStatusUpdateRequest
 
 	if err := c.BodyParser(&input); err != nil {
@@ -121,16 +253,15 @@ func (h *UsersHandler) UpdateUserStatus(c *fiber.Ctx) error {
 	}
 
 	user, err := h.userRepo.GetUserByID(userID)
-	if err != nil || user == nil {
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
 
-	user.IsActive = input.Active
-	if err := h.userRepo.UpdateUser(user); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update user status",
+	if _, ferr := h.applyUserUpdate(claims, user, UserUpdateRequest{Active: &input.Active}); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
 		})
 	}
 
@@ -138,3 +269,509 @@ func (h *UsersHandler) UpdateUserStatus(c *fiber.Ctx) error {
 		Message: "User status updated successfully",
 	})
 }
+
+// @Summary Revoke a refresh token
+// @Description Revoke one of a user's refresh tokens by its session ID, leaving their other sessions signed in (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param tokenId path string true "Refresh token (session) ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "Token revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User or token not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/refresh-tokens/{tokenId}/revoke [post]
+func (h *UsersHandler) RevokeRefreshToken(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	tokenID := c.Params("tokenId")
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	user, err := h.userRepo.GetUserByID(userID)
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	session, err := h.userRepo.GetSession(tokenID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch refresh token",
+		})
+	}
+	if session == nil || session.UserID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Refresh token not found",
+		})
+	}
+
+	// Refresh tokens are only valid while their session exists. The audit
+	// entry is part of the revocation, so neither happens without the other.
+	err = h.userRepo.WithTx(func(tx repository.TxRepos) error {
+		if err := tx.Users.DeleteSession(session.ID); err != nil {
+			return err
+		}
+		return tx.Audit.Record(claims.UserID, models.AuditRefreshTokenRevoked, "user", userID, map[string]interface{}{
+			"sessionId": session.ID,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke refresh token",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Refresh token revoked",
+	})
+}
+
+// ImpersonationResponse carries an access token for acting as another user
+type ImpersonationResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJ..."`
+	ExpiresIn   int    `json:"expires_in" example:"900"` // in seconds
+}
+
+// @Summary Impersonate a user
+// @Description Issue a short-lived access token that acts as the user, flagged as impersonated. Sensitive operations are blocked for it and every use is logged (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} ImpersonationResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/impersonate [post]
+func (h *UsersHandler) Impersonate(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	// No chaining: an impersonation token must not mint further ones
+	if claims.ImpersonatedBy != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Not allowed while impersonating a user",
+		})
+	}
+
+	user, err := h.userRepo.GetUserByID(c.Params("id"))
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	for _, access := range user.Accesses {
+		if access == "superadmin" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Superadmins cannot be impersonated",
+			})
+		}
+	}
+
+	token, err := auth.GenerateImpersonationToken(user.ID, user.Email, user.Provider, user.Accesses, user.TenantID, claims.UserID, config.Get())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	if err := h.auditRepo.Record(claims.UserID, models.AuditUserImpersonated, "user", user.ID, map[string]interface{}{
+		"ip":        c.IP(),
+		"userAgent": c.Get(fiber.HeaderUserAgent),
+	}); err != nil {
+		// Impersonation without an audit trail is not allowed
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit entry",
+		})
+	}
+
+	return c.JSON(ImpersonationResponse{
+		AccessToken: token,
+		ExpiresIn:   int(auth.ImpersonationTokenDuration.Seconds()),
+	})
+}
+
+// @Summary Update user accesses
+// @Description Replace a user's access levels and sign them out of every session so the change takes effect (requires superadmin access)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body UserAccessesUpdateRequest true "New access levels"
+// @Security BearerAuth
+// @Success 200 {object} UserDetails "Updated user"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/accesses [put]
+func (h *UsersHandler) UpdateUserAccesses(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var input UserAccessesUpdateRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	accesses, ferr := normalizeAccesses(input.Accesses)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	user, err := h.userRepo.GetUserByID(c.Params("id"))
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	// Keep a superadmin from locking themselves out of the admin API
+	if user.ID == claims.UserID && !hasAccess(accesses, models.AccessSuperAdmin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You cannot remove your own superadmin access",
+		})
+	}
+
+	// Accesses are baked into tokens, so the user's sessions end with the change
+	// and the next login picks them up. The change isn't made without its audit entry.
+	err = h.userRepo.WithTx(func(tx repository.TxRepos) error {
+		if err := tx.Users.UpdateUserAccesses(user.ID, accesses); err != nil {
+			return err
+		}
+		if err := tx.Users.RevokeUserSessions(user.ID); err != nil {
+			return err
+		}
+		return tx.Audit.Record(claims.UserID, models.AuditUserAccessesUpdated, "user", user.ID, map[string]interface{}{
+			"from": []string(user.Accesses),
+			"to":   accesses,
+		})
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user accesses",
+		})
+	}
+
+	return c.JSON(UserDetails{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Provider:  user.Provider,
+		IsActive:  user.IsActive,
+		Accesses:  accesses,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+// @Summary List a user's blocked refresh tokens
+// @Description List the refresh tokens revoked for a user, newest first; token values are never returned (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param cursor query string false "Cursor from the previous page's nextCursor"
+// @Param limit query int false "Page size"
+// @Security BearerAuth
+// @Success 200 {object} BlockedTokenListResponse
+// @Failure 400 {object} ErrorResponse "Invalid cursor"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/blocked-tokens [get]
+func (h *UsersHandler) ListBlockedTokens(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	cursor, err := pagination.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+	limit := pagination.ClampLimit(c.QueryInt("limit"))
+
+	user, err := h.userRepo.GetUserByID(c.Params("id"))
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	tokens, next, err := h.userRepo.GetBlockedTokensPage(user.ID, cursor, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch blocked tokens",
+		})
+	}
+
+	response := BlockedTokenListResponse{
+		Tokens:     make([]BlockedTokenInfo, 0, len(tokens)),
+		NextCursor: next,
+	}
+	for _, token := range tokens {
+		response.Tokens = append(response.Tokens, BlockedTokenInfo{
+			ID:        token.ID,
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// @Summary List a user's login attempts
+// @Description List a user's email/password sign-in attempts, newest first, to spot brute-force patterns (requires superadmin access)
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param success query bool false "Only successful (true) or failed (false) attempts"
+// @Param cursor query string false "Cursor from the previous page's nextCursor"
+// @Param limit query int false "Page size"
+// @Security BearerAuth
+// @Success 200 {object} LoginAttemptListResponse
+// @Failure 400 {object} ErrorResponse "Invalid cursor or success filter"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/login-attempts [get]
+func (h *UsersHandler) ListLoginAttempts(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	cursor, err := pagination.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid cursor",
+		})
+	}
+	limit := pagination.ClampLimit(c.QueryInt("limit"))
+
+	var success *bool
+	if raw := c.Query("success"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "success must be true or false",
+			})
+		}
+		success = &value
+	}
+
+	user, err := h.userRepo.GetUserByID(c.Params("id"))
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	attempts, next, err := h.userRepo.GetLoginAttemptsPage(user.ID, success, cursor, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch login attempts",
+		})
+	}
+
+	return c.JSON(LoginAttemptListResponse{
+		Attempts:   attempts,
+		NextCursor: next,
+	})
+}
+
+// @Summary Update a user
+// @Description Change a user's active flag, name, accesses and/or session limit; only the fields present in the body are changed (requires superadmin access)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body UserUpdateRequest true "Fields to change"
+// @Security BearerAuth
+// @Success 200 {object} UserDetails "Updated user"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id} [patch]
+func (h *UsersHandler) UpdateUser(c *fiber.Ctx) error {
+	claims, ok := ctxutil.Claims(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var input UserUpdateRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	user, err := h.userRepo.GetUserByID(c.Params("id"))
+	if err != nil || user == nil || !claims.CanAccessTenant(user.TenantID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	updated, ferr := h.applyUserUpdate(claims, user, input)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	return c.JSON(UserDetails{
+		ID:          updated.ID,
+		Email:       updated.Email,
+		Name:        updated.Name,
+		Provider:    updated.Provider,
+		IsActive:    updated.IsActive,
+		Accesses:    updated.Accesses,
+		CreatedAt:   updated.CreatedAt,
+		MaxSessions: updated.MaxSessions,
+	})
+}
+
+// applyUserUpdate validates and stores the fields present in input, ends the
+// user's sessions when their access changed and audits the change. Failures
+// come back as a *fiber.Error carrying the status and message to answer with.
+func (h *UsersHandler) applyUserUpdate(claims *auth.Claims, user *models.User, input UserUpdateRequest) (*models.User, *fiber.Error) {
+	fields := make(map[string]interface{})
+	changes := make(map[string]interface{})
+	updated := *user
+	revoke := false
+
+	if input.Active != nil && *input.Active != user.IsActive {
+		// Keep an admin from locking themselves out
+		if user.ID == claims.UserID && !*input.Active {
+			return nil, fiber.NewError(fiber.StatusForbidden, "You cannot deactivate your own account")
+		}
+		fields["is_active"] = *input.Active
+		changes["active"] = fiber.Map{"from": user.IsActive, "to": *input.Active}
+		updated.IsActive = *input.Active
+		revoke = !*input.Active
+	}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		maxName := config.Get().Auth.MaxNameLength
+		if name == "" || auth.CheckLengths("", name) != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Name must be between 1 and %d characters", maxName))
+		}
+		if name != user.Name {
+			fields["name"] = name
+			changes["name"] = fiber.Map{"from": user.Name, "to": name}
+			updated.Name = name
+		}
+	}
+
+	if input.Accesses != nil {
+		accesses, ferr := normalizeAccesses(input.Accesses)
+		if ferr != nil {
+			return nil, ferr
+		}
+		if user.ID == claims.UserID && !hasAccess(accesses, models.AccessSuperAdmin) {
+			return nil, fiber.NewError(fiber.StatusForbidden, "You cannot remove your own superadmin access")
+		}
+		fields["accesses"] = models.StringArray(accesses)
+		changes["accesses"] = fiber.Map{"from": []string(user.Accesses), "to": accesses}
+		updated.Accesses = accesses
+		revoke = true
+	}
+
+	if input.MaxSessions != nil {
+		limit := *input.MaxSessions
+		if limit < -1 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "maxSessions must be -1 (use the default), 0 (no limit) or a positive number")
+		}
+		var to *int
+		if limit >= 0 {
+			to = &limit
+		}
+		fields["max_sessions"] = to
+		changes["maxSessions"] = fiber.Map{"from": user.MaxSessions, "to": to}
+		updated.MaxSessions = to
+	}
+
+	if len(fields) == 0 {
+		return &updated, nil
+	}
+
+	// Accesses are baked into tokens and a deactivated user must not keep
+	// refreshing; end the user's sessions in the same transaction so the
+	// change can't be applied without them, nor without its audit entry
+	err := h.userRepo.WithTx(func(tx repository.TxRepos) error {
+		if err := tx.Users.UpdateUserFields(user.ID, fields); err != nil {
+			return err
+		}
+		if revoke {
+			if err := tx.Users.RevokeUserSessions(user.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Audit.Record(claims.UserID, models.AuditUserUpdated, "user", user.ID, changes)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		log.Error().Err(err).Str("userId", user.ID).Msg("Failed to update user")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to update user")
+	}
+
+	return &updated, nil
+}
+
+// normalizeAccesses validates access levels and drops duplicates, keeping order
+func normalizeAccesses(input []string) ([]string, *fiber.Error) {
+	if len(input) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "At least one access level is required")
+	}
+
+	accesses := make([]string, 0, len(input))
+	seen := make(map[string]bool, len(input))
+	for _, access := range input {
+		if !models.IsValidAccessLevel(access) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Unknown access level: "+access)
+		}
+		if !seen[access] {
+			seen[access] = true
+			accesses = append(accesses, access)
+		}
+	}
+	return accesses, nil
+}
+
+// hasAccess reports whether accesses contains the given level
+func hasAccess(accesses []string, level models.AccessLevel) bool {
+	for _, access := range accesses {
+		if access == string(level) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,699 @@
+package handlers
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/middleware"
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/pagination"
+	"bedrud-backend/internal/repository"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// opaqueSessions plays the refresh sessions of user u1 under the opaque refresh token scheme
+type opaqueSessions struct {
+	mu     sync.Mutex
+	hashes map[string]string // session ID -> current token hash
+}
+
+func (s *opaqueSessions) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row := func(id string) []interface{} {
+		return []interface{}{id, "u1", s.hashes[id], time.Now().Add(time.Hour)}
+	}
+	sessions := &dbtest.Result{Columns: []string{"id", "user_id", "token_hash", "expires_at"}}
+
+	switch {
+	case stmt.Is("INSERT") && stmt.Mentions(`"refresh_sessions"`):
+		id, _ := stmt.Value("id")
+		hash, _ := stmt.Value("token_hash")
+		s.hashes[id.(string)] = hash.(string)
+	case stmt.Is("SELECT") && stmt.Mentions(`"refresh_sessions"`) && stmt.Mentions("token_hash ="):
+		for id, hash := range s.hashes {
+			if hash == stmt.Args[0] {
+				sessions.Rows = append(sessions.Rows, row(id))
+			}
+		}
+		return sessions, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"refresh_sessions"`) && stmt.Mentions("id ="):
+		if _, ok := s.hashes[stmt.Args[0].(string)]; ok {
+			sessions.Rows = append(sessions.Rows, row(stmt.Args[0].(string)))
+		}
+		return sessions, nil
+	case stmt.Is("UPDATE") && stmt.Mentions(`"refresh_sessions"`) && stmt.Mentions(`"token_hash"=`):
+		hash, _ := stmt.Value("token_hash")
+		id := stmt.Args[len(stmt.Args)-2].(string)
+		if s.hashes[id] != stmt.Args[len(stmt.Args)-1] {
+			return &dbtest.Result{}, nil
+		}
+		s.hashes[id] = hash.(string)
+		return &dbtest.Result{Affected: 1}, nil
+	case stmt.Is("DELETE") && stmt.Mentions(`"refresh_sessions"`):
+		delete(s.hashes, stmt.Args[0].(string))
+		return &dbtest.Result{Affected: 1}, nil
+	case stmt.Is("SELECT") && stmt.Mentions("count("):
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(len(s.hashes))}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+		return &dbtest.Result{
+			Columns: []string{"id", "email", "accesses", "is_active"},
+			Rows:    [][]interface{}{{"u1", "ann@example.com", "{user}", true}},
+		}, nil
+	case stmt.Is("SELECT"):
+		return &dbtest.Result{Columns: []string{"id"}}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+// sessionIDs returns the IDs of the sessions left
+func (s *opaqueSessions) sessionIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id := range s.hashes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	configtest.Load(t, map[string]interface{}{"auth.refreshTokenScheme": auth.RefreshSchemeOpaque})
+	sessions := &opaqueSessions{hashes: map[string]string{}}
+	db, fake := dbtest.Open(t, sessions.answer)
+	authService := auth.NewAuthService(repository.NewUserRepository(db), nil)
+	h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+	user := &models.User{ID: "u1", Email: "ann@example.com", IsActive: true}
+	laptop, err := authService.StartSession(user, auth.SessionInfo{})
+	if err != nil {
+		t.Fatalf("StartSession() = %v", err)
+	}
+	laptopSession := sessions.sessionIDs()[0]
+	phone, err := authService.StartSession(user, auth.SessionInfo{})
+	if err != nil {
+		t.Fatalf("StartSession() = %v", err)
+	}
+
+	app := fiber.New()
+	app.Post("/admin/users/:id/refresh-tokens/:tokenId/revoke", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), h.RevokeRefreshToken)
+
+	if status := call(t, app, "POST", "/admin/users/u1/refresh-tokens/"+laptopSession+"/revoke", nil, nil); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	if _, err := authService.Refresh(laptop.RefreshToken); err == nil {
+		t.Error("the revoked refresh token still refreshes")
+	}
+	if _, err := authService.Refresh(phone.RefreshToken); err != nil {
+		t.Errorf("the other session's refresh token = %v, want it to keep working", err)
+	}
+
+	audits := fake.Find("INSERT", `"audit_logs"`)
+	if len(audits) != 1 || !hasArg(audits[0].Args, models.AuditRefreshTokenRevoked) || !hasArg(audits[0].Args, "admin") {
+		t.Errorf("audit entries = %v, want the revocation by admin", audits)
+	}
+
+	if status := call(t, app, "POST", "/admin/users/u1/refresh-tokens/"+laptopSession+"/revoke", nil, nil); status != fiber.StatusNotFound {
+		t.Errorf("revoking again: status = %d, want %d", status, fiber.StatusNotFound)
+	}
+}
+
+func TestImpersonate(t *testing.T) {
+	cfg := configtest.Load(t, nil)
+	accesses := map[string]string{"u1": "{user}", "root": "{superadmin}"}
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`"users"`) {
+			id := stmt.Args[0].(string)
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "provider", "accesses", "is_active"},
+				Rows:    [][]interface{}{{id, id + "@example.com", "local", accesses[id], true}},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+	app := fiber.New()
+	app.Post("/admin/users/:id/impersonate", signedIn(&auth.Claims{UserID: "admin", Accesses: []string{"superadmin"}}), h.Impersonate)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/auth/me", middleware.Protected(), ok)
+	app.Post("/auth/logout", middleware.Protected(), middleware.BlockImpersonation(), ok)
+
+	var resp ImpersonationResponse
+	if status := call(t, app, "POST", "/admin/users/u1/impersonate", nil, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if resp.ExpiresIn != int(auth.ImpersonationTokenDuration.Seconds()) {
+		t.Errorf("expires_in = %d, want %d", resp.ExpiresIn, int(auth.ImpersonationTokenDuration.Seconds()))
+	}
+
+	claims, err := auth.ValidateToken(resp.AccessToken, cfg)
+	if err != nil {
+		t.Fatalf("ValidateToken() = %v", err)
+	}
+	if claims.UserID != "u1" || claims.ImpersonatedBy != "admin" {
+		t.Errorf("token is for %q impersonated by %q, want u1 impersonated by admin", claims.UserID, claims.ImpersonatedBy)
+	}
+	if left := time.Until(claims.ExpiresAt.Time); left > auth.ImpersonationTokenDuration {
+		t.Errorf("token expires in %v, want at most %v", left, auth.ImpersonationTokenDuration)
+	}
+
+	audits := fake.Find("INSERT", `"audit_logs"`)
+	if len(audits) != 1 || !hasArg(audits[0].Args, models.AuditUserImpersonated) || !hasArg(audits[0].Args, "admin") {
+		t.Errorf("audit entries = %v, want the impersonation by admin", audits)
+	}
+
+	as := func(method, target string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+resp.AccessToken)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+		return res.StatusCode
+	}
+	if status := as("GET", "/auth/me"); status != fiber.StatusOK {
+		t.Errorf("GET /auth/me as the impersonated user: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := as("POST", "/auth/logout"); status != fiber.StatusForbidden {
+		t.Errorf("POST /auth/logout as the impersonated user: status = %d, want %d", status, fiber.StatusForbidden)
+	}
+
+	if status := call(t, app, "POST", "/admin/users/root/impersonate", nil, nil); status != fiber.StatusForbidden {
+		t.Errorf("impersonating a superadmin: status = %d, want %d", status, fiber.StatusForbidden)
+	}
+}
+
+func TestImpersonationTokensCannotImpersonate(t *testing.T) {
+	configtest.Load(t, nil)
+	db, fake := dbtest.Open(t, nil)
+	h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+	app := fiber.New()
+	app.Post("/admin/users/:id/impersonate", signedIn(&auth.Claims{UserID: "u1", Accesses: []string{"superadmin"}, ImpersonatedBy: "admin"}), h.Impersonate)
+
+	if status := call(t, app, "POST", "/admin/users/u2/impersonate", nil, nil); status != fiber.StatusForbidden {
+		t.Errorf("status = %d, want %d", status, fiber.StatusForbidden)
+	}
+	if audits := fake.Find("INSERT", `"audit_logs"`); len(audits) != 0 {
+		t.Errorf("audit entries = %v, want none", audits)
+	}
+}
+
+func TestUpdateUserAccesses(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		accesses     []string
+		wantStatus   int
+		wantAccesses []string
+	}{
+		{"valid", "u1", []string{"user", "admin", "admin"}, fiber.StatusOK, []string{"user", "admin"}},
+		{"unknown level", "u1", []string{"user", "owner"}, fiber.StatusBadRequest, nil},
+		{"no levels", "u1", []string{}, fiber.StatusBadRequest, nil},
+		{"own superadmin removed", "root", []string{"admin"}, fiber.StatusForbidden, nil},
+		{"own superadmin kept", "root", []string{"superadmin", "admin"}, fiber.StatusOK, []string{"superadmin", "admin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accesses := map[string]string{"u1": "{user}", "root": "{superadmin}"}
+			db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				if stmt.Is("SELECT") && stmt.Mentions(`"users"`) {
+					id := stmt.Args[0].(string)
+					return &dbtest.Result{
+						Columns: []string{"id", "email", "provider", "accesses", "is_active"},
+						Rows:    [][]interface{}{{id, id + "@example.com", "local", accesses[id], true}},
+					}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+			h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+			app := fiber.New()
+			app.Put("/admin/users/:id/accesses", signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}), h.UpdateUserAccesses)
+
+			var resp UserDetails
+			status := call(t, app, "PUT", "/admin/users/"+tt.target+"/accesses", UserAccessesUpdateRequest{Accesses: tt.accesses}, &resp)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+
+			updates := fake.Find("UPDATE", `"accesses"`)
+			revocations := fake.Find("DELETE", `"refresh_sessions"`)
+			audits := fake.Find("INSERT", `"audit_logs"`)
+			if tt.wantStatus != fiber.StatusOK {
+				if len(updates)+len(revocations)+len(audits) != 0 {
+					t.Errorf("a rejected change wrote %d updates, %d revocations and %d audit entries", len(updates), len(revocations), len(audits))
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(resp.Accesses, tt.wantAccesses) {
+				t.Errorf("accesses = %q, want %q", resp.Accesses, tt.wantAccesses)
+			}
+			if len(updates) != 1 {
+				t.Errorf("%d access updates, want 1", len(updates))
+			}
+			if len(revocations) != 1 || !hasArg(revocations[0].Args, tt.target) {
+				t.Errorf("session revocations = %v, want the sessions of %s", revocations, tt.target)
+			}
+			if len(audits) != 1 || !hasArg(audits[0].Args, models.AuditUserAccessesUpdated) || !hasArg(audits[0].Args, "root") {
+				t.Errorf("audit entries = %v, want the change by root", audits)
+			}
+			if events := fake.Transactions(); len(events) == 0 || events[len(events)-1] != dbtest.Commit {
+				t.Errorf("transactions = %v, want the change committed", events)
+			}
+		})
+	}
+}
+
+func TestUserTimestampsAreRFC3339(t *testing.T) {
+	created := time.Date(2024, 3, 9, 14, 5, 30, 0, time.FixedZone("CET", 3600))
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") && stmt.Mentions(`"users"`) {
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "provider", "accesses", "is_active", "created_at"},
+				Rows:    [][]interface{}{{"u1", "ann@example.com", "local", "{user}", true, created}},
+			}, nil
+		}
+		return nil, nil
+	})
+	h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+	app := fiber.New()
+	app.Get("/admin/users", signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}), h.ListUsers)
+
+	var resp struct {
+		Users []struct {
+			CreatedAt string `json:"createdAt"`
+		} `json:"users"`
+	}
+	if status := call(t, app, "GET", "/admin/users", nil, &resp); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if len(resp.Users) != 1 {
+		t.Fatalf("%d users, want 1", len(resp.Users))
+	}
+
+	got, err := time.Parse(time.RFC3339, resp.Users[0].CreatedAt)
+	if err != nil {
+		t.Fatalf("createdAt = %q, want RFC 3339: %v", resp.Users[0].CreatedAt, err)
+	}
+	if !got.Equal(created) {
+		t.Errorf("createdAt = %v, want %v", got, created)
+	}
+}
+
+func TestListUsersIsScopedToTheTenant(t *testing.T) {
+	tests := []struct {
+		name       string
+		tenantID   string
+		wantTenant bool
+	}{
+		{"tenant token", "acme", true},
+		{"global token", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := dbtest.Open(t, nil)
+			h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+			app := fiber.New()
+			app.Get("/admin/users", signedIn(&auth.Claims{UserID: "root", TenantID: tt.tenantID, Accesses: []string{"superadmin"}}), h.ListUsers)
+
+			if status := call(t, app, "GET", "/admin/users", nil, nil); status != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+			}
+			queries := fake.Find("SELECT", `"users"`)
+			if len(queries) != 1 {
+				t.Fatalf("%d user queries, want 1", len(queries))
+			}
+			scoped := queries[0].Mentions("tenant_id") && hasArg(queries[0].Args, "acme")
+			if scoped != tt.wantTenant {
+				t.Errorf("query %q with %v scoped to acme: %v, want %v", queries[0].Query, queries[0].Args, scoped, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	yes, no := true, false
+	renamed := "  Ann Lee "
+	tooLong := strings.Repeat("é", 256)
+
+	tests := []struct {
+		name        string
+		target      string
+		route       string
+		body        interface{}
+		wantStatus  int
+		wantFields  map[string]interface{}
+		wantRevoked bool
+	}{
+		{
+			name:        "only active",
+			target:      "u1",
+			body:        UserUpdateRequest{Active: &no},
+			wantStatus:  fiber.StatusOK,
+			wantFields:  map[string]interface{}{"is_active": false},
+			wantRevoked: true,
+		},
+		{
+			name:        "only accesses",
+			target:      "u1",
+			body:        UserUpdateRequest{Accesses: []string{"user", "moderator"}},
+			wantStatus:  fiber.StatusOK,
+			wantFields:  map[string]interface{}{"accesses": nil},
+			wantRevoked: true,
+		},
+		{
+			name:        "combined, already active",
+			target:      "u1",
+			body:        UserUpdateRequest{Active: &yes, Name: &renamed, Accesses: []string{"admin"}},
+			wantStatus:  fiber.StatusOK,
+			wantFields:  map[string]interface{}{"name": "Ann Lee", "accesses": nil},
+			wantRevoked: true,
+		},
+		{
+			name:       "only name",
+			target:     "u1",
+			body:       UserUpdateRequest{Name: &renamed},
+			wantStatus: fiber.StatusOK,
+			wantFields: map[string]interface{}{"name": "Ann Lee"},
+		},
+		{
+			name:        "status route",
+			target:      "u1",
+			route:       "/status",
+			body:        UserStatusUpdateRequest{Active: false},
+			wantStatus:  fiber.StatusOK,
+			wantFields:  map[string]interface{}{"is_active": false},
+			wantRevoked: true,
+		},
+		{
+			name:       "name over the limit",
+			target:     "u1",
+			body:       UserUpdateRequest{Name: &tooLong},
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:       "unknown access",
+			target:     "u1",
+			body:       UserUpdateRequest{Active: &no, Accesses: []string{"owner"}},
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:       "deactivating yourself",
+			target:     "root",
+			body:       UserUpdateRequest{Active: &no},
+			wantStatus: fiber.StatusForbidden,
+		},
+		{
+			name:       "dropping your own superadmin",
+			target:     "root",
+			body:       UserUpdateRequest{Accesses: []string{"admin"}},
+			wantStatus: fiber.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configtest.Load(t, nil)
+			accesses := map[string]string{"u1": "{user}", "root": "{superadmin}"}
+			db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				if stmt.Is("SELECT") && stmt.Mentions(`"users"`) {
+					id := stmt.Args[0].(string)
+					return &dbtest.Result{
+						Columns: []string{"id", "email", "name", "provider", "accesses", "is_active"},
+						Rows:    [][]interface{}{{id, id + "@example.com", "Ann", "local", accesses[id], true}},
+					}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+			h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+			app := fiber.New()
+			superadmin := signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}})
+			app.Patch("/admin/users/:id", superadmin, h.UpdateUser)
+			app.Put("/admin/users/:id/status", superadmin, h.UpdateUserStatus)
+
+			method := "PATCH"
+			if tt.route != "" {
+				method = "PUT"
+			}
+			if status := call(t, app, method, "/admin/users/"+tt.target+tt.route, tt.body, nil); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+
+			updates := fake.Find("UPDATE", `"users"`)
+			revocations := fake.Find("DELETE", `"refresh_sessions"`)
+			audits := fake.Find("INSERT", `"audit_logs"`)
+			if tt.wantFields == nil {
+				if len(updates)+len(revocations)+len(audits) != 0 {
+					t.Errorf("a rejected update wrote %d updates, %d revocations and %d audit entries", len(updates), len(revocations), len(audits))
+				}
+				return
+			}
+
+			var fields []dbtest.Statement
+			for _, update := range updates {
+				if _, ok := update.Value("updated_at"); ok && !update.Mentions(`"refresh_token"`) {
+					fields = append(fields, update)
+				}
+			}
+			if len(fields) != 1 {
+				t.Fatalf("user updates = %v, want one", fields)
+			}
+			for _, column := range []string{"is_active", "name", "accesses", "max_sessions"} {
+				got, set := fields[0].Value(column)
+				want, wantSet := tt.wantFields[column]
+				if set != wantSet {
+					t.Errorf("%s set: %v, want %v", column, set, wantSet)
+				} else if set && want != nil && got != want {
+					t.Errorf("%s = %v, want %v", column, got, want)
+				}
+			}
+			if (len(revocations) > 0) != tt.wantRevoked {
+				t.Errorf("sessions revoked: %v, want %v", len(revocations) > 0, tt.wantRevoked)
+			}
+			if len(audits) != 1 || !hasArg(audits[0].Args, models.AuditUserUpdated) {
+				t.Errorf("audit entries = %v, want the update", audits)
+			}
+		})
+	}
+}
+
+func TestListBlockedTokens(t *testing.T) {
+	created := time.Date(2024, 3, 9, 14, 0, 0, 0, time.UTC)
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		switch {
+		case stmt.Is("SELECT") && stmt.Mentions(`"blocked_refresh_tokens"`):
+			return &dbtest.Result{
+				Columns: []string{"id", "token", "user_id", "expires_at", "created_at"},
+				Rows: [][]interface{}{
+					{"b2", "raw-token-two", "u1", created.Add(48 * time.Hour), created.Add(time.Hour)},
+					{"b1", "raw-token-one", "u1", created.Add(24 * time.Hour), created},
+				},
+			}, nil
+		case stmt.Is("SELECT") && stmt.Mentions(`"users"`) && hasArg(stmt.Args, "u1"):
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "tenant_id", "accesses", "is_active"},
+				Rows:    [][]interface{}{{"u1", "ann@example.com", "acme", "{user}", true}},
+			}, nil
+		}
+		return &dbtest.Result{Columns: []string{"id"}}, nil
+	})
+	h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+	app := fiber.New()
+	app.Get("/admin/users/:id/blocked-tokens", signedIn(&auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}), h.ListBlockedTokens)
+
+	var body json.RawMessage
+	if status := call(t, app, "GET", "/admin/users/u1/blocked-tokens", nil, &body); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if strings.Contains(string(body), "raw-token") {
+		t.Errorf("response %s contains a token value", body)
+	}
+
+	var resp BlockedTokenListResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	var ids []string
+	for _, token := range resp.Tokens {
+		ids = append(ids, token.ID)
+	}
+	if want := []string{"b2", "b1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("tokens = %v, want %v", ids, want)
+	}
+	if !resp.Tokens[1].ExpiresAt.Equal(created.Add(24 * time.Hour)) {
+		t.Errorf("expiresAt = %v, want %v", resp.Tokens[1].ExpiresAt, created.Add(24*time.Hour))
+	}
+
+	queries := fake.Find("SELECT", `"blocked_refresh_tokens"`)
+	if len(queries) != 1 || !hasArg(queries[0].Args, "u1") {
+		t.Errorf("blocked token queries = %v, want one scoped to u1", queries)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		claims     *auth.Claims
+		wantStatus int
+	}{
+		{"unknown user", "/admin/users/u9/blocked-tokens", &auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}, fiber.StatusNotFound},
+		{"user of another tenant", "/admin/users/u1/blocked-tokens", &auth.Claims{UserID: "root", TenantID: "globex", Accesses: []string{"superadmin"}}, fiber.StatusNotFound},
+		{"bad cursor", "/admin/users/u1/blocked-tokens?cursor=%25%25", &auth.Claims{UserID: "root", Accesses: []string{"superadmin"}}, fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		app := fiber.New()
+		app.Get("/admin/users/:id/blocked-tokens", signedIn(tt.claims), h.ListBlockedTokens)
+
+		if status := call(t, app, "GET", tt.target, nil, nil); status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+	}
+}
+
+func TestListUsersByAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		tenantID   string
+		wantStatus int
+		wantMeta   pagination.Meta
+	}{
+		{"first page", "/admin/users/by-access/admin", "", fiber.StatusOK, pagination.Meta{Total: 3, Page: 1, PageSize: pagination.DefaultLimit, TotalPages: 1}},
+		{"later page", "/admin/users/by-access/admin?page=2&pageSize=2", "", fiber.StatusOK, pagination.Meta{Total: 3, Page: 2, PageSize: 2, TotalPages: 2}},
+		{"tenant token", "/admin/users/by-access/admin", "acme", fiber.StatusOK, pagination.Meta{Total: 3, Page: 1, PageSize: pagination.DefaultLimit, TotalPages: 1}},
+		{"unknown level", "/admin/users/by-access/owner", "", fiber.StatusBadRequest, pagination.Meta{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				if stmt.Mentions("count(") {
+					return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(3)}}}, nil
+				}
+				return &dbtest.Result{
+					Columns: []string{"id", "email", "name", "provider", "accesses", "is_active"},
+					Rows:    [][]interface{}{{"u1", "ann@example.com", "Ann", "local", "{admin}", true}, {"u3", "bob@example.com", "Bob", "google", "{user,admin}", true}},
+				}, nil
+			})
+			h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+			app := fiber.New()
+			app.Get("/admin/users/by-access/:level", signedIn(&auth.Claims{UserID: "root", TenantID: tt.tenantID, Accesses: []string{"superadmin"}}), h.ListUsersByAccess)
+
+			var resp UserPageResponse
+			if status := call(t, app, "GET", tt.target, nil, &resp); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			queries := fake.Find("SELECT", `"users"`)
+			if tt.wantStatus != fiber.StatusOK {
+				if len(queries) != 0 {
+					t.Errorf("ran %d user queries for a rejected level", len(queries))
+				}
+				return
+			}
+
+			if resp.Meta != tt.wantMeta {
+				t.Errorf("meta = %+v, want %+v", resp.Meta, tt.wantMeta)
+			}
+			if len(resp.Users) != 2 || resp.Users[0].ID != "u1" || resp.Users[1].ID != "u3" {
+				t.Errorf("users = %+v, want u1 and u3", resp.Users)
+			}
+			for _, query := range queries {
+				if !hasArg(query.Args, "admin") {
+					t.Errorf("query %q with %v isn't filtered to admins", query.Query, query.Args)
+				}
+				if scoped := query.Mentions("tenant_id") && hasArg(query.Args, "acme"); scoped != (tt.tenantID != "") {
+					t.Errorf("query %q with %v scoped to acme: %v, want %v", query.Query, query.Args, scoped, tt.tenantID != "")
+				}
+			}
+		})
+	}
+}
+
+func TestListLoginAttempts(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		target      string
+		tenantID    string
+		wantStatus  int
+		wantSuccess interface{} // the success filter bound in the query, nil for none
+	}{
+		{"all attempts", "/admin/users/u1/login-attempts", "", fiber.StatusOK, nil},
+		{"failed attempts", "/admin/users/u1/login-attempts?success=false", "", fiber.StatusOK, false},
+		{"successful attempts", "/admin/users/u1/login-attempts?success=true", "", fiber.StatusOK, true},
+		{"bad success filter", "/admin/users/u1/login-attempts?success=maybe", "", fiber.StatusBadRequest, nil},
+		{"user of another tenant", "/admin/users/u1/login-attempts", "globex", fiber.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+				switch {
+				case stmt.Is("SELECT") && stmt.Mentions(`"login_attempts"`):
+					return &dbtest.Result{
+						Columns: []string{"id", "user_id", "email", "ip", "success", "created_at"},
+						Rows: [][]interface{}{
+							{"a2", "u1", "ann@example.com", "203.0.113.7", true, now},
+							{"a1", "u1", "ann@example.com", "198.51.100.9", false, now.Add(-time.Minute)},
+						},
+					}, nil
+				case stmt.Is("SELECT") && stmt.Mentions(`"users"`):
+					return &dbtest.Result{
+						Columns: []string{"id", "email", "tenant_id", "accesses", "is_active"},
+						Rows:    [][]interface{}{{"u1", "ann@example.com", "acme", "{user}", true}},
+					}, nil
+				}
+				return &dbtest.Result{Affected: 1}, nil
+			})
+			h := NewUsersHandler(repository.NewUserRepository(db), repository.NewAuditRepository(db))
+
+			app := fiber.New()
+			app.Get("/admin/users/:id/login-attempts", signedIn(&auth.Claims{UserID: "root", TenantID: tt.tenantID, Accesses: []string{"superadmin"}}), h.ListLoginAttempts)
+
+			var resp LoginAttemptListResponse
+			if status := call(t, app, "GET", tt.target, nil, &resp); status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			queries := fake.Find("SELECT", `"login_attempts"`)
+			if tt.wantStatus != fiber.StatusOK {
+				if len(queries) != 0 {
+					t.Errorf("ran %d login attempt queries for a rejected request", len(queries))
+				}
+				return
+			}
+
+			if len(queries) != 1 || !hasArg(queries[0].Args, "u1") {
+				t.Fatalf("login attempt queries = %v, want one for u1", queries)
+			}
+			if filtered := queries[0].Mentions("success"); filtered != (tt.wantSuccess != nil) {
+				t.Errorf("query %q filtered on success: %v, want %v", queries[0].Query, filtered, tt.wantSuccess != nil)
+			} else if filtered && !hasArg(queries[0].Args, tt.wantSuccess) {
+				t.Errorf("query %q with %v, want success = %v", queries[0].Query, queries[0].Args, tt.wantSuccess)
+			}
+			if len(resp.Attempts) != 2 || resp.Attempts[0].ID != "a2" || !resp.Attempts[0].Success || resp.Attempts[1].Success {
+				t.Errorf("attempts = %+v, want a2 then a1", resp.Attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Package jobs runs background work on a small in-process queue with retries.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrQueueClosed is returned when enqueueing after Shutdown has started
+	ErrQueueClosed = errors.New("job queue is shut down")
+	// ErrQueueFull is returned when the queue's buffer has no room left
+	ErrQueueFull = errors.New("job queue is full")
+)
+
+// RetryPolicy controls how often a failed job is retried and how long to wait in between.
+// The wait doubles after every failed attempt, capped at MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first; < 1 means a single attempt
+	Backoff     time.Duration // wait before the first retry
+	MaxBackoff  time.Duration // 0 means no cap
+}
+
+// DefaultRetry retries a job up to three times over a few seconds
+var DefaultRetry = RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 30 * time.Second}
+
+// Job is a named unit of work; Run returning an error makes it eligible for a retry
+type Job struct {
+	Name  string
+	Run   func(ctx context.Context) error
+	Retry RetryPolicy
+}
+
+// Queue runs jobs on a fixed number of workers
+type Queue struct {
+	jobs   chan Job
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue starts workers goroutines that take jobs from a buffer of the given capacity
+func NewQueue(workers, capacity int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if capacity < 0 {
+		capacity = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		jobs:   make(chan Job, capacity),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue adds a job without blocking
+func (q *Queue) Enqueue(job Job) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// cancelGrace is how long Shutdown waits for cancelled jobs to return before
+// giving up on them
+const cancelGrace = 5 * time.Second
+
+// Shutdown stops accepting jobs and waits for queued and running ones to finish.
+// When ctx ends first, running jobs are cancelled and ctx's error is returned;
+// jobs that ignore the cancellation are abandoned after cancelGrace.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		select {
+		case <-done:
+		case <-time.After(cancelGrace):
+			log.Warn().Msg("Abandoning background jobs that did not stop after cancellation")
+		}
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.run(job)
+	}
+}
+
+// run executes a job, retrying with backoff until it succeeds, runs out of
+// attempts or the queue is cancelled
+func (q *Queue) run(job Job) {
+	attempts := job.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := job.Retry.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := q.runOnce(job)
+		if err == nil {
+			return
+		}
+		if attempt >= attempts || q.ctx.Err() != nil {
+			log.Error().Err(err).Str("job", job.Name).Int("attempts", attempt).Msg("Job failed")
+			return
+		}
+
+		log.Warn().Err(err).Str("job", job.Name).Int("attempt", attempt).Dur("retryIn", backoff).Msg("Job failed, retrying")
+		select {
+		case <-time.After(backoff):
+		case <-q.ctx.Done():
+			log.Error().Err(err).Str("job", job.Name).Int("attempts", attempt).Msg("Job abandoned on shutdown")
+			return
+		}
+
+		backoff *= 2
+		if max := job.Retry.MaxBackoff; max > 0 && backoff > max {
+			backoff = max
+		}
+	}
+}
+
+// runOnce executes a single attempt, turning a panic into an error
+func (q *Queue) runOnce(job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Interface("panic", r).Str("job", job.Name).Msg("Job panicked")
+			err = errors.New("job panicked")
+		}
+	}()
+	return job.Run(q.ctx)
+}
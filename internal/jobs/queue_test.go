@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetry retries quickly enough for tests
+var fastRetry = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestQueueRunsJobs(t *testing.T) {
+	q := NewQueue(2, 10)
+
+	var ran int32
+	for i := 0; i < 5; i++ {
+		err := q.Enqueue(Job{Name: "count", Run: func(context.Context) error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		}})
+		if err != nil {
+			t.Fatalf("Enqueue() = %v", err)
+		}
+	}
+
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if ran != 5 {
+		t.Errorf("%d jobs ran, want 5", ran)
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	transient := errors.New("connection reset")
+
+	tests := []struct {
+		name         string
+		failures     int
+		panics       bool
+		wantAttempts int32
+	}{
+		{"succeeds first time", 0, false, 1},
+		{"transient failure", 2, false, 3},
+		{"persistent failure", 10, false, 3},
+		{"panic", 1, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(1, 1)
+
+			var attempts int32
+			err := q.Enqueue(Job{Name: tt.name, Retry: fastRetry, Run: func(context.Context) error {
+				if n := atomic.AddInt32(&attempts, 1); int(n) <= tt.failures {
+					if tt.panics {
+						panic("boom")
+					}
+					return transient
+				}
+				return nil
+			}})
+			if err != nil {
+				t.Fatalf("Enqueue() = %v", err)
+			}
+
+			if err := q.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown() = %v", err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestShutdownDrainsTheQueue(t *testing.T) {
+	q := NewQueue(1, 10)
+
+	var mu sync.Mutex
+	var finished []int
+	for i := 0; i < 4; i++ {
+		i := i
+		err := q.Enqueue(Job{Name: "slow", Run: func(context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			finished = append(finished, i)
+			mu.Unlock()
+			return nil
+		}})
+		if err != nil {
+			t.Fatalf("Enqueue() = %v", err)
+		}
+	}
+
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if len(finished) != 4 {
+		t.Errorf("%d jobs finished before Shutdown returned, want 4", len(finished))
+	}
+	if err := q.Enqueue(Job{Name: "late", Run: func(context.Context) error { return nil }}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Enqueue() after Shutdown = %v, want ErrQueueClosed", err)
+	}
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown() = %v", err)
+	}
+}
+
+func TestShutdownCancelsJobsWhenTheContextEnds(t *testing.T) {
+	q := NewQueue(1, 1)
+
+	started := make(chan struct{})
+	var cancelled int32
+	err := q.Enqueue(Job{Name: "stuck", Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		atomic.StoreInt32(&cancelled, 1)
+		return ctx.Err()
+	}})
+	if err != nil {
+		t.Fatalf("Enqueue() = %v", err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("the running job was not cancelled")
+	}
+}
+
+func TestEnqueueWhenFull(t *testing.T) {
+	q := NewQueue(1, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	block := Job{Name: "block", Run: func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}}
+	if err := q.Enqueue(block); err != nil {
+		t.Fatalf("Enqueue() = %v", err)
+	}
+	<-started
+
+	noop := Job{Name: "noop", Run: func(context.Context) error { return nil }}
+	if err := q.Enqueue(noop); err != nil {
+		t.Fatalf("Enqueue() into the free slot = %v", err)
+	}
+	if err := q.Enqueue(noop); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Enqueue() into a full queue = %v, want ErrQueueFull", err)
+	}
+
+	close(release)
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+}
@@ -3,12 +3,22 @@ package middleware
 import (
 	"bedrud-backend/config"
 	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/ctxutil"
 	"bedrud-backend/internal/models" // Add this import
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
 )
 
+// validateCredential checks a bearer credential, either an API key or a JWT
+func validateCredential(token string) (*auth.Claims, error) {
+	if auth.IsAPIKey(token) {
+		return auth.ValidateAPIKey(token)
+	}
+	return auth.ValidateToken(token, config.Get())
+}
+
 // Protected middleware
 func Protected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -25,15 +35,78 @@ func Protected() fiber.Handler {
 			token = authHeader[7:] // Remove "Bearer " prefix
 		}
 
-		claims, err := auth.ValidateToken(token, config.Get())
+		claims, err := validateCredential(token)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid token",
 			})
 		}
 
+		if claims.ImpersonatedBy != "" {
+			log.Info().
+				Str("adminId", claims.ImpersonatedBy).
+				Str("userId", claims.UserID).
+				Str("method", c.Method()).
+				Str("path", c.Path()).
+				Msg("Impersonated request")
+		}
+
 		// Add claims to context for use in protected routes
-		c.Locals("user", claims)
+		ctxutil.SetClaims(c, claims)
+		if claims.TenantID != "" {
+			ctxutil.SetTenantID(c, claims.TenantID)
+		}
+		return c.Next()
+	}
+}
+
+// RequireTenant rejects tokens that aren't scoped to a tenant. It must run after Protected.
+func RequireTenant() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := ctxutil.TenantID(c); !ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "A tenant-scoped token is required",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RequireGlobal rejects tokens scoped to a tenant, for operations that affect the
+// whole deployment. It must run after Protected.
+func RequireGlobal() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := ctxutil.TenantID(c); ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Not allowed with a tenant-scoped token",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// BlockImpersonation rejects requests made with an impersonation token, for
+// operations an admin acting as someone else must not perform. It must run after Protected.
+func BlockImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if claims, ok := ctxutil.Claims(c); ok && claims.ImpersonatedBy != "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Not allowed while impersonating a user",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// BlockAPIKeys rejects requests made with an API key, for operations that need
+// the user to be signed in, such as managing the keys themselves. It must run after Protected.
+func BlockAPIKeys() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if claims, ok := ctxutil.Claims(c); ok && claims.APIKeyID != "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Not allowed with an API key",
+			})
+		}
 		return c.Next()
 	}
 }
@@ -41,7 +114,12 @@ func Protected() fiber.Handler {
 // RequireAccess middleware checks for specific access level
 func RequireAccess(requiredAccess models.AccessLevel) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		claims := c.Locals("user").(*auth.Claims)
+		claims, ok := ctxutil.Claims(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Missing authorization",
+			})
+		}
 
 		for _, access := range claims.Accesses {
 			if access == string(requiredAccess) {
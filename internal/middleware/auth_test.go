@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/configtest"
+	"bedrud-backend/internal/ctxutil"
+	"bedrud-backend/internal/models"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProtectedScopesRequestsToTheTenant(t *testing.T) {
+	cfg := configtest.Load(t, nil)
+
+	app := fiber.New()
+	tenantOf := func(c *fiber.Ctx) error {
+		tenantID, _ := ctxutil.TenantID(c)
+		return c.SendString(tenantID)
+	}
+	app.Get("/any", Protected(), tenantOf)
+	app.Get("/tenant", Protected(), RequireTenant(), tenantOf)
+	app.Get("/global", Protected(), RequireGlobal(), tenantOf)
+
+	tests := []struct {
+		path       string
+		tenantID   string
+		wantStatus int
+	}{
+		{"/any", "acme", fiber.StatusOK},
+		{"/any", "", fiber.StatusOK},
+		{"/tenant", "acme", fiber.StatusOK},
+		{"/tenant", "", fiber.StatusForbidden},
+		{"/global", "acme", fiber.StatusForbidden},
+		{"/global", "", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		token, err := auth.GenerateToken("u1", "ann@example.com", "local", []string{"superadmin"}, tt.tenantID, cfg)
+		if err != nil {
+			t.Fatalf("GenerateToken() = %v", err)
+		}
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test() = %v", err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s with tenant %q: status = %d, want %d", tt.path, tt.tenantID, resp.StatusCode, tt.wantStatus)
+			continue
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			continue
+		}
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		if got := string(body[:n]); got != tt.tenantID {
+			t.Errorf("%s with tenant %q: tenant in context = %q", tt.path, tt.tenantID, got)
+		}
+	}
+}
+
+func TestRequireAccessKeepsModeratorsOffUserAdministration(t *testing.T) {
+	cfg := configtest.Load(t, nil)
+
+	app := fiber.New()
+	app.Get("/admin/users", Protected(), RequireAccess(models.AccessSuperAdmin), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		accesses   []string
+		wantStatus int
+	}{
+		{[]string{"superadmin"}, fiber.StatusOK},
+		{[]string{"user", "moderator"}, fiber.StatusForbidden},
+		{[]string{"user", "admin"}, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		token, err := auth.GenerateToken("u1", "ann@example.com", "local", tt.accesses, "", cfg)
+		if err != nil {
+			t.Fatalf("GenerateToken() = %v", err)
+		}
+		req := httptest.NewRequest("GET", "/admin/users", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test() = %v", err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("accesses %v: status = %d, want %d", tt.accesses, resp.StatusCode, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errMalformedJSON = errors.New("Malformed JSON body")
+	errJSONTooDeep   = errors.New("JSON body is nested too deeply")
+)
+
+// JSONBody rejects request bodies that aren't well-formed JSON before any
+// handler parses them, so every endpoint fails the same way. Bodies larger
+// than maxBytes or nested deeper than maxDepth are refused outright. Requests
+// without a body pass through untouched.
+func JSONBody(maxBytes, maxDepth int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		body := c.Body()
+		if len(body) == 0 {
+			return c.Next()
+		}
+
+		if !c.Is("json") {
+			return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+				"error": "Content-Type must be application/json",
+			})
+		}
+
+		if len(body) > maxBytes {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "Request body is too large",
+			})
+		}
+
+		if err := checkJSON(body, maxDepth); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// checkJSON walks the body token by token, so depth is checked without
+// building the value and a deep document can't exhaust the stack
+func checkJSON(body []byte, maxDepth int) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			// Token reports a clean EOF even inside an unterminated object
+			if depth != 0 {
+				return errMalformedJSON
+			}
+			break
+		}
+		if err != nil {
+			return errMalformedJSON
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxDepth {
+				return errJSONTooDeep
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestJSONBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantError   string
+	}{
+		{"well-formed body", "application/json", `{"name":"standup","settings":{"allowChat":true}}`, fiber.StatusOK, ""},
+		{"charset parameter", "application/json; charset=utf-8", `{"name":"standup"}`, fiber.StatusOK, ""},
+		{"empty body", "", "", fiber.StatusOK, ""},
+		{"wrong content type", "text/plain", `{"name":"standup"}`, fiber.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"form body", "application/x-www-form-urlencoded", "name=standup", fiber.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"malformed JSON", "application/json", `{"name":`, fiber.StatusBadRequest, errMalformedJSON.Error()},
+		{"unterminated array", "application/json", `[1, 2`, fiber.StatusBadRequest, errMalformedJSON.Error()},
+		{"trailing garbage", "application/json", `{"name":"standup"}}`, fiber.StatusBadRequest, errMalformedJSON.Error()},
+		{"at the depth limit", "application/json", strings.Repeat("[", 4) + strings.Repeat("]", 4), fiber.StatusOK, ""},
+		{"excessive nesting", "application/json", strings.Repeat("[", 5) + strings.Repeat("]", 5), fiber.StatusBadRequest, errJSONTooDeep.Error()},
+		{"deep unterminated nesting", "application/json", strings.Repeat(`{"a":`, 200), fiber.StatusBadRequest, errJSONTooDeep.Error()},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", 1024) + `"}`, fiber.StatusRequestEntityTooLarge, "Request body is too large"},
+	}
+
+	app := fiber.New()
+	app.Post("/rooms", JSONBody(1024, 4), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/rooms", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() = %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if body.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantError)
+			}
+		})
+	}
+}
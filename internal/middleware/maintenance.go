@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maintenance is the runtime maintenance-mode switch, seeded from config at
+// startup and kept in step with the stored flag by MaintenanceHandler.Sync
+var maintenance atomic.Bool
+
+// maintenanceExempt paths stay reachable during maintenance: probes, and the
+// login endpoints admins need to get a token
+var maintenanceExempt = map[string]bool{
+	"/health":       true,
+	"/ready":        true,
+	"/auth/login":   true,
+	"/auth/refresh": true,
+}
+
+// SetMaintenance turns maintenance mode on or off
+func SetMaintenance(enabled bool) {
+	maintenance.Store(enabled)
+}
+
+// MaintenanceEnabled reports whether maintenance mode is on
+func MaintenanceEnabled() bool {
+	return maintenance.Load()
+}
+
+// Maintenance answers 503 with Retry-After to everyone but admins while
+// maintenance mode is on. It runs before Protected, so it checks the token itself.
+func Maintenance(retryAfterSeconds int) fiber.Handler {
+	retryAfter := strconv.Itoa(retryAfterSeconds)
+	return func(c *fiber.Ctx) error {
+		if !maintenance.Load() || maintenanceExempt[c.Path()] || isAdminRequest(c) {
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderRetryAfter, retryAfter)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Service is under maintenance, please try again later",
+		})
+	}
+}
+
+// isAdminRequest reports whether the request carries a valid admin or
+// superadmin token or API key
+func isAdminRequest(c *fiber.Ctx) bool {
+	token := c.Get(fiber.HeaderAuthorization)
+	if strings.HasPrefix(strings.ToLower(token), "bearer ") {
+		token = token[7:]
+	}
+	if token == "" {
+		return false
+	}
+
+	claims, err := validateCredential(token)
+	if err != nil {
+		return false
+	}
+	for _, access := range claims.Accesses {
+		if access == "admin" || access == "superadmin" {
+			return true
+		}
+	}
+	return false
+}
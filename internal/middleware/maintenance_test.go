@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/configtest"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMaintenance(t *testing.T) {
+	cfg := configtest.Load(t, nil)
+	SetMaintenance(true)
+	t.Cleanup(func() { SetMaintenance(false) })
+
+	app := fiber.New()
+	app.Use(Maintenance(120))
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/health", ok)
+	app.Get("/rooms", ok)
+
+	tests := []struct {
+		name       string
+		path       string
+		accesses   []string
+		wantStatus int
+	}{
+		{"anonymous user", "/rooms", nil, fiber.StatusServiceUnavailable},
+		{"normal user", "/rooms", []string{"user"}, fiber.StatusServiceUnavailable},
+		{"moderator", "/rooms", []string{"user", "moderator"}, fiber.StatusServiceUnavailable},
+		{"admin", "/rooms", []string{"user", "admin"}, fiber.StatusOK},
+		{"superadmin", "/rooms", []string{"superadmin"}, fiber.StatusOK},
+		{"health check", "/health", nil, fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accesses != nil {
+				token, err := auth.GenerateToken("u1", "ann@example.com", "local", tt.accesses, "", cfg)
+				if err != nil {
+					t.Fatalf("GenerateToken() = %v", err)
+				}
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() = %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if retryAfter := resp.Header.Get(fiber.HeaderRetryAfter); tt.wantStatus == fiber.StatusServiceUnavailable && retryAfter != "120" {
+				t.Errorf("Retry-After = %q, want 120", retryAfter)
+			}
+		})
+	}
+}
+
+func TestMaintenanceOff(t *testing.T) {
+	SetMaintenance(false)
+
+	app := fiber.New()
+	app.Use(Maintenance(120))
+	app.Get("/rooms", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/rooms", nil))
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"bedrud-backend/internal/ctxutil"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// RateLimit allows max requests per window for each authenticated user, or
+// per client IP when the route isn't behind Protected. Counters are kept in
+// storage, or in memory when storage is nil.
+func RateLimit(max int, window time.Duration, storage fiber.Storage) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		Storage:    storage,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			if claims, ok := ctxutil.Claims(c); ok {
+				return "user:" + claims.UserID
+			}
+			return "ip:" + c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many requests",
+			})
+		},
+	})
+}
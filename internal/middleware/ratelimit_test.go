@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/repository"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// limitTable is the rate_limit_entries table, kept outside any one database
+// handle so it outlives a restart
+type limitTable struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+}
+
+func newLimitTable() *limitTable {
+	return &limitTable{values: map[string][]byte{}, expires: map[string]time.Time{}}
+}
+
+func (l *limitTable) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case stmt.Is("SELECT"):
+		key := stmt.Args[0].(string)
+		result := &dbtest.Result{Columns: []string{"key", "value", "expires_at"}}
+		if value, ok := l.values[key]; ok && time.Now().Before(l.expires[key]) {
+			result.Rows = [][]interface{}{{key, value, l.expires[key]}}
+		}
+		return result, nil
+	case stmt.Is("INSERT"):
+		key, _ := stmt.Value("key")
+		value, _ := stmt.Value("value")
+		expiresAt, _ := stmt.Value("expires_at")
+		l.values[key.(string)] = value.([]byte)
+		l.expires[key.(string)] = *expiresAt.(*time.Time)
+		return &dbtest.Result{Affected: 1}, nil
+	case stmt.Is("DELETE"):
+		for key, expiresAt := range l.expires {
+			if time.Now().After(expiresAt) {
+				delete(l.values, key)
+				delete(l.expires, key)
+			}
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	}
+	return &dbtest.Result{}, nil
+}
+
+// limitedApp starts a server process: a fresh database handle and limiter
+// over table
+func limitedApp(t *testing.T, table *limitTable, max int, window time.Duration) *fiber.App {
+	t.Helper()
+
+	db, _ := dbtest.Open(t, table.answer)
+	app := fiber.New()
+	app.Get("/rooms", RateLimit(max, window, repository.NewRateLimitStore(db)), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func get(t *testing.T, app *fiber.App) int {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/rooms", nil))
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestRateLimitCountsSurviveARestart(t *testing.T) {
+	table := newLimitTable()
+
+	before := limitedApp(t, table, 3, time.Minute)
+	for i := 0; i < 2; i++ {
+		if status := get(t, before); status != fiber.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, status, fiber.StatusOK)
+		}
+	}
+
+	after := limitedApp(t, table, 3, time.Minute)
+	if status := get(t, after); status != fiber.StatusOK {
+		t.Fatalf("third request: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := get(t, after); status != fiber.StatusTooManyRequests {
+		t.Errorf("fourth request after the restart: status = %d, want %d", status, fiber.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitDeleteExpired(t *testing.T) {
+	table := newLimitTable()
+	db, _ := dbtest.Open(t, table.answer)
+	store := repository.NewRateLimitStore(db)
+
+	if err := store.Set("ip:203.0.113.7", []byte("old"), time.Millisecond); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if err := store.Set("ip:203.0.113.8", []byte("new"), time.Minute); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if err := store.DeleteExpired(); err != nil {
+		t.Fatalf("DeleteExpired() = %v", err)
+	}
+	if _, ok := table.values["ip:203.0.113.7"]; ok {
+		t.Error("the expired counter was kept")
+	}
+	if got, err := store.Get("ip:203.0.113.8"); err != nil || string(got) != "new" {
+		t.Errorf("Get() = %q, %v, want the live counter", got, err)
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"bedrud-backend/internal/ctxutil"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Timeout wraps the request's user context with a deadline. Downstream calls
+// that use c.UserContext() are cancelled once it passes and the request is
+// answered with 504. It can be registered globally and again on individual
+// routes; the innermost registration wins, whether shorter or longer.
+//
+// The deadline only covers the handler. Fiber's ReadTimeout applies before it
+// runs and WriteTimeout starts once it returns, so a route may take longer than
+// either; a streamed body, however, must be written within WriteTimeout unless
+// the handler extends it with ctxutil.ExtendWriteDeadline.
+func Timeout(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		base, ok := ctxutil.TimeoutBase(c)
+		if !ok {
+			base = c.UserContext()
+			ctxutil.SetTimeoutBase(c, base)
+		}
+
+		ctx, cancel := context.WithTimeout(base, timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+		ctxutil.SetRouteTimeout(c, timeout)
+
+		err := c.Next()
+
+		// A route-level Timeout replaced our context and already handled its own deadline
+		if c.UserContext() != ctx {
+			return err
+		}
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+				"error": "Request timed out",
+			})
+		}
+
+		return err
+	}
+}
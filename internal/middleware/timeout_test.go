@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"bedrud-backend/internal/ctxutil"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sleepHandler waits for d or for the request context to end, and reports
+// which through cancelled
+func sleepHandler(d time.Duration, cancelled chan<- error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		select {
+		case <-time.After(d):
+			cancelled <- nil
+			return c.SendString("done")
+		case <-c.UserContext().Done():
+			cancelled <- c.UserContext().Err()
+			return nil
+		}
+	}
+}
+
+func TestTimeoutAnswers504AndCancelsTheContext(t *testing.T) {
+	cancelled := make(chan error, 1)
+	app := fiber.New()
+	app.Get("/slow", Timeout(20*time.Millisecond), sleepHandler(time.Second, cancelled))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/slow", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusGatewayTimeout)
+	}
+	if err := <-cancelled; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler context ended with %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTimeoutLetsFastHandlersThrough(t *testing.T) {
+	cancelled := make(chan error, 1)
+	app := fiber.New()
+	app.Get("/fast", Timeout(time.Second), sleepHandler(time.Millisecond, cancelled))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/fast", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if err := <-cancelled; err != nil {
+		t.Errorf("handler context ended with %v", err)
+	}
+}
+
+func TestZeroTimeoutIsDisabled(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", Timeout(0), func(c *fiber.Ctx) error {
+		if _, ok := c.UserContext().Deadline(); ok {
+			t.Error("a zero timeout set a deadline")
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusNoContent)
+	}
+}
+
+func TestRouteTimeoutOverridesTheGlobalOne(t *testing.T) {
+	tests := []struct {
+		name       string
+		global     time.Duration
+		route      time.Duration
+		sleep      time.Duration
+		wantStatus int
+	}{
+		{"longer route timeout", 20 * time.Millisecond, time.Second, 80 * time.Millisecond, fiber.StatusOK},
+		{"shorter route timeout", time.Second, 20 * time.Millisecond, time.Second, fiber.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		cancelled := make(chan error, 1)
+		var routeTimeout time.Duration
+		app := fiber.New()
+		app.Use(Timeout(tt.global))
+		app.Get("/export", Timeout(tt.route), func(c *fiber.Ctx) error {
+			routeTimeout = ctxutil.RouteTimeout(c)
+			return c.Next()
+		}, sleepHandler(tt.sleep, cancelled))
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/export", nil), -1)
+		if err != nil {
+			t.Fatalf("%s: app.Test() = %v", tt.name, err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+		err = <-cancelled
+		if wantErr := tt.wantStatus != fiber.StatusOK; errors.Is(err, context.DeadlineExceeded) != wantErr {
+			t.Errorf("%s: handler context ended with %v, want a deadline %v", tt.name, err, wantErr)
+		}
+		if routeTimeout != tt.route {
+			t.Errorf("%s: RouteTimeout() = %v, want %v", tt.name, routeTimeout, tt.route)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+// Unavailable answers every request with 503 and the given message, for route
+// groups whose backing service isn't configured
+func Unavailable(message string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+}
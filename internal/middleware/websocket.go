@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireWebSocket rejects plain HTTP requests to WebSocket routes. Browsers
+// can't set headers on WebSocket requests, so on an upgrade, and nowhere else,
+// an access_token query parameter is accepted in place of the Authorization
+// header. The parameter is dropped from the request once read so nothing
+// downstream logs it. It must run before Protected.
+func RequireWebSocket() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+				"error": "WebSocket upgrade required",
+			})
+		}
+
+		uri := c.Request().URI()
+		args := uri.QueryArgs()
+		if token := string(args.Peek("access_token")); token != "" {
+			if c.Get(fiber.HeaderAuthorization) == "" {
+				c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+			}
+			// Deleting the argument alone leaves the raw query string and
+			// OriginalURL untouched, so rewrite both
+			args.Del("access_token")
+			uri.SetQueryStringBytes(args.QueryString())
+			c.Request().Header.SetRequestURIBytes(uri.RequestURI())
+		}
+
+		return c.Next()
+	}
+}
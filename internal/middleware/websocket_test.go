@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"bedrud-backend/internal/auth"
+	"bedrud-backend/internal/configtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// upgradeRequest returns a WebSocket upgrade request for target
+func upgradeRequest(target string) *http.Request {
+	req := httptest.NewRequest("GET", target, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	return req
+}
+
+func TestRequireWebSocketRejectsPlainRequests(t *testing.T) {
+	app := fiber.New()
+	app.Get("/stream", RequireWebSocket(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/stream?access_token=secret", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusUpgradeRequired {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUpgradeRequired)
+	}
+}
+
+func TestRequireWebSocketMovesTheQueryToken(t *testing.T) {
+	var authorization, query, original string
+	app := fiber.New()
+	app.Get("/stream", RequireWebSocket(), func(c *fiber.Ctx) error {
+		authorization = c.Get(fiber.HeaderAuthorization)
+		query = string(c.Request().URI().QueryString())
+		original = c.OriginalURL()
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	if _, err := app.Test(upgradeRequest("/stream?access_token=secret&since=5"), -1); err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the query token", authorization)
+	}
+	if query != "since=5" || original != "/stream?since=5" {
+		t.Errorf("query = %q, original URL = %q, want the token removed", query, original)
+	}
+
+	req := upgradeRequest("/stream?access_token=secret")
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer header")
+	if _, err := app.Test(req, -1); err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if authorization != "Bearer header" {
+		t.Errorf("Authorization = %q, want the header to win", authorization)
+	}
+}
+
+// The gate in front of GET /admin/stream
+func TestAdminStreamGate(t *testing.T) {
+	cfg := configtest.Load(t, nil)
+
+	app := fiber.New()
+	app.Get("/admin/stream",
+		RequireWebSocket(),
+		Protected(),
+		RequireGlobal(),
+		RequireAccess("superadmin"),
+		func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) },
+	)
+
+	tests := []struct {
+		name     string
+		accesses []string
+		tenantID string
+		want     int
+	}{
+		{"user", []string{"user"}, "", fiber.StatusForbidden},
+		{"admin", []string{"user", "admin"}, "", fiber.StatusForbidden},
+		{"tenant superadmin", []string{"superadmin"}, "acme", fiber.StatusForbidden},
+		{"superadmin", []string{"superadmin"}, "", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := auth.GenerateToken("u1", "ann@example.com", "local", tt.accesses, tt.tenantID, cfg)
+			if err != nil {
+				t.Fatalf("GenerateToken() = %v", err)
+			}
+
+			resp, err := app.Test(upgradeRequest("/admin/stream?access_token="+token), -1)
+			if err != nil {
+				t.Fatalf("app.Test() = %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	resp, err := app.Test(upgradeRequest("/admin/stream"), -1)
+	if err != nil {
+		t.Fatalf("app.Test() = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+}
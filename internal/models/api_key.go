@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// APIKey lets a user or a service acting for them call the API without
+// signing in. Only the SHA-256 hash of the key is stored; the key itself is
+// shown once, when it is created.
+type APIKey struct {
+	ID         string      `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID     string      `json:"userId" gorm:"type:varchar(36);not null;index"`
+	Name       string      `json:"name" gorm:"type:varchar(100)"`
+	Prefix     string      `json:"prefix" gorm:"type:varchar(16);not null"` // start of the key, so it can be recognised
+	KeyHash    string      `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Scopes     StringArray `json:"scopes" gorm:"type:text[]"` // access levels; empty means all of the user's
+	LastUsedAt *time.Time  `json:"lastUsedAt"`
+	CreatedAt  time.Time   `json:"createdAt" gorm:"autoCreateTime;not null"`
+}
+
+// TableName specifies the table name for GORM
+func (APIKey) TableName() string {
+	return "api_keys"
+}
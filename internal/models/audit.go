@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditRefreshTokenRevoked = "refresh_token.revoked"
+	AuditMaintenanceToggled  = "maintenance.toggled"
+	AuditUserImpersonated    = "user.impersonated"
+	AuditUserAccessesUpdated = "user.accesses_updated"
+	AuditUserUpdated         = "user.updated"
+
+	AuditRoomEnded              = "room.ended"
+	AuditRoomDeactivated        = "room.deactivated"
+	AuditRoomReactivated        = "room.reactivated"
+	AuditRoomMetadataUpdated    = "room.metadata_updated"
+	AuditRoomPermissionsUpdated = "room.permissions_updated"
+	AuditRoomParticipantReset   = "room.participant_reset"
+	AuditRoomTokenIssued        = "room.token_issued"
+	AuditRoomAdminPromoted      = "room.admin_promoted"
+	AuditRoomAdminDemoted       = "room.admin_demoted"
+	AuditRoomChatMuted          = "room.chat_muted"
+)
+
+// AuditLog records an administrative action and who performed it. The
+// composite indexes back the per-target and per-actor listings, newest first.
+type AuditLog struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	ActorID    string    `json:"actorId" gorm:"type:varchar(36);not null;index;index:idx_audit_logs_actor,priority:1"`
+	Action     string    `json:"action" gorm:"type:varchar(64);not null;index"`
+	TargetType string    `json:"targetType" gorm:"type:varchar(32);index:idx_audit_logs_target,priority:1"`
+	TargetID   string    `json:"targetId" gorm:"type:varchar(36);index;index:idx_audit_logs_target,priority:2"`
+	Details    string    `json:"details,omitempty" gorm:"type:text"` // JSON object
+	CreatedAt  time.Time `json:"createdAt" gorm:"autoCreateTime;not null;index;index:idx_audit_logs_actor,priority:2;index:idx_audit_logs_target,priority:3"`
+}
+
+// TableName specifies the table name for GORM
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestAuditLogIndexesBackTheListings(t *testing.T) {
+	parsed, err := schema.Parse(&AuditLog{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("schema.Parse() = %v", err)
+	}
+	indexes := parsed.ParseIndexes()
+
+	want := map[string][]string{
+		"idx_audit_logs_target": {"target_type", "target_id", "created_at"},
+		"idx_audit_logs_actor":  {"actor_id", "created_at"},
+	}
+	for name, wantColumns := range want {
+		index, ok := indexes[name]
+		if !ok {
+			t.Errorf("audit_logs has no %s index", name)
+			continue
+		}
+		var columns []string
+		for _, field := range index.Fields {
+			columns = append(columns, field.DBName)
+		}
+		if !reflect.DeepEqual(columns, wantColumns) {
+			t.Errorf("%s columns = %v, want %v", name, columns, wantColumns)
+		}
+	}
+}
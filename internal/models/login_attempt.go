@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// LoginAttempt records one email/password sign-in, successful or not. UserID is
+// empty when the email didn't match an account.
+type LoginAttempt struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID    string    `json:"userId,omitempty" gorm:"type:varchar(36);index:idx_login_attempts_user_created"`
+	Email     string    `json:"email" gorm:"type:varchar(255);index"`
+	IP        string    `json:"ip" gorm:"type:varchar(45)"`
+	UserAgent string    `json:"userAgent" gorm:"type:varchar(512)"`
+	Success   bool      `json:"success" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"autoCreateTime;not null;index;index:idx_login_attempts_user_created"`
+}
+
+// TableName specifies the table name for GORM
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
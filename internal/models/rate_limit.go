@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RateLimitEntry is one rate-limiter counter kept in the database so limits
+// survive restarts. Value is the limiter's own encoding of the hit counts.
+type RateLimitEntry struct {
+	Key       string     `gorm:"primaryKey;type:varchar(255)"`
+	Value     []byte     `gorm:"type:bytea;not null"`
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+// TableName specifies the table name for GORM
+func (RateLimitEntry) TableName() string {
+	return "rate_limit_entries"
+}
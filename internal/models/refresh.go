@@ -14,3 +14,57 @@ type BlockedRefreshToken struct {
 func (BlockedRefreshToken) TableName() string {
 	return "blocked_refresh_tokens"
 }
+
+// RefreshSession tracks one signed-in device. Refresh tokens carry the session ID,
+// so deleting the row revokes that device without affecting the user's other sessions.
+type RefreshSession struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID     string    `json:"userId" gorm:"type:varchar(36);not null;index"`
+	Label      string    `json:"label" gorm:"type:varchar(100)"`
+	UserAgent  string    `json:"userAgent" gorm:"type:varchar(512)"`
+	IP         string    `json:"ip" gorm:"type:varchar(45)"`
+	TokenHash  string    `json:"-" gorm:"type:varchar(64);index"` // set only for opaque refresh tokens
+	CreatedAt  time.Time `json:"createdAt" gorm:"autoCreateTime;not null"`
+	LastUsedAt time.Time `json:"lastUsedAt" gorm:"not null"`
+	ExpiresAt  time.Time `json:"expiresAt" gorm:"not null;index"`
+}
+
+// TableName specifies the table name for GORM
+func (RefreshSession) TableName() string {
+	return "refresh_sessions"
+}
+
+// RetiredRefreshToken is an opaque refresh token a session rotated away from.
+// Together they form the session's lineage: presenting any of them again means
+// the token chain may be in two hands, except for a parallel refresh with the
+// immediately previous token within auth.refreshReuseGrace. Rows are kept until
+// the token would have expired anyway.
+type RetiredRefreshToken struct {
+	TokenHash string    `json:"-" gorm:"primaryKey;type:varchar(64)"`
+	SessionID string    `json:"sessionId" gorm:"type:varchar(36);not null;index"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
+	RetiredAt time.Time `json:"retiredAt" gorm:"autoCreateTime;not null"`
+
+	// NextTokenSalt is the random salt the token's replacement was derived
+	// with. Only someone holding the retired token can derive it again.
+	NextTokenSalt string `json:"-" gorm:"type:varchar(64)"`
+}
+
+// TableName specifies the table name for GORM
+func (RetiredRefreshToken) TableName() string {
+	return "retired_refresh_tokens"
+}
+
+// AuthExchangeCode is a short-lived, single-use code the SPA swaps for a token
+// pair after an OAuth login. Only the SHA-256 hash of the code is stored.
+type AuthExchangeCode struct {
+	CodeHash  string    `json:"-" gorm:"primaryKey;type:varchar(64)"`
+	UserID    string    `json:"userId" gorm:"type:varchar(36);not null;index"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
+	CreatedAt time.Time `json:"createdAt" gorm:"autoCreateTime;not null"`
+}
+
+// TableName specifies the table name for GORM
+func (AuthExchangeCode) TableName() string {
+	return "auth_exchange_codes"
+}
@@ -1,6 +1,15 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DefaultMaxParticipants is the capacity of a room created without one; it
+// matches the max_participants column default
+const DefaultMaxParticipants = 20
 
 type Room struct {
 	ID              string       `json:"id" gorm:"primaryKey;type:varchar(36)"`
@@ -11,8 +20,82 @@ type Room struct {
 	CreatedAt       time.Time    `json:"createdAt" gorm:"autoCreateTime;not null"`
 	UpdatedAt       time.Time    `json:"updatedAt" gorm:"autoUpdateTime;not null"`
 	ExpiresAt       time.Time    `json:"expiresAt" gorm:"index"`
+	TenantID        string       `json:"tenantId,omitempty" gorm:"type:varchar(64);index"`
+	Region          string       `json:"region,omitempty" gorm:"type:varchar(64);index"`
+	DeactivatedAt   *time.Time   `json:"deactivatedAt"`                            // set when an admin closed the room, as opposed to it expiring
 	AdminID         string       `json:"adminId" gorm:"type:varchar(36);not null"` // Room creator/admin
 	Settings        RoomSettings `json:"settings" gorm:"embedded;embeddedPrefix:settings_"`
+	Metadata        StringMap    `json:"metadata"` // passed to LiveKit as the room metadata
+
+	// JoinerPermissions are granted to everyone who joins other than the creator
+	JoinerPermissions JoinerPermissions `json:"joinerPermissions" gorm:"embedded;embeddedPrefix:joiner_"`
+}
+
+// IsExpired reports whether the room is past its expiry. An expired room can
+// still be marked active until the cleanup job gets to it.
+func (r *Room) IsExpired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// IsJoinable reports whether anyone can join the room or get a token for it,
+// regardless of whether cleanup has caught up with its expiry yet. Approval is
+// per participant and is checked separately.
+func (r *Room) IsJoinable() bool {
+	return r.IsActive && !r.IsExpired()
+}
+
+// JoinerPermissions are the permissions a participant gets on first joining a room
+type JoinerPermissions struct {
+	CanKick         bool `json:"canKick" gorm:"not null;default:false"`
+	CanMuteAudio    bool `json:"canMuteAudio" gorm:"not null;default:false"`
+	CanDisableVideo bool `json:"canDisableVideo" gorm:"not null;default:false"`
+	CanChat         bool `json:"canChat" gorm:"not null;default:true"`
+}
+
+// StringMap is a string map stored as a JSON object
+type StringMap map[string]string
+
+// Scan implements the sql.Scanner interface
+func (m *StringMap) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return errors.New("failed to scan StringMap")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// GormDataType implements the GormDataTypeInterface
+func (StringMap) GormDataType() string {
+	return "text"
+}
+
+// String returns the JSON form sent to LiveKit; empty when there is no metadata
+func (m StringMap) String() string {
+	if len(m) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
 }
 
 // RoomSettings represents the global settings for a room
@@ -21,6 +104,65 @@ type RoomSettings struct {
 	AllowVideo      bool `json:"allowVideo" gorm:"not null;default:true"`
 	AllowAudio      bool `json:"allowAudio" gorm:"not null;default:true"`
 	RequireApproval bool `json:"requireApproval" gorm:"not null;default:false"`
+	KickIdle        bool `json:"kickIdle" gorm:"not null;default:false"` // remove participants idle past rooms.idleKickMinutes
+}
+
+// RoomSettingsInput is RoomSettings as sent by clients. A nil field was omitted
+// and falls back to the server default; an explicit false is kept.
+type RoomSettingsInput struct {
+	AllowChat       *bool `json:"allowChat"`
+	AllowVideo      *bool `json:"allowVideo"`
+	AllowAudio      *bool `json:"allowAudio"`
+	RequireApproval *bool `json:"requireApproval"`
+	KickIdle        *bool `json:"kickIdle"`
+}
+
+// Resolve fills omitted fields from defaults
+func (in RoomSettingsInput) Resolve(defaults RoomSettings) RoomSettings {
+	settings := defaults
+	if in.AllowChat != nil {
+		settings.AllowChat = *in.AllowChat
+	}
+	if in.AllowVideo != nil {
+		settings.AllowVideo = *in.AllowVideo
+	}
+	if in.AllowAudio != nil {
+		settings.AllowAudio = *in.AllowAudio
+	}
+	if in.RequireApproval != nil {
+		settings.RequireApproval = *in.RequireApproval
+	}
+	if in.KickIdle != nil {
+		settings.KickIdle = *in.KickIdle
+	}
+	return settings
+}
+
+// JoinerPermissionsInput is JoinerPermissions as sent by clients. Like
+// RoomSettingsInput, a nil field was omitted and falls back to the server default.
+type JoinerPermissionsInput struct {
+	CanKick         *bool `json:"canKick"`
+	CanMuteAudio    *bool `json:"canMuteAudio"`
+	CanDisableVideo *bool `json:"canDisableVideo"`
+	CanChat         *bool `json:"canChat"`
+}
+
+// Resolve fills omitted fields from defaults
+func (in JoinerPermissionsInput) Resolve(defaults JoinerPermissions) JoinerPermissions {
+	permissions := defaults
+	if in.CanKick != nil {
+		permissions.CanKick = *in.CanKick
+	}
+	if in.CanMuteAudio != nil {
+		permissions.CanMuteAudio = *in.CanMuteAudio
+	}
+	if in.CanDisableVideo != nil {
+		permissions.CanDisableVideo = *in.CanDisableVideo
+	}
+	if in.CanChat != nil {
+		permissions.CanChat = *in.CanChat
+	}
+	return permissions
 }
 
 // RoomParticipant represents a user in a room
@@ -35,16 +177,59 @@ type RoomParticipant struct {
 	IsMuted       bool             `json:"isMuted" gorm:"not null;default:false"`
 	IsVideoOff    bool             `json:"isVideoOff" gorm:"not null;default:false"`
 	IsChatBlocked bool             `json:"isChatBlocked" gorm:"not null;default:false"`
+	SelfMuted     bool             `json:"selfMuted" gorm:"not null;default:false"`    // self-reported; IsMuted is admin-enforced and wins
+	SelfVideoOff  bool             `json:"selfVideoOff" gorm:"not null;default:false"` // self-reported; IsVideoOff is admin-enforced and wins
+	HandRaised    bool             `json:"handRaised" gorm:"not null;default:false"`
+	DisplayName   string           `json:"displayName" gorm:"type:varchar(255)"` // name shown in the room; may be suffixed to keep it unique
 	User          *User            `json:"user" gorm:"foreignKey:UserID"`
 	Room          *Room            `json:"room" gorm:"foreignKey:RoomID"`
 	Permission    *RoomPermissions `json:"permission" gorm:"-"`
+
+	// ChatMutedUntil is set by a timed chat mute; unlike IsChatBlocked it lifts itself
+	ChatMutedUntil *time.Time `json:"chatMutedUntil" gorm:"index"`
+	// LastActiveAt is when the participant last updated their state or refreshed
+	// their token; nil until they do either after joining
+	LastActiveAt *time.Time `json:"lastActiveAt"`
+}
+
+// LastActivity returns when the participant was last seen doing something:
+// joining, updating their state or refreshing their token
+func (p RoomParticipant) LastActivity() time.Time {
+	if p.LastActiveAt != nil && p.LastActiveAt.After(p.JoinedAt) {
+		return *p.LastActiveAt
+	}
+	return p.JoinedAt
+}
+
+// ChatMuted reports whether the participant may not chat right now, either
+// blocked outright or under a timed chat mute that hasn't run out
+func (p RoomParticipant) ChatMuted() bool {
+	return p.IsChatBlocked || (p.ChatMutedUntil != nil && time.Now().Before(*p.ChatMutedUntil))
+}
+
+// ParticipantSession is one join/leave cycle of a participant. RoomParticipant is
+// reused when someone rejoins, so a new session is appended on every join instead.
+type ParticipantSession struct {
+	ID       string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	RoomID   string     `json:"roomId" gorm:"type:varchar(36);not null;index"`
+	UserID   string     `json:"userId" gorm:"type:varchar(36);not null;index"`
+	JoinedAt time.Time  `json:"joinedAt" gorm:"not null"`
+	LeftAt   *time.Time `json:"leftAt"`
+}
+
+// Duration is how long the session lasted, or has lasted so far if it is still open
+func (s ParticipantSession) Duration() time.Duration {
+	if s.LeftAt == nil {
+		return time.Since(s.JoinedAt)
+	}
+	return s.LeftAt.Sub(s.JoinedAt)
 }
 
 // RoomPermissions represents the permissions a participant has in a room
 type RoomPermissions struct {
 	ID              string           `json:"id" gorm:"primaryKey;type:varchar(36)"`
-	RoomID          string           `json:"roomId" gorm:"type:varchar(36);not null;index"`
-	UserID          string           `json:"userId" gorm:"type:varchar(36);not null;index"`
+	RoomID          string           `json:"roomId" gorm:"type:varchar(36);not null;index;uniqueIndex:idx_room_permissions_room_user"`
+	UserID          string           `json:"userId" gorm:"type:varchar(36);not null;index;uniqueIndex:idx_room_permissions_room_user"`
 	IsAdmin         bool             `json:"isAdmin" gorm:"not null;default:false"`
 	CanKick         bool             `json:"canKick" gorm:"not null;default:false"`
 	CanMuteAudio    bool             `json:"canMuteAudio" gorm:"not null;default:false"`
@@ -64,6 +249,10 @@ func (RoomParticipant) TableName() string {
 	return "room_participants"
 }
 
+func (ParticipantSession) TableName() string {
+	return "participant_sessions"
+}
+
 func (RoomPermissions) TableName() string {
 	return "room_permissions"
 }
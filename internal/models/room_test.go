@@ -0,0 +1,200 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestRoomSettingsInputResolve(t *testing.T) {
+	defaults := RoomSettings{AllowChat: true, AllowVideo: true, AllowAudio: true}
+
+	tests := []struct {
+		name string
+		body string
+		want RoomSettings
+	}{
+		{"omitted settings use the defaults", `{}`, defaults},
+		{"null fields use the defaults", `{"allowChat": null}`, defaults},
+		{"explicit false is honoured", `{"allowChat": false, "allowAudio": false}`, RoomSettings{AllowVideo: true}},
+		{"explicit true overrides a false default", `{"requireApproval": true, "kickIdle": true}`,
+			RoomSettings{AllowChat: true, AllowVideo: true, AllowAudio: true, RequireApproval: true, KickIdle: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in RoomSettingsInput
+			if err := json.Unmarshal([]byte(tt.body), &in); err != nil {
+				t.Fatalf("unmarshal %s: %v", tt.body, err)
+			}
+			if got := in.Resolve(defaults); got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoomSettingsInputResolvesEachField(t *testing.T) {
+	defaults := RoomSettings{AllowChat: true, AllowVideo: true, AllowAudio: true}
+	fields := map[string]func(RoomSettings) bool{
+		"allowChat":       func(s RoomSettings) bool { return s.AllowChat },
+		"allowVideo":      func(s RoomSettings) bool { return s.AllowVideo },
+		"allowAudio":      func(s RoomSettings) bool { return s.AllowAudio },
+		"requireApproval": func(s RoomSettings) bool { return s.RequireApproval },
+		"kickIdle":        func(s RoomSettings) bool { return s.KickIdle },
+	}
+
+	for field, get := range fields {
+		for _, value := range []string{"omitted", "true", "false"} {
+			body := `{}`
+			want := get(defaults)
+			if value != "omitted" {
+				body = `{"` + field + `": ` + value + `}`
+				want = value == "true"
+			}
+
+			var in RoomSettingsInput
+			if err := json.Unmarshal([]byte(body), &in); err != nil {
+				t.Fatalf("unmarshal %s: %v", body, err)
+			}
+			got := in.Resolve(defaults)
+			if get(got) != want {
+				t.Errorf("%s %s: Resolve() = %v, want %v", field, value, get(got), want)
+			}
+			for other, getOther := range fields {
+				if other != field && getOther(got) != getOther(defaults) {
+					t.Errorf("%s %s: changed %s too", field, value, other)
+				}
+			}
+		}
+	}
+}
+
+func TestJoinerPermissionsInputResolvesEachField(t *testing.T) {
+	defaults := JoinerPermissions{CanMuteAudio: true, CanChat: true}
+	fields := map[string]func(JoinerPermissions) bool{
+		"canKick":         func(p JoinerPermissions) bool { return p.CanKick },
+		"canMuteAudio":    func(p JoinerPermissions) bool { return p.CanMuteAudio },
+		"canDisableVideo": func(p JoinerPermissions) bool { return p.CanDisableVideo },
+		"canChat":         func(p JoinerPermissions) bool { return p.CanChat },
+	}
+
+	for field, get := range fields {
+		for _, value := range []string{"omitted", "true", "false"} {
+			body := `{}`
+			want := get(defaults)
+			if value != "omitted" {
+				body = `{"` + field + `": ` + value + `}`
+				want = value == "true"
+			}
+
+			var in JoinerPermissionsInput
+			if err := json.Unmarshal([]byte(body), &in); err != nil {
+				t.Fatalf("unmarshal %s: %v", body, err)
+			}
+			got := in.Resolve(defaults)
+			if get(got) != want {
+				t.Errorf("%s %s: Resolve() = %v, want %v", field, value, get(got), want)
+			}
+			for other, getOther := range fields {
+				if other != field && getOther(got) != getOther(defaults) {
+					t.Errorf("%s %s: changed %s too", field, value, other)
+				}
+			}
+		}
+	}
+}
+
+func TestRoomIsJoinable(t *testing.T) {
+	tests := []struct {
+		name      string
+		active    bool
+		expiresAt time.Time
+		want      bool
+	}{
+		{"open", true, time.Now().Add(time.Hour), true},
+		{"expired before cleanup", true, time.Now().Add(-time.Minute), false},
+		{"ended", false, time.Now().Add(time.Hour), false},
+		{"ended and expired", false, time.Now().Add(-time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		room := &Room{IsActive: tt.active, ExpiresAt: tt.expiresAt}
+		if got := room.IsJoinable(); got != tt.want {
+			t.Errorf("%s: IsJoinable() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got, want := room.IsExpired(), tt.expiresAt.Before(time.Now()); got != want {
+			t.Errorf("%s: IsExpired() = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestRoomParticipantChatMuted(t *testing.T) {
+	later := time.Now().Add(time.Minute)
+	earlier := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		participant RoomParticipant
+		want        bool
+	}{
+		{"not muted", RoomParticipant{}, false},
+		{"blocked", RoomParticipant{IsChatBlocked: true}, true},
+		{"timed mute running", RoomParticipant{ChatMutedUntil: &later}, true},
+		{"timed mute run out", RoomParticipant{ChatMutedUntil: &earlier}, false},
+		{"blocked after a timed mute ran out", RoomParticipant{IsChatBlocked: true, ChatMutedUntil: &earlier}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.participant.ChatMuted(); got != tt.want {
+			t.Errorf("%s: ChatMuted() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoomParticipantLastActivity(t *testing.T) {
+	joined := time.Now().Add(-time.Hour)
+	later := joined.Add(time.Minute)
+	earlier := joined.Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		participant RoomParticipant
+		want        time.Time
+	}{
+		{"nothing since joining", RoomParticipant{JoinedAt: joined}, joined},
+		{"active since joining", RoomParticipant{JoinedAt: joined, LastActiveAt: &later}, later},
+		{"active before rejoining", RoomParticipant{JoinedAt: joined, LastActiveAt: &earlier}, joined},
+	}
+
+	for _, tt := range tests {
+		if got := tt.participant.LastActivity(); !got.Equal(tt.want) {
+			t.Errorf("%s: LastActivity() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoomPermissionsAreUniquePerParticipant(t *testing.T) {
+	parsed, err := schema.Parse(&RoomPermissions{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("schema.Parse() = %v", err)
+	}
+
+	index, ok := parsed.ParseIndexes()["idx_room_permissions_room_user"]
+	if !ok {
+		t.Fatal("room_permissions has no idx_room_permissions_room_user index")
+	}
+	if index.Class != "UNIQUE" {
+		t.Errorf("index class = %q, want UNIQUE", index.Class)
+	}
+	var columns []string
+	for _, field := range index.Fields {
+		columns = append(columns, field.DBName)
+	}
+	if len(columns) != 2 || columns[0] != "room_id" || columns[1] != "user_id" {
+		t.Errorf("index columns = %v, want [room_id user_id]", columns)
+	}
+}
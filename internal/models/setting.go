@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Keys of runtime settings shared by every server instance
+const (
+	SettingMaintenanceMode = "maintenance_mode"
+
+	// SettingRoomCapacitiesBackfilled records that the one-off room capacity
+	// migration has run
+	SettingRoomCapacitiesBackfilled = "room_capacities_backfilled"
+)
+
+// SystemSetting is a runtime setting changed through the admin API. Keeping it
+// in the database lets every instance behind a load balancer see the change.
+type SystemSetting struct {
+	Key       string    `gorm:"primaryKey;type:varchar(64)"`
+	Value     string    `gorm:"type:text;not null"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null"`
+}
+
+// TableName specifies the table name for GORM
+func (SystemSetting) TableName() string {
+	return "system_settings"
+}
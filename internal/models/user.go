@@ -10,12 +10,22 @@ import (
 type AccessLevel string
 
 const (
-	AccessAdmin AccessLevel = "admin"
-	AccessMod   AccessLevel = "moderator"
-	AccessUser  AccessLevel = "user"
-	AccessGuest AccessLevel = "guest"
+	AccessSuperAdmin AccessLevel = "superadmin"
+	AccessAdmin      AccessLevel = "admin"
+	AccessMod        AccessLevel = "moderator"
+	AccessUser       AccessLevel = "user"
+	AccessGuest      AccessLevel = "guest"
 )
 
+// IsValidAccessLevel reports whether s names a known access level
+func IsValidAccessLevel(s string) bool {
+	switch AccessLevel(s) {
+	case AccessSuperAdmin, AccessAdmin, AccessMod, AccessUser, AccessGuest:
+		return true
+	}
+	return false
+}
+
 // StringArray is a custom type for handling string arrays in PostgreSQL
 type StringArray []string
 
@@ -66,17 +76,21 @@ func (StringArray) GormDataType() string {
 }
 
 type User struct {
-	ID           string      `json:"id" gorm:"primaryKey;type:varchar(36)"`
-	Email        string      `json:"email" gorm:"uniqueIndex;not null;type:varchar(255)"`
-	Name         string      `json:"name" gorm:"not null;type:varchar(255)"`
-	Provider     string      `json:"provider" gorm:"not null;type:varchar(50);index"`
-	AvatarURL    string      `json:"avatarUrl" gorm:"column:avatar_url;type:varchar(255)"`
-	Password     string      `json:"-" gorm:"type:varchar(255)"`
-	RefreshToken string      `json:"-" gorm:"column:refresh_token;type:text"`
-	Accesses     StringArray `json:"accesses" gorm:"type:text[]"`
-	IsActive     bool        `json:"isActive" gorm:"not null;default:true"`
-	CreatedAt    time.Time   `json:"createdAt" gorm:"autoCreateTime;not null"`
-	UpdatedAt    time.Time   `json:"updatedAt" gorm:"autoUpdateTime;not null"`
+	ID             string      `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	Email          string      `json:"email" gorm:"uniqueIndex;not null;type:varchar(255)"`
+	Name           string      `json:"name" gorm:"not null;type:varchar(255)"`
+	Provider       string      `json:"provider" gorm:"not null;type:varchar(50);index;index:idx_provider_user"`
+	ProviderUserID string      `json:"-" gorm:"column:provider_user_id;type:varchar(255);index:idx_provider_user"` // ID at the OAuth provider, empty for local users
+	AvatarURL      string      `json:"avatarUrl" gorm:"column:avatar_url;type:varchar(255)"`
+	Password       string      `json:"-" gorm:"type:varchar(255)"`
+	RefreshToken   string      `json:"-" gorm:"column:refresh_token;type:text"`
+	Accesses       StringArray `json:"accesses" gorm:"type:text[]"`
+	IsActive       bool        `json:"isActive" gorm:"not null;default:true"`
+	TenantID       string      `json:"tenantId,omitempty" gorm:"type:varchar(64);index"` // empty in single-tenant deployments
+	EmailVerified  bool        `json:"emailVerified" gorm:"not null;default:false"`      // the OAuth provider vouched for the email on the last login
+	MaxSessions    *int        `json:"maxSessions,omitempty"`                            // overrides auth.maxSessions when set; 0 means no limit
+	CreatedAt      time.Time   `json:"createdAt" gorm:"autoCreateTime;not null"`
+	UpdatedAt      time.Time   `json:"updatedAt" gorm:"autoUpdateTime;not null"`
 }
 
 // TableName specifies the table name for GORM
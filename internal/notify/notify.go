@@ -0,0 +1,46 @@
+// Package notify provides outbound user notifications such as email.
+package notify
+
+import (
+	"bedrud-backend/config"
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Notifier sends a templated message to a single recipient
+type Notifier interface {
+	Send(ctx context.Context, to, template string, data map[string]interface{}) error
+}
+
+// New returns an SMTP notifier when SMTP is configured, otherwise a logging no-op notifier
+func New(cfg *config.SMTPConfig) Notifier {
+	if cfg == nil || cfg.Host == "" {
+		log.Info().Msg("SMTP not configured, using log notifier")
+		return NewLogNotifier()
+	}
+	return NewSMTPNotifier(cfg)
+}
+
+// LogNotifier renders messages and writes them to the log instead of sending them
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+// Send renders the template and logs the result
+func (n *LogNotifier) Send(ctx context.Context, to, template string, data map[string]interface{}) error {
+	subject, body, err := Render(template, data)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().
+		Str("to", to).
+		Str("template", template).
+		Str("subject", subject).
+		Str("body", body).
+		Msg("Notification not sent (log notifier)")
+	return nil
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bedrud-backend/config"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		data        map[string]interface{}
+		wantSubject string
+		wantBody    []string
+		dontWant    string
+	}{
+		{
+			name:        "password reset",
+			template:    TemplatePasswordReset,
+			data:        map[string]interface{}{"Name": "Ann", "Link": "https://bedrud.example/reset?t=abc"},
+			wantSubject: "Reset your Bedrud password",
+			wantBody:    []string{"Hi Ann,", "https://bedrud.example/reset?t=abc"},
+		},
+		{
+			name:        "email verification",
+			template:    TemplateEmailVerification,
+			data:        map[string]interface{}{"Name": "Ann", "Link": "https://bedrud.example/verify?t=abc"},
+			wantSubject: "Verify your Bedrud email address",
+			wantBody:    []string{"Hi Ann,", "https://bedrud.example/verify?t=abc"},
+		},
+		{
+			name:        "ban with a reason",
+			template:    TemplateAccountBanned,
+			data:        map[string]interface{}{"Name": "Ann", "Reason": "spam"},
+			wantSubject: "Your Bedrud account has been suspended",
+			wantBody:    []string{"Hi Ann,", "Reason: spam"},
+		},
+		{
+			name:        "ban without a reason",
+			template:    TemplateAccountBanned,
+			data:        map[string]interface{}{"Name": "Ann"},
+			wantSubject: "Your Bedrud account has been suspended",
+			wantBody:    []string{"Hi Ann,"},
+			dontWant:    "Reason:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, err := Render(tt.template, tt.data)
+			if err != nil {
+				t.Fatalf("Render() = %v", err)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", subject, tt.wantSubject)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("body %q doesn't contain %q", body, want)
+				}
+			}
+			if tt.dontWant != "" && strings.Contains(body, tt.dontWant) {
+				t.Errorf("body %q contains %q", body, tt.dontWant)
+			}
+		})
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, _, err := Render("no_such_template", nil); err == nil {
+		t.Error("Render() of an unknown template succeeded")
+	}
+}
+
+func TestNewWithoutSMTPUsesLogNotifier(t *testing.T) {
+	for name, cfg := range map[string]*config.SMTPConfig{
+		"no config":  nil,
+		"empty host": {Port: "587", From: "noreply@bedrud.example"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			notifier := New(cfg)
+			if _, ok := notifier.(*LogNotifier); !ok {
+				t.Fatalf("New() = %T, want *LogNotifier", notifier)
+			}
+			if err := notifier.Send(context.Background(), "ann@example.com", TemplatePasswordReset, map[string]interface{}{"Name": "Ann"}); err != nil {
+				t.Errorf("Send() = %v", err)
+			}
+		})
+	}
+}
+
+func TestNewWithSMTPUsesSMTPNotifier(t *testing.T) {
+	notifier := New(&config.SMTPConfig{Host: "smtp.example.com", Port: "587"})
+	if _, ok := notifier.(*SMTPNotifier); !ok {
+		t.Fatalf("New() = %T, want *SMTPNotifier", notifier)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	msg := string(buildMessage("noreply@bedrud.example", "ann@example.com", "Hello", "Body text\n"))
+
+	headers, body, ok := strings.Cut(msg, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message %q has no header/body separator", msg)
+	}
+	for _, want := range []string{"From: noreply@bedrud.example", "To: ann@example.com", "Subject: Hello"} {
+		if !strings.Contains(headers, want+"\r\n") {
+			t.Errorf("headers %q don't contain %q", headers, want)
+		}
+	}
+	if body != "Body text\n" {
+		t.Errorf("body = %q, want %q", body, "Body text\n")
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// Template names understood by Render
+const (
+	TemplatePasswordReset     = "password_reset"
+	TemplateEmailVerification = "email_verification"
+	TemplateAccountBanned     = "account_banned"
+)
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var templates = map[string]messageTemplate{
+	TemplatePasswordReset: newMessageTemplate(
+		"Reset your Bedrud password",
+		"Hi {{.Name}},\n\nUse the link below to reset your password:\n\n{{.Link}}\n\nIf you did not request this, you can ignore this email.\n",
+	),
+	TemplateEmailVerification: newMessageTemplate(
+		"Verify your Bedrud email address",
+		"Hi {{.Name}},\n\nPlease confirm your email address by opening the link below:\n\n{{.Link}}\n",
+	),
+	TemplateAccountBanned: newMessageTemplate(
+		"Your Bedrud account has been suspended",
+		"Hi {{.Name}},\n\nYour account has been suspended.{{if .Reason}}\n\nReason: {{.Reason}}{{end}}\n",
+	),
+}
+
+func newMessageTemplate(subject, body string) messageTemplate {
+	return messageTemplate{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+// Render executes the named template and returns the subject and body
+func Render(name string, data map[string]interface{}) (string, string, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown notification template: %s", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("failed to render subject: %w", err)
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("failed to render body: %w", err)
+	}
+
+	return subject.String(), body.String(), nil
+}
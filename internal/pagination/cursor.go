@@ -0,0 +1,93 @@
+// Package pagination provides keyset (cursor) pagination over (created_at, id)
+// and the metadata reported by offset-paginated lists.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultLimit and MaxLimit bound the page size accepted from clients
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrInvalidCursor is returned when a cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor identifies the last row of a page. Rows are ordered newest first by
+// created_at, with id breaking ties, so the next page starts strictly after it.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque string handed to clients as nextCursor
+func (c Cursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor previously returned by Encode. An empty string
+// means the first page and yields a nil cursor.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: createdAt, ID: parts[1]}, nil
+}
+
+// ClampLimit applies the default and maximum page size
+func ClampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
+
+// Keyset returns a scope selecting the page after cursor. It fetches one extra
+// row so Page can tell whether another page follows.
+func Keyset(cursor *Cursor, limit int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cursor != nil {
+			db = db.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+		return db.Order("created_at DESC").Order("id DESC").Limit(limit + 1)
+	}
+}
+
+// Page trims the extra row fetched by Keyset and returns the cursor for the
+// next page, or an empty string on the last page
+func Page[T any](rows []T, limit int, key func(T) (time.Time, string)) ([]T, string) {
+	if len(rows) <= limit {
+		return rows, ""
+	}
+
+	rows = rows[:limit]
+	createdAt, id := key(rows[len(rows)-1])
+	return rows, Cursor{CreatedAt: createdAt, ID: id}.Encode()
+}
@@ -0,0 +1,143 @@
+package pagination
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+type item struct {
+	ID        string
+	CreatedAt time.Time
+}
+
+func itemKey(i item) (time.Time, string) { return i.CreatedAt, i.ID }
+
+// seedItems returns n items, three to a timestamp so page boundaries fall
+// between rows created at the same instant
+func seedItems(n int) []item {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	items := make([]item, n)
+	for i := range items {
+		items[i] = item{ID: fmt.Sprintf("item-%02d", i), CreatedAt: base.Add(time.Duration(i/3) * time.Second)}
+	}
+	return items
+}
+
+// keysetAnswer plays the database for Keyset over items: newest first, after
+// the cursor in the statement's arguments, limit+1 rows
+func keysetAnswer(items []item, limit int) dbtest.Answer {
+	sorted := append([]item(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool { return before(sorted[j], sorted[i]) })
+
+	return func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		var after *item
+		if len(stmt.Args) >= 2 {
+			createdAt, _ := stmt.Args[0].(time.Time)
+			id, _ := stmt.Args[1].(string)
+			after = &item{ID: id, CreatedAt: createdAt}
+		}
+
+		result := &dbtest.Result{Columns: []string{"id", "created_at"}}
+		for _, it := range sorted {
+			if after != nil && !before(it, *after) {
+				continue
+			}
+			if len(result.Rows) == limit+1 {
+				break
+			}
+			result.Rows = append(result.Rows, []interface{}{it.ID, it.CreatedAt})
+		}
+		return result, nil
+	}
+}
+
+// before reports whether (a.CreatedAt, a.ID) < (b.CreatedAt, b.ID)
+func before(a, b item) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+func TestPagingVisitsEveryRowOnce(t *testing.T) {
+	for _, limit := range []int{1, 2, 3, 4, 7, 23, 50} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			items := seedItems(23)
+			db, _ := dbtest.Open(t, keysetAnswer(items, limit))
+
+			seen := map[string]int{}
+			next := ""
+			for pages := 0; ; pages++ {
+				if pages > len(items) {
+					t.Fatal("paging didn't end")
+				}
+				cursor, err := DecodeCursor(next)
+				if err != nil {
+					t.Fatalf("DecodeCursor(%q) = %v", next, err)
+				}
+
+				var rows []item
+				if err := db.Table("items").Scopes(Keyset(cursor, limit)).Find(&rows).Error; err != nil {
+					t.Fatalf("query page: %v", err)
+				}
+				var page []item
+				page, next = Page(rows, limit, itemKey)
+				if len(page) > limit {
+					t.Fatalf("page has %d rows, want at most %d", len(page), limit)
+				}
+				for _, it := range page {
+					seen[it.ID]++
+				}
+				if next == "" {
+					break
+				}
+			}
+
+			if len(seen) != len(items) {
+				t.Errorf("visited %d rows, want %d", len(seen), len(items))
+			}
+			for id, count := range seen {
+				if count != 1 {
+					t.Errorf("visited %s %d times", id, count)
+				}
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC), ID: "a|b"}
+
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor() = %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("DecodeCursor(Encode()) = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	if cursor, err := DecodeCursor(""); cursor != nil || err != nil {
+		t.Errorf(`DecodeCursor("") = %v, %v, want the first page`, cursor, err)
+	}
+
+	for _, s := range []string{"not base64!", "bm8tc2VwYXJhdG9y", "MjAyNC0wNS0wMXw", "eWVzdGVyZGF5fGlk"} {
+		if _, err := DecodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestClampLimit(t *testing.T) {
+	tests := map[int]int{-1: DefaultLimit, 0: DefaultLimit, 10: 10, MaxLimit: MaxLimit, MaxLimit + 1: MaxLimit}
+	for limit, want := range tests {
+		if got := ClampLimit(limit); got != want {
+			t.Errorf("ClampLimit(%d) = %d, want %d", limit, got, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package pagination
+
+// Meta describes one page of an offset-paginated list. List responses embed it
+// so every endpoint reports its position the same way.
+type Meta struct {
+	Total      int64 `json:"total"`
+	Page       int   `json:"page"`
+	PageSize   int   `json:"pageSize"`
+	TotalPages int   `json:"totalPages"`
+	HasNext    bool  `json:"hasNext"`
+}
+
+// NewMeta computes the metadata for a page, counting pages from 1
+func NewMeta(total int64, page, pageSize int) Meta {
+	meta := Meta{Total: total, Page: page, PageSize: pageSize}
+	if pageSize > 0 {
+		meta.TotalPages = int((total + int64(pageSize) - 1) / int64(pageSize))
+	}
+	meta.HasNext = page < meta.TotalPages
+	return meta
+}
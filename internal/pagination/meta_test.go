@@ -0,0 +1,48 @@
+package pagination
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewMeta(t *testing.T) {
+	tests := []struct {
+		total          int64
+		page, pageSize int
+		wantPages      int
+		wantNext       bool
+	}{
+		{0, 1, 20, 0, false},
+		{1, 1, 20, 1, false},
+		{20, 1, 20, 1, false},
+		{21, 1, 20, 2, true},
+		{21, 2, 20, 2, false},
+		{100, 3, 25, 4, true},
+		{100, 5, 25, 4, false},
+		{10, 1, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		got := NewMeta(tt.total, tt.page, tt.pageSize)
+		want := Meta{Total: tt.total, Page: tt.page, PageSize: tt.pageSize, TotalPages: tt.wantPages, HasNext: tt.wantNext}
+		if got != want {
+			t.Errorf("NewMeta(%d, %d, %d) = %+v, want %+v", tt.total, tt.page, tt.pageSize, got, want)
+		}
+	}
+}
+
+func TestMetaIsFlattenedIntoResponses(t *testing.T) {
+	response := struct {
+		Items []string `json:"items"`
+		Meta
+	}{Items: []string{"a"}, Meta: NewMeta(3, 1, 2)}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	want := `{"items":["a"],"total":3,"page":1,"pageSize":2,"totalPages":2,"hasNext":true}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,143 @@
+// Package realtime fans out server events to connected WebSocket clients.
+package realtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Event types published by the handlers
+const (
+	EventRoomCreated       = "room.created"
+	EventParticipantJoined = "participant.joined"
+	EventRoomEnded         = "room.ended"
+	EventParticipantState  = "participant.state"
+	EventParticipantLeft   = "participant.left"
+)
+
+// clientBuffer is how many events a slow client may fall behind before events are dropped for it
+const clientBuffer = 64
+
+// ErrHubClosed is returned when subscribing after Shutdown has started
+var ErrHubClosed = errors.New("realtime hub is shut down")
+
+// Event is a single notification pushed to subscribers
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+	Time time.Time   `json:"time"`
+}
+
+// Client is a subscription to the hub's events
+type Client struct {
+	events   chan Event
+	shutdown <-chan struct{}
+}
+
+// Events returns the channel the client's events are delivered on
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Shutdown is closed when the hub shuts down; the client should say goodbye
+// to its connection and unsubscribe
+func (c *Client) Shutdown() <-chan struct{} {
+	return c.shutdown
+}
+
+// Hub keeps track of subscribers and broadcasts events to them
+type Hub struct {
+	mu       sync.RWMutex
+	clients  map[*Client]struct{}
+	closed   bool
+	shutdown chan struct{}
+	drained  sync.WaitGroup // one per subscribed client
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients:  make(map[*Client]struct{}),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Subscribe registers a new client
+func (h *Hub) Subscribe() (*Client, error) {
+	client := &Client{events: make(chan Event, clientBuffer), shutdown: h.shutdown}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+	h.clients[client] = struct{}{}
+	h.drained.Add(1)
+
+	return client, nil
+}
+
+// Unsubscribe removes a client and closes its event channel
+func (h *Hub) Unsubscribe(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.events)
+		h.drained.Done()
+	}
+}
+
+// Shutdown stops accepting subscribers, tells every client to close its
+// connection and waits until all of them have unsubscribed or ctx ends
+func (h *Hub) Shutdown(ctx context.Context) error {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.shutdown)
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.drained.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Publish sends an event to every client without blocking. Clients whose
+// buffer is full miss the event.
+func (h *Hub) Publish(eventType string, data interface{}) {
+	if h == nil {
+		return
+	}
+
+	event := Event{Type: eventType, Data: data, Time: time.Now()}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients {
+		select {
+		case client.events <- event:
+		default:
+			log.Warn().Str("type", eventType).Msg("Dropping realtime event for slow client")
+		}
+	}
+}
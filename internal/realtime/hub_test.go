@@ -0,0 +1,99 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPublish(t *testing.T) {
+	hub := NewHub()
+	a, err := hub.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	b, err := hub.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	hub.Unsubscribe(b)
+
+	hub.Publish(EventRoomCreated, map[string]string{"roomId": "r1"})
+
+	select {
+	case event := <-a.Events():
+		if event.Type != EventRoomCreated {
+			t.Errorf("event type = %q, want %q", event.Type, EventRoomCreated)
+		}
+	default:
+		t.Error("the subscribed client got no event")
+	}
+	if _, ok := <-b.Events(); ok {
+		t.Error("an unsubscribed client got an event")
+	}
+
+	// Slow clients lose events instead of blocking the publisher
+	for i := 0; i < clientBuffer+10; i++ {
+		hub.Publish(EventParticipantJoined, nil)
+	}
+	if len(a.Events()) != clientBuffer {
+		t.Errorf("%d events buffered, want %d", len(a.Events()), clientBuffer)
+	}
+
+	var nilHub *Hub
+	nilHub.Publish(EventRoomEnded, nil)
+}
+
+func TestShutdownWaitsForClients(t *testing.T) {
+	hub := NewHub()
+	var unsubscribed []*Client
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		client, err := hub.Subscribe()
+		if err != nil {
+			t.Fatalf("Subscribe() = %v", err)
+		}
+		// Each client plays a connection's loop: it says goodbye on shutdown
+		go func() {
+			<-client.Shutdown()
+			time.Sleep(5 * time.Millisecond)
+			hub.Unsubscribe(client)
+			done <- struct{}{}
+		}()
+		unsubscribed = append(unsubscribed, client)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	for range unsubscribed {
+		select {
+		case <-done:
+		default:
+			t.Fatal("Shutdown returned before every client unsubscribed")
+		}
+	}
+
+	if _, err := hub.Subscribe(); !errors.Is(err, ErrHubClosed) {
+		t.Errorf("Subscribe() after Shutdown = %v, want ErrHubClosed", err)
+	}
+	if err := hub.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown() = %v", err)
+	}
+}
+
+func TestShutdownGivesUpOnStuckClients(t *testing.T) {
+	hub := NewHub()
+	if _, err := hub.Subscribe(); err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := hub.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/pagination"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// AuditFilter narrows an audit log listing; empty fields don't filter
+type AuditFilter struct {
+	ActorID    string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Record stores an audit entry. details may be nil. Every failure is logged at
+// error level, so callers that can carry on without the entry may ignore the
+// error; security-relevant actions must fail instead, ideally by recording
+// through TxRepos in the transaction that makes the change.
+func (r *AuditRepository) Record(actorID, action, targetType, targetID string, details map[string]interface{}) error {
+	entry := &models.AuditLog{
+		ID:         uuid.New().String(),
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+
+	err := func() error {
+		if len(details) > 0 {
+			data, err := json.Marshal(details)
+			if err != nil {
+				return err
+			}
+			entry.Details = string(data)
+		}
+		return r.db.Create(entry).Error
+	}()
+	if err != nil {
+		log.Error().Err(err).
+			Str("action", action).
+			Str("actorId", actorID).
+			Str("targetType", targetType).
+			Str("targetId", targetID).
+			Msg("Failed to record audit entry")
+		return err
+	}
+	return nil
+}
+
+// ListPage returns one page of the entries matching the filter, newest first
+func (r *AuditRepository) ListPage(filter AuditFilter, cursor *pagination.Cursor, limit int) ([]models.AuditLog, string, error) {
+	query := r.db.Model(&models.AuditLog{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+
+	var entries []models.AuditLog
+	if err := query.Scopes(pagination.Keyset(cursor, limit)).Find(&entries).Error; err != nil {
+		return nil, "", err
+	}
+
+	entries, next := pagination.Page(entries, limit, func(e models.AuditLog) (time.Time, string) {
+		return e.CreatedAt, e.ID
+	})
+	return entries, next, nil
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// auditTrail plays the audit_logs table, applying the listing's filters in the
+// order ListPage adds them. Entries are newest first.
+type auditTrail struct {
+	entries []auditEntry
+}
+
+type auditEntry struct {
+	id, actorID, targetType, targetID string
+	createdAt                         time.Time
+}
+
+func (a *auditTrail) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	if !stmt.Is("SELECT") || !stmt.Mentions(`"audit_logs"`) {
+		return &dbtest.Result{Affected: 1}, nil
+	}
+
+	args := stmt.Args
+	next := func() interface{} {
+		arg := args[0]
+		args = args[1:]
+		return arg
+	}
+	var keep []func(auditEntry) bool
+	if stmt.Mentions("actor_id =") {
+		actor := next()
+		keep = append(keep, func(e auditEntry) bool { return e.actorID == actor })
+	}
+	if stmt.Mentions("target_type =") {
+		targetType := next()
+		keep = append(keep, func(e auditEntry) bool { return e.targetType == targetType })
+	}
+	if stmt.Mentions("target_id =") {
+		targetID := next()
+		keep = append(keep, func(e auditEntry) bool { return e.targetID == targetID })
+	}
+	if stmt.Mentions("created_at >=") {
+		from := next().(time.Time)
+		keep = append(keep, func(e auditEntry) bool { return !e.createdAt.Before(from) })
+	}
+	if stmt.Mentions("created_at <=") {
+		to := next().(time.Time)
+		keep = append(keep, func(e auditEntry) bool { return !e.createdAt.After(to) })
+	}
+
+	result := &dbtest.Result{Columns: []string{"id", "actor_id", "action", "target_type", "target_id", "created_at"}}
+entries:
+	for _, e := range a.entries {
+		for _, ok := range keep {
+			if !ok(e) {
+				continue entries
+			}
+		}
+		result.Rows = append(result.Rows, []interface{}{e.id, e.actorID, "room.ended", e.targetType, e.targetID, e.createdAt})
+	}
+	return result, nil
+}
+
+func TestAuditListPageFilters(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	trail := &auditTrail{entries: []auditEntry{
+		{"e6", "a1", "room", "r1", now},
+		{"e5", "a2", "room", "r1", now.Add(-time.Hour)},
+		{"e4", "a1", "room", "r2", now.Add(-2 * time.Hour)},
+		{"e3", "a1", "user", "r1", now.Add(-3 * time.Hour)}, // a user whose ID looks like a room's
+		{"e2", "a2", "user", "u1", now.Add(-4 * time.Hour)},
+		{"e1", "a1", "room", "r1", now.Add(-48 * time.Hour)},
+	}}
+	from := now.Add(-24 * time.Hour)
+	to := now.Add(-30 * time.Minute)
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []string
+	}{
+		{"no filter", AuditFilter{}, []string{"e6", "e5", "e4", "e3", "e2", "e1"}},
+		{"one room", AuditFilter{TargetType: "room", TargetID: "r1"}, []string{"e6", "e5", "e1"}},
+		{"one user", AuditFilter{TargetType: "user", TargetID: "u1"}, []string{"e2"}},
+		{"every room", AuditFilter{TargetType: "room"}, []string{"e6", "e5", "e4", "e1"}},
+		{"actor and room", AuditFilter{ActorID: "a1", TargetType: "room", TargetID: "r1"}, []string{"e6", "e1"}},
+		{"actor, room and time range", AuditFilter{ActorID: "a1", TargetType: "room", TargetID: "r1", From: &from}, []string{"e6"}},
+		{"room and time range", AuditFilter{TargetType: "room", TargetID: "r1", From: &from, To: &to}, []string{"e5"}},
+	}
+
+	for _, tt := range tests {
+		db, _ := dbtest.Open(t, trail.answer)
+
+		entries, next, err := NewAuditRepository(db).ListPage(tt.filter, nil, 50)
+		if err != nil {
+			t.Fatalf("%s: ListPage() = %v", tt.name, err)
+		}
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) || next != "" {
+			t.Errorf("%s: entries = %v (next %q), want %v", tt.name, ids, next, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"bedrud-backend/internal/database"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Errors returned by repository writes, and by lookups that don't report a
+// missing row as nil. The database error they were mapped from stays in the
+// chain, so errors.Is works for both.
+var (
+	// ErrNotFound means the row to read or change doesn't exist
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict means a unique constraint rejected the write
+	ErrConflict = errors.New("record already exists")
+	// ErrForeignKey means the write referenced a row that doesn't exist, or
+	// would leave rows referencing one that doesn't
+	ErrForeignKey = errors.New("record references a missing row")
+)
+
+// wrapError maps GORM and driver errors onto the repository errors. Errors it
+// doesn't recognise are returned unchanged.
+func wrapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, gorm.ErrDuplicatedKey) || database.IsUniqueViolation(err):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, gorm.ErrForeignKeyViolated) || database.IsForeignKeyViolation(err):
+		return fmt.Errorf("%w: %w", ErrForeignKey, err)
+	}
+	return err
+}
+
+// affected wraps the error of a write aimed at one row, reporting ErrNotFound
+// when the row doesn't exist
+func affected(result *gorm.DB) error {
+	if result.Error != nil {
+		return wrapError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
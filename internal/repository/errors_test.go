@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func TestWrapError(t *testing.T) {
+	other := errors.New("connection reset")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"record not found", gorm.ErrRecordNotFound, ErrNotFound},
+		{"duplicated key", gorm.ErrDuplicatedKey, ErrConflict},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, ErrConflict},
+		{"wrapped unique violation", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), ErrConflict},
+		{"foreign key violated", gorm.ErrForeignKeyViolated, ErrForeignKey},
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, ErrForeignKey},
+		{"other errors pass through", other, other},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapError(tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("wrapError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("wrapError(%v) = %v, lost the original error", tt.err, got)
+			}
+		})
+	}
+
+	if err := wrapError(nil); err != nil {
+		t.Errorf("wrapError(nil) = %v, want nil", err)
+	}
+}
+
+func TestCreateUserDuplicateIsConflict(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("INSERT") {
+			return nil, &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+		}
+		return nil, nil
+	})
+
+	err := NewUserRepository(db).CreateUser(&models.User{ID: "u1", Email: "a@example.com"})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("CreateUser() = %v, want ErrConflict", err)
+	}
+}
+
+func TestLockUserMissingRowIsNotFound(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Columns: []string{"id"}}, nil
+	})
+
+	err := NewUserRepository(db).LockUser("missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("LockUser() = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdatePasswordMissingRowIsNotFound(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Affected: 0}, nil
+	})
+
+	err := NewUserRepository(db).UpdatePassword("missing", "hash")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdatePassword() = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdatePasswordExistingRow(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	if err := NewUserRepository(db).UpdatePassword("u1", "hash"); err != nil {
+		t.Fatalf("UpdatePassword() = %v, want nil", err)
+	}
+}
+
+func TestCreateRoomDuplicateIsConflict(t *testing.T) {
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("INSERT") && stmt.Mentions(`"rooms"`) {
+			return nil, &pgconn.PgError{Code: "23505", ConstraintName: "idx_rooms_name"}
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	_, err := NewRoomRepository(db).CreateRoom(CreateRoomParams{CreatedBy: "u1", Name: "standup"})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("CreateRoom() = %v, want ErrConflict", err)
+	}
+	if inserts := fake.Find("INSERT", `"room_permissions"`); len(inserts) != 0 {
+		t.Errorf("wrote %d permission rows for a room that wasn't created", len(inserts))
+	}
+}
+
+func TestRoomWritesToMissingRowsAreNotFound(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Columns: []string{"id"}, Affected: 0}, nil
+	})
+	repo := NewRoomRepository(db)
+
+	writes := map[string]func() error{
+		"LockRoom":           func() error { return repo.LockRoom("missing") },
+		"DeactivateRoom":     func() error { return repo.DeactivateRoom("missing") },
+		"UpdateRoomMetadata": func() error { return repo.UpdateRoomMetadata("missing", models.StringMap{"topic": "retro"}) },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s() = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestAddParticipantToDeletedRoomIsForeignKey(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("INSERT") && stmt.Mentions(`"room_participants"`) {
+			return nil, &pgconn.PgError{Code: "23503", ConstraintName: "fk_rooms_participants"}
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	err := NewRoomRepository(db).AddParticipant("deleted", "u1", "Ann", models.JoinerPermissions{})
+	if !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("AddParticipant() = %v, want ErrForeignKey", err)
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"bedrud-backend/internal/database"
+	"bedrud-backend/internal/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitStore keeps rate-limiter counters in the database. It satisfies
+// fiber.Storage, so it can back Fiber's limiter middleware.
+type RateLimitStore struct {
+	db *gorm.DB
+}
+
+func NewRateLimitStore(db *gorm.DB) *RateLimitStore {
+	return &RateLimitStore{db: db}
+}
+
+// Get returns the stored value, or nil if the key is missing or expired. It
+// reads the primary, since a lagging replica would undercount recent hits.
+func (s *RateLimitStore) Get(key string) ([]byte, error) {
+	var entry models.RateLimitEntry
+	err := database.Primary(s.db).Where("key = ? AND (expires_at IS NULL OR expires_at > ?)", key, time.Now()).
+		First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry.Value, nil
+}
+
+// Set stores a value; a zero exp means it never expires
+func (s *RateLimitStore) Set(key string, val []byte, exp time.Duration) error {
+	entry := &models.RateLimitEntry{
+		Key:   key,
+		Value: val,
+	}
+	if exp > 0 {
+		expiresAt := time.Now().Add(exp)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at"}),
+	}).Create(entry).Error
+}
+
+// Delete removes a key
+func (s *RateLimitStore) Delete(key string) error {
+	return s.db.Delete(&models.RateLimitEntry{}, "key = ?", key).Error
+}
+
+// Reset removes every counter
+func (s *RateLimitStore) Reset() error {
+	return s.db.Where("1 = 1").Delete(&models.RateLimitEntry{}).Error
+}
+
+// Close is a no-op; the connection belongs to the database package
+func (s *RateLimitStore) Close() error {
+	return nil
+}
+
+// DeleteExpired removes counters whose window has passed
+func (s *RateLimitStore) DeleteExpired() error {
+	return s.db.Where("expires_at < ?", time.Now()).Delete(&models.RateLimitEntry{}).Error
+}
@@ -1,14 +1,24 @@
 package repository
 
 import (
+	"bedrud-backend/internal/database"
 	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/pagination"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrLastRoomAdmin is returned when a change would leave a room without any admin
+var ErrLastRoomAdmin = errors.New("a room must keep at least one admin")
+
+// RoomLifetime is how long a room stays joinable after it is created or reactivated
+const RoomLifetime = 24 * time.Hour
+
 type RoomRepository struct {
 	db *gorm.DB
 }
@@ -17,31 +27,75 @@ func NewRoomRepository(db *gorm.DB) *RoomRepository {
 	return &RoomRepository{db: db}
 }
 
+// CreateRoomParams describes a room to create. Zero values mean: no tenant,
+// no region, no metadata, the default RoomLifetime and DefaultMaxParticipants.
+type CreateRoomParams struct {
+	CreatedBy       string
+	TenantID        string
+	Name            string
+	Settings        models.RoomSettings
+	Joiner          models.JoinerPermissions
+	Metadata        models.StringMap
+	Region          string
+	Lifetime        time.Duration
+	MaxParticipants int
+}
+
 // CreateRoom creates a new room with default admin permissions for creator
-func (r *RoomRepository) CreateRoom(createdBy string, name string, settings models.RoomSettings) (*models.Room, error) {
+func (r *RoomRepository) CreateRoom(params CreateRoomParams) (*models.Room, error) {
+	return r.CreateRoomProvisioned(params, nil)
+}
+
+// CreateRoomProvisioned creates a room like CreateRoom and runs provision inside the
+// same transaction once the rows exist; if provision fails nothing is committed.
+func (r *RoomRepository) CreateRoomProvisioned(params CreateRoomParams, provision func(*models.Room) error) (*models.Room, error) {
 	var room *models.Room
+	lifetime := params.Lifetime
+	if lifetime <= 0 {
+		lifetime = RoomLifetime
+	}
+	maxParticipants := params.MaxParticipants
+	if maxParticipants <= 0 {
+		maxParticipants = models.DefaultMaxParticipants
+	}
 
 	err := r.db.Transaction(func(tx *gorm.DB) error {
 		// Create room first
 		newRoom := &models.Room{
 			ID:        uuid.New().String(),
-			Name:      name,
-			CreatedBy: createdBy,
-			AdminID:   createdBy,
+			Name:      params.Name,
+			CreatedBy: params.CreatedBy,
+			AdminID:   params.CreatedBy,
+			TenantID:  params.TenantID,
+			Region:    params.Region,
 			IsActive:  true,
-			Settings:  settings,
-			ExpiresAt: time.Now().Add(24 * time.Hour),
+			Settings:  params.Settings,
+			Metadata:  params.Metadata,
+			ExpiresAt: time.Now().Add(lifetime),
+
+			JoinerPermissions: params.Joiner,
+			MaxParticipants:   maxParticipants,
 		}
 
 		if err := tx.Create(newRoom).Error; err != nil {
 			return err
 		}
+		// Creating from a struct writes a column's default in place of a false
+		// value, so the switches that default to true are written again as given
+		if err := tx.Model(newRoom).Updates(map[string]interface{}{
+			"settings_allow_chat":  params.Settings.AllowChat,
+			"settings_allow_video": params.Settings.AllowVideo,
+			"settings_allow_audio": params.Settings.AllowAudio,
+			"joiner_can_chat":      params.Joiner.CanChat,
+		}).Error; err != nil {
+			return err
+		}
 
 		// Create room participant record for the creator
 		participant := &models.RoomParticipant{
 			ID:         uuid.New().String(),
 			RoomID:     newRoom.ID,
-			UserID:     createdBy,
+			UserID:     params.CreatedBy,
 			IsActive:   true,
 			IsApproved: true, // Creator is automatically approved
 		}
@@ -54,7 +108,7 @@ func (r *RoomRepository) CreateRoom(createdBy string, name string, settings mode
 		adminPermissions := &models.RoomPermissions{
 			ID:              uuid.New().String(),
 			RoomID:          newRoom.ID,
-			UserID:          createdBy,
+			UserID:          params.CreatedBy,
 			IsAdmin:         true,
 			CanKick:         true,
 			CanMuteAudio:    true,
@@ -66,12 +120,18 @@ func (r *RoomRepository) CreateRoom(createdBy string, name string, settings mode
 			return err
 		}
 
+		if provision != nil {
+			if err := provision(newRoom); err != nil {
+				return err
+			}
+		}
+
 		room = newRoom
 		return nil
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	return room, nil
@@ -90,6 +150,16 @@ func (r *RoomRepository) GetRoom(id string) (*models.Room, error) {
 	return &room, nil
 }
 
+// LockRoom takes a row lock on the room until the surrounding transaction ends,
+// serialising joins so capacity checks see each other's writes. It only has an
+// effect on a repository from WithTx.
+func (r *RoomRepository) LockRoom(roomID string) error {
+	var room models.Room
+	return wrapError(r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&room, "id = ?", roomID).Error)
+}
+
 // GetRoomByName retrieves a room by name
 func (r *RoomRepository) GetRoomByName(name string) (*models.Room, error) {
 	var room models.Room
@@ -103,47 +173,285 @@ func (r *RoomRepository) GetRoomByName(name string) (*models.Room, error) {
 	return &room, nil
 }
 
-// AddParticipant adds a participant to a room or reactivates them if they already exist
-func (r *RoomRepository) AddParticipant(roomID, userID string) error {
-	// Check if participant already exists
-	var existing models.RoomParticipant
-	err := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&existing).Error
-
-	if err == nil {
-		// Participant exists, update their status
-		return r.db.Model(&existing).Updates(map[string]interface{}{
-			"is_active": true,
-			"left_at":   nil,
-			"joined_at": time.Now(),
-		}).Error
-	}
-
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		// Unexpected error
-		return err
+// GetRoomByNameInsensitive retrieves a room whose name matches regardless of case
+func (r *RoomRepository) GetRoomByNameInsensitive(name string) (*models.Room, error) {
+	var room models.Room
+	result := r.db.First(&room, "LOWER(name) = LOWER(?)", name)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
 	}
+	return &room, nil
+}
 
-	// Create new participant
+// AddParticipant adds a participant to a room or reactivates them if they already exist.
+// It is a single upsert on (room_id, user_id), so concurrent joins can't race.
+// Every join also opens a new entry in the participant's session history, and a
+// participant without a permissions row gets one from joiner.
+func (r *RoomRepository) AddParticipant(roomID, userID, displayName string, joiner models.JoinerPermissions) error {
+	now := time.Now()
 	participant := &models.RoomParticipant{
-		ID:       uuid.New().String(),
-		RoomID:   roomID,
-		UserID:   userID,
-		IsActive: true,
-		JoinedAt: time.Now(),
+		ID:          uuid.New().String(),
+		RoomID:      roomID,
+		UserID:      userID,
+		IsActive:    true,
+		JoinedAt:    now,
+		DisplayName: displayName,
 	}
 
-	return r.db.Create(participant).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"is_active":      true,
+				"left_at":        nil,
+				"joined_at":      now,
+				"self_muted":     false,
+				"self_video_off": false,
+				"hand_raised":    false,
+				"display_name":   displayName,
+			}),
+		}).Create(participant).Error
+		if err != nil {
+			return err
+		}
+
+		if err := ensurePermissions(tx, roomID, userID, joiner); err != nil {
+			return err
+		}
+
+		// A rejoin without a recorded leave (e.g. a reconnect) ends the previous session
+		if err := closeSessions(tx, now, "room_id = ? AND user_id = ?", roomID, userID); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.ParticipantSession{
+			ID:       uuid.New().String(),
+			RoomID:   roomID,
+			UserID:   userID,
+			JoinedAt: now,
+		}).Error
+	})
+	// A room deleted meanwhile fails the foreign key
+	return wrapError(err)
+}
+
+// ensurePermissions creates the participant's permissions row from joiner unless one exists
+func ensurePermissions(tx *gorm.DB, roomID, userID string, joiner models.JoinerPermissions) error {
+	return tx.Model(&models.RoomPermissions{}).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+		DoNothing: true,
+	}).Create(permissionsRow(roomID, userID, models.RoomPermissions{
+		CanKick:         joiner.CanKick,
+		CanMuteAudio:    joiner.CanMuteAudio,
+		CanDisableVideo: joiner.CanDisableVideo,
+		CanChat:         joiner.CanChat,
+	})).Error
+}
+
+// permissionsRow returns a new permissions row as a column map. Creating from
+// the struct would write the column default in place of a false CanChat.
+func permissionsRow(roomID, userID string, permissions models.RoomPermissions) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"id":                uuid.New().String(),
+		"room_id":           roomID,
+		"user_id":           userID,
+		"is_admin":          permissions.IsAdmin,
+		"can_kick":          permissions.CanKick,
+		"can_mute_audio":    permissions.CanMuteAudio,
+		"can_disable_video": permissions.CanDisableVideo,
+		"can_chat":          permissions.CanChat,
+		"created_at":        now,
+		"updated_at":        now,
+	}
 }
 
 // RemoveParticipant marks a participant as inactive and sets their leave time
 func (r *RoomRepository) RemoveParticipant(roomID, userID string) error {
 	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RoomParticipant{}).
+			Where("room_id = ? AND user_id = ? AND is_active = ?", roomID, userID, true).
+			Updates(map[string]interface{}{
+				"is_active": false,
+				"left_at":   now,
+			}).Error; err != nil {
+			return err
+		}
+
+		return closeSessions(tx, now, "room_id = ? AND user_id = ?", roomID, userID)
+	})
+}
+
+// closeSessions sets the leave time on the open participant sessions matching the condition
+func closeSessions(tx *gorm.DB, leftAt time.Time, query string, args ...interface{}) error {
+	return tx.Model(&models.ParticipantSession{}).
+		Where(query, args...).
+		Where("left_at IS NULL").
+		Update("left_at", leftAt).Error
+}
+
+// GetParticipantSessions returns a room's join/leave history, oldest first
+func (r *RoomRepository) GetParticipantSessions(roomID string) ([]models.ParticipantSession, error) {
+	var sessions []models.ParticipantSession
+	err := r.db.Where("room_id = ?", roomID).
+		Order("joined_at ASC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// GetActiveParticipantsPage returns one page of a room's active participants,
+// with their users, and the total number of active participants
+func (r *RoomRepository) GetActiveParticipantsPage(roomID string, page, pageSize int) ([]models.RoomParticipant, int64, error) {
+	total, err := r.CountActiveParticipants(roomID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var participants []models.RoomParticipant
+	err = r.db.Preload("User").
+		Where("room_id = ? AND is_active = ?", roomID, true).
+		Order("joined_at ASC, id ASC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&participants).Error
+	return participants, total, err
+}
+
+// CountActiveParticipants returns the number of participants currently in a room
+func (r *RoomRepository) CountActiveParticipants(roomID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RoomParticipant{}).
+		Where("room_id = ? AND is_active = ?", roomID, true).
+		Count(&count).Error
+	return count, err
+}
+
+// GetParticipant returns a user's participant record in a room, or nil if they never joined
+func (r *RoomRepository) GetParticipant(roomID, userID string) (*models.RoomParticipant, error) {
+	var participant models.RoomParticipant
+	result := r.db.First(&participant, "room_id = ? AND user_id = ?", roomID, userID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &participant, nil
+}
+
+// GetMembership reports whether the user has ever joined the room and, if so,
+// whether they are in it now and approved. Only the two flags are read.
+func (r *RoomRepository) GetMembership(roomID, userID string) (joined, active, approved bool, err error) {
+	var row struct {
+		IsActive   bool
+		IsApproved bool
+	}
+	result := r.db.Model(&models.RoomParticipant{}).
+		Select("is_active", "is_approved").
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Limit(1).
+		Find(&row)
+	return result.RowsAffected > 0, row.IsActive, row.IsApproved, result.Error
+}
+
+// GetEnforcedMutes returns a room's active participants that a room admin has
+// muted or turned the video off for, with their users
+func (r *RoomRepository) GetEnforcedMutes(roomID string) ([]models.RoomParticipant, error) {
+	var participants []models.RoomParticipant
+	err := r.db.Preload("User").
+		Where("room_id = ? AND is_active = ?", roomID, true).
+		Where("is_muted = ? OR is_video_off = ?", true, true).
+		Find(&participants).Error
+	return participants, err
+}
+
+// GetRoomsWithEnforcedMutes returns the active rooms with at least one active
+// participant muted or with video turned off by a room admin
+func (r *RoomRepository) GetRoomsWithEnforcedMutes() ([]models.Room, error) {
+	var rooms []models.Room
+	enforced := r.db.Model(&models.RoomParticipant{}).
+		Select("room_id").
+		Where("is_active = ?", true).
+		Where("is_muted = ? OR is_video_off = ?", true, true)
+	err := r.db.Where("is_active = ? AND id IN (?)", true, enforced).Find(&rooms).Error
+	return rooms, err
+}
+
+// GetRoomsKickingIdle returns the active rooms that remove idle participants
+func (r *RoomRepository) GetRoomsKickingIdle() ([]models.Room, error) {
+	var rooms []models.Room
+	err := r.db.Where("is_active = ? AND settings_kick_idle = ?", true, true).Find(&rooms).Error
+	return rooms, err
+}
+
+// TouchParticipant records activity by a participant
+func (r *RoomRepository) TouchParticipant(roomID, userID string) error {
 	return r.db.Model(&models.RoomParticipant{}).
-		Where("room_id = ? AND user_id = ? AND is_active = ?", roomID, userID, true).
-		Updates(map[string]interface{}{
-			"is_active": false,
-			"left_at":   now,
-		}).Error
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("last_active_at", time.Now()).Error
+}
+
+// MuteChat stops a participant from chatting, until the given time or, with a
+// nil until, until cleared by a state reset. It reports false when the user
+// isn't a participant of the room.
+func (r *RoomRepository) MuteChat(roomID, userID string, until *time.Time) (bool, error) {
+	updates := map[string]interface{}{"is_chat_blocked": true}
+	if until != nil {
+		updates = map[string]interface{}{"chat_muted_until": *until}
+	}
+	result := r.db.Model(&models.RoomParticipant{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetChatMutes returns a room's active participants who may not chat right now, with their users
+func (r *RoomRepository) GetChatMutes(roomID string) ([]models.RoomParticipant, error) {
+	var participants []models.RoomParticipant
+	err := r.db.Preload("User").
+		Where("room_id = ? AND is_active = ?", roomID, true).
+		Where("is_chat_blocked = ? OR chat_muted_until > ?", true, time.Now()).
+		Find(&participants).Error
+	return participants, err
+}
+
+// ExpireChatMutes clears timed chat mutes that have run out and returns the
+// participants they were cleared for, with their users and rooms
+func (r *RoomRepository) ExpireChatMutes() ([]models.RoomParticipant, error) {
+	now := time.Now()
+	var participants []models.RoomParticipant
+	if err := r.db.Preload("User").Preload("Room").
+		Where("chat_muted_until <= ?", now).
+		Find(&participants).Error; err != nil {
+		return nil, err
+	}
+	if len(participants) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(participants))
+	for i, p := range participants {
+		ids[i] = p.ID
+	}
+	err := r.db.Model(&models.RoomParticipant{}).
+		Where("id IN ? AND chat_muted_until <= ?", ids, now).
+		Update("chat_muted_until", nil).Error
+	return participants, err
+}
+
+// GetActiveDisplayNames returns the in-room names of a room's active participants other than excludeUserID
+func (r *RoomRepository) GetActiveDisplayNames(roomID, excludeUserID string) ([]string, error) {
+	var names []string
+	// Participants who joined before display names were stored fall back to their user name
+	err := r.db.Model(&models.RoomParticipant{}).
+		Joins("JOIN users ON users.id = room_participants.user_id").
+		Where("room_participants.room_id = ? AND room_participants.is_active = ? AND room_participants.user_id <> ?", roomID, true, excludeUserID).
+		Pluck("COALESCE(NULLIF(room_participants.display_name, ''), users.name)", &names).Error
+	return names, err
 }
 
 // GetActiveParticipants gets all active participants in a room
@@ -154,6 +462,130 @@ func (r *RoomRepository) GetActiveParticipants(roomID string) ([]models.RoomPart
 	return participants, err
 }
 
+// GetActiveParticipantsWithUsers returns the room's active participants with their users
+func (r *RoomRepository) GetActiveParticipantsWithUsers(roomID string) ([]models.RoomParticipant, error) {
+	var participants []models.RoomParticipant
+	err := r.db.Preload("User").
+		Where("room_id = ? AND is_active = ?", roomID, true).
+		Find(&participants).Error
+	return participants, err
+}
+
+// EndRoom deactivates a room and marks every active participant as having left.
+// History is kept; nothing is deleted.
+func (r *RoomRepository) EndRoom(roomID string) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RoomParticipant{}).
+			Where("room_id = ? AND is_active = ?", roomID, true).
+			Updates(map[string]interface{}{
+				"is_active": false,
+				"left_at":   now,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := closeSessions(tx, now, "room_id = ?", roomID); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Room{}).
+			Where("id = ?", roomID).
+			Update("is_active", false).Error
+	})
+}
+
+// PurgeInactiveRooms hard-deletes rooms that have been inactive since before the
+// cutoff, along with their participants, permissions and session history. Rooms
+// are removed batchSize at a time so a large backlog doesn't hold one long
+// transaction. It returns how many rooms were deleted.
+func (r *RoomRepository) PurgeInactiveRooms(before time.Time, batchSize int) (int, error) {
+	purged := 0
+	for {
+		var ids []string
+		if err := r.db.Model(&models.Room{}).
+			Where("is_active = ? AND updated_at < ?", false, before).
+			Order("updated_at").
+			Limit(batchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return purged, err
+		}
+		if len(ids) == 0 {
+			return purged, nil
+		}
+
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("room_id IN ?", ids).Delete(&models.ParticipantSession{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("room_id IN ?", ids).Delete(&models.RoomPermissions{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("room_id IN ?", ids).Delete(&models.RoomParticipant{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("id IN ?", ids).Delete(&models.Room{}).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+
+		purged += len(ids)
+		if len(ids) < batchSize {
+			return purged, nil
+		}
+	}
+}
+
+// UpdateRoomMetadata replaces a room's metadata
+func (r *RoomRepository) UpdateRoomMetadata(roomID string, metadata models.StringMap) error {
+	return affected(r.db.Model(&models.Room{}).
+		Where("id = ?", roomID).
+		Update("metadata", metadata))
+}
+
+// DeactivateRoom closes a room to new joins without touching its participants or history
+func (r *RoomRepository) DeactivateRoom(roomID string) error {
+	return affected(r.db.Model(&models.Room{}).
+		Where("id = ?", roomID).
+		Updates(map[string]interface{}{
+			"is_active":      false,
+			"deactivated_at": time.Now(),
+		}))
+}
+
+// ReactivateRoom opens a room again, giving it a fresh lifetime if it already expired
+func (r *RoomRepository) ReactivateRoom(room *models.Room) error {
+	updates := map[string]interface{}{
+		"is_active":      true,
+		"deactivated_at": nil,
+	}
+	if room.IsExpired() {
+		updates["expires_at"] = time.Now().Add(RoomLifetime)
+	}
+
+	return r.db.Model(room).Updates(updates).Error
+}
+
+// ExtendRoomExpiry moves a room's expiry out to expiresAt; an expiry already later is kept
+func (r *RoomRepository) ExtendRoomExpiry(roomID string, expiresAt time.Time) error {
+	return r.db.Model(&models.Room{}).
+		Where("id = ? AND expires_at < ?", roomID, expiresAt).
+		Update("expires_at", expiresAt).Error
+}
+
+// GetExpiredRooms returns up to limit rooms that are still active past their
+// expiry, oldest first. Callers end each room before asking for the next batch,
+// so it reads the primary: a lagging replica would hand back rooms already ended.
+func (r *RoomRepository) GetExpiredRooms(limit int) ([]models.Room, error) {
+	var rooms []models.Room
+	err := database.Primary(r.db).Where("expires_at < ? AND is_active = ?", time.Now(), true).
+		Order("expires_at").
+		Limit(limit).
+		Find(&rooms).Error
+	return rooms, err
+}
+
 // CleanupExpiredRooms marks rooms as inactive if they've expired
 func (r *RoomRepository) CleanupExpiredRooms() error {
 	return r.db.Model(&models.Room{}).
@@ -161,10 +593,52 @@ func (r *RoomRepository) CleanupExpiredRooms() error {
 		Update("is_active", false).Error
 }
 
+// ResetParticipantState clears a participant's mute, video and chat-block flags
+// and any timed chat mute. It reports false when the user isn't a participant of the room.
+func (r *RoomRepository) ResetParticipantState(roomID, userID string) (bool, error) {
+	result := r.db.Model(&models.RoomParticipant{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Updates(map[string]interface{}{
+			"is_muted":         false,
+			"is_video_off":     false,
+			"is_chat_blocked":  false,
+			"chat_muted_until": nil,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
 // UpdateParticipantPermissions updates a participant's permissions
+// Demoting the room's only admin fails with ErrLastRoomAdmin.
 func (r *RoomRepository) UpdateParticipantPermissions(roomID, userID string, permissions models.RoomPermissions) error {
-	return r.db.Where("room_id = ? AND user_id = ?", roomID, userID).
-		Updates(&permissions).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if !permissions.IsAdmin {
+			// Lock the admin rows so two concurrent demotions can't both pass the check
+			var admins []models.RoomPermissions
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("room_id = ? AND is_admin = ?", roomID, true).
+				Find(&admins).Error; err != nil {
+				return err
+			}
+			if len(admins) == 1 && admins[0].UserID == userID {
+				return ErrLastRoomAdmin
+			}
+		}
+
+		// Upsert, as participants who joined before joiner permissions existed
+		// have no row yet. Maps rather than the struct, so revoking a
+		// permission (false) is written too.
+		return tx.Model(&models.RoomPermissions{}).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"is_admin":          permissions.IsAdmin,
+				"can_kick":          permissions.CanKick,
+				"can_mute_audio":    permissions.CanMuteAudio,
+				"can_disable_video": permissions.CanDisableVideo,
+				"can_chat":          permissions.CanChat,
+				"updated_at":        time.Now(),
+			}),
+		}).Create(permissionsRow(roomID, userID, permissions)).Error
+	})
 }
 
 // GetParticipantPermissions gets a participant's permissions
@@ -172,7 +646,7 @@ func (r *RoomRepository) GetParticipantPermissions(roomID, userID string) (*mode
 	var permissions models.RoomPermissions
 	err := r.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&permissions).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &permissions, nil
 }
@@ -187,24 +661,84 @@ func (r *RoomRepository) UpdateParticipantStatus(roomID, userID string, updates
 // KickParticipant removes a participant from the room
 func (r *RoomRepository) KickParticipant(roomID, userID string) error {
 	now := time.Now()
-	return r.db.Model(&models.RoomParticipant{}).
-		Where("room_id = ? AND user_id = ?", roomID, userID).
-		Updates(map[string]interface{}{
-			"is_active": false,
-			"left_at":   now,
-		}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RoomParticipant{}).
+			Where("room_id = ? AND user_id = ?", roomID, userID).
+			Updates(map[string]interface{}{
+				"is_active": false,
+				"left_at":   now,
+			}).Error; err != nil {
+			return err
+		}
+
+		return closeSessions(tx, now, "room_id = ? AND user_id = ?", roomID, userID)
+	})
 }
 
 // UpdateRoomSettings updates room global settings
 func (r *RoomRepository) UpdateRoomSettings(roomID string, settings models.RoomSettings) error {
-	return r.db.Model(&models.Room{}).
+	return affected(r.db.Model(&models.Room{}).
 		Where("id = ?", roomID).
 		Updates(map[string]interface{}{
 			"settings_allow_chat":       settings.AllowChat,
 			"settings_allow_video":      settings.AllowVideo,
 			"settings_allow_audio":      settings.AllowAudio,
 			"settings_require_approval": settings.RequireApproval,
-		}).Error
+			"settings_kick_idle":        settings.KickIdle,
+		}))
+}
+
+// CountRooms returns the number of rooms and how many of them are active
+func (r *RoomRepository) CountRooms() (total int64, active int64, err error) {
+	if err = r.db.Model(&models.Room{}).Count(&total).Error; err != nil {
+		return 0, 0, err
+	}
+	err = r.db.Model(&models.Room{}).Where("is_active = ?", true).Count(&active).Error
+	return total, active, err
+}
+
+// RoomCounts breaks the number of rooms down by status
+type RoomCounts struct {
+	Total       int64
+	Active      int64 // open and not yet expired
+	Expired     int64 // still open past their expiry, waiting for the cleanup sweep
+	Inactive    int64 // closed by expiry, ending or deactivation
+	Deactivated int64 // closed by an admin; also counted in Inactive
+}
+
+// CountRoomsByStatus counts rooms per status in a single aggregate query.
+// An empty tenantID counts every tenant.
+func (r *RoomRepository) CountRoomsByStatus(tenantID string) (RoomCounts, error) {
+	now := time.Now()
+	query := r.db.Model(&models.Room{}).Select(
+		"COUNT(*) AS total, "+
+			"COUNT(*) FILTER (WHERE is_active AND expires_at >= ?) AS active, "+
+			"COUNT(*) FILTER (WHERE is_active AND expires_at < ?) AS expired, "+
+			"COUNT(*) FILTER (WHERE NOT is_active) AS inactive, "+
+			"COUNT(*) FILTER (WHERE NOT is_active AND deactivated_at IS NOT NULL) AS deactivated",
+		now, now,
+	)
+	if tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+
+	var counts RoomCounts
+	err := query.Scan(&counts).Error
+	return counts, err
+}
+
+// CountAllActiveParticipants returns the number of participants currently in any room
+func (r *RoomRepository) CountAllActiveParticipants() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RoomParticipant{}).Where("is_active = ?", true).Count(&count).Error
+	return count, err
+}
+
+// GetRoomsByTenant returns every room of one tenant
+func (r *RoomRepository) GetRoomsByTenant(tenantID string) ([]models.Room, error) {
+	var rooms []models.Room
+	err := r.db.Where("tenant_id = ?", tenantID).Find(&rooms).Error
+	return rooms, err
 }
 
 func (r *RoomRepository) GetAllRooms() ([]models.Room, error) {
@@ -219,11 +753,138 @@ func (r *RoomRepository) GetRoomParticipantsWithUsers(roomID string) ([]models.R
 	return participants, err
 }
 
+// EachParticipantBatch calls fn with every participant a room has had, with
+// their users, batchSize at a time. An error from fn stops the iteration.
+func (r *RoomRepository) EachParticipantBatch(roomID string, batchSize int, fn func([]models.RoomParticipant) error) error {
+	var batch []models.RoomParticipant
+	return r.db.Preload("User").
+		Where("room_id = ?", roomID).
+		FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+			return fn(batch)
+		}).Error
+}
+
+// GetUserRoomsWithPermissions returns a page of the rooms a user participates in,
+// most recent join first, with the user's permissions in each room attached, and
+// the total number of such rooms
+func (r *RoomRepository) GetUserRoomsWithPermissions(userID string, limit, offset int) ([]models.RoomParticipant, int64, error) {
+	var total int64
+	if err := r.db.Model(&models.RoomParticipant{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var participants []models.RoomParticipant
+	err := r.db.Joins("Room").
+		Where("room_participants.user_id = ?", userID).
+		Order("room_participants.joined_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&participants).Error
+	if err != nil || len(participants) == 0 {
+		return participants, total, err
+	}
+
+	roomIDs := make([]string, 0, len(participants))
+	for _, p := range participants {
+		roomIDs = append(roomIDs, p.RoomID)
+	}
+
+	var permissions []models.RoomPermissions
+	if err := r.db.Where("user_id = ? AND room_id IN ?", userID, roomIDs).Find(&permissions).Error; err != nil {
+		return nil, 0, err
+	}
+
+	byRoom := make(map[string]*models.RoomPermissions, len(permissions))
+	for i := range permissions {
+		byRoom[permissions[i].RoomID] = &permissions[i]
+	}
+	for i := range participants {
+		participants[i].Permission = byRoom[participants[i].RoomID]
+	}
+
+	return participants, total, nil
+}
+
+// GetActiveRoomsForUser returns the active rooms the user has ever joined
+func (r *RoomRepository) GetActiveRoomsForUser(userID string) ([]models.Room, error) {
+	var rooms []models.Room
+	err := r.db.
+		Joins("JOIN room_participants ON room_participants.room_id = rooms.id").
+		Where("room_participants.user_id = ? AND rooms.is_active = ?", userID, true).
+		Find(&rooms).Error
+	return rooms, err
+}
+
 func (r *RoomRepository) GetUserByID(userID string) (*models.User, error) {
 	var user models.User
 	err := r.db.Where("id = ?", userID).First(&user).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &user, nil
 }
+
+// TimelineEntry is one event of a room's activity timeline: the room's
+// creation, a participant joining or leaving, or an audited action. Key orders
+// entries at the same instant, creation first and a join before its leave.
+type TimelineEntry struct {
+	Type    string
+	At      time.Time `gorm:"column:occurred_at"`
+	ActorID string
+	UserID  string
+	Details string
+	Key     string `gorm:"column:sort_key"`
+}
+
+// timelineQuery unions the sources of a room's timeline into one ordered set.
+// Each key starts with a rank that breaks ties between sources.
+const timelineQuery = `
+SELECT * FROM (
+	SELECT 'room.created' AS type, created_at AS occurred_at, created_by AS actor_id, '' AS user_id, '' AS details, '0:' || id AS sort_key
+		FROM rooms WHERE id = @room
+	UNION ALL
+	SELECT 'participant.joined', joined_at, '', user_id, '', '1:' || id
+		FROM participant_sessions WHERE room_id = @room
+	UNION ALL
+	SELECT 'participant.left', left_at, '', user_id, '', '2:' || id
+		FROM participant_sessions WHERE room_id = @room AND left_at IS NOT NULL
+	UNION ALL
+	SELECT action, created_at, actor_id, '', COALESCE(details, ''), '3:' || id
+		FROM audit_logs WHERE target_type = 'room' AND target_id = @room
+) timeline`
+
+// GetTimelinePage returns one page of a room's timeline, oldest first,
+// optionally limited to the [from, to] window. The page after cursor is found
+// by keyset over (occurred_at, sort_key), so the database only reads what the page needs.
+func (r *RoomRepository) GetTimelinePage(roomID string, from, to *time.Time, cursor *pagination.Cursor, limit int) ([]TimelineEntry, string, error) {
+	args := map[string]interface{}{"room": roomID, "limit": limit + 1}
+	var conditions []string
+	if from != nil {
+		conditions = append(conditions, "occurred_at >= @from")
+		args["from"] = *from
+	}
+	if to != nil {
+		conditions = append(conditions, "occurred_at <= @to")
+		args["to"] = *to
+	}
+	if cursor != nil {
+		conditions = append(conditions, "(occurred_at, sort_key) > (@cursorAt, @cursorKey)")
+		args["cursorAt"] = cursor.CreatedAt
+		args["cursorKey"] = cursor.ID
+	}
+
+	query := timelineQuery
+	if len(conditions) > 0 {
+		query += "\nWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\nORDER BY occurred_at, sort_key\nLIMIT @limit"
+
+	var entries []TimelineEntry
+	if err := r.db.Raw(query, args).Scan(&entries).Error; err != nil {
+		return nil, "", err
+	}
+	entries, next := pagination.Page(entries, limit, func(e TimelineEntry) (time.Time, string) {
+		return e.At, e.Key
+	})
+	return entries, next, nil
+}
@@ -0,0 +1,556 @@
+package repository
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestAddParticipantConcurrentJoins(t *testing.T) {
+	// room_participants with its unique (room_id, user_id) index
+	var mu sync.Mutex
+	rows := map[string]int{}
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if !stmt.Is("INSERT") || !stmt.Mentions(`"room_participants"`) {
+			return &dbtest.Result{Affected: 1}, nil
+		}
+		roomID, _ := stmt.Value("room_id")
+		userID, _ := stmt.Value("user_id")
+		key := roomID.(string) + "/" + userID.(string)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if rows[key] > 0 && !stmt.Mentions("ON CONFLICT") {
+			return nil, &pgconn.PgError{Code: "23505", ConstraintName: "idx_room_user"}
+		}
+		if rows[key] == 0 {
+			rows[key] = 1
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	repo := NewRoomRepository(db)
+
+	const joins = 8
+	errs := make(chan error, joins)
+	var wg sync.WaitGroup
+	for i := 0; i < joins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.AddParticipant("r1", "u1", "Ann", models.JoinerPermissions{CanChat: true})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("AddParticipant() = %v", err)
+		}
+	}
+	if len(rows) != 1 || rows["r1/u1"] != 1 {
+		t.Errorf("participant rows = %v, want one for r1/u1", rows)
+	}
+}
+
+// sessionLog plays participant_sessions
+type sessionLog struct {
+	mu   sync.Mutex
+	rows [][]interface{} // id, room_id, user_id, joined_at, left_at
+}
+
+func (l *sessionLog) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case stmt.Is("INSERT") && stmt.Mentions(`"participant_sessions"`):
+		id, _ := stmt.Value("id")
+		roomID, _ := stmt.Value("room_id")
+		userID, _ := stmt.Value("user_id")
+		joinedAt, _ := stmt.Value("joined_at")
+		l.rows = append(l.rows, []interface{}{id, roomID, userID, joinedAt, nil})
+	case stmt.Is("UPDATE") && stmt.Mentions(`"participant_sessions"`):
+		leftAt, _ := stmt.Value("left_at")
+		for _, row := range l.rows {
+			if row[4] == nil {
+				row[4] = leftAt
+			}
+		}
+	case stmt.Is("SELECT") && stmt.Mentions(`"participant_sessions"`):
+		return &dbtest.Result{Columns: []string{"id", "room_id", "user_id", "joined_at", "left_at"}, Rows: l.rows}, nil
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestJoinLeaveCyclesAppendSessions(t *testing.T) {
+	log := &sessionLog{}
+	db, _ := dbtest.Open(t, log.answer)
+	repo := NewRoomRepository(db)
+
+	for i := 0; i < 2; i++ {
+		if err := repo.AddParticipant("r1", "u1", "Ann", models.JoinerPermissions{}); err != nil {
+			t.Fatalf("AddParticipant() = %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if err := repo.RemoveParticipant("r1", "u1"); err != nil {
+			t.Fatalf("RemoveParticipant() = %v", err)
+		}
+	}
+
+	sessions, err := repo.GetParticipantSessions("r1")
+	if err != nil {
+		t.Fatalf("GetParticipantSessions() = %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want one per join", len(sessions))
+	}
+	for i, session := range sessions {
+		if session.LeftAt == nil {
+			t.Fatalf("session %d is still open", i)
+		}
+		if got, want := session.Duration(), session.LeftAt.Sub(session.JoinedAt); got != want || got < 5*time.Millisecond {
+			t.Errorf("session %d lasted %v, want %v of at least 5ms", i, got, want)
+		}
+	}
+	if sessions[0].ID == sessions[1].ID {
+		t.Error("the rejoin reused the first session")
+	}
+}
+
+// crowd plays room r1 with active participants p000 onwards, who joined in
+// that order
+type crowd struct {
+	active int
+}
+
+// clauseValue returns the number after keyword in a query, whether inlined or
+// bound as a parameter
+func clauseValue(stmt dbtest.Statement, keyword string) (int, bool) {
+	match := regexp.MustCompile(keyword + ` (\$?\d+)`).FindStringSubmatch(stmt.Query)
+	if match == nil {
+		return 0, false
+	}
+	if match[1][0] == '$' {
+		n, _ := strconv.Atoi(match[1][1:])
+		return stmt.Args[n-1].(int), true
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n, true
+}
+
+func (c *crowd) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions("count(") && stmt.Mentions(`"room_participants"`):
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(c.active)}}}, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "room_participants"`):
+		limit, ok := clauseValue(stmt, "LIMIT")
+		if !ok {
+			limit = c.active
+		}
+		offset, _ := clauseValue(stmt, "OFFSET")
+		result := &dbtest.Result{Columns: []string{"id", "room_id", "user_id", "is_active", "joined_at"}}
+		start := time.Now().Add(-time.Hour)
+		for i := offset; i < c.active && i < offset+limit; i++ {
+			id := fmt.Sprintf("p%03d", i)
+			result.Rows = append(result.Rows, []interface{}{id, "r1", "u" + id, true, start.Add(time.Duration(i) * time.Second)})
+		}
+		return result, nil
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "users"`):
+		result := &dbtest.Result{Columns: []string{"id", "name"}}
+		for _, arg := range stmt.Args {
+			if id, ok := arg.(string); ok {
+				result.Rows = append(result.Rows, []interface{}{id, "User " + id})
+			}
+		}
+		return result, nil
+	}
+	return &dbtest.Result{}, nil
+}
+
+func TestCountActiveParticipants(t *testing.T) {
+	db, fake := dbtest.Open(t, (&crowd{active: 1234}).answer)
+	repo := NewRoomRepository(db)
+
+	count, err := repo.CountActiveParticipants("r1")
+	if err != nil {
+		t.Fatalf("CountActiveParticipants() = %v", err)
+	}
+	if count != 1234 {
+		t.Errorf("count = %d, want 1234", count)
+	}
+	counts := fake.Find("SELECT", "count(")
+	if len(counts) != 1 || !counts[0].Mentions("is_active") {
+		t.Errorf("count queries = %v, want one counting only active participants", counts)
+	}
+	if rows := fake.Find("SELECT", "SELECT *"); len(rows) != 0 {
+		t.Errorf("loaded participants to count them: %v", rows)
+	}
+}
+
+func TestGetActiveParticipantsPage(t *testing.T) {
+	db, _ := dbtest.Open(t, (&crowd{active: 250}).answer)
+	repo := NewRoomRepository(db)
+
+	tests := []struct {
+		page, pageSize int
+		wantFirst      string
+		wantLen        int
+	}{
+		{1, 100, "p000", 100},
+		{2, 100, "p100", 100},
+		{3, 100, "p200", 50},
+		{4, 100, "", 0},
+		{7, 40, "p240", 10},
+	}
+
+	for _, tt := range tests {
+		participants, total, err := repo.GetActiveParticipantsPage("r1", tt.page, tt.pageSize)
+		if err != nil {
+			t.Fatalf("GetActiveParticipantsPage(%d, %d) = %v", tt.page, tt.pageSize, err)
+		}
+		if total != 250 {
+			t.Errorf("page %d of %d: total = %d, want 250", tt.page, tt.pageSize, total)
+		}
+		if len(participants) != tt.wantLen {
+			t.Errorf("page %d of %d: got %d participants, want %d", tt.page, tt.pageSize, len(participants), tt.wantLen)
+			continue
+		}
+		if tt.wantLen > 0 {
+			if participants[0].ID != tt.wantFirst {
+				t.Errorf("page %d of %d starts at %s, want %s", tt.page, tt.pageSize, participants[0].ID, tt.wantFirst)
+			}
+			if participants[0].User.Name == "" {
+				t.Errorf("page %d of %d: the user wasn't loaded", tt.page, tt.pageSize)
+			}
+		}
+	}
+}
+
+// roomArchive plays the rooms table and the rows hanging off each room
+type roomArchive struct {
+	rooms        map[string]archivedRoom
+	participants map[string]string // participant ID -> room ID
+}
+
+type archivedRoom struct {
+	active    bool
+	updatedAt time.Time
+}
+
+func (a *roomArchive) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	switch {
+	case stmt.Is("SELECT") && stmt.Mentions(`FROM "rooms"`):
+		before := stmt.Args[1].(time.Time)
+		limit, _ := clauseValue(stmt, "LIMIT")
+		result := &dbtest.Result{Columns: []string{"id"}}
+		for id, room := range a.rooms {
+			if !room.active && room.updatedAt.Before(before) && len(result.Rows) < limit {
+				result.Rows = append(result.Rows, []interface{}{id})
+			}
+		}
+		return result, nil
+	case stmt.Is("DELETE") && stmt.Mentions(`"rooms"`):
+		for _, arg := range stmt.Args {
+			delete(a.rooms, arg.(string))
+		}
+	case stmt.Is("DELETE") && stmt.Mentions(`"room_participants"`):
+		for _, arg := range stmt.Args {
+			for id, roomID := range a.participants {
+				if roomID == arg {
+					delete(a.participants, id)
+				}
+			}
+		}
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestPurgeInactiveRooms(t *testing.T) {
+	now := time.Now()
+	days := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+	archive := &roomArchive{
+		rooms: map[string]archivedRoom{
+			"old":        {active: false, updatedAt: days(40)},
+			"recent":     {active: false, updatedAt: days(5)},
+			"active-old": {active: true, updatedAt: days(60)},
+		},
+		participants: map[string]string{"p1": "old", "p2": "recent", "p3": "active-old"},
+	}
+	db, fake := dbtest.Open(t, archive.answer)
+
+	purged, err := NewRoomRepository(db).PurgeInactiveRooms(days(30), 100)
+	if err != nil {
+		t.Fatalf("PurgeInactiveRooms() = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d rooms, want 1", purged)
+	}
+	if _, ok := archive.rooms["old"]; ok {
+		t.Error("the room inactive beyond the retention window was kept")
+	}
+	if _, ok := archive.rooms["recent"]; !ok {
+		t.Error("the room inactive within the retention window was purged")
+	}
+	if _, ok := archive.rooms["active-old"]; !ok {
+		t.Error("an active room was purged")
+	}
+	if _, ok := archive.participants["p1"]; ok {
+		t.Error("the purged room's participants were kept")
+	}
+	if len(archive.participants) != 2 {
+		t.Errorf("participants left = %v, want those of the kept rooms", archive.participants)
+	}
+	for _, table := range []string{`"participant_sessions"`, `"room_permissions"`} {
+		if deletes := fake.Find("DELETE", table); len(deletes) != 1 || !hasArg(deletes[0].Args, "old") {
+			t.Errorf("deletes from %s = %v, want the purged room's rows", table, deletes)
+		}
+	}
+}
+
+func TestPurgeInactiveRoomsInBatches(t *testing.T) {
+	archive := &roomArchive{rooms: map[string]archivedRoom{}, participants: map[string]string{}}
+	for i := 0; i < 5; i++ {
+		archive.rooms[fmt.Sprintf("r%d", i)] = archivedRoom{updatedAt: time.Now().AddDate(0, 0, -40)}
+	}
+	db, fake := dbtest.Open(t, archive.answer)
+
+	purged, err := NewRoomRepository(db).PurgeInactiveRooms(time.Now().AddDate(0, 0, -30), 2)
+	if err != nil {
+		t.Fatalf("PurgeInactiveRooms() = %v", err)
+	}
+	if purged != 5 || len(archive.rooms) != 0 {
+		t.Errorf("purged %d rooms leaving %d, want 5 leaving none", purged, len(archive.rooms))
+	}
+	if batches := len(fake.Find("DELETE", `"rooms"`)); batches != 3 {
+		t.Errorf("purged in %d batches, want 3", batches)
+	}
+}
+
+func TestAddParticipantGivesJoinerPermissions(t *testing.T) {
+	db, fake := dbtest.Open(t, nil)
+
+	joiner := models.JoinerPermissions{CanMuteAudio: true, CanChat: false}
+	if err := NewRoomRepository(db).AddParticipant("r1", "u2", "Bob", joiner); err != nil {
+		t.Fatalf("AddParticipant() = %v", err)
+	}
+
+	inserts := fake.Find("INSERT", `"room_permissions"`)
+	if len(inserts) != 1 {
+		t.Fatalf("%d permission rows created, want 1", len(inserts))
+	}
+	// A rejoin keeps the row it already has
+	if !inserts[0].Mentions("DO NOTHING") {
+		t.Errorf("permissions insert %q overwrites an existing row", inserts[0].Query)
+	}
+	want := map[string]interface{}{
+		"room_id": "r1", "user_id": "u2", "is_admin": false,
+		"can_kick": false, "can_mute_audio": true, "can_disable_video": false, "can_chat": false,
+	}
+	for column, value := range want {
+		if got, ok := inserts[0].Value(column); !ok || got != value {
+			t.Errorf("%s = %v, want %v", column, got, value)
+		}
+	}
+}
+
+func TestUpdateParticipantPermissionsCreatesAMissingRow(t *testing.T) {
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	permissions := models.RoomPermissions{IsAdmin: true, CanChat: false}
+	if err := NewRoomRepository(db).UpdateParticipantPermissions("r1", "u2", permissions); err != nil {
+		t.Fatalf("UpdateParticipantPermissions() = %v", err)
+	}
+
+	upserts := fake.Find("INSERT", `"room_permissions"`)
+	if len(upserts) != 1 || !upserts[0].Mentions("ON CONFLICT") {
+		t.Fatalf("permission writes = %v, want one upsert", upserts)
+	}
+	if got, _ := upserts[0].Value("can_chat"); got != false {
+		t.Errorf("can_chat = %v, want false", got)
+	}
+}
+
+// permissionTable plays room_permissions with its unique index on
+// (room_id, user_id): a plain insert of an existing pair fails, an upsert
+// updates the row or, with DO NOTHING, leaves it alone
+type permissionTable struct {
+	mu   sync.Mutex
+	rows map[[2]string]map[string]interface{}
+}
+
+func (p *permissionTable) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !stmt.Is("INSERT") || !stmt.Mentions(`"room_permissions"`) {
+		return &dbtest.Result{Affected: 1}, nil
+	}
+	roomID, _ := stmt.Value("room_id")
+	userID, _ := stmt.Value("user_id")
+	key := [2]string{roomID.(string), userID.(string)}
+
+	row := map[string]interface{}{}
+	for _, column := range []string{"id", "is_admin", "can_kick", "can_mute_audio", "can_disable_video", "can_chat"} {
+		row[column], _ = stmt.Value(column)
+	}
+
+	existing, exists := p.rows[key]
+	switch {
+	case !exists:
+		p.rows[key] = row
+	case stmt.Mentions("DO NOTHING"):
+		return &dbtest.Result{}, nil
+	case stmt.Mentions("DO UPDATE"):
+		row["id"] = existing["id"]
+		p.rows[key] = row
+	default:
+		return nil, &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint \"idx_room_permissions_room_user\""}
+	}
+	return &dbtest.Result{Affected: 1}, nil
+}
+
+func TestRepeatedPermissionWritesKeepOneRow(t *testing.T) {
+	table := &permissionTable{rows: map[[2]string]map[string]interface{}{}}
+	db, _ := dbtest.Open(t, table.answer)
+	repo := NewRoomRepository(db)
+
+	if err := repo.AddParticipant("r1", "u2", "Bob", models.JoinerPermissions{CanChat: true}); err != nil {
+		t.Fatalf("AddParticipant() = %v", err)
+	}
+	first := table.rows[[2]string{"r1", "u2"}]["id"]
+
+	for _, permissions := range []models.RoomPermissions{
+		{IsAdmin: true, CanKick: true, CanChat: true},
+		{IsAdmin: true, CanKick: true, CanMuteAudio: true, CanChat: true},
+		{CanChat: false},
+	} {
+		if err := repo.UpdateParticipantPermissions("r1", "u2", permissions); err != nil {
+			t.Fatalf("UpdateParticipantPermissions(%+v) = %v", permissions, err)
+		}
+	}
+	// Rejoining keeps the permissions the room gave them
+	if err := repo.AddParticipant("r1", "u2", "Bob", models.JoinerPermissions{CanChat: true}); err != nil {
+		t.Fatalf("AddParticipant() again = %v", err)
+	}
+
+	if len(table.rows) != 1 {
+		t.Fatalf("%d permission rows, want 1", len(table.rows))
+	}
+	row := table.rows[[2]string{"r1", "u2"}]
+	if row["id"] != first {
+		t.Errorf("row id = %v, want the original %v kept", row["id"], first)
+	}
+	want := map[string]interface{}{"is_admin": false, "can_kick": false, "can_mute_audio": false, "can_chat": false}
+	for column, value := range want {
+		if row[column] != value {
+			t.Errorf("%s = %v, want %v from the last update", column, row[column], value)
+		}
+	}
+}
+
+// hasArg reports whether args contains value
+func hasArg(args []interface{}, value interface{}) bool {
+	for _, arg := range args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+// roomCensus plays the rooms table for the aggregate status counts
+type roomCensus struct {
+	rooms []censusRoom
+}
+
+type censusRoom struct {
+	tenant      string
+	active      bool
+	expiresAt   time.Time
+	deactivated bool
+}
+
+func (c *roomCensus) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	if !stmt.Is("SELECT") || !stmt.Mentions("FILTER") {
+		return &dbtest.Result{}, nil
+	}
+	now := stmt.Args[0].(time.Time)
+	var tenant string
+	if len(stmt.Args) > 2 {
+		tenant = stmt.Args[2].(string)
+	}
+
+	var total, active, expired, inactive, deactivated int64
+	for _, room := range c.rooms {
+		if tenant != "" && room.tenant != tenant {
+			continue
+		}
+		total++
+		switch {
+		case room.active && !room.expiresAt.Before(now):
+			active++
+		case room.active:
+			expired++
+		default:
+			inactive++
+			if room.deactivated {
+				deactivated++
+			}
+		}
+	}
+	return &dbtest.Result{
+		Columns: []string{"total", "active", "expired", "inactive", "deactivated"},
+		Rows:    [][]interface{}{{total, active, expired, inactive, deactivated}},
+	}, nil
+}
+
+func TestCountRoomsByStatus(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Hour)
+	census := &roomCensus{rooms: []censusRoom{
+		{tenant: "t1", active: true, expiresAt: later},
+		{tenant: "t1", active: true, expiresAt: later},
+		{tenant: "t1", active: true, expiresAt: earlier},
+		{tenant: "t1", active: false, expiresAt: earlier},
+		{tenant: "t1", active: false, expiresAt: later, deactivated: true},
+		{tenant: "t2", active: true, expiresAt: later},
+		{tenant: "t2", active: false, expiresAt: later, deactivated: true},
+	}}
+
+	tests := []struct {
+		tenant string
+		want   RoomCounts
+	}{
+		{"", RoomCounts{Total: 7, Active: 3, Expired: 1, Inactive: 3, Deactivated: 2}},
+		{"t1", RoomCounts{Total: 5, Active: 2, Expired: 1, Inactive: 2, Deactivated: 1}},
+		{"t3", RoomCounts{}},
+	}
+
+	for _, tt := range tests {
+		db, fake := dbtest.Open(t, census.answer)
+
+		counts, err := NewRoomRepository(db).CountRoomsByStatus(tt.tenant)
+		if err != nil {
+			t.Fatalf("tenant %q: CountRoomsByStatus() = %v", tt.tenant, err)
+		}
+		if counts != tt.want {
+			t.Errorf("tenant %q: CountRoomsByStatus() = %+v, want %+v", tt.tenant, counts, tt.want)
+		}
+		if statements := fake.Statements(); len(statements) != 1 {
+			t.Errorf("tenant %q: ran %d statements, want a single aggregate query", tt.tenant, len(statements))
+		}
+		if rows := fake.Find("SELECT", "SELECT *"); len(rows) != 0 {
+			t.Errorf("tenant %q: loaded rooms to count them: %v", tt.tenant, rows)
+		}
+	}
+}
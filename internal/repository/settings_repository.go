@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"bedrud-backend/internal/database"
+	"bedrud-backend/internal/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SettingsRepository stores runtime settings shared between server instances
+type SettingsRepository struct {
+	db *gorm.DB
+}
+
+func NewSettingsRepository(db *gorm.DB) *SettingsRepository {
+	return &SettingsRepository{db: db}
+}
+
+// Get returns a setting's value and whether it has been set
+func (r *SettingsRepository) Get(key string) (string, bool, error) {
+	var setting models.SystemSetting
+	// Read the primary so a change made moments ago on another instance is seen
+	err := database.Primary(r.db).Where("key = ?", key).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return setting.Value, true, nil
+}
+
+// Set stores a setting, replacing any previous value
+func (r *SettingsRepository) Set(key, value string) error {
+	setting := &models.SystemSetting{
+		Key:       key,
+		Value:     value,
+		UpdatedAt: time.Now(),
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(setting).Error
+}
@@ -0,0 +1,33 @@
+package repository
+
+import "gorm.io/gorm"
+
+// TxRepos holds repositories bound to one database transaction. Everything done
+// through them is committed together or not at all.
+type TxRepos struct {
+	Users *UserRepository
+	Rooms *RoomRepository
+	Audit *AuditRepository
+}
+
+// withTx runs fn inside a transaction on db. The transaction is rolled back if
+// fn returns an error or panics, and committed otherwise.
+func withTx(db *gorm.DB, fn func(TxRepos) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return fn(TxRepos{
+			Users: NewUserRepository(tx),
+			Rooms: NewRoomRepository(tx),
+			Audit: NewAuditRepository(tx),
+		})
+	})
+}
+
+// WithTx runs fn with transaction-scoped repositories; see TxRepos
+func (r *RoomRepository) WithTx(fn func(TxRepos) error) error {
+	return withTx(r.db, fn)
+}
+
+// WithTx runs fn with transaction-scoped repositories; see TxRepos
+func (r *UserRepository) WithTx(fn func(TxRepos) error) error {
+	return withTx(r.db, fn)
+}
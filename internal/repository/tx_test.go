@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWithTxCommits(t *testing.T) {
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	err := NewUserRepository(db).WithTx(func(tx TxRepos) error {
+		return tx.Users.UpdatePassword("u1", "hash")
+	})
+	if err != nil {
+		t.Fatalf("WithTx() = %v, want nil", err)
+	}
+
+	if got, want := fake.Transactions(), []string{dbtest.Begin, dbtest.Commit}; !reflect.DeepEqual(got, want) {
+		t.Errorf("transaction events = %v, want %v", got, want)
+	}
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	boom := errors.New("boom")
+	err := NewUserRepository(db).WithTx(func(tx TxRepos) error {
+		if err := tx.Users.UpdatePassword("u1", "hash"); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("WithTx() = %v, want %v", err, boom)
+	}
+
+	if got, want := fake.Transactions(), []string{dbtest.Begin, dbtest.Rollback}; !reflect.DeepEqual(got, want) {
+		t.Errorf("transaction events = %v, want %v", got, want)
+	}
+	if got := len(fake.Statements()); got != 1 {
+		t.Errorf("ran %d statements, want the update only", got)
+	}
+}
+
+func TestWithTxRollsBackWhenAStepFails(t *testing.T) {
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		// The user to update doesn't exist
+		return &dbtest.Result{Affected: 0}, nil
+	})
+
+	laterStepRan := false
+	err := NewUserRepository(db).WithTx(func(tx TxRepos) error {
+		if err := tx.Users.UpdatePassword("missing", "hash"); err != nil {
+			return err
+		}
+		laterStepRan = true
+		return nil
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("WithTx() = %v, want ErrNotFound", err)
+	}
+	if laterStepRan {
+		t.Error("steps after the failed one ran")
+	}
+
+	if got, want := fake.Transactions(), []string{dbtest.Begin, dbtest.Rollback}; !reflect.DeepEqual(got, want) {
+		t.Errorf("transaction events = %v, want %v", got, want)
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	db, fake := dbtest.Open(t, nil)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithTx swallowed the panic")
+			}
+		}()
+		_ = NewRoomRepository(db).WithTx(func(tx TxRepos) error {
+			panic("boom")
+		})
+	}()
+
+	if got, want := fake.Transactions(), []string{dbtest.Begin, dbtest.Rollback}; !reflect.DeepEqual(got, want) {
+		t.Errorf("transaction events = %v, want %v", got, want)
+	}
+}
@@ -1,14 +1,21 @@
 package repository
 
 import (
+	"bedrud-backend/internal/database"
 	"bedrud-backend/internal/models"
+	"bedrud-backend/internal/pagination"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrEmailInUse is returned when an OAuth login's email already belongs to another account
+var ErrEmailInUse = errors.New("email is already used by another account")
+
 type UserRepository struct {
 	db *gorm.DB
 }
@@ -17,19 +24,54 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) CreateOrUpdateUser(user *models.User) error {
-	now := time.Now()
-	user.UpdatedAt = now
+// FindOrCreateByProvider looks up an OAuth user by provider identity, creating
+// the account with a fresh UUID if it doesn't exist yet. Existing users only
+// have their name, avatar and email verification refreshed. On return user
+// holds the stored record.
+func (r *UserRepository) FindOrCreateByProvider(user *models.User) error {
+	var existing models.User
+	// Read from the primary so a concurrent login can't miss a just-created row
+	result := database.Primary(r.db).
+		Where("provider = ? AND provider_user_id = ?", user.Provider, user.ProviderUserID).
+		First(&existing)
 
-	result := r.db.Where("email = ? AND provider = ?", user.Email, user.Provider).
-		Assign(user).
-		FirstOrCreate(user)
+	if result.Error == gorm.ErrRecordNotFound {
+		user.ID = uuid.New().String()
+		err := r.CreateUser(user)
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+
+		// Either a concurrent first login created the same account, or the email
+		// belongs to an account from another provider
+		result = database.Primary(r.db).
+			Where("provider = ? AND provider_user_id = ?", user.Provider, user.ProviderUserID).
+			First(&existing)
+		if result.Error == gorm.ErrRecordNotFound {
+			return ErrEmailInUse
+		}
+	}
+
+	if result.Error != nil {
+		log.Error().Err(result.Error).Msg("Failed to find user by provider")
+		return result.Error
+	}
 
+	// Only refresh profile fields; accesses, status and password belong to us, not the provider
+	existing.Name = user.Name
+	existing.AvatarURL = user.AvatarURL
+	existing.EmailVerified = user.EmailVerified
+	result = r.db.Model(&existing).Updates(map[string]interface{}{
+		"name":           existing.Name,
+		"avatar_url":     existing.AvatarURL,
+		"email_verified": existing.EmailVerified,
+	})
 	if result.Error != nil {
-		log.Error().Err(result.Error).Msg("Failed to create or update user")
+		log.Error().Err(result.Error).Msg("Failed to refresh user profile")
 		return result.Error
 	}
 
+	*user = existing
 	return nil
 }
 
@@ -69,7 +111,7 @@ func (r *UserRepository) CreateUser(user *models.User) error {
 	result := r.db.Create(user)
 	if result.Error != nil {
 		log.Error().Err(result.Error).Msg("Failed to create user")
-		return result.Error
+		return wrapError(result.Error)
 	}
 	return nil
 }
@@ -81,7 +123,7 @@ func (r *UserRepository) UpdateRefreshToken(userID, refreshToken string) error {
 
 	if result.Error != nil {
 		log.Error().Err(result.Error).Msg("Failed to update refresh token")
-		return result.Error
+		return wrapError(result.Error)
 	}
 	return nil
 }
@@ -111,63 +153,494 @@ func (r *UserRepository) BlockRefreshToken(userID, token string, expiresAt time.
 	}
 
 	result := r.db.Create(blocked)
-	return result.Error
+	return wrapError(result.Error)
+}
+
+// GetBlockedTokensPage returns one page of a user's blocked refresh tokens, newest first
+func (r *UserRepository) GetBlockedTokensPage(userID string, cursor *pagination.Cursor, limit int) ([]models.BlockedRefreshToken, string, error) {
+	var tokens []models.BlockedRefreshToken
+	err := r.db.Where("user_id = ?", userID).
+		Scopes(pagination.Keyset(cursor, limit)).
+		Find(&tokens).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	tokens, next := pagination.Page(tokens, limit, func(t models.BlockedRefreshToken) (time.Time, string) {
+		return t.CreatedAt, t.ID
+	})
+	return tokens, next, nil
 }
 
 func (r *UserRepository) IsRefreshTokenBlocked(token string) bool {
 	var count int64
-	r.db.Model(&models.BlockedRefreshToken{}).
+	// Always check the primary so a token revoked moments ago is rejected
+	database.Primary(r.db).Model(&models.BlockedRefreshToken{}).
 		Where("token = ? AND expires_at > ?", token, time.Now()).
 		Count(&count)
 	return count > 0
 }
 
+// CreateSession stores a new refresh session
+func (r *UserRepository) CreateSession(session *models.RefreshSession) error {
+	result := r.db.Create(session)
+	if result.Error != nil {
+		log.Error().Err(result.Error).Msg("Failed to create session")
+		return wrapError(result.Error)
+	}
+	return nil
+}
+
+// GetSession returns a session by ID, or nil if it doesn't exist
+func (r *UserRepository) GetSession(id string) (*models.RefreshSession, error) {
+	var session models.RefreshSession
+	result := database.Primary(r.db).Where("id = ?", id).First(&session)
+
+	if result.Error == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		log.Error().Err(result.Error).Msg("Failed to get session")
+		return nil, result.Error
+	}
+
+	return &session, nil
+}
+
+// GetSessionByTokenHash returns the session holding an opaque refresh token, or nil if none does
+func (r *UserRepository) GetSessionByTokenHash(tokenHash string) (*models.RefreshSession, error) {
+	var session models.RefreshSession
+	result := database.Primary(r.db).Where("token_hash = ?", tokenHash).First(&session)
+
+	if result.Error == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		log.Error().Err(result.Error).Msg("Failed to get session by token")
+		return nil, result.Error
+	}
+
+	return &session, nil
+}
+
+// GetRetiredRefreshToken returns the lineage entry of an opaque refresh token
+// a session rotated away from, or nil if it never was
+func (r *UserRepository) GetRetiredRefreshToken(tokenHash string) (*models.RetiredRefreshToken, error) {
+	var retired models.RetiredRefreshToken
+	result := database.Primary(r.db).Where("token_hash = ?", tokenHash).First(&retired)
+
+	if result.Error == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		log.Error().Err(result.Error).Msg("Failed to get retired refresh token")
+		return nil, result.Error
+	}
+
+	return &retired, nil
+}
+
+// RotateSessionToken replaces a session's opaque refresh token and extends it,
+// adding the old token, valid until oldExpiresAt, to the session's lineage along
+// with the salt its replacement was derived with.
+// It returns false if the old token was already rotated away.
+func (r *UserRepository) RotateSessionToken(id, oldHash, newHash, salt string, oldExpiresAt, expiresAt time.Time) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshSession{}).
+			Where("id = ? AND token_hash = ?", id, oldHash).
+			Updates(map[string]interface{}{
+				"token_hash":   newHash,
+				"last_used_at": time.Now(),
+				"expires_at":   expiresAt,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		rotated = true
+		return tx.Create(&models.RetiredRefreshToken{
+			TokenHash:     oldHash,
+			SessionID:     id,
+			ExpiresAt:     oldExpiresAt,
+			NextTokenSalt: salt,
+		}).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return rotated, nil
+}
+
+// DeleteSessionByTokenHash removes the user's session holding an opaque refresh token.
+// It returns false if no such session exists.
+func (r *UserRepository) DeleteSessionByTokenHash(userID, tokenHash string) (bool, error) {
+	result := r.db.Where("user_id = ? AND token_hash = ?", userID, tokenHash).Delete(&models.RefreshSession{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetUserSessions returns a user's unexpired sessions, most recently used first
+func (r *UserRepository) GetUserSessions(userID string) ([]models.RefreshSession, error) {
+	var sessions []models.RefreshSession
+	err := r.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// CountActiveSessions returns how many unexpired sessions the user has
+func (r *UserRepository) CountActiveSessions(userID string) (int64, error) {
+	var count int64
+	err := database.Primary(r.db).Model(&models.RefreshSession{}).
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// LockUser takes a row lock on the user until the surrounding transaction
+// ends, serialising logins so session limit checks see each other's writes.
+// It only has an effect on a repository from WithTx.
+func (r *UserRepository) LockUser(userID string) error {
+	var user models.User
+	return wrapError(r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&user, "id = ?", userID).Error)
+}
+
+// CreateSessionLimited stores a session under the user's session limit. In one
+// transaction holding the user's row lock it counts their unexpired sessions
+// and asks keep how many of them may stay: the least recently used of the rest
+// are deleted, along with expired ones, before the insert. A negative keep
+// leaves them all, and an error from keep aborts the insert. It returns how
+// many sessions were deleted.
+func (r *UserRepository) CreateSessionLimited(session *models.RefreshSession, keep func(active int64) (int, error)) (int64, error) {
+	var pruned int64
+	err := r.WithTx(func(tx TxRepos) error {
+		if err := tx.Users.LockUser(session.UserID); err != nil {
+			return err
+		}
+		active, err := tx.Users.CountActiveSessions(session.UserID)
+		if err != nil {
+			return err
+		}
+		n, err := keep(active)
+		if err != nil {
+			return err
+		}
+		if n >= 0 && active > int64(n) {
+			if pruned, err = tx.Users.PruneSessions(session.UserID, n); err != nil {
+				return err
+			}
+		}
+		return tx.Users.CreateSession(session)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+// PruneSessions deletes all but the keep most recently used of the user's
+// unexpired sessions, along with any expired ones, and returns how many rows
+// were removed
+func (r *UserRepository) PruneSessions(userID string, keep int) (int64, error) {
+	query := r.db.Where("user_id = ?", userID)
+	if keep > 0 {
+		kept := r.db.Model(&models.RefreshSession{}).
+			Select("id").
+			Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+			Order("last_used_at DESC").
+			Limit(keep)
+		query = query.Where("id NOT IN (?)", kept)
+	}
+
+	result := query.Delete(&models.RefreshSession{})
+	return result.RowsAffected, result.Error
+}
+
+// UpdateSessionLabel sets the device label of one of the user's sessions.
+// It returns false if the session doesn't belong to the user.
+func (r *UserRepository) UpdateSessionLabel(id, userID, label string) (bool, error) {
+	result := r.db.Model(&models.RefreshSession{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("label", label)
+	return result.RowsAffected > 0, result.Error
+}
+
+// TouchSession records that a session was just used to refresh tokens
+func (r *UserRepository) TouchSession(id string, expiresAt time.Time) error {
+	return r.db.Model(&models.RefreshSession{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_used_at": time.Now(),
+			"expires_at":   expiresAt,
+		}).Error
+}
+
+// DeleteSession removes a session, revoking any refresh token bound to it
+func (r *UserRepository) DeleteSession(id string) error {
+	return r.db.Delete(&models.RefreshSession{}, "id = ?", id).Error
+}
+
+// CreateExchangeCode stores a one-time OAuth exchange code
+func (r *UserRepository) CreateExchangeCode(code *models.AuthExchangeCode) error {
+	return wrapError(r.db.Create(code).Error)
+}
+
+// ConsumeExchangeCode deletes an unexpired exchange code and returns the user it
+// was issued for. Deleting and reading in one statement makes the code single-use
+// even under concurrent requests. Returns an empty string if the code is unknown.
+func (r *UserRepository) ConsumeExchangeCode(codeHash string) (string, error) {
+	var codes []models.AuthExchangeCode
+	result := r.db.Clauses(clause.Returning{}).
+		Where("code_hash = ? AND expires_at > ?", codeHash, time.Now()).
+		Delete(&codes)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if len(codes) == 0 {
+		return "", nil
+	}
+	return codes[0].UserID, nil
+}
+
+// CreateAPIKey stores a new API key
+func (r *UserRepository) CreateAPIKey(key *models.APIKey) error {
+	return wrapError(r.db.Create(key).Error)
+}
+
+// GetAPIKeys returns the user's API keys, newest first
+func (r *UserRepository) GetAPIKeys(userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// CountAPIKeys returns how many API keys the user has
+func (r *UserRepository) CountAPIKeys(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.APIKey{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// GetAPIKeyByHash returns the API key with the given hash, or nil if none exists
+func (r *UserRepository) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	result := database.Primary(r.db).Where("key_hash = ?", keyHash).First(&key)
+
+	if result.Error == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &key, nil
+}
+
+// DeleteAPIKey deletes one of the user's API keys. It reports false when the
+// user has no key with that ID.
+func (r *UserRepository) DeleteAPIKey(id, userID string) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIKey{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// TouchAPIKey records that an API key was just used
+func (r *UserRepository) TouchAPIKey(id string) error {
+	return r.db.Model(&models.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", time.Now()).Error
+}
+
 func (r *UserRepository) CleanupBlockedTokens() error {
 	result := r.db.Where("expires_at < ?", time.Now()).
 		Delete(&models.BlockedRefreshToken{})
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	// Retired tokens past their expiry are refused without needing the lineage
+	return r.db.Where("expires_at < ?", time.Now()).
+		Delete(&models.RetiredRefreshToken{}).Error
+}
+
+// RecordLoginAttempt stores one sign-in attempt
+func (r *UserRepository) RecordLoginAttempt(attempt *models.LoginAttempt) error {
+	return wrapError(r.db.Create(attempt).Error)
+}
+
+// GetLoginAttemptsPage returns one page of a user's login attempts, newest
+// first. A non-nil success keeps only the successful or the failed ones.
+func (r *UserRepository) GetLoginAttemptsPage(userID string, success *bool, cursor *pagination.Cursor, limit int) ([]models.LoginAttempt, string, error) {
+	query := r.db.Where("user_id = ?", userID)
+	if success != nil {
+		query = query.Where("success = ?", *success)
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Scopes(pagination.Keyset(cursor, limit)).Find(&attempts).Error; err != nil {
+		return nil, "", err
+	}
+
+	attempts, next := pagination.Page(attempts, limit, func(a models.LoginAttempt) (time.Time, string) {
+		return a.CreatedAt, a.ID
+	})
+	return attempts, next, nil
+}
+
+// CleanupLoginAttempts removes login attempts recorded before the cutoff
+func (r *UserRepository) CleanupLoginAttempts(before time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", before).Delete(&models.LoginAttempt{})
+	return result.RowsAffected, result.Error
 }
 
 func (r *UserRepository) UpdateUserAccesses(userID string, accesses []string) error {
 	result := r.db.Model(&models.User{}).
 		Where("id = ?", userID).
-		Update("accesses", accesses)
+		Update("accesses", models.StringArray(accesses))
 
-	return result.Error
+	return affected(result)
 }
 
 func (r *UserRepository) GetUsersByAccess(access models.AccessLevel) ([]models.User, error) {
 	var users []models.User
-	err := r.db.Where("? = ANY(accesses)", string(access)).Find(&users).Error
+	err := r.db.Scopes(withAccess(access)).Find(&users).Error
 	return users, err
 }
 
+// GetUsersByAccessPage returns one page of the users holding an access level,
+// oldest first, and how many there are in total. An empty tenantID covers every tenant.
+func (r *UserRepository) GetUsersByAccessPage(access models.AccessLevel, tenantID string, page, pageSize int) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{}).Scopes(withAccess(access))
+	if tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	err := query.
+		Order("created_at ASC, id ASC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&users).Error
+	return users, total, err
+}
+
+// withAccess selects users whose accesses include the given level. On Postgres
+// it uses array containment, which the GIN index on accesses serves; other
+// databases hold the array as its "{a,b}" text form and match an element of it.
+func withAccess(access models.AccessLevel) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if db.Dialector.Name() == "postgres" {
+			return db.Where("accesses @> ARRAY[?]::text[]", string(access))
+		}
+		level := string(access)
+		return db.Where("accesses = ? OR accesses LIKE ? OR accesses LIKE ? OR accesses LIKE ?",
+			"{"+level+"}", "{"+level+",%", "%,"+level+"}", "%,"+level+",%")
+	}
+}
+
+// UpdatePassword replaces a user's stored password hash
+func (r *UserRepository) UpdatePassword(userID, hash string) error {
+	return affected(r.db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"password":   hash,
+			"updated_at": time.Now(),
+		}))
+}
+
 // UpdateUser updates an existing user
 func (r *UserRepository) UpdateUser(user *models.User) error {
 	user.UpdatedAt = time.Now()
 	result := r.db.Save(user)
 	if result.Error != nil {
 		log.Error().Err(result.Error).Msg("Failed to update user")
-		return result.Error
+		return wrapError(result.Error)
 	}
 	return nil
 }
 
-// DeleteUser deletes a user by ID
-func (r *UserRepository) DeleteUser(userID string) error {
-	// First delete associated room participants and permissions
-	if err := r.db.Delete(&models.RoomParticipant{}, "user_id = ?", userID).Error; err != nil {
-		return err
-	}
-	if err := r.db.Delete(&models.RoomPermissions{}, "user_id = ?", userID).Error; err != nil {
-		return err
-	}
-	// Then delete blocked refresh tokens
-	if err := r.db.Delete(&models.BlockedRefreshToken{}, "user_id = ?", userID).Error; err != nil {
-		return err
+// RevokeUserSessions deletes every refresh session of the user and clears the
+// legacy refresh token, so none of their refresh tokens can be used again
+func (r *UserRepository) RevokeUserSessions(userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.RefreshSession{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("refresh_token", "").Error
+	})
+}
+
+// SetUserActive enables or disables a user's account
+func (r *UserRepository) SetUserActive(userID string, active bool) error {
+	return affected(r.db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"is_active":  active,
+			"updated_at": time.Now(),
+		}))
+}
+
+// UpdateUserFields applies a partial update given as column -> value. A map is
+// used so zero values such as is_active = false are written too.
+func (r *UserRepository) UpdateUserFields(userID string, fields map[string]interface{}) error {
+	updates := make(map[string]interface{}, len(fields)+1)
+	for column, value := range fields {
+		updates[column] = value
 	}
-	// Finally delete the user
-	return r.db.Delete(&models.User{}, "id = ?", userID).Error
+	updates["updated_at"] = time.Now()
+
+	return affected(r.db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(updates))
+}
+
+// DeleteUser deletes a user by ID along with their participation, permissions,
+// sessions, blocked tokens, API keys and login attempts. Either everything is deleted or nothing is.
+func (r *UserRepository) DeleteUser(userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// First delete associated room participants and permissions
+		if err := tx.Delete(&models.RoomParticipant{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.RoomPermissions{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.ParticipantSession{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		// Then delete blocked refresh tokens and sessions
+		if err := tx.Delete(&models.BlockedRefreshToken{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.RefreshSession{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.APIKey{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.LoginAttempt{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		// Finally delete the user
+		return affected(tx.Delete(&models.User{}, "id = ?", userID))
+	})
+}
+
+// GetUsersByTenant returns every user of one tenant
+func (r *UserRepository) GetUsersByTenant(tenantID string) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("tenant_id = ?", tenantID).Find(&users).Error
+	return users, err
 }
 
 // GetAllUsers returns all users in the system
@@ -176,3 +649,12 @@ func (r *UserRepository) GetAllUsers() ([]models.User, error) {
 	err := r.db.Find(&users).Error
 	return users, err
 }
+
+// CountUsers returns the number of users and how many of them are active
+func (r *UserRepository) CountUsers() (total int64, active int64, err error) {
+	if err = r.db.Model(&models.User{}).Count(&total).Error; err != nil {
+		return 0, 0, err
+	}
+	err = r.db.Model(&models.User{}).Where("is_active = ?", true).Count(&active).Error
+	return total, active, err
+}
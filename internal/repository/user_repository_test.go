@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"bedrud-backend/internal/dbtest"
+	"bedrud-backend/internal/models"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// providerLookups returns the provider each provider identity lookup was scoped to
+func providerLookups(fake *dbtest.DB) []interface{} {
+	var providers []interface{}
+	for _, stmt := range fake.Find("SELECT", "provider_user_id") {
+		providers = append(providers, stmt.Args[0])
+	}
+	return providers
+}
+
+func TestFindOrCreateByProviderKeepsProvidersApart(t *testing.T) {
+	// Neither provider has an account for the external ID yet
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") {
+			return &dbtest.Result{Columns: []string{"id"}}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+	repo := NewUserRepository(db)
+
+	google := &models.User{Email: "ann@gmail.example", Provider: "google", ProviderUserID: "12345"}
+	github := &models.User{Email: "ann@github.example", Provider: "github", ProviderUserID: "12345"}
+	for _, user := range []*models.User{google, github} {
+		if err := repo.FindOrCreateByProvider(user); err != nil {
+			t.Fatalf("FindOrCreateByProvider(%s) = %v", user.Provider, err)
+		}
+	}
+
+	if google.ID == "" || github.ID == "" || google.ID == github.ID {
+		t.Errorf("account IDs %q and %q, want two distinct accounts", google.ID, github.ID)
+	}
+	if inserts := fake.Find("INSERT", "users"); len(inserts) != 2 {
+		t.Errorf("created %d accounts, want 2", len(inserts))
+	}
+	if got := providerLookups(fake); len(got) != 2 || got[0] != "google" || got[1] != "github" {
+		t.Errorf("lookups scoped to providers %v, want google then github", got)
+	}
+}
+
+func TestFindOrCreateByProviderEmailTakenByAnotherProvider(t *testing.T) {
+	db, _ := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("INSERT") {
+			return nil, &pgconn.PgError{Code: "23505", ConstraintName: "idx_users_email"}
+		}
+		return &dbtest.Result{Columns: []string{"id"}}, nil
+	})
+
+	user := &models.User{Email: "ann@example.com", Provider: "github", ProviderUserID: "12345"}
+	if err := NewUserRepository(db).FindOrCreateByProvider(user); !errors.Is(err, ErrEmailInUse) {
+		t.Fatalf("FindOrCreateByProvider() = %v, want ErrEmailInUse", err)
+	}
+}
+
+func TestFindOrCreateByProviderKeepsAccessesOfExistingUsers(t *testing.T) {
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		if stmt.Is("SELECT") {
+			return &dbtest.Result{
+				Columns: []string{"id", "email", "name", "provider", "provider_user_id", "avatar_url", "password", "accesses", "is_active"},
+				Rows:    [][]interface{}{{"u1", "ann@example.com", "Ann", "google", "12345", "", "stored-hash", "{admin}", false}},
+			}, nil
+		}
+		return &dbtest.Result{Affected: 1}, nil
+	})
+
+	// What the OAuth callback passes in for every login
+	user := &models.User{
+		Email:          "ann@example.com",
+		Name:           "Ann Example",
+		AvatarURL:      "https://example.com/ann.png",
+		Provider:       "google",
+		ProviderUserID: "12345",
+		Accesses:       models.StringArray{string(models.AccessUser)},
+		IsActive:       true,
+	}
+	if err := NewUserRepository(db).FindOrCreateByProvider(user); err != nil {
+		t.Fatalf("FindOrCreateByProvider() = %v", err)
+	}
+
+	if user.ID != "u1" || !user.HasAccess(models.AccessAdmin) || user.HasAccess(models.AccessUser) {
+		t.Errorf("user %s has accesses %v, want u1 to keep [admin]", user.ID, user.Accesses)
+	}
+	if user.IsActive || user.Password != "stored-hash" {
+		t.Errorf("active = %v, password = %q, want the stored status and password", user.IsActive, user.Password)
+	}
+	if user.Name != "Ann Example" || user.AvatarURL != "https://example.com/ann.png" {
+		t.Errorf("profile = %q %q, want the provider's name and avatar", user.Name, user.AvatarURL)
+	}
+
+	updates := fake.Find("UPDATE", "users")
+	if len(updates) != 1 {
+		t.Fatalf("ran %d updates, want 1", len(updates))
+	}
+	for _, column := range []string{"accesses", "is_active", "password"} {
+		if updates[0].Mentions(`"` + column + `"`) {
+			t.Errorf("the update %q overwrote %s", updates[0].Query, column)
+		}
+	}
+}
+
+func TestFindOrCreateByProviderRefreshesEmailVerification(t *testing.T) {
+	for _, verified := range []bool{true, false} {
+		db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+			if stmt.Is("SELECT") {
+				return &dbtest.Result{
+					Columns: []string{"id", "email", "provider", "provider_user_id", "accesses", "is_active", "email_verified"},
+					Rows:    [][]interface{}{{"u1", "ann@example.com", "google", "12345", "{user}", true, !verified}},
+				}, nil
+			}
+			return &dbtest.Result{Affected: 1}, nil
+		})
+
+		user := &models.User{Email: "ann@example.com", Provider: "google", ProviderUserID: "12345", EmailVerified: verified}
+		if err := NewUserRepository(db).FindOrCreateByProvider(user); err != nil {
+			t.Fatalf("FindOrCreateByProvider() = %v", err)
+		}
+
+		if user.EmailVerified != verified {
+			t.Errorf("verified %v: user.EmailVerified = %v", verified, user.EmailVerified)
+		}
+		updates := fake.Find("UPDATE", "users")
+		if len(updates) != 1 {
+			t.Fatalf("verified %v: ran %d updates, want 1", verified, len(updates))
+		}
+		if got, ok := updates[0].Value("email_verified"); !ok || got != verified {
+			t.Errorf("verified %v: stored email_verified = %v", verified, got)
+		}
+	}
+}
+
+// accessHolders plays a users table, evaluating the access filter the way
+// Postgres does, or SQLite for the text fallback
+type accessHolders struct {
+	users [][]interface{} // id, accesses
+}
+
+func (a *accessHolders) answer(stmt dbtest.Statement) (*dbtest.Result, error) {
+	if !stmt.Is("SELECT") || !stmt.Mentions(`"users"`) {
+		return &dbtest.Result{Affected: 1}, nil
+	}
+
+	var matched [][]interface{}
+	for _, user := range a.users {
+		if a.holds(stmt, user[1].(string)) {
+			matched = append(matched, user)
+		}
+	}
+	if stmt.Mentions("count(") {
+		return &dbtest.Result{Columns: []string{"count"}, Rows: [][]interface{}{{int64(len(matched))}}}, nil
+	}
+	return &dbtest.Result{Columns: []string{"id", "accesses"}, Rows: matched}, nil
+}
+
+func (a *accessHolders) holds(stmt dbtest.Statement, accesses string) bool {
+	if stmt.Mentions("@>") {
+		level := stmt.Args[0].(string)
+		for _, access := range strings.Split(strings.Trim(accesses, "{}"), ",") {
+			if access == level {
+				return true
+			}
+		}
+		return false
+	}
+
+	if accesses == stmt.Args[0].(string) {
+		return true
+	}
+	for _, arg := range stmt.Args[1:4] {
+		pattern := strings.ReplaceAll(regexp.QuoteMeta(arg.(string)), "%", ".*")
+		if regexp.MustCompile("^" + pattern + "$").MatchString(accesses) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliteNamed reports itself as SQLite so the text fallback is used
+type sqliteNamed struct {
+	gorm.Dialector
+}
+
+func (sqliteNamed) Name() string { return "sqlite" }
+
+func TestGetUsersByAccessPage(t *testing.T) {
+	holders := &accessHolders{users: [][]interface{}{
+		{"u1", "{admin}"},
+		{"u2", "{user}"},
+		{"u3", "{user,admin}"},
+		{"u4", "{superadmin}"},
+		{"u5", "{admin,moderator}"},
+		{"u6", "{user,admin,guest}"},
+		{"u7", "{user,superadmin}"},
+	}}
+
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		db, fake := dbtest.Open(t, holders.answer)
+		filter := "@>"
+		if dialect == "sqlite" {
+			db.Dialector = sqliteNamed{db.Dialector}
+			filter = "LIKE"
+		}
+
+		users, total, err := NewUserRepository(db).GetUsersByAccessPage(models.AccessAdmin, "", 1, 50)
+		if err != nil {
+			t.Fatalf("%s: GetUsersByAccessPage() = %v", dialect, err)
+		}
+
+		var ids []string
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+		if want := []string{"u1", "u3", "u5", "u6"}; !reflect.DeepEqual(ids, want) || total != int64(len(want)) {
+			t.Errorf("%s: admins = %v (total %d), want %v", dialect, ids, total, want)
+		}
+		for _, query := range fake.Find("SELECT", `"users"`) {
+			if !query.Mentions(filter) {
+				t.Errorf("%s: query %q doesn't filter with %s", dialect, query.Query, filter)
+			}
+		}
+	}
+}
+
+func TestCleanupLoginAttempts(t *testing.T) {
+	db, fake := dbtest.Open(t, func(stmt dbtest.Statement) (*dbtest.Result, error) {
+		return &dbtest.Result{Affected: 4}, nil
+	})
+	cutoff := time.Now().AddDate(0, 0, -90)
+
+	removed, err := NewUserRepository(db).CleanupLoginAttempts(cutoff)
+	if err != nil {
+		t.Fatalf("CleanupLoginAttempts() = %v", err)
+	}
+	if removed != 4 {
+		t.Errorf("CleanupLoginAttempts() = %d, want 4", removed)
+	}
+	deletes := fake.Find("DELETE", `"login_attempts"`)
+	if len(deletes) != 1 || !deletes[0].Mentions("created_at <") || !hasArg(deletes[0].Args, cutoff) {
+		t.Errorf("deletes = %v, want one of the attempts before %v", deletes, cutoff)
+	}
+}
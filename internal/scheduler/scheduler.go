@@ -25,6 +25,12 @@ func Initialize() {
 	scheduler.StartAsync()
 }
 
+// Every runs task at a fixed interval until the scheduler stops
+func Every(interval time.Duration, task func()) error {
+	_, err := scheduler.Every(interval).Do(task)
+	return err
+}
+
 // Stop gracefully shuts down the scheduler
 func Stop() {
 	if scheduler != nil {
@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"bedrud-backend/config"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	lkauth "github.com/livekit/protocol/auth"
+)
+
+// sign returns the Authorization header LiveKit sends with body, signed with key and secret
+func sign(t *testing.T, key, secret string, body []byte) string {
+	t.Helper()
+
+	sum := sha256.Sum256(body)
+	token, err := lkauth.NewAccessToken(key, secret).
+		SetSha256(base64.StdEncoding.EncodeToString(sum[:])).
+		ToJWT()
+	if err != nil {
+		t.Fatalf("ToJWT() = %v", err)
+	}
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	const (
+		mainSecret     = "main-secret-that-is-long-enough-to-sign"
+		webhookSecret  = "webhook-secret-that-is-long-enough-to-sign"
+		rotationSecret = "rotation-secret-that-is-long-enough-to-sign"
+	)
+	body := []byte(`{"event":"room_finished","room":{"name":"standup"}}`)
+
+	rotating := &config.LiveKitConfig{
+		APIKey:              "main",
+		APISecret:           mainSecret,
+		WebhookAPIKey:       "webhook",
+		WebhookAPISecret:    webhookSecret,
+		WebhookRotationKeys: map[string]string{"previous": rotationSecret},
+	}
+	fallback := &config.LiveKitConfig{APIKey: "main", APISecret: mainSecret}
+
+	tests := []struct {
+		name    string
+		cfg     *config.LiveKitConfig
+		header  string
+		body    []byte
+		wantErr error
+	}{
+		{"webhook key", rotating, sign(t, "webhook", webhookSecret, body), body, nil},
+		{"rotation key", rotating, sign(t, "previous", rotationSecret, body), body, nil},
+		{"main key once a webhook key is set", rotating, sign(t, "main", mainSecret, body), body, ErrUnknownKey},
+		{"main key as the fallback", fallback, sign(t, "main", mainSecret, body), body, nil},
+		{"unknown key", fallback, sign(t, "stranger", mainSecret, body), body, ErrUnknownKey},
+		{"tampered body", rotating, sign(t, "webhook", webhookSecret, body), []byte(`{"event":"room_started"}`), ErrInvalidChecksum},
+		{"missing signature", rotating, "", body, ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewVerifier(tt.cfg).Verify(tt.header, tt.body); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("wrong secret", func(t *testing.T) {
+		if err := NewVerifier(rotating).Verify(sign(t, "previous", "not-the-rotation-secret-at-all-really", body), body); err == nil {
+			t.Error("Verify() accepted a signature made with the wrong secret")
+		}
+	})
+}
@@ -70,6 +70,9 @@ func Clean() {
 
 func Swagger() error {
 	fmt.Println("Generating Swagger docs...")
-	cmd := exec.Command("swag", "init", "-g", "cmd/server/main.go")
+	// --strict turns warnings such as a route declared twice into errors
+	cmd := exec.Command("swag", "init", "-g", "cmd/server/main.go", "--strict")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }